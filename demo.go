@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"geecache/geecache"
+	"geecache/geecache/server"
+	"log"
+)
+
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+	"Sam":  "567",
+}
+
+// demoConfig 返回示例集群的配置：3个本地节点共享scores group，api为true时同时在9999端口启动API服务
+func demoConfig(port int, api bool) server.Config {
+	cfg := server.Config{
+		Self:  fmt.Sprintf("http://localhost:%d", port),
+		Peers: []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"},
+		Groups: []server.GroupConfig{{Name: "scores", CacheBytes: 2 << 10, Getter: geecache.GetterFunc(
+			func(key string) ([]byte, error) {
+				log.Println("[SlowDB] search key", key)
+				if v, ok := db[key]; ok {
+					return []byte(v), nil
+				}
+				// 包装ErrNotFound，远程节点和API据此返回404，而不是把它当作数据源故障
+				return nil, fmt.Errorf("%w: %s", geecache.ErrNotFound, key)
+			})}},
+	}
+	if api {
+		cfg.APIAddr = "http://localhost:9999"
+	}
+	return cfg
+}
@@ -0,0 +1,80 @@
+package geecache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// HTTPPool的管理接口
+//   GET  <basepath>flags 返回HTTPPool和已注册group的所有开关
+//   POST <basepath>flags 修改一个开关，请求体为 {"group": "scores", "name": "early_refresh", "enabled": false}，group为空表示HTTPPool的开关
+// 请求需要携带WithAdminToken配置的令牌，修改操作会连同X-Geecache-Actor头中的操作人一起记录到日志
+
+// FlagsReport 是GET管理接口返回的开关状态
+type FlagsReport struct {
+	Pool   map[string]bool            `json:"pool"`
+	Groups map[string]map[string]bool `json:"groups"`
+}
+
+// FlagUpdate 是POST管理接口的请求体
+type FlagUpdate struct {
+	Group   string `json:"group"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+func (p *HTTPPool) serveFlags(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		report := FlagsReport{Pool: p.flags.Snapshot(), Groups: make(map[string]map[string]bool)}
+		p.mu.Lock()
+		for name, g := range p.groups {
+			report.Groups[name] = g.flags.Snapshot()
+		}
+		p.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	case http.MethodPost:
+		var u FlagUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		flags := &p.flags
+		if u.Group != "" {
+			g := p.getGroup(u.Group)
+			if g == nil {
+				http.Error(w, "no such group: "+u.Group, http.StatusNotFound)
+				return
+			}
+			flags = &g.flags
+		}
+		if err := flags.Set(u.Name, u.Enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		actor := r.Header.Get("X-Geecache-Actor")
+		if actor == "" {
+			actor = "unknown (" + r.RemoteAddr + ")"
+		}
+		p.Log("flag %q of group %q set to %v by %s", u.Name, u.Group, u.Enabled, actor)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorized 检查请求是否携带了正确的管理令牌，未配置令牌时拒绝所有请求
+func (p *HTTPPool) authorized(r *http.Request) bool {
+	if p.adminToken == "" {
+		return false
+	}
+	got := r.Header.Get("Authorization")
+	return subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+p.adminToken)) == 1
+}
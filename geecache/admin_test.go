@@ -0,0 +1,70 @@
+package geecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminFlags(t *testing.T) {
+	silenceLog(t)
+	pool := NewHTTPPool("self", WithAdminToken("secret"))
+	g := NewGroup("admin-flags", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithEarlyRefresh(1))
+	g.RegisterPeers(pool)
+
+	do := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/_geecache/flags", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("X-Geecache-Actor", "alice")
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("missing token: status %d", w.Code)
+	}
+	if w := do(http.MethodGet, "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "secret", "")
+	var report FlagsReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Pool[FlagPeerFairQueue] || !report.Groups["admin-flags"][FlagEarlyRefresh] {
+		t.Fatalf("unexpected default flags: %+v", report)
+	}
+
+	w = do(http.MethodPost, "secret", `{"group":"admin-flags","name":"early_refresh","enabled":false}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("set group flag: status %d %s", w.Code, w.Body)
+	}
+	if g.Flags().Enabled(FlagEarlyRefresh) {
+		t.Fatal("group flag not disabled")
+	}
+	w = do(http.MethodPost, "secret", `{"name":"peer_fair_queue","enabled":false}`)
+	if w.Code != http.StatusNoContent || pool.Flags().Enabled(FlagPeerFairQueue) {
+		t.Fatalf("set pool flag: status %d", w.Code)
+	}
+	if w := do(http.MethodPost, "secret", `{"name":"no_such_flag","enabled":true}`); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown flag: status %d", w.Code)
+	}
+
+	// 没有配置令牌时管理接口关闭
+	closed := NewHTTPPool("other")
+	req := httptest.NewRequest(http.MethodGet, "/_geecache/flags", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	closed.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("admin endpoint open without token: status %d", rec.Code)
+	}
+}
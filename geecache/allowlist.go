@@ -0,0 +1,75 @@
+package geecache
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPPool只为白名单中的group提供服务，URL中的group名来自请求方，不能让它决定节点上创建或者查找什么。
+// 默认的白名单就是已经注册的group（NewGroup注册的全局group以及RegisterPeers注册到本HTTPPool的group），
+// 每次查找时读取注册表，所以注册和删除group后立即生效；WithAllowedGroups可以进一步限定为固定的名单。
+// 查找永远不会创建group。对未知group的请求会被计数，日志按来源限速，避免扫描器刷屏。
+
+// unknownGroupLogInterval 是同一来源两次记录未知group日志的最小间隔
+const unknownGroupLogInterval = time.Minute
+
+// maxLoggedSources 是记录日志限速状态的来源数上限，超过时清空重新开始
+const maxLoggedSources = 1024
+
+// groupGuard 记录对未知group的请求
+type groupGuard struct {
+	rejected atomic.Int64
+
+	mu     sync.Mutex
+	logged map[string]time.Time // 来源 -> 上次记录日志的时间
+}
+
+// WithAllowedGroups 限定HTTPPool只为这些group提供服务，即使其他group已经注册
+func WithAllowedGroups(names ...string) PoolOption {
+	return func(p *HTTPPool) {
+		p.allowed = make(map[string]bool, len(names))
+		for _, name := range names {
+			p.allowed[name] = true
+		}
+	}
+}
+
+// UnknownGroupRequests 返回请求了未知（或不在白名单中）group的次数
+func (p *HTTPPool) UnknownGroupRequests() int64 {
+	return p.guard.rejected.Load()
+}
+
+// rejectUnknownGroup 拒绝对未知group的请求
+func (p *HTTPPool) rejectUnknownGroup(w http.ResponseWriter, r *http.Request, name string) {
+	p.guard.rejected.Add(1)
+	if p.guard.shouldLog(requestSource(r), time.Now()) {
+		p.Log("request for unknown group %q from %s", name, requestSource(r))
+	}
+	http.Error(w, "no such group", http.StatusNotFound)
+}
+
+// shouldLog 判断是否应当为来源source记录日志，同一来源在unknownGroupLogInterval内只记录一次
+func (g *groupGuard) shouldLog(source string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if last, ok := g.logged[source]; ok && now.Sub(last) < unknownGroupLogInterval {
+		return false
+	}
+	if g.logged == nil || len(g.logged) >= maxLoggedSources {
+		g.logged = make(map[string]time.Time)
+	}
+	g.logged[source] = now
+	return true
+}
+
+// requestSource 返回请求来源的IP，不包括端口
+func requestSource(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,86 @@
+package geecache
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func serve(p *HTTPPool, path, remote string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remote
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestUnknownGroupRejected(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	pool := NewHTTPPool("self")
+	for i := 0; i < 10; i++ {
+		if code := serve(pool, fmt.Sprintf("/_geecache/scan-%d/k", i), "10.0.0.1:1234"); code != http.StatusNotFound {
+			t.Fatalf("unknown group: status %d", code)
+		}
+	}
+	serve(pool, "/_geecache/scan/k", "10.0.0.2:1234")
+	if n := pool.UnknownGroupRequests(); n != 11 {
+		t.Fatalf("UnknownGroupRequests = %d, want 11", n)
+	}
+	// 每个来源只记录一次
+	if n := strings.Count(buf.String(), "unknown group"); n != 2 {
+		t.Fatalf("logged %d unknown group lines, want 2:\n%s", n, buf.String())
+	}
+}
+
+func TestAllowedGroups(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	NewGroup("allowed", 2<<10, getter)
+	NewGroup("not-allowed", 2<<10, getter)
+
+	pool := NewHTTPPool("self", WithAllowedGroups("allowed"))
+	if code := serve(pool, "/_geecache/allowed/k", "10.0.0.1:1"); code != http.StatusOK {
+		t.Fatalf("allowed group: status %d", code)
+	}
+	if code := serve(pool, "/_geecache/not-allowed/k", "10.0.0.1:1"); code != http.StatusNotFound {
+		t.Fatalf("registered group outside the allowlist: status %d", code)
+	}
+}
+
+func TestAllowlistFollowsRegistration(t *testing.T) {
+	silenceLog(t)
+	pool := NewHTTPPool("self")
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("late-%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			NewGroup(name, 2<<10, getter)
+		}()
+		go func() {
+			defer wg.Done()
+			// 注册之前是404，之后是200，不会出现其他结果
+			if code := serve(pool, "/_geecache/"+name+"/k", "10.0.0.1:1"); code != http.StatusOK && code != http.StatusNotFound {
+				t.Errorf("%s: status %d", name, code)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 20; i++ {
+		if code := serve(pool, fmt.Sprintf("/_geecache/late-%d/k", i), "10.0.0.1:1"); code != http.StatusOK {
+			t.Fatalf("late-%d not served after registration: status %d", i, code)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package geecache
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 不存在key的布隆过滤器：负缓存只能挡住同一个key的重复读取，请求大量不同的、不存在的key时每个key仍然要调用一次回调函数。
+// 开启WithNotFoundFilter后，回调函数返回ErrNotFound的key被加入过滤器，之后本地加载这些key时直接返回ErrNotFound，不再调用回调函数。
+// 过滤器只占用固定的内存（每个计数器1字节），有一定的误判率：不在过滤器中的key也可能被判定为不存在。
+// 为此WithNotFoundFilterRecheck可以每n次命中放行一次，重新调用回调函数确认，加载成功的key从过滤器中移除。
+// 过滤器分为新旧两代，每过rotate丢弃旧的一代，后来才出现在数据源中的key最多被挡住两个周期。
+// Set、GetOrSet写入和Delete使key从过滤器中移除（计数器减一），RemovePrefix无法按前缀移除，清空整个过滤器。
+// 过滤器只在负责key的节点上使用，其他节点照常向它请求
+
+// WithNotFoundFilter 开启不存在key的布隆过滤器，每一代有cells个计数器，每个key使用hashes个哈希函数，
+// 每过rotate轮换一次，0表示不轮换。cells或hashes小于等于0表示关闭（默认）
+func WithNotFoundFilter(cells, hashes int, rotate time.Duration) GroupOption {
+	return func(g *Group) {
+		g.notFound = nil
+		if cells > 0 && hashes > 0 {
+			g.notFound = newNotFoundFilter(cells, hashes, rotate)
+		}
+	}
+}
+
+// WithNotFoundFilterRecheck 使过滤器每命中n次放行一次，重新调用回调函数确认key是否仍然不存在，0表示不放行（默认）
+func WithNotFoundFilterRecheck(n int) GroupOption {
+	return func(g *Group) {
+		g.notFoundRecheck = n
+	}
+}
+
+// notFoundFilter 是分代的计数布隆过滤器，计数器达到255后不再增减
+type notFoundFilter struct {
+	hashes int
+	rotate time.Duration
+	seed   maphash.Seed
+	hits   atomic.Uint64 // 命中次数，用于按比例放行
+
+	mu        sync.Mutex
+	cur, prev []uint8
+	rotated   time.Time // 上次轮换的时间
+}
+
+func newNotFoundFilter(cells, hashes int, rotate time.Duration) *notFoundFilter {
+	return &notFoundFilter{
+		hashes: hashes,
+		rotate: rotate,
+		seed:   maphash.MakeSeed(),
+		cur:    make([]uint8, cells),
+		prev:   make([]uint8, cells),
+	}
+}
+
+// index 返回key的第i个计数器的下标，用两个哈希值组合出hashes个哈希函数
+func (f *notFoundFilter) index(h uint64, i int) int {
+	h1, h2 := h&0xffffffff, h>>32|1
+	return int((h1 + uint64(i)*h2) % uint64(len(f.cur)))
+}
+
+// rotateLocked 在距离上次轮换超过rotate时丢弃旧的一代，超过两个周期时两代都清空
+func (f *notFoundFilter) rotateLocked(now time.Time) {
+	if f.rotate <= 0 || now.Sub(f.rotated) < f.rotate {
+		return
+	}
+	if now.Sub(f.rotated) >= 2*f.rotate {
+		clear(f.cur)
+	}
+	clear(f.prev)
+	f.cur, f.prev = f.prev, f.cur
+	f.rotated = now
+}
+
+// has 判断key是否在gen中
+func (f *notFoundFilter) has(gen []uint8, h uint64) bool {
+	for i := 0; i < f.hashes; i++ {
+		if gen[f.index(h, i)] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add 把key加入新的一代
+func (f *notFoundFilter) add(now time.Time, key string) {
+	h := maphash.String(f.seed, key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rotateLocked(now)
+	for i := 0; i < f.hashes; i++ {
+		if c := &f.cur[f.index(h, i)]; *c < 255 {
+			*c++
+		}
+	}
+}
+
+// contains 判断key是否可能不存在
+func (f *notFoundFilter) contains(now time.Time, key string) bool {
+	h := maphash.String(f.seed, key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rotateLocked(now)
+	return f.has(f.cur, h) || f.has(f.prev, h)
+}
+
+// remove 把key从两代中移除。key只是被误判时也会减少其他key的计数器，代价是那些key多调用一次回调函数
+func (f *notFoundFilter) remove(key string) {
+	h := maphash.String(f.seed, key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, gen := range [][]uint8{f.cur, f.prev} {
+		if !f.has(gen, h) {
+			continue
+		}
+		for i := 0; i < f.hashes; i++ {
+			if c := &gen[f.index(h, i)]; *c < 255 {
+				*c--
+			}
+		}
+	}
+}
+
+// reset 清空过滤器
+func (f *notFoundFilter) reset() {
+	f.mu.Lock()
+	clear(f.cur)
+	clear(f.prev)
+	f.mu.Unlock()
+}
+
+// filterNotFound 在调用回调函数之前查询过滤器，key可能不存在时返回ErrNotFound，按WithNotFoundFilterRecheck放行
+func (g *Group) filterNotFound(key string) error {
+	f := g.notFound
+	if f == nil || !f.contains(g.now(), key) {
+		return nil
+	}
+	if n := g.notFoundRecheck; n > 0 && f.hits.Add(1)%uint64(n) == 0 {
+		g.stats.filterRechecks.Add(1)
+		return nil
+	}
+	g.stats.filterHits.Add(1)
+	return ErrNotFound
+}
+
+// forgetNotFound 在key被写入或删除后把它从过滤器中移除
+func (g *Group) forgetNotFound(key string) {
+	if g.notFound != nil {
+		g.notFound.remove(key)
+	}
+}
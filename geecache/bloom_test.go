@@ -0,0 +1,135 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// existsGetter 只返回exists中的key，其他key返回ErrNotFound，记录每个key的调用次数
+type existsGetter struct {
+	mu     sync.Mutex
+	exists map[string]bool
+	calls  map[string]int
+}
+
+func newExistsGetter() *existsGetter {
+	return &existsGetter{exists: make(map[string]bool), calls: make(map[string]int)}
+}
+
+func (e *existsGetter) Get(_ context.Context, key string) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls[key]++
+	if !e.exists[key] {
+		return nil, fmt.Errorf("no row %q: %w", key, ErrNotFound)
+	}
+	return []byte("v:" + key), nil
+}
+
+func (e *existsGetter) set(key string) {
+	e.mu.Lock()
+	e.exists[key] = true
+	e.mu.Unlock()
+}
+
+func (e *existsGetter) count(key string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls[key]
+}
+
+func TestNotFoundFilter(t *testing.T) {
+	ctx := context.Background()
+	eg := newExistsGetter()
+	g := NewGroup("not-found-filter", 1<<20, eg, WithNotFoundFilter(1<<16, 4, 0))
+
+	// 大量不同的不存在的key，每个只调用一次回调函数
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 1000; i++ {
+			if _, err := g.Get(ctx, fmt.Sprintf("missing-%d", i)); !isNotFound(err) {
+				t.Fatalf("Get(missing-%d) = %v, want ErrNotFound", i, err)
+			}
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if n := eg.count(fmt.Sprintf("missing-%d", i)); n != 1 {
+			t.Fatalf("getter called %d times for missing-%d, want 1", n, i)
+		}
+	}
+	if n := g.Stats().FilterHits; n != 2000 {
+		t.Fatalf("FilterHits = %d, want 2000", n)
+	}
+
+	// Set使key不再被过滤器挡住，被淘汰后也能重新加载
+	eg.set("missing-1")
+	if err := g.Set("missing-1", []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	g.mainCache.remove("missing-1")
+	if v, err := g.Get(ctx, "missing-1"); err != nil || v.String() != "v:missing-1" {
+		t.Fatalf("Get(missing-1) after Set = %q, %v", v.String(), err)
+	}
+	// Delete同样如此：数据源中新增了key后用Delete使缓存失效
+	eg.set("missing-2")
+	g.Delete("missing-2")
+	if v, err := g.Get(ctx, "missing-2"); err != nil || v.String() != "v:missing-2" {
+		t.Fatalf("Get(missing-2) after Delete = %q, %v", v.String(), err)
+	}
+	// RemovePrefix清空整个过滤器
+	eg.set("missing-3")
+	g.RemovePrefix("other")
+	if _, err := g.Get(ctx, "missing-3"); err != nil {
+		t.Fatalf("Get(missing-3) after RemovePrefix = %v", err)
+	}
+}
+
+func TestNotFoundFilterRotation(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	eg := newExistsGetter()
+	g := NewGroup("not-found-filter-rotation", 1<<20, eg, WithNotFoundFilter(1<<10, 3, time.Minute))
+	g.now = clock.Now
+
+	g.Get(ctx, "k")
+	eg.set("k") // 数据源中后来出现了这个key，但没有通知缓存
+	clock.Advance(time.Minute)
+	if _, err := g.Get(ctx, "k"); !isNotFound(err) {
+		t.Fatalf("Get(k) one rotation later = %v, want ErrNotFound from the older generation", err)
+	}
+	clock.Advance(time.Minute)
+	if v, err := g.Get(ctx, "k"); err != nil || v.String() != "v:k" {
+		t.Fatalf("Get(k) two rotations later = %q, %v", v.String(), err)
+	}
+	if n := eg.count("k"); n != 2 {
+		t.Fatalf("getter called %d times, want 2", n)
+	}
+}
+
+func TestNotFoundFilterRecheck(t *testing.T) {
+	ctx := context.Background()
+	eg := newExistsGetter()
+	g := NewGroup("not-found-filter-recheck", 1<<20, eg, WithNotFoundFilter(1<<10, 3, 0), WithNotFoundFilterRecheck(3))
+
+	g.Get(ctx, "k")
+	eg.set("k")
+	for i := 0; i < 2; i++ {
+		if _, err := g.Get(ctx, "k"); !isNotFound(err) {
+			t.Fatalf("Get(k) #%d = %v, want ErrNotFound", i, err)
+		}
+	}
+	// 第3次命中放行，确认key已经存在后从过滤器中移除
+	if v, err := g.Get(ctx, "k"); err != nil || v.String() != "v:k" {
+		t.Fatalf("rechecked Get(k) = %q, %v", v.String(), err)
+	}
+	g.mainCache.remove("k")
+	if _, err := g.Get(ctx, "k"); err != nil {
+		t.Fatalf("Get(k) after the recheck = %v", err)
+	}
+	s := g.Stats()
+	if s.FilterHits != 2 || s.FilterRechecks != 1 {
+		t.Fatalf("FilterHits = %d, FilterRechecks = %d, want 2 and 1", s.FilterHits, s.FilterRechecks)
+	}
+}
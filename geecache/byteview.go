@@ -1,25 +1,98 @@
 package geecache
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+	"unsafe"
+)
+
 // 只读数据结构ByteView，表示缓存值
 
 type ByteView struct {
-	b []byte // b存储真实的缓存值
+	b        []byte        // b存储真实的缓存值
+	soft     time.Time     // 软过期时间，超过后在后台刷新但仍然返回，零值表示没有软过期
+	expire   time.Time     // 硬过期时间，超过后不再返回，零值表示永不过期
+	noExpiry bool          // 回调函数要求永不过期，写入缓存时不使用group默认的硬过期时间，见NoExpiry
+	delta    time.Duration // 最近一次从回调函数加载该值的耗时，用于提前刷新
+	loaded   time.Time     // 从回调函数加载完成的时间，零值表示不是本地加载的值，见refreshahead.go
+	gen      uint64        // 写入本地缓存时的写入计数，用于按前缀批量失效
+	version  uint64        // 版本号，见version.go
+	err      error         // 不为nil时这是负缓存的墓碑，读取时返回这个错误，见negative.go
 }
 
 func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// Expire 返回值的（硬）过期时间，零值表示永不过期，可用于设置Expires、Cache-Control等响应头。
+// 从远程节点取回的值带着所属节点上剩余的过期时间
+func (v ByteView) Expire() time.Time {
+	return v.expire
+}
+
 // b是只读的，使用ByteSlice() 方法返回一个拷贝，防止缓存值被外部程序修改
 
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// WriteTo 把缓存值直接写到w，实现了io.WriterTo，不需要先拷贝一份；按io.Writer的约定w不能修改或保留传入的切片。
+// ByteView不是io.Reader，需要io.Copy时使用io.Copy(w, v.Reader())，bytes.Reader同样走WriterTo的快速路径。w只写出了一部分且没有返回错误时返回io.ErrShortWrite
+func (v ByteView) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(v.b)
+	if err == nil && n < len(v.b) {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
+// Slice 返回[from, to)范围的子视图，与原视图共享底层数组，不会拷贝，同样是只读的；
+// 子视图保留原视图的过期时间等元数据。范围的规则与Go切片相同，越界时panic
+func (v ByteView) Slice(from, to int) ByteView {
+	if from < 0 || to < from || to > len(v.b) {
+		panic(fmt.Sprintf("geecache: ByteView.Slice[%d:%d] out of range with length %d", from, to, len(v.b)))
+	}
+	v.b = v.b[from:to:to]
+	return v
+}
+
+// At 返回第i个字节，越界时panic
+func (v ByteView) At(i int) byte {
+	if i < 0 || i >= len(v.b) {
+		panic(fmt.Sprintf("geecache: ByteView.At(%d) out of range with length %d", i, len(v.b)))
+	}
+	return v.b[i]
+}
+
+// Reader 返回读取缓存值的*bytes.Reader，它直接读取内部的切片，不会拷贝，
+// 同时实现了io.ReaderAt和io.Seeker，可以交给http.ServeContent。读出的数据都拷贝到调用方的缓冲区，缓存值不会被修改
+func (v ByteView) Reader() *bytes.Reader {
+	return bytes.NewReader(v.b)
+}
+
 func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// Equal 判断两个视图的内容是否相同，不会分配内存
+func (v ByteView) Equal(other ByteView) bool {
+	return bytes.Equal(v.b, other.b)
+}
+
+// EqualString 判断视图的内容是否等于s，不会分配内存
+func (v ByteView) EqualString(s string) bool {
+	return string(v.b) == s // 编译器对比较中的转换不做拷贝
+}
+
+// StringNoCopy 返回与视图共享内存的字符串，不会拷贝。
+// 不安全：返回值只能在当前请求内临时使用（如查map、比较），不能保存下来，也不能在视图被丢弃后继续使用；
+// 需要保存时使用String
+func (v ByteView) StringNoCopy() string {
+	return unsafe.String(unsafe.SliceData(v.b), len(v.b))
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -0,0 +1,126 @@
+package geecache
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ByteView的二进制和JSON编码，用于缓存转储、消息队列等需要在进程外保存或传递值的场景。
+// 二进制格式：版本（1字节）、标志（1字节，bit0表示带硬过期时间，bit1表示带软过期时间）、
+// 按标志出现的过期时间（各8字节，大端序的Unix纳秒），剩余部分为值本身。
+// JSON格式：没有过期时间时与[]byte一样是base64字符串；否则为{"value":<base64>,"expire":<RFC3339>,"soft":<RFC3339>}
+
+const byteViewVersion = 1
+
+const (
+	flagExpire = 1 << iota
+	flagSoft
+)
+
+var errByteViewFormat = errors.New("geecache: invalid ByteView encoding")
+
+// MarshalBinary 实现encoding.BinaryMarshaler
+func (v ByteView) MarshalBinary() ([]byte, error) {
+	var flags byte
+	n := 2 + len(v.b)
+	if !v.expire.IsZero() {
+		flags |= flagExpire
+		n += 8
+	}
+	if !v.soft.IsZero() {
+		flags |= flagSoft
+		n += 8
+	}
+	buf := make([]byte, 2, n)
+	buf[0], buf[1] = byteViewVersion, flags
+	if flags&flagExpire != 0 {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(v.expire.UnixNano()))
+	}
+	if flags&flagSoft != 0 {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(v.soft.UnixNano()))
+	}
+	return append(buf, v.b...), nil
+}
+
+// UnmarshalBinary 实现encoding.BinaryUnmarshaler，值会拷贝一份，之后修改data不影响v
+func (v *ByteView) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return errByteViewFormat
+	}
+	if data[0] != byteViewVersion {
+		return fmt.Errorf("geecache: unsupported ByteView encoding version %d", data[0])
+	}
+	flags, data := data[1], data[2:]
+	if flags&^(flagExpire|flagSoft) != 0 {
+		return errByteViewFormat
+	}
+	var view ByteView
+	for _, f := range []struct {
+		flag byte
+		t    *time.Time
+	}{{flagExpire, &view.expire}, {flagSoft, &view.soft}} {
+		if flags&f.flag == 0 {
+			continue
+		}
+		if len(data) < 8 {
+			return errByteViewFormat
+		}
+		*f.t = time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+		data = data[8:]
+	}
+	view.b = cloneBytes(data)
+	*v = view
+	return nil
+}
+
+// byteViewJSON 是带过期时间的值的JSON格式
+type byteViewJSON struct {
+	Value  []byte     `json:"value"`
+	Expire *time.Time `json:"expire,omitempty"`
+	Soft   *time.Time `json:"soft,omitempty"`
+}
+
+// MarshalJSON 实现json.Marshaler
+func (v ByteView) MarshalJSON() ([]byte, error) {
+	if v.expire.IsZero() && v.soft.IsZero() {
+		return json.Marshal(v.b)
+	}
+	j := byteViewJSON{Value: v.b}
+	if !v.expire.IsZero() {
+		j.Expire = &v.expire
+	}
+	if !v.soft.IsZero() {
+		j.Soft = &v.soft
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，接受MarshalJSON输出的两种格式
+func (v *ByteView) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		*v = ByteView{b: b}
+		return nil
+	}
+	var j byteViewJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	view := ByteView{b: j.Value}
+	if j.Expire != nil {
+		view.expire = *j.Expire
+	}
+	if j.Soft != nil {
+		view.soft = *j.Soft
+	}
+	*v = view
+	return nil
+}
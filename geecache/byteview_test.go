@@ -0,0 +1,210 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestByteViewReader(t *testing.T) {
+	v := ByteView{b: []byte("hello world")}
+	got, err := io.ReadAll(v.Reader())
+	if err != nil || string(got) != "hello world" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+	// 修改读出的数据、ReadAt的缓冲区都不影响缓存值
+	got[0] = 'J'
+	buf := make([]byte, 5)
+	v.Reader().ReadAt(buf, 6)
+	buf[0] = 'W'
+	if v.String() != "hello world" {
+		t.Fatalf("view mutated through reader: %q", v.String())
+	}
+
+	// 支持Seek，可以交给http.ServeContent处理Range请求
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Range", "bytes=6-")
+	http.ServeContent(w, r, "", time.Time{}, v.Reader())
+	if w.Code != http.StatusPartialContent || w.Body.String() != "world" {
+		t.Fatalf("ServeContent = %d %q", w.Code, w.Body.String())
+	}
+	if !bytes.Equal(v.ByteSlice(), []byte("hello world")) {
+		t.Fatal("ByteSlice changed")
+	}
+}
+
+func TestByteViewSlice(t *testing.T) {
+	expire := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := ByteView{b: []byte("\x03abc\x02de"), expire: expire}
+	field := v.Slice(1, 1+int(v.At(0)))
+	if field.Len() != 3 || field.String() != "abc" || field.At(2) != 'c' || field.expire != expire {
+		t.Fatalf("field = %q (len %d)", field.String(), field.Len())
+	}
+	if s := v.Slice(5, 7).Slice(1, 2); s.String() != "e" {
+		t.Fatalf("nested slice = %q", s.String())
+	}
+	// 子视图没有多余的容量，ByteSlice得到的拷贝也不能修改原值
+	b := field.ByteSlice()
+	b = append(b, 'X')
+	b[0] = 'Z'
+	if v.String() != "\x03abc\x02de" {
+		t.Fatalf("view mutated: %q", v.String())
+	}
+	if cap(field.b) != 3 {
+		t.Fatalf("sub-view capacity %d, want 3", cap(field.b))
+	}
+	if v.Slice(7, 7).Len() != 0 {
+		t.Fatal("empty slice at end")
+	}
+
+	for _, f := range []func(){
+		func() { v.Slice(-1, 2) },
+		func() { v.Slice(3, 2) },
+		func() { v.Slice(0, 8) },
+		func() { v.At(7) },
+		func() { v.At(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("out-of-range access did not panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestByteViewEqual(t *testing.T) {
+	silenceLog(t)
+	g := NewGroup("byteview-equal", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	sentinel := ByteView{b: []byte("value-a")}
+	lookup := map[string]int{"value-a": 1}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				v, err := g.Get(context.Background(), "a")
+				if err != nil || !v.Equal(sentinel) || !v.EqualString("value-a") || v.EqualString("value-b") ||
+					lookup[v.StringNoCopy()] != 1 {
+					t.Errorf("comparison failed for %q", v.String())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, _ := g.Get(context.Background(), "a")
+	allocs := testing.AllocsPerRun(100, func() {
+		if !v.Equal(sentinel) || !v.EqualString("value-a") || lookup[v.StringNoCopy()] != 1 {
+			t.Fatal("comparison failed")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("comparisons allocated %v times", allocs)
+	}
+	if (ByteView{}).StringNoCopy() != "" || !(ByteView{}).EqualString("") {
+		t.Fatal("empty view")
+	}
+}
+
+// shortWriter 每次最多写出n个字节，err不为nil时写出后返回err
+type shortWriter struct {
+	n   int
+	err error
+	buf bytes.Buffer
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	w.buf.Write(p)
+	return len(p), w.err
+}
+
+func TestByteViewWriteTo(t *testing.T) {
+	v := ByteView{b: []byte("hello world")}
+	var buf bytes.Buffer
+	if n, err := v.WriteTo(&buf); err != nil || n != 11 || buf.String() != "hello world" {
+		t.Fatalf("io.Copy = %d, %v, %q", n, err, buf.String())
+	}
+
+	w := &shortWriter{n: 4}
+	if n, err := v.WriteTo(w); n != 4 || err != io.ErrShortWrite {
+		t.Fatalf("short write = %d, %v", n, err)
+	}
+	broken := errors.New("connection reset")
+	w = &shortWriter{n: 6, err: broken}
+	if n, err := v.WriteTo(w); n != 6 || err != broken || w.buf.String() != "hello " {
+		t.Fatalf("failed write = %d, %v", n, err)
+	}
+}
+
+func TestByteViewMarshal(t *testing.T) {
+	expire := time.Date(2024, 1, 1, 0, 0, 0, 123, time.UTC)
+	large := bytes.Repeat([]byte("0123456789"), 1<<17)
+	views := []ByteView{
+		{},
+		{b: []byte("hello")},
+		{b: []byte("hello"), expire: expire},
+		{b: []byte{}, expire: expire, soft: expire.Add(-time.Minute)},
+		{b: large, soft: expire},
+	}
+	same := func(a, b ByteView) bool {
+		return a.Equal(b) && a.expire.Equal(b.expire) && a.soft.Equal(b.soft)
+	}
+	for i, v := range views {
+		data, err := v.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ByteView
+		if err := got.UnmarshalBinary(data); err != nil || !same(got, v) {
+			t.Fatalf("view %d: binary round trip = %v", i, err)
+		}
+
+		js, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = ByteView{}
+		if err := json.Unmarshal(js, &got); err != nil || !same(got, v) {
+			t.Fatalf("view %d: JSON round trip of %.40s = %v", i, js, err)
+		}
+	}
+
+	// 没有过期时间时与[]byte的JSON编码相同
+	js, _ := json.Marshal(ByteView{b: []byte("hello")})
+	want, _ := json.Marshal([]byte("hello"))
+	if !bytes.Equal(js, want) {
+		t.Fatalf("JSON = %s, want %s", js, want)
+	}
+
+	for _, data := range [][]byte{nil, {1}, {2, 0}, {1, 4}, {1, flagExpire, 0, 0, 0}} {
+		var v ByteView
+		if err := v.UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary(%v) succeeded", data)
+		}
+	}
+	for _, data := range []string{`"not base64!"`, `{"value":1}`, `[]`} {
+		var v ByteView
+		if err := json.Unmarshal([]byte(data), &v); err == nil {
+			t.Errorf("UnmarshalJSON(%s) succeeded", data)
+		}
+	}
+}
@@ -2,35 +2,584 @@ package geecache
 
 import (
 	"geecache/geecache/lru"
+	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*sync.Mutex 互斥锁的使用，并实现 LRU 缓存的并发控制。
 实现 GeeCache 核心数据结构 Group，缓存不存在时，调用回调函数获取源数据*/
 
+// 读路径：命中只需要读锁，用Peek读取值，而把"最近访问"的更新（移到队尾、SLRU晋升、TinyLFU计数）
+// 放进promotions队列，下一次获取写锁时（lockWrite）批量补做。每次可能淘汰的写入之前都会先补做，
+// 所以热点key不会因为更新被推迟而被淘汰；队列满时命中的goroutine自己获取写锁补做。
+// 未命中、已过期或已失效的记录仍然在写锁下按原来的方式处理（惰性删除等）
+
+// maxValueRatio 是单个值的默认上限占cacheBytes的比例的倒数，见WithMaxValueBytes
+const maxValueRatio = 4
+
+// promoteBuffer 是等待补做的访问更新的队列长度
+const promoteBuffer = 256
+
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
-	cacheBytes int64
+	mu          sync.RWMutex
+	promotions  chan string // 只持有读锁的命中，等待在写锁下补做访问更新
+	lru         lru.PolicyOf[ByteView]
+	cacheBytes  int64            // 0表示不缓存，见disabled
+	unlimited   bool             // 不限制缓存大小，忽略cacheBytes，见WithUnlimitedBytes
+	now         func() time.Time // 判断过期使用的时钟，为nil时使用time.Now
+	policy      EvictionPolicy
+	admission   int // TinyLFU准入策略的采样数，0表示接纳所有新记录
+	onEvicted   func(key string, value ByteView, reason lru.EvictReason)
+	lowWater    float64 // 低水位比例，见WithLowWater
+	maxEntries  int     // 记录条数上限，0表示不限制，见WithMaxEntries
+	churn       churnMeter
+	evicted     []evictedEntry // 持有锁时淘汰、尚未调用onEvicted的记录，按淘汰顺序排列
+	dispatching bool           // 有goroutine正在调用onEvicted，见unlock
+
+	nhit, nmiss  atomic.Int64  // 命中和未命中的次数，命中时只持有读锁，因此使用原子操作
+	nadd, nevict int64         // 写入和移除的次数，持有写锁时修改
+	noversize    int64         // 因超过单个值的上限而没有缓存的次数，持有写锁时修改
+	maxValue     int64         // 单个值的上限，0表示使用默认值，负数表示不限制，见WithMaxValueBytes
+	cleanup      time.Duration // 后台清理过期记录的间隔，0表示不清理
+
+	gen             uint64            // 写入计数，每条记录保存写入时的值，用于按前缀批量失效
+	removed         map[string]uint64 // 被删除的key和删除时的写入计数，删除之前开始的加载不再写回，见addLoaded
+	removedFloor    uint64            // removed超过上限被清空时的写入计数，在此之前开始的加载都不写回
+	tombstones      []tombstone       // 尚未清理完的前缀失效
+	prefixThreshold int               // 按前缀删除超过这个数量后改为惰性失效，0表示使用defaultPrefixThreshold
 }
 
-func (c *cache) add(key string, value ByteView) {
+// EvictionPolicy 选择本地缓存的淘汰策略
+type EvictionPolicy int
+
+const (
+	PolicyLRU  EvictionPolicy = iota // 最近最少使用（默认）
+	PolicySLRU                       // 分段LRU，新记录先进入试用段，再次命中才进入保护段，抵抗一次性扫描
+	PolicyARC                        // 自适应替换，在最近访问和访问频率之间自动调整
+)
+
+// slruProtectedRatio 是分段LRU中保护段占缓存的比例
+const slruProtectedRatio = 0.8
+
+// limit 返回底层淘汰策略使用的上限，lru中0表示不限制
+func (c *cache) limit() int64 {
+	if c.unlimited {
+		return 0
+	}
+	return c.cacheBytes
+}
+
+// disabled 判断是否关闭了本地缓存（cacheBytes为0且没有WithUnlimitedBytes），此时所有写入都被忽略
+func (c *cache) disabled() bool {
+	return !c.unlimited && c.cacheBytes == 0
+}
+
+// newPolicy 按c.policy创建底层的淘汰策略
+func (c *cache) newPolicy() lru.PolicyOf[ByteView] {
+	switch c.policy {
+	case PolicySLRU:
+		l := lru.NewSegmentedOf(c.limit(), slruProtectedRatio, byteViewCost, nil)
+		l.Hash = lru.HashString
+		l.Now = c.now
+		l.Admission = c.newAdmission()
+		l.OnEvictedWithReason = c.evictedCallback()
+		l.LowWater = c.lowWater
+		l.MaxEntries = c.maxEntries
+		l.Locker = (*cacheLocker)(c)
+		c.startJanitor(l)
+		return l
+	case PolicyARC:
+		a := lru.NewARCOf(c.limit(), byteViewCost, nil)
+		a.Now = c.now
+		a.OnEvictedWithReason = c.evictedCallback()
+		a.LowWater = c.lowWater
+		a.MaxEntries = c.maxEntries
+		a.Locker = (*cacheLocker)(c)
+		c.startJanitor(a)
+		return a
+	}
+	l := lru.NewOf(c.limit(), byteViewCost, nil)
+	l.Hash = lru.HashString
+	l.Now = c.now
+	l.Admission = c.newAdmission()
+	l.OnEvictedWithReason = c.evictedCallback()
+	l.LowWater = c.lowWater
+	l.MaxEntries = c.maxEntries
+	l.Locker = (*cacheLocker)(c)
+	c.startJanitor(l)
+	return l
+}
+
+// startJanitor 按c.cleanup开启后台清理，清理goroutine每批操作时获取c.mu
+func (c *cache) startJanitor(p interface{ StartJanitor(time.Duration) }) {
+	if c.cleanup > 0 {
+		p.StartJanitor(c.cleanup)
+	}
+}
+
+// byteViewCost 是一条记录占用的字节数，与lru.DefaultCost相同
+func byteViewCost(key string, value ByteView) int64 {
+	return int64(len(key)) + int64(value.Len())
+}
+
+// evictedEntry 是一条等待调用onEvicted的被淘汰记录
+type evictedEntry struct {
+	key    string
+	value  ByteView
+	reason lru.EvictReason
+}
+
+// evictedCallback 返回底层淘汰策略的回调：统计因容量淘汰的字节数，再把记录加入c.evicted，
+// 回调在持有c.mu时被调用，c.onEvicted留到释放锁之后由unlock调用
+func (c *cache) evictedCallback() func(string, ByteView, lru.EvictReason) {
+	return func(key string, value ByteView, reason lru.EvictReason) {
+		if reason == lru.ReasonCapacity {
+			c.churn.add(c.now(), int64(len(key)+value.Len()))
+		}
+		c.nevict++
+		if c.onEvicted != nil {
+			c.evicted = append(c.evicted, evictedEntry{key, value, reason})
+		}
+	}
+}
+
+// unlock 释放c.mu，然后在锁外按淘汰顺序对期间被淘汰的记录调用onEvicted，因此onEvicted中可以读写同一个group。
+// 同一时刻只有一个goroutine调用onEvicted：其他goroutine（包括onEvicted中重入的操作）淘汰的记录
+// 加入队列后直接返回，由正在调用的goroutine接着处理，所以所有回调严格按淘汰顺序、串行地执行，
+// 但不一定在触发淘汰的操作返回之前执行
+func (c *cache) unlock() {
+	if c.dispatching || len(c.evicted) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.dispatching = true
+	for len(c.evicted) > 0 {
+		batch := c.evicted
+		c.evicted = nil
+		c.mu.Unlock()
+		for _, e := range batch {
+			c.onEvicted(e.key, e.value, e.reason)
+		}
+		c.mu.Lock()
+	}
+	c.dispatching = false
+	c.mu.Unlock()
+}
+
+// cacheLocker 是交给底层淘汰策略的后台清理使用的锁，释放时与unlock一样在锁外调用onEvicted
+type cacheLocker cache
+
+func (l *cacheLocker) Lock()   { (*cache)(l).lockWrite() }
+func (l *cacheLocker) Unlock() { (*cache)(l).unlock() }
+
+func (c *cache) newAdmission() *lru.TinyLFU {
+	if c.admission <= 0 {
+		return nil
+	}
+	return lru.NewTinyLFU(c.admission)
+}
+
+// lockWrite 获取写锁，并补做只持有读锁的命中推迟的访问更新
+func (c *cache) lockWrite() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.applyPromotions()
+}
+
+// applyPromotions 按命中的顺序补做队列中的访问更新，调用时需持有写锁
+func (c *cache) applyPromotions() {
 	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+		return
+	}
+	for {
+		select {
+		case key := <-c.promotions:
+			c.lru.Get(key)
+		default:
+			return
+		}
 	}
-	c.lru.Add(key, value)
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// ensurePolicy 第一次写入时创建底层的淘汰策略，调用时需持有写锁
+func (c *cache) ensurePolicy() {
 	if c.lru == nil {
+		c.lru = c.newPolicy()
+		c.promotions = make(chan string, promoteBuffer)
+	}
+}
+
+func (c *cache) add(key string, value ByteView) {
+	c.lockWrite()
+	defer c.unlock()
+	if c.disabled() || c.oversize(value) {
+		return
+	}
+	c.ensurePolicy()
+	c.gen++
+	c.nadd++
+	value = storedVersion(value)
+	value.gen = c.gen
+	c.lru.AddWithExpire(key, value, value.expire)
+}
+
+// oversize 判断value是否超过单个值的上限，超过时计数并返回true，调用方不缓存它；调用时持有写锁。
+// 负缓存的墓碑不受限制
+func (c *cache) oversize(value ByteView) bool {
+	if value.err != nil {
+		return false
+	}
+	if limit := c.limitValue(); limit < 0 || int64(value.Len()) <= limit {
+		return false
+	}
+	c.noversize++
+	return true
+}
+
+// limitValue 返回单个值的上限，负数表示不限制；调用时持有锁。
+// 默认上限为cacheBytes的1/maxValueRatio，不限制大小的缓存默认不设上限
+func (c *cache) limitValue() int64 {
+	limit := c.maxValue
+	if limit == 0 {
+		if c.unlimited {
+			return -1
+		}
+		limit = c.cacheBytes / maxValueRatio
+		if limit < 1 {
+			limit = 1
+		}
+	}
+	return limit
+}
+
+// valueLimit 返回单个值的上限，负数表示不限制，见limitValue
+func (c *cache) valueLimit() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.limitValue()
+}
+
+// rejectOversize 记录一次因超过单个值的上限而没有读取的值
+func (c *cache) rejectOversize() {
+	c.lockWrite()
+	c.noversize++
+	c.unlock()
+}
+
+// version 返回当前的写入计数，加载开始前记下，写回时交给addLoaded
+func (c *cache) version() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.gen
+}
+
+// addLoaded 写入从version为since时开始加载的值；期间key已经被写入了更新的值（如Group.Set）时保留那个值，
+// 期间key被删除（如Group.Delete）时不写入。返回缓存中最终的值，以及value是否被写入；
+// 与关闭缓存时一样，因为删除而没有写入时同样返回value和true，调用方照常使用value
+func (c *cache) addLoaded(key string, value ByteView, since uint64) (ByteView, bool) {
+	c.lockWrite()
+	defer c.unlock()
+	if c.disabled() {
+		return value, true
+	}
+	if since < c.removedFloor {
+		return value, true
+	}
+	if gen, ok := c.removed[key]; ok {
+		if gen > since {
+			return value, true
+		}
+		delete(c.removed, key) // 写入的值之后由它的写入计数保护
+	}
+	c.ensurePolicy()
+	if v, ok := c.lru.Peek(key); ok && v.gen > since && !c.invalidated(key, v) {
+		return v, false
+	}
+	if c.oversize(value) {
+		return value, true
+	}
+	c.gen++
+	c.nadd++
+	value = storedVersion(value)
+	value.gen = c.gen
+	c.lru.AddWithExpire(key, value, value.expire)
+	return value, true
+}
+
+// addAll 在一次加锁中写入多条记录，底层为lru.Cache时只在最后淘汰一次
+func (c *cache) addAll(keys []string, values []ByteView) {
+	c.lockWrite()
+	defer c.unlock()
+	if c.disabled() {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+	c.ensurePolicy()
+	entries := make([]lru.EntryOf[string, ByteView], 0, len(keys))
+	for i, key := range keys {
+		if c.oversize(values[i]) {
+			continue
+		}
+		c.gen++
+		values[i] = storedVersion(values[i])
+		values[i].gen = c.gen
+		entries = append(entries, lru.EntryOf[string, ByteView]{Key: key, Value: values[i], Expire: values[i].expire})
 	}
+	c.nadd += int64(len(entries))
+	if l, ok := c.lru.(*lru.CacheOf[string, ByteView]); ok {
+		l.AddAll(entries)
+		return
+	}
+	for _, e := range entries {
+		c.lru.AddWithExpire(e.Key, e.Value, e.Expire)
+	}
+}
+
+func (c *cache) get(key string) (value ByteView, ok bool) {
+	c.mu.RLock()
+	if c.lru != nil {
+		if v, found := c.lru.Peek(key); found && !c.invalidated(key, v) {
+			promotions := c.promotions
+			c.mu.RUnlock()
+			c.nhit.Add(1)
+			c.promote(promotions, key)
+			return v, true
+		}
+	}
+	c.mu.RUnlock()
+
+	c.lockWrite()
+	defer c.unlock()
+	if c.lru != nil {
+		if v, found := c.lru.Get(key); found && !c.invalidated(key, v) {
+			c.nhit.Add(1)
+			return v, true
+		} else if found {
+			c.lru.Remove(key)
+		}
+	}
+	c.nmiss.Add(1)
 	return
 }
+
+// promote 把一次命中的访问更新放进队列，队列满时获取写锁，连同队列中的更新一起补做
+func (c *cache) promote(promotions chan string, key string) {
+	select {
+	case promotions <- key:
+	default:
+		c.lockWrite()
+		c.lru.Get(key)
+		c.unlock()
+	}
+}
+
+// peek 返回key对应的值，不计入命中统计，也不改变记录的新旧顺序
+func (c *cache) peek(key string) (ByteView, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return ByteView{}, false
+	}
+	if v, ok := c.lru.Peek(key); ok && !c.invalidated(key, v) {
+		return v, true
+	}
+	return ByteView{}, false
+}
+
+// contains 判断缓存中是否有key，不改变记录的新旧顺序，也不复制值。只持有读锁，不会阻塞并发的命中
+func (c *cache) contains(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return false
+	}
+	if len(c.tombstones) == 0 {
+		return c.lru.Contains(key)
+	}
+	v, ok := c.lru.Peek(key)
+	return ok && !c.invalidated(key, v)
+}
+
+// lruStats 返回底层淘汰策略的占用和淘汰统计，lru尚未创建时只有上限
+func (c *cache) lruStats() lru.Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return lru.Stats{MaxBytes: c.limit()}
+	}
+	return c.lru.Stats()
+}
+
+// isDisabled 是加锁版本的disabled
+func (c *cache) isDisabled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.disabled()
+}
+
+// stats 返回缓存的计数器和当前占用
+func (c *cache) stats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := CacheStats{Hits: c.nhit.Load(), Misses: c.nmiss.Load(), Adds: c.nadd, Evictions: c.nevict, Oversize: c.noversize}
+	s.Gets = s.Hits + s.Misses
+	if c.lru != nil {
+		s.Bytes = c.lru.Bytes()
+		s.Items = int64(c.lru.Len())
+	}
+	return s
+}
+
+// bytes 返回缓存当前占用的字节数，lru尚未创建时为0
+func (c *cache) bytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return 0
+	}
+	return c.lru.Bytes()
+}
+
+// items 返回缓存当前的记录数，lru尚未创建时为0
+func (c *cache) items() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return 0
+	}
+	return c.lru.Len()
+}
+
+// maxBytes 返回配置的上限：不缓存时为0，不限制大小时为math.MaxInt64
+func (c *cache) maxBytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.unlimited {
+		return math.MaxInt64
+	}
+	return c.cacheBytes
+}
+
+// pinner 是支持Pin的淘汰策略（lru.CacheOf）实现的接口
+type pinner interface {
+	Pin(key string) bool
+	Unpin(key string)
+}
+
+// pin 在unpin之前保持key对应的记录不被淘汰或清空，例如在写出一个很大的值时；
+// 记录不存在或淘汰策略不支持Pin（ARC）时返回false，此时不需要unpin
+func (c *cache) pin(key string) bool {
+	c.lockWrite()
+	defer c.unlock()
+	p, ok := c.lru.(pinner)
+	return ok && p.Pin(key)
+}
+
+// unpin 撤销一次pin
+func (c *cache) unpin(key string) {
+	c.lockWrite()
+	defer c.unlock()
+	if p, ok := c.lru.(pinner); ok {
+		p.Unpin(key)
+	}
+}
+
+// resize 修改缓存上限，lru尚未创建时只记录新的上限；cacheBytes为0时关闭缓存并清空已有记录
+func (c *cache) resize(cacheBytes int64) {
+	c.lockWrite()
+	defer c.unlock()
+	c.cacheBytes = cacheBytes
+	c.unlimited = false
+	if c.lru == nil {
+		return
+	}
+	if c.disabled() {
+		c.lru.Clear()
+		return
+	}
+	c.lru.Resize(cacheBytes)
+}
+
+// maxRemoved 是记录的被删除key的数量上限，超过时清空，改为阻止之前开始的所有加载写回
+const maxRemoved = 1024
+
+// remove 删除key对应的记录，并记下删除时的写入计数，使删除之前开始的加载不再写回；记录不存在时同样记下
+func (c *cache) remove(key string) {
+	c.lockWrite()
+	defer c.unlock()
+	if c.lru != nil {
+		c.lru.Remove(key)
+	}
+	c.gen++
+	if len(c.removed) >= maxRemoved {
+		c.removed, c.removedFloor = nil, c.gen
+	}
+	if c.removed == nil {
+		c.removed = make(map[string]uint64)
+	}
+	c.removed[key] = c.gen
+}
+
+// removeOldest 按淘汰策略淘汰一条记录，用于与其他缓存共享容量时腾出空间
+func (c *cache) removeOldest() {
+	c.lockWrite()
+	defer c.unlock()
+	if c.lru != nil {
+		c.lru.RemoveOldest()
+	}
+}
+
+// clear 清空缓存
+func (c *cache) clear() {
+	c.lockWrite()
+	defer c.unlock()
+	if c.lru != nil {
+		c.lru.Clear()
+	}
+	c.tombstones = nil
+}
+
+// close 停止后台清理并清空缓存，用于注销group
+func (c *cache) close() {
+	c.lockWrite()
+	p := c.lru
+	c.unlock()
+	// StopJanitor等待清理goroutine退出，不能持有c.mu
+	if j, ok := p.(interface{ StopJanitor() }); ok {
+		j.StopJanitor()
+	}
+	c.clear()
+}
+
+// keys 按从最近使用到最久未使用的顺序返回所有键
+func (c *cache) keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return nil
+	}
+	return c.lru.Keys()
+}
+
+// rangeEntries 在锁内取得缓存的快照，释放锁之后再依次调用f，因此f中可以安全地读写同一个cache
+func (c *cache) rangeEntries(f func(key string, value ByteView) bool) {
+	c.lockWrite()
+	var keys []string
+	var values []ByteView
+	if c.lru != nil {
+		c.lru.Range(func(key string, value ByteView) bool {
+			if c.invalidated(key, value) {
+				return true
+			}
+			keys = append(keys, key)
+			values = append(values, value)
+			return true
+		})
+	}
+	c.unlock()
+	for i, key := range keys {
+		if !f(key, values[i]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// 回调函数的回退链：按“本地物化文件 → 主数据库 → 远程API”的顺序查找时，不必每次都写一个把几层拼在一起的回调函数。
+// GetterChain依次调用每一层，某一层返回可以跳过的错误（默认为ErrNotFound）时继续下一层，
+// 成功或者返回其他错误时立即结束；所有层都失败时返回用errors.Join合并的错误，每个错误带着层号，
+// 全部是ErrNotFound时合并后的错误仍然满足errors.Is(err, ErrNotFound)，负缓存照常生效。
+// 每一层只使用Get方法，GetterWithTTL等可选接口不会被调用
+
+// GetterChain 是按顺序回退的Getter，用MultiGetter创建
+type GetterChain struct {
+	getters []Getter
+	skip    func(err error) bool
+	served  []atomic.Int64
+}
+
+// MultiGetter 返回依次尝试getters的Getter，见GetterChain
+func MultiGetter(getters ...Getter) *GetterChain {
+	return &GetterChain{
+		getters: getters,
+		skip:    isNotFound,
+		served:  make([]atomic.Int64, len(getters)),
+	}
+}
+
+// FallThrough 设置哪些错误继续尝试下一层，默认只有ErrNotFound。需要在开始使用之前调用，返回c本身
+func (c *GetterChain) FallThrough(f func(err error) bool) *GetterChain {
+	c.skip = f
+	return c
+}
+
+// Get 依次调用每一层，返回第一个成功的结果，实现了Getter
+func (c *GetterChain) Get(ctx context.Context, key string) ([]byte, error) {
+	var errs []error
+	for i, g := range c.getters {
+		b, err := g.Get(ctx, key)
+		if err == nil {
+			c.served[i].Add(1)
+			return b, nil
+		}
+		err = fmt.Errorf("tier %d: %w", i, err)
+		if !c.skip(err) {
+			return nil, err
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			// 调用方已经离开，不再尝试后面的层
+			return nil, errors.Join(append(errs, ctx.Err())...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNotFound
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Served 返回每一层成功返回值的次数，与创建时的getters一一对应
+func (c *GetterChain) Served() []int64 {
+	n := make([]int64, len(c.served))
+	for i := range c.served {
+		n[i] = c.served[i].Load()
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// mapGetter 从map中读取，没有的key返回ErrNotFound
+type mapGetter map[string]string
+
+func (m mapGetter) Get(_ context.Context, key string) ([]byte, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return []byte(v), nil
+}
+
+func TestMultiGetter(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("database down")
+	var apiCalls int
+	chain := MultiGetter(
+		mapGetter{"file": "from file"},
+		GetterFunc(func(key string) ([]byte, error) {
+			if key == "broken" {
+				return nil, errDown
+			}
+			return mapGetter{"db": "from db"}.Get(ctx, key)
+		}),
+		GetterFunc(func(key string) ([]byte, error) {
+			apiCalls++
+			return mapGetter{"api": "from api", "db": "api copy"}.Get(ctx, key)
+		}),
+	)
+
+	for key, want := range map[string]string{"file": "from file", "db": "from db", "api": "from api"} {
+		if v, err := chain.Get(ctx, key); err != nil || string(v) != want {
+			t.Fatalf("Get(%s) = %q, %v, want %q", key, v, err, want)
+		}
+	}
+	if got := chain.Served(); got[0] != 1 || got[1] != 1 || got[2] != 1 {
+		t.Fatalf("Served = %v, want one per tier", got)
+	}
+
+	// 其他错误立即返回，不再尝试后面的层
+	apiCalls = 0
+	if _, err := chain.Get(ctx, "broken"); !errors.Is(err, errDown) || isNotFound(err) || apiCalls != 0 {
+		t.Fatalf("Get(broken) = %v after %d API calls, want the database error without trying the API", err, apiCalls)
+	}
+
+	// 所有层都没有时合并每一层的错误，仍然是ErrNotFound
+	_, err := chain.Get(ctx, "missing")
+	if !isNotFound(err) {
+		t.Fatalf("Get(missing) = %v, want ErrNotFound", err)
+	}
+	for i := 0; i < 3; i++ {
+		if want := fmt.Sprintf("tier %d:", i); !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not mention %q", err, want)
+		}
+	}
+
+	// 自定义可以跳过的错误
+	apiCalls = 0
+	chain.FallThrough(func(err error) bool { return isNotFound(err) || errors.Is(err, errDown) })
+	if _, err := chain.Get(ctx, "broken"); !errors.Is(err, errDown) || !isNotFound(err) || apiCalls != 1 {
+		t.Fatalf("Get(broken) = %v after %d API calls, want both errors after trying the API", err, apiCalls)
+	}
+}
+
+func TestMultiGetterInGroup(t *testing.T) {
+	g := NewGroup("multi-getter", 1<<10, MultiGetter(mapGetter{}, mapGetter{"k": "v"}))
+	if v, err := g.Get(context.Background(), "k"); err != nil || v.String() != "v" {
+		t.Fatalf("Get = %q, %v", v.String(), err)
+	}
+	if _, err := g.Get(context.Background(), "missing"); !isNotFound(err) {
+		t.Fatalf("Get(missing) = %v, want ErrNotFound", err)
+	}
+	if _, err := MultiGetter().Get(context.Background(), "k"); !isNotFound(err) {
+		t.Fatalf("empty chain returned %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"geecache/geecache/consistenthash"
+	"geecache/geecache/internal/protocol"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 供只需要读取缓存的服务使用：不运行节点、不注册group、没有回调函数
+// Client 在给定节点上构建与集群相同的一致性哈希环，直接向key的所属节点发起节点间协议的读取，
+// 读取失败时返回错误，不会像Group那样回退到本地加载。
+// Client按原来的key选择节点和发起请求，不知道group的WithKeyHashing，不能用于开启了它的group
+
+type Client struct {
+	basePath   string
+	adminToken string
+	replicas   int
+	retries    int
+	timeout    time.Duration
+	httpClient *http.Client
+	ring       *consistenthash.Map
+}
+
+// Option 用于在创建Client时修改默认配置
+type Option func(*Client)
+
+// WithTimeout 设置每次请求的超时时间
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithHTTPClient 使用自定义的http.Client发起请求，可用于配置连接池、鉴权等
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithRetries 设置请求失败后的重试次数，默认不重试
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.retries = n
+	}
+}
+
+// WithReplicas 设置一致性哈希的虚拟节点倍数，必须与集群中HTTPPool使用的一致
+func WithReplicas(n int) Option {
+	return func(c *Client) {
+		c.replicas = n
+	}
+}
+
+// WithAdminToken 设置调用需要鉴权的接口（如Import）时使用的管理令牌，与节点的geecache.WithAdminToken一致
+func WithAdminToken(token string) Option {
+	return func(c *Client) {
+		c.adminToken = token
+	}
+}
+
+// WithBasePath 设置节点间通信地址的前缀，必须与集群中HTTPPool使用的一致
+func WithBasePath(path string) Option {
+	return func(c *Client) {
+		c.basePath = path
+	}
+}
+
+// New 创建客户端，peers为集群中所有节点的地址，如["http://localhost:8001","http://localhost:8002"]
+func New(peers []string, opts ...Option) *Client {
+	c := &Client{
+		basePath:   protocol.DefaultBasePath,
+		replicas:   protocol.DefaultReplicas,
+		httpClient: &http.Client{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeout > 0 {
+		hc := *c.httpClient
+		hc.Timeout = c.timeout
+		c.httpClient = &hc
+	}
+	c.ring = consistenthash.New(c.replicas, nil)
+	c.ring.Add(peers...)
+	return c
+}
+
+// owner 返回key所属节点的访问前缀，如"http://localhost:8001/_geecache/"
+func (c *Client) owner(key string) string {
+	return c.ring.Get(key) + c.basePath
+}
+
+// retry 执行fn，失败时最多重试c.retries次，ctx结束后不再重试
+func (c *Client) retry(ctx context.Context, fn func() error) error {
+	err := fn()
+	for i := 0; i < c.retries && err != nil && ctx.Err() == nil; i++ {
+		err = fn()
+	}
+	return err
+}
+
+// Get 从key的所属节点读取group中key的值
+func (c *Client) Get(ctx context.Context, group, key string) ([]byte, error) {
+	var value []byte
+	err := c.retry(ctx, func() (err error) {
+		value, err = protocol.Get(ctx, c.httpClient, c.owner(key), group, key)
+		return err
+	})
+	return value, err
+}
+
+// Exists 检查key的所属节点是否已经缓存了group中的key，不会触发加载
+func (c *Client) Exists(ctx context.Context, group, key string) (bool, error) {
+	var ok bool
+	err := c.retry(ctx, func() (err error) {
+		ok, err = protocol.Exists(ctx, c.httpClient, c.owner(key), group, key)
+		return err
+	})
+	return ok, err
+}
+
+// GetMulti 读取group中的多个key，按所属节点分组后对每个节点并发地发起批量请求
+// 返回读取成功的值以及每个失败key的错误，一个节点失败不影响其他节点上的key
+func (c *Client) GetMulti(ctx context.Context, group string, keys []string) (map[string][]byte, map[string]error) {
+	var mu sync.Mutex
+	values := make(map[string][]byte, len(keys))
+	errs := make(map[string]error)
+	c.GetMultiFunc(ctx, group, keys, func(key string, value []byte, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[key] = err
+		} else {
+			values[key] = value
+		}
+	})
+	return values, errs
+}
+
+// GetMultiFunc 与GetMulti相同，但每个key的结果一到达就调用fn，不需要等待所有节点的响应，适合读取大量或很大的值
+// fn会被多个goroutine并发调用，每个key恰好调用一次；节点因响应过大而要求单独读取的key会自动改为单独读取
+func (c *Client) GetMultiFunc(ctx context.Context, group string, keys []string, fn func(key string, value []byte, err error)) {
+	byOwner := make(map[string][]string)
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		owner := c.owner(key)
+		byOwner[owner] = append(byOwner[owner], key)
+	}
+
+	var wg sync.WaitGroup
+	for owner, ownerKeys := range byOwner {
+		for len(ownerKeys) > 0 {
+			n := len(ownerKeys)
+			if n > protocol.MaxBatchKeys {
+				n = protocol.MaxBatchKeys
+			}
+			batch := ownerKeys[:n]
+			ownerKeys = ownerKeys[n:]
+			wg.Add(1)
+			go func(owner string, batch []string) {
+				defer wg.Done()
+				c.fetchBatch(ctx, owner, group, batch, fn)
+			}(owner, batch)
+		}
+	}
+	wg.Wait()
+}
+
+// fetchBatch 向一个节点批量读取batch，整个请求失败时重试尚未得到结果的key
+func (c *Client) fetchBatch(ctx context.Context, owner, group string, batch []string, fn func(string, []byte, error)) {
+	done := 0 // 已经交给fn的key数，结果按顺序到达
+	var retry []string
+	err := c.retry(ctx, func() error {
+		pending := batch[done:]
+		return protocol.StreamMulti(ctx, c.httpClient, owner, group, pending, func(i int, r protocol.Result) {
+			done++
+			if errors.Is(r.Err, protocol.ErrRetryIndividually) {
+				retry = append(retry, pending[i])
+				return
+			}
+			fn(pending[i], r.Value, r.Err)
+		})
+	})
+	if err != nil {
+		for _, key := range batch[done:] {
+			fn(key, nil, err)
+		}
+	}
+	for _, key := range retry {
+		value, err := c.Get(ctx, group, key)
+		fn(key, value, err)
+	}
+}
+
+// ImportProgress 是批量导入的进度确认，见geecache.ImportWriter
+type ImportProgress = protocol.ImportProgress
+
+// Import 把r中由geecache.ImportWriter编码的记录导入到node（如"http://localhost:8001"）上的group，
+// node会保存属于自己的key并把其余的转发给所属节点。start为开始导入的记录序号，用于继续之前中断的导入；
+// 每收到一次进度确认调用fn（可以为nil）。导入中断时从最后确认的Cursor处重新发送，最多重试WithRetries次，
+// 失败时返回的进度的Cursor可以作为下一次调用的start
+func (c *Client) Import(ctx context.Context, node, group string, r io.ReadSeeker, start int64, fn func(ImportProgress)) (ImportProgress, error) {
+	progress := ImportProgress{Cursor: start}
+	err := c.retry(ctx, func() error {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		body := bufio.NewReader(r)
+		if err := protocol.SkipImportEntries(body, progress.Cursor); err != nil {
+			return err
+		}
+		p, err := protocol.Import(ctx, c.httpClient, node+c.basePath, group, c.adminToken, progress.Cursor, false, body, fn)
+		progress = accumulate(progress, p)
+		return err
+	})
+	return progress, err
+}
+
+// accumulate 把一次导入请求的进度累加到之前的进度上，Cursor取最新的值
+func accumulate(total, p ImportProgress) ImportProgress {
+	return ImportProgress{
+		Cursor:           p.Cursor,
+		Stored:           total.Stored + p.Stored,
+		Forwarded:        total.Forwarded + p.Forwarded,
+		Rejected:         total.Rejected + p.Rejected,
+		ChecksumFailures: total.ChecksumFailures + p.ChecksumFailures,
+		Done:             p.Done,
+		Error:            p.Error,
+	}
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"geecache/geecache"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cluster 是在同一进程中运行的若干个缓存节点，loads记录每个节点调用回调函数的次数
+type cluster struct {
+	addrs []string
+	mu    sync.Mutex
+	loads map[string]int
+}
+
+func (c *cluster) totalLoads() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, v := range c.loads {
+		n += v
+	}
+	return n
+}
+
+func startCluster(t *testing.T, n int, group string, db map[string]string) *cluster {
+	t.Helper()
+	c := &cluster{loads: make(map[string]int)}
+	servers := make([]*httptest.Server, n)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		c.addrs = append(c.addrs, "http://"+servers[i].Listener.Addr().String())
+	}
+	for i, srv := range servers {
+		self := c.addrs[i]
+		g := geecache.NewGroup(group, 2<<10, geecache.GetterFunc(func(key string) ([]byte, error) {
+			c.mu.Lock()
+			c.loads[self]++
+			c.mu.Unlock()
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+		pool := geecache.NewHTTPPool(self)
+		pool.Set(c.addrs...)
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		t.Cleanup(srv.Close)
+	}
+	return c
+}
+
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+	"Sam":  "567",
+	"a/b":  "slash",
+	"a b":  "space",
+}
+
+func TestGetAndExists(t *testing.T) {
+	c := startCluster(t, 3, "client-get", db)
+	cli := New(c.addrs)
+	ctx := context.Background()
+
+	if ok, err := cli.Exists(ctx, "client-get", "Tom"); err != nil || ok {
+		t.Fatalf("Exists before Get = %v, %v", ok, err)
+	}
+	for i := 0; i < 2; i++ {
+		for key, v := range db {
+			if got, err := cli.Get(ctx, "client-get", key); err != nil || string(got) != v {
+				t.Fatalf("Get(%q) = %q, %v", key, got, err)
+			}
+		}
+	}
+	// 客户端直接访问所属节点，每个key只加载一次
+	if n := c.totalLoads(); n != len(db) {
+		t.Fatalf("getter called %d times, expect %d", n, len(db))
+	}
+	if ok, err := cli.Exists(ctx, "client-get", "Tom"); err != nil || !ok {
+		t.Fatalf("Exists after Get = %v, %v", ok, err)
+	}
+	if ok, _ := cli.Exists(ctx, "client-get", "Unknown"); ok || c.totalLoads() != len(db) {
+		t.Fatal("Exists must not trigger a load")
+	}
+	if _, err := cli.Get(ctx, "client-get", "Unknown"); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	c := startCluster(t, 3, "client-multi", db)
+	cli := New(c.addrs)
+
+	keys := []string{"Tom", "Jack", "Sam", "Tom", "Unknown", "a/b"}
+	values, errs := cli.GetMulti(context.Background(), "client-multi", keys)
+	if len(values) != 4 || len(errs) != 1 {
+		t.Fatalf("got %d values and %d errors", len(values), len(errs))
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam", "a/b"} {
+		if string(values[key]) != db[key] {
+			t.Fatalf("values[%q] = %q", key, values[key])
+		}
+	}
+	if err := errs["Unknown"]; err == nil || !strings.Contains(err.Error(), "not exist") {
+		t.Fatalf("errs[Unknown] = %v", err)
+	}
+	if n := c.totalLoads(); n != 5 {
+		t.Fatalf("getter called %d times, expect 5", n)
+	}
+}
+
+func TestTimeoutAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	cli := New([]string{srv.URL}, WithTimeout(20*time.Millisecond), WithRetries(2))
+	start := time.Now()
+	if _, err := cli.Get(context.Background(), "g", "k"); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Fatalf("Get took %v despite timeout", d)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Fatalf("server called %d times, expect 3", calls)
+	}
+}
+
+func TestGetMultiStreamsAndRetriesLargeValues(t *testing.T) {
+	const size = 1 << 20
+	first := make(chan struct{})
+	srv := httptest.NewUnstartedServer(nil)
+	addr := "http://" + srv.Listener.Addr().String()
+	g := geecache.NewGroup("client-huge", 0, geecache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "k1" {
+			// 客户端必须在整个响应结束之前拿到k0
+			select {
+			case <-first:
+			case <-time.After(5 * time.Second):
+				return nil, fmt.Errorf("k0 was not delivered before k1 was loaded")
+			}
+		}
+		return []byte(strings.Repeat(key[1:], size)), nil
+	}), geecache.WithUnlimitedBytes())
+	pool := geecache.NewHTTPPool(addr, geecache.WithMaxBatchBytes(3*size))
+	pool.Set(addr)
+	g.RegisterPeers(pool)
+	srv.Config.Handler = pool
+	srv.Start()
+	defer srv.Close()
+
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+	}
+	var mu sync.Mutex
+	got := make(map[string]int)
+	New([]string{addr}).GetMultiFunc(context.Background(), "client-huge", keys, func(key string, value []byte, err error) {
+		if err != nil {
+			t.Errorf("%s: %v", key, err)
+			return
+		}
+		if len(value) != size || value[0] != key[1] {
+			t.Errorf("%s: wrong value of %d bytes", key, len(value))
+		}
+		mu.Lock()
+		got[key]++
+		mu.Unlock()
+		if key == "k0" {
+			close(first)
+		}
+	})
+	if len(got) != len(keys) {
+		t.Fatalf("got %d keys, want %d", len(got), len(keys))
+	}
+	for key, n := range got {
+		if n != 1 {
+			t.Fatalf("%s delivered %d times", key, n)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package geecache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// 编解码：调用方拿到ByteView后几乎总是立刻把它解码成结构体，GetInto把这一步收进group，
+// 按group配置的Codec（默认JSON）把缓存的值解码到dest；SetValue反过来用同一个Codec编码后写入。
+// 解码失败只影响这一次调用：缓存中保存的仍然是原始的字节，不会因为调用方传错了类型而被删除或改写
+
+// Codec 把值编码成缓存中保存的字节，以及反过来解码，可能被并发调用
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec 使用encoding/json编解码，是默认的Codec
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtoCodec 使用值自己的Marshal/Unmarshal方法编解码，值必须实现Message（protobuf生成的类型都实现了），
+// geecache本身不需要依赖protobuf
+var ProtoCodec Codec = protoCodec{}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(Message)
+	if !ok {
+		return nil, fmt.Errorf("geecache: %T does not implement Message", v)
+	}
+	return m.Marshal()
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(Message)
+	if !ok {
+		return fmt.Errorf("geecache: %T does not implement Message", v)
+	}
+	return m.Unmarshal(data)
+}
+
+// WithCodec 设置GetInto和SetValue使用的Codec，默认为JSONCodec
+func WithCodec(c Codec) GroupOption {
+	return func(g *Group) {
+		g.codec = c
+	}
+}
+
+func (g *Group) valueCodec() Codec {
+	if g.codec == nil {
+		return JSONCodec
+	}
+	return g.codec
+}
+
+// GetInto 读取key并用group的Codec解码到dest，dest通常是指针。解码失败时返回错误，缓存中的值不受影响
+func (g *Group) GetInto(ctx context.Context, key string, dest any) error {
+	v, err := g.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := g.valueCodec().Unmarshal(v.b, dest); err != nil {
+		return fmt.Errorf("geecache: decoding %q: %w", key, err)
+	}
+	return nil
+}
+
+// SetValue 用group的Codec编码v后写入key，见Set
+func (g *Group) SetValue(key string, v any) error {
+	b, err := g.valueCodec().Marshal(v)
+	if err != nil {
+		return fmt.Errorf("geecache: encoding %q: %w", key, err)
+	}
+	return g.Set(key, b)
+}
@@ -0,0 +1,70 @@
+package geecache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+type score struct {
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+func TestGetIntoJSON(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroup("codec-json", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte(`{"name":"` + key + `","score":630}`), nil
+	}))
+	ctx := context.Background()
+
+	var s score
+	if err := g.GetInto(ctx, "Tom", &s); err != nil || s != (score{"Tom", 630}) {
+		t.Fatalf("GetInto = %+v, %v", s, err)
+	}
+	// 类型不匹配：只有调用方得到错误，缓存中的原始字节保留
+	var n int
+	if err := g.GetInto(ctx, "Tom", &n); err == nil {
+		t.Fatal("GetInto decoded an object into an int")
+	}
+	if !g.CachedLocally("Tom") {
+		t.Fatal("decoding error evicted the cached value")
+	}
+	s = score{}
+	if err := g.GetInto(ctx, "Tom", &s); err != nil || s.Score != 630 || loads.Load() != 1 {
+		t.Fatalf("GetInto after mismatch = %+v, %v, loads=%d", s, err, loads.Load())
+	}
+
+	if err := g.SetValue("Jack", score{"Jack", 589}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get(ctx, "Jack"); v.String() != `{"name":"Jack","score":589}` {
+		t.Fatalf("SetValue stored %s", v)
+	}
+}
+
+func TestGetIntoProto(t *testing.T) {
+	g := NewGroup("codec-proto", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCodec(ProtoCodec))
+	ctx := context.Background()
+
+	var m upperMessage
+	if err := g.GetInto(ctx, "hello", &m); err != nil || m.text != "hello" {
+		t.Fatalf("GetInto = %q, %v", m.text, err)
+	}
+	var s score
+	if err := g.GetInto(ctx, "hello", &s); err == nil {
+		t.Fatal("ProtoCodec decoded into a type that is not a Message")
+	}
+	if err := g.SetValue("k", &upperMessage{text: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get(ctx, "k"); v.String() != "ABC" {
+		t.Fatalf("SetValue stored %s, want the Message's encoding", v)
+	}
+	if err := g.SetValue("k", score{}); err == nil {
+		t.Fatal("ProtoCodec encoded a type that is not a Message")
+	}
+}
@@ -1,7 +1,9 @@
 package consistenthash
 
 import (
+	"fmt"
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
 )
@@ -10,40 +12,255 @@ import (
 
 type Hash func(data []byte) uint32
 
+// 64位哈希函数，哈希空间更大，虚拟节点很多时也很少冲突，见New64
+
+type Hash64 func(data []byte) uint64
+
+// 把32位的哈希函数转换为Hash64，环上虚拟节点的顺序不变
+
+func To64(fn Hash) Hash64 {
+	return func(data []byte) uint64 {
+		return uint64(fn(data))
+	}
+}
+
+// 64位的FNV-1a哈希，New64的默认哈希函数
+
+func FNV64a(data []byte) uint64 {
+	hash := uint64(14695981039346656037)
+	for _, b := range data {
+		hash ^= uint64(b)
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// 负载函数，返回真实节点当前的负载（如正在处理的请求数），用于有界负载，见SetBoundedLoad
+
+type LoadFunc func(node string) int64
+
 type Map struct {
-	hash     Hash
-	replicas int            // 虚拟节点倍数
-	keys     []int          // 哈希环
-	hashMap  map[int]string // 虚拟节点--真实节点 映射表  （键：虚拟节点的哈希值，值：真实节点的名称）
+	hash     Hash64
+	replicas int                // 虚拟节点倍数
+	keys     []uint64           // 哈希环
+	hashMap  map[uint64]string  // 虚拟节点--真实节点 映射表  （键：虚拟节点的哈希值，值：真实节点的名称）
+	vnodes   map[string][]vnode // 真实节点--按编号排列的虚拟节点，个数为replicas×权重
+	bound    float64            // 有界负载的系数c
+	load     LoadFunc           // 为nil时没有开启有界负载
+}
+
+// 虚拟节点在环上的位置，attempt为0时名称是编号+真实节点名称，大于0表示因哈希冲突换过attempt次名称
+
+type vnode struct {
+	hash    uint64
+	attempt int
 }
 
+// 使用32位哈希函数fn，默认crc32，集群中所有节点以及client、ownership包必须使用相同的哈希函数
+
 func New(replicas int, fn Hash) *Map {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return New64(replicas, To64(fn))
+}
+
+// 与New相同，但使用64位哈希函数fn，默认FNV64a
+
+func New64(replicas int, fn Hash64) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		hashMap:  make(map[uint64]string),
+		vnodes:   make(map[string][]vnode),
 	}
 	if m.hash == nil {
-		m.hash = crc32.ChecksumIEEE
+		m.hash = FNV64a
 	}
 	return m
 }
 
 // 允许传入0/多个真实节点名称
 // 对于每个真实节点key，创建replicas倍数个虚拟节点，strconv.Itoa(i)：添加编号，区分不同的虚拟节点
-// m.hash 计算虚拟节点的哈希值，并添加到环上
+// m.hash 计算虚拟节点的哈希值，并添加到环上，哈希值冲突时见place
 // hashMap中添加虚拟--真实 的键值对
 // 环上哈希值排序
 
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
+		m.add(key, m.replicas)
+	}
+	m.sortKeys()
+}
+
+// 添加权重为weight的真实节点，它有replicas×weight个虚拟节点，因此负责的key大约是权重为1的节点的weight倍
+// 前replicas个虚拟节点与Add相同，调整权重时只有增减的虚拟节点上的key移动
+
+func (m *Map) AddWithWeight(key string, weight int) {
+	if weight <= 0 {
+		panic(fmt.Sprintf("consistenthash: weight %d for node %q is not positive", weight, key))
+	}
+	m.add(key, m.replicas*weight)
+	m.sortKeys()
+}
+
+// 把环上的真实节点设置为keys（权重都为1）：与当前的节点比较，只添加新的节点、删除不再存在的节点，
+// 没有变化的节点的虚拟节点保持不动，因此只有增删的节点上的key移动
+
+func (m *Map) SetNodes(keys []string) {
+	weights := make(map[string]int, len(keys))
+	for _, key := range keys {
+		weights[key] = 1
+	}
+	m.SetNodesWithWeights(weights)
+}
+
+// 与SetNodes相同，但按权重设置节点的虚拟节点数，权重变化的节点只增删相差的虚拟节点
+
+func (m *Map) SetNodesWithWeights(weights map[string]int) {
+	for key, weight := range weights {
+		if weight <= 0 {
+			panic(fmt.Sprintf("consistenthash: weight %d for node %q is not positive", weight, key))
+		}
+	}
+	removed := false
+	for key := range m.vnodes {
+		if n := m.replicas * weights[key]; n < len(m.vnodes[key]) {
+			m.remove(key, n)
+			removed = true
+		}
+	}
+	if removed {
+		m.prune()
+	}
+	for key, weight := range weights {
+		m.add(key, m.replicas*weight)
+	}
+	m.sortKeys()
+}
+
+// 为真实节点key添加虚拟节点，直到它有n个，已有的虚拟节点不变，调用方负责排序
+
+func (m *Map) add(key string, n int) {
+	for i := len(m.vnodes[key]); i < n; i++ {
+		m.vnodes[key] = append(m.vnodes[key], vnode{})
+		m.place(key, i, 0)
+	}
+}
+
+// 把真实节点key编号为i的虚拟节点放到环上，从第attempt次尝试开始。哈希值已被其他虚拟节点占用时，
+// 较小的虚拟节点（先比较真实节点名称，再比较编号）得到这个位置，另一个在名称后加上"#attempt"重新计算哈希值，
+// 因此发生冲突时每个真实节点的虚拟节点数仍然正确，结果也与添加节点的顺序无关
+
+// 一个虚拟节点最多换名称的次数，超过时哈希函数几乎不随输入变化
+const maxAttempts = 100
+
+func (m *Map) place(key string, i, attempt int) {
+	for {
+		name := strconv.Itoa(i) + key
+		if attempt > 0 {
+			name += "#" + strconv.Itoa(attempt)
+		}
+		hash := m.hash([]byte(name))
+		owner, taken := m.hashMap[hash]
+		if !taken {
 			m.hashMap[hash] = key
+			m.vnodes[key][i] = vnode{hash: hash, attempt: attempt}
+			m.keys = append(m.keys, hash)
+			return
+		}
+		j := m.index(owner, hash)
+		if owner < key || (owner == key && j < i) {
+			if attempt++; attempt > maxAttempts {
+				panic(fmt.Sprintf("consistenthash: virtual node %d of %q collides %d times, the hash function is unsuitable", i, key, maxAttempts))
+			}
+			continue
 		}
+		// 抢占这个位置，被挤走的虚拟节点继续尝试下一个名称
+		m.hashMap[hash] = key
+		m.vnodes[key][i] = vnode{hash: hash, attempt: attempt}
+		key, i, attempt = owner, j, m.vnodes[owner][j].attempt+1
 	}
-	sort.Ints(m.keys)
+}
+
+// 返回真实节点key落在hash上的虚拟节点的编号
+
+func (m *Map) index(key string, hash uint64) int {
+	for i, v := range m.vnodes[key] {
+		if v.hash == hash {
+			return i
+		}
+	}
+	panic("consistenthash: virtual node not found")
+}
+
+// 从hashMap中删除真实节点key编号不小于from的虚拟节点，调用方负责prune
+
+func (m *Map) remove(key string, from int) {
+	for _, v := range m.vnodes[key][from:] {
+		delete(m.hashMap, v.hash)
+	}
+	if from == 0 {
+		delete(m.vnodes, key)
+	} else {
+		m.vnodes[key] = m.vnodes[key][:from]
+	}
+}
+
+// 从环上去掉hashMap中已经没有的虚拟节点，原地过滤，环仍然有序。
+// 删除的虚拟节点可能挤走过其他虚拟节点，这时按现有的节点重新放置所有虚拟节点，使结果与从头添加这些节点相同
+
+func (m *Map) prune() {
+	keys := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; ok {
+			keys = append(keys, hash)
+		}
+	}
+	m.keys = keys
+	if m.Collisions() == 0 {
+		return
+	}
+	counts := make(map[string]int, len(m.vnodes))
+	for key, vs := range m.vnodes {
+		counts[key] = len(vs)
+	}
+	m.keys = m.keys[:0]
+	m.hashMap = make(map[uint64]string, len(m.hashMap))
+	m.vnodes = make(map[string][]vnode, len(counts))
+	for key, n := range counts {
+		m.add(key, n)
+	}
+	m.sortKeys()
+}
+
+// 返回因哈希冲突换过名称的虚拟节点数，用于检查哈希函数是否合适
+
+func (m *Map) Collisions() int {
+	n := 0
+	for _, vs := range m.vnodes {
+		for _, v := range vs {
+			if v.attempt > 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (m *Map) sortKeys() {
+	sort.Slice(m.keys, func(i, j int) bool { return m.keys[i] < m.keys[j] })
+}
+
+// 删除真实节点key的所有虚拟节点，原来落在这些虚拟节点上的key顺时针交给下一个虚拟节点，其他key不受影响
+// key不在环上时什么也不做；删除最后一个节点后Get返回""
+
+func (m *Map) Remove(key string) {
+	if _, ok := m.vnodes[key]; !ok {
+		return
+	}
+	m.remove(key, 0)
+	m.prune()
 }
 
 // 选择节点
@@ -53,7 +270,7 @@ func (m *Map) Get(key string) string {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key))) // 计算key的哈希值
+	hash := m.hash([]byte(key)) // 计算key的哈希值
 
 	// 顺时针找到第一个匹配的虚拟节点的下标idx
 	// search会找到【0，n）第一个符合条件的index， 如果没有，返回n
@@ -65,3 +282,75 @@ func (m *Map) Get(key string) string {
 
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// 从key的哈希值开始顺时针遍历哈希环，跳过已经选中的真实节点，返回最多n个不同的真实节点，第一个就是Get的结果
+// 环上的真实节点不足n个时返回全部节点；结果只取决于环的内容
+
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(m.vnodes))
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// 开启有界负载（consistent hashing with bounded loads）：GetBounded在key的节点负载达到c×平均负载时改为顺时针的下一个低于上限的节点，
+// 避免热点key集中的节点过载。c必须大于1，越接近1负载越均匀，但越多的请求离开原来的节点；load为nil时关闭，Get不受影响
+
+func (m *Map) SetBoundedLoad(c float64, load LoadFunc) {
+	if load != nil && c <= 1 {
+		panic(fmt.Sprintf("consistenthash: bounded load factor %v is not greater than 1", c))
+	}
+	m.bound, m.load = c, load
+}
+
+// 有界负载下选择节点：上限为ceil(c×(总负载+1)/节点数)，从key的节点开始顺时针找第一个负载低于上限的节点。
+// 没有开启有界负载时与Get相同。结果随负载变化，只用于可以由任意节点处理的请求（如读取），需要固定节点的请求（如写入）应当使用Get
+
+func (m *Map) GetBounded(key string) string {
+	if m.load == nil || len(m.keys) == 0 {
+		return m.Get(key)
+	}
+	var total int64
+	for node := range m.vnodes {
+		total += m.load(node)
+	}
+	limit := int64(math.Ceil(m.bound * float64(total+1) / float64(len(m.vnodes))))
+
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	checked := make([]string, 0, len(m.vnodes))
+	for i := 0; i < len(m.keys) && len(checked) < len(m.vnodes); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if contains(checked, node) {
+			continue
+		}
+		if m.load(node) < limit {
+			return node
+		}
+		checked = append(checked, node)
+	}
+	return m.Get(key) // 负载函数在遍历期间变化时可能都不低于上限
+}
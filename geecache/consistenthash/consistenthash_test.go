@@ -1,6 +1,9 @@
 package consistenthash
 
 import (
+	"hash/crc32"
+	"math"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -35,3 +38,329 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2", "8")
+	hash.Remove("8")
+	hash.Remove("9") // 不在环上的节点
+
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+
+	hash.Remove("6")
+	hash.Remove("4")
+	hash.Remove("2")
+	if got := hash.Get("11"); got != "" {
+		t.Fatalf("Get on an empty ring = %q, want empty", got)
+	}
+	hash.Add("4")
+	if got := hash.Get("11"); got != "4" {
+		t.Fatalf("Get after re-adding = %q, want 4", got)
+	}
+}
+
+func TestRemoveDistribution(t *testing.T) {
+	hash := New(50, nil)
+	nodes := []string{"node0", "node1", "node2", "node3", "node4"}
+	hash.Add(nodes...)
+	before := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := "key" + strconv.Itoa(i)
+		before[key] = hash.Get(key)
+	}
+
+	hash.Remove("node2")
+	moved := 0
+	for key, owner := range before {
+		got := hash.Get(key)
+		if got == "node2" {
+			t.Fatalf("%s still routed to the removed node", key)
+		}
+		if owner != "node2" && got != owner {
+			t.Fatalf("%s moved from %s to %s, only node2's keys should move", key, owner, got)
+		}
+		if got != owner {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatal("no keys were owned by node2")
+	}
+}
+
+func TestWeightedDistribution(t *testing.T) {
+	hash := New(100, nil)
+	weights := map[string]int{"node0": 1, "node1": 1, "node2": 1, "node3": 1, "big0": 4, "big1": 4}
+	total := 0
+	for _, node := range []string{"node0", "node1", "node2", "node3", "big0", "big1"} {
+		hash.AddWithWeight(node, weights[node])
+		total += weights[node]
+	}
+
+	const n = 200000
+	owned := make(map[string]int)
+	for i := 0; i < n; i++ {
+		owned[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	for node, w := range weights {
+		share := float64(owned[node]) / n
+		want := float64(w) / float64(total)
+		if share < want-0.03 || share > want+0.03 {
+			t.Errorf("%s (weight %d) owns %.3f of the keys, want about %.3f", node, w, share, want)
+		}
+	}
+
+	// Remove删除按权重放大的全部虚拟节点
+	hash.Remove("big0")
+	for i := 0; i < n; i += 100 {
+		if got := hash.Get("key" + strconv.Itoa(i)); got == "big0" {
+			t.Fatal("keys still routed to the removed weighted node")
+		}
+	}
+	if len(hash.keys) != 100*(total-4) || len(hash.hashMap) != len(hash.keys) {
+		t.Fatalf("ring has %d virtual nodes (%d mapped) after Remove, want %d", len(hash.keys), len(hash.hashMap), 100*(total-4))
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	if got := hash.GetN("11", 2); got != nil {
+		t.Fatalf("GetN on an empty ring = %v, want nil", got)
+	}
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key  string
+		n    int
+		want []string
+	}{
+		{"11", 2, []string{"2", "4"}},
+		{"23", 3, []string{"4", "6", "2"}},
+		{"27", 3, []string{"2", "4", "6"}}, // 越过环的末尾
+		{"27", 5, []string{"2", "4", "6"}}, // n大于节点数
+		{"2", 1, []string{"2"}},
+		{"2", 0, nil},
+	}
+	for _, tc := range testCases {
+		if got := hash.GetN(tc.key, tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GetN(%s, %d) = %v, want %v", tc.key, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestGetNMatchesGet(t *testing.T) {
+	nodes := []string{"node0", "node1", "node2", "node3", "node4"}
+	a, b := New(50, nil), New(50, nil)
+	a.Add(nodes...)
+	for i := len(nodes) - 1; i >= 0; i-- {
+		b.Add(nodes[i])
+	}
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		got := a.GetN(key, 3)
+		if len(got) != 3 || got[0] != a.Get(key) || got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+			t.Fatalf("GetN(%s, 3) = %v, want 3 distinct nodes starting with %s", key, got, a.Get(key))
+		}
+		// 结果只取决于环的内容，与添加顺序无关
+		if other := b.GetN(key, 3); !reflect.DeepEqual(got, other) {
+			t.Fatalf("GetN(%s, 3) = %v on one ring, %v on an identical one", key, got, other)
+		}
+	}
+}
+
+func TestSetNodes(t *testing.T) {
+	hash := New(50, nil)
+	hash.SetNodes([]string{"node0", "node1", "node2"})
+	before := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := "key" + strconv.Itoa(i)
+		before[key] = hash.Get(key)
+	}
+
+	// 换掉一个节点：只有node1的key和新节点node3的key移动
+	hash.SetNodes([]string{"node2", "node0", "node3"})
+	fresh := New(50, nil)
+	fresh.Add("node0", "node2", "node3")
+	for key, was := range before {
+		got := hash.Get(key)
+		if got != fresh.Get(key) {
+			t.Fatalf("%s routed to %s, a freshly built ring says %s", key, got, fresh.Get(key))
+		}
+		if was != "node1" && got != was && got != "node3" {
+			t.Fatalf("%s moved from %s to %s", key, was, got)
+		}
+	}
+	if len(hash.keys) != 150 || len(hash.hashMap) != 150 {
+		t.Fatalf("ring has %d virtual nodes (%d mapped), want 150", len(hash.keys), len(hash.hashMap))
+	}
+
+	// 调整权重只增删相差的虚拟节点
+	hash.SetNodesWithWeights(map[string]int{"node0": 2, "node2": 1, "node3": 1})
+	if len(hash.keys) != 200 {
+		t.Fatalf("ring has %d virtual nodes after raising a weight, want 200", len(hash.keys))
+	}
+	hash.SetNodes([]string{"node0", "node2", "node3"})
+	for key := range before {
+		if hash.Get(key) != fresh.Get(key) {
+			t.Fatalf("%s routed to %s after restoring the weight, want %s", key, hash.Get(key), fresh.Get(key))
+		}
+	}
+
+	hash.SetNodes(nil)
+	if got := hash.Get("key1"); got != "" || len(hash.keys) != 0 {
+		t.Fatalf("Get after SetNodes(nil) = %q with %d virtual nodes", got, len(hash.keys))
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	nodes := []string{"node0", "node1", "node2", "node3", "node4"}
+	// 一半的请求是同一个热点key，其余分散在1000个key上；请求一直不结束，负载只增不减
+	var requests []string
+	for i := 0; i < 10000; i++ {
+		requests = append(requests, "hot", "key"+strconv.Itoa(i%1000))
+	}
+	const warmup = 1000 // 上限向上取整，请求很少时比值可能超过c，之后最多超出节点数/warmup
+	run := func(c float64) (maxRatio float64) {
+		hash := New(50, nil)
+		hash.Add(nodes...)
+		loads := make(map[string]int64)
+		if c > 0 {
+			hash.SetBoundedLoad(c, func(node string) int64 { return loads[node] })
+		}
+		var max int64
+		for i, key := range requests {
+			node := hash.GetBounded(key)
+			loads[node]++
+			if loads[node] > max {
+				max = loads[node]
+			}
+			if i+1 >= warmup {
+				maxRatio = math.Max(maxRatio, float64(max)*float64(len(nodes))/float64(i+1))
+			}
+		}
+		return maxRatio
+	}
+
+	if ratio := run(0); ratio < 2 {
+		t.Fatalf("unbounded max/mean load = %.2f, the key distribution is not skewed enough", ratio)
+	}
+	for _, c := range []float64{1.25, 1.5, 2} {
+		if ratio := run(c); ratio > c+float64(len(nodes))/warmup {
+			t.Errorf("c=%v: max/mean load reached %.3f", c, ratio)
+		}
+	}
+
+	// 负载不高时与Get相同
+	hash := New(50, nil)
+	hash.Add(nodes...)
+	hash.SetBoundedLoad(1.25, func(string) int64 { return 0 })
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if hash.GetBounded(key) != hash.Get(key) {
+			t.Fatalf("GetBounded(%s) left an idle owner", key)
+		}
+	}
+}
+
+// stubHash 按表返回哈希值，表中没有的输入返回它的crc32
+func stubHash(table map[string]uint64) Hash64 {
+	return func(data []byte) uint64 {
+		if h, ok := table[string(data)]; ok {
+			return h
+		}
+		return uint64(crc32.ChecksumIEEE(data))
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	// a和b的第0个虚拟节点冲突，b的第0个与第1个虚拟节点也冲突
+	table := map[string]uint64{"0a": 10, "0b": 10, "1b": 10, "0b#1": 20, "1b#1": 20, "1b#2": 30, "1a": 40}
+	build := func(nodes ...string) *Map {
+		m := New64(2, stubHash(table))
+		m.Add(nodes...)
+		return m
+	}
+	ab, ba := build("a", "b"), build("b", "a")
+	for _, m := range []*Map{ab, ba} {
+		if !reflect.DeepEqual(m.keys, []uint64{10, 20, 30, 40}) {
+			t.Fatalf("ring = %v, want every virtual node on its own slot", m.keys)
+		}
+		// 名称较小的a保留冲突的位置，b的两个虚拟节点依次换名称
+		want := map[uint64]string{10: "a", 20: "b", 30: "b", 40: "a"}
+		if !reflect.DeepEqual(m.hashMap, want) {
+			t.Fatalf("hashMap = %v, want %v", m.hashMap, want)
+		}
+		if n := m.Collisions(); n != 2 {
+			t.Fatalf("Collisions = %d, want 2", n)
+		}
+	}
+
+	// 删除a后b回到不冲突时的位置，与只添加b相同
+	ab.Remove("a")
+	if b := build("b"); !reflect.DeepEqual(ab.hashMap, b.hashMap) || !reflect.DeepEqual(ab.keys, b.keys) {
+		t.Fatalf("ring after Remove = %v %v, want %v %v", ab.keys, ab.hashMap, b.keys, b.hashMap)
+	}
+	if n := ab.Collisions(); n != 1 {
+		t.Fatalf("Collisions after Remove = %d, want 1 (b with itself)", n)
+	}
+	ab.Remove("b")
+	if len(ab.keys) != 0 || len(ab.hashMap) != 0 || ab.Get("x") != "" {
+		t.Fatalf("ring not empty after removing every node: %v", ab.keys)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Add accepted a constant hash function")
+			}
+		}()
+		m := New64(2, func([]byte) uint64 { return 1 })
+		m.Add("a")
+	}()
+}
+
+func TestHash64(t *testing.T) {
+	// To64保持crc32的哈希环不变
+	a, b := New(50, nil), New64(50, To64(crc32.ChecksumIEEE))
+	a.Add("node0", "node1", "node2")
+	b.Add("node0", "node1", "node2")
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if a.Get(key) != b.Get(key) {
+			t.Fatalf("Get(%s) differs between New and New64 with To64", key)
+		}
+	}
+
+	// 64位的默认哈希函数：大量虚拟节点没有冲突，key的分布大致均匀
+	m := New64(1000, nil)
+	nodes := []string{"node0", "node1", "node2", "node3"}
+	m.Add(nodes...)
+	if n := m.Collisions(); n != 0 || len(m.keys) != 4000 {
+		t.Fatalf("%d collisions, %d virtual nodes", n, len(m.keys))
+	}
+	owned := make(map[string]int)
+	for i := 0; i < 40000; i++ {
+		owned[m.Get("key"+strconv.Itoa(i))]++
+	}
+	for _, node := range nodes {
+		if share := float64(owned[node]) / 40000; share < 0.2 || share > 0.3 {
+			t.Errorf("%s owns %.3f of the keys", node, share)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package geecache
+
+import (
+	"fmt"
+)
+
+// 删除：数据源中的值改变后，用Delete让缓存中的旧值失效，而不必等它被淘汰。
+// 本节点的mainCache和hotCache中的key都会被删除；key由其他节点负责时，再通知那个节点（PeerRemover）删除。
+// 其他节点hotCache中的副本不会被通知，需要整个集群都失效时使用RemovePrefix。
+// 与Set一样，Delete之前开始的加载不会把旧值写回缓存（它们的调用方仍然得到那个值），之后的读取也不会加入这些加载，而是重新加载
+
+// Delete 删除key，key不存在时同样返回nil。维护期间删除排队到退出维护模式时执行，届时通知失败只记录日志
+func (g *Group) Delete(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	var err error
+	queued, qerr := g.mutate(func() {
+		if err = g.delete(g.cacheKey(key)); err != nil {
+			g.logger().Errorf("Failed to delete %q: %v", key, err)
+		}
+	})
+	if qerr != nil || queued {
+		return qerr
+	}
+	return err
+}
+
+func (g *Group) delete(key string) error {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.forgetLoads(key)
+	g.forgetNotFound(key)
+	if g.peers == nil {
+		return nil
+	}
+	peer, ok := g.peers.PickPeer(key)
+	if !ok {
+		return nil
+	}
+	r, ok := peer.(PeerRemover)
+	if !ok {
+		return fmt.Errorf("geecache: peer for key %q does not support Delete", key)
+	}
+	return r.Remove(g.name, key)
+}
+
+// DeletePrefix 删除本节点mainCache和hotCache中所有以prefix开头的key，返回删除的数量，不通知其他节点（整个集群使用RemovePrefix）。
+// 与RemovePrefix不同，匹配的记录再多也会全部扫描删除，不改为惰性失效，返回值是准确的；
+// 扫描分块进行，每块之间释放锁，期间的读写不会被长时间阻塞。被删除的记录以EvictRemoved调用淘汰回调。
+// 维护期间删除排队到退出维护模式时执行，返回0。开启了WithKeyHashing时同RemovePrefix，不做任何删除并返回0
+func (g *Group) DeletePrefix(prefix string) int {
+	if g.keyHash != nil {
+		g.logger().Errorf("Failed to delete prefix %q: %v", prefix, ErrPrefixWithKeyHashing)
+		return 0
+	}
+	n := 0
+	queued, err := g.mutate(func() {
+		n = g.removeLocalPrefix(prefix, false)
+	})
+	if err != nil {
+		g.logger().Errorf("Failed to queue deletion of prefix %q: %v", prefix, err)
+	}
+	if queued || err != nil {
+		return 0
+	}
+	return n
+}
+
+// removeLocally 从本地缓存中删除其他节点转发来的key，不再转发
+func (g *Group) removeLocally(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	_, err := g.mutate(func() {
+		g.mainCache.remove(key)
+		g.hotCache.remove(key)
+		g.forgetLoads(key)
+		g.forgetNotFound(key)
+	})
+	return err
+}
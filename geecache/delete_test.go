@@ -0,0 +1,207 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	silenceLog(t)
+	var mu sync.Mutex
+	db := map[string]string{"k": "v1"}
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return []byte(db[key]), nil
+	})
+
+	// 三个进程内节点，使用同名group
+	const name = "delete"
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 3; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<10, getter)
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	// 找到一个由B负责的key
+	a, b := groups[0], groups[1]
+	key := ""
+	for i := 0; key == ""; i++ {
+		k := string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if pools[0].peers.Get(k) == urls[1] {
+			key = k
+		}
+	}
+	mu.Lock()
+	db[key] = "v1"
+	mu.Unlock()
+
+	if v, err := a.Get(context.Background(), key); err != nil || v.String() != "v1" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if !b.CachedLocally(key) {
+		t.Fatal("owner did not cache the key")
+	}
+
+	// 数据源改变后在A上删除，B上的旧值也被删除
+	mu.Lock()
+	db[key] = "v2"
+	mu.Unlock()
+	if err := a.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if b.CachedLocally(key) {
+		t.Fatal("Delete on A did not invalidate the owner B")
+	}
+	if v, err := a.Get(context.Background(), key); err != nil || v.String() != "v2" {
+		t.Fatalf("Get after Delete = %q, %v", v, err)
+	}
+
+	// 删除不存在的key同样成功
+	if err := a.Delete("missing-" + key); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Delete(""); err == nil {
+		t.Fatal("Delete with an empty key succeeded")
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	var removed atomic.Int64 // 以EvictRemoved调用回调的次数
+	g := NewGroup("delete-prefix", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithUnlimitedBytes(), WithEvictionCallback(func(key string, _ ByteView, reason EvictReason) {
+		if reason == EvictRemoved {
+			removed.Add(1)
+		}
+	}))
+	g.mainCache.prefixThreshold = 50 // DeletePrefix不改为惰性失效
+	for u := 0; u < 10; u++ {
+		for i := 0; i < 100; i++ {
+			g.Get(ctx, fmt.Sprintf("user:%d:item%d", u, i))
+		}
+	}
+	for i := 0; i < 500; i++ {
+		g.Get(ctx, fmt.Sprintf("order:%d", i))
+	}
+
+	// 删除期间一直有并发的读取
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := r; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := g.Get(ctx, fmt.Sprintf("order:%d", i%500)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(r)
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	if n := g.DeletePrefix("nobody:"); n != 0 {
+		t.Fatalf("DeletePrefix(nobody:) = %d, want 0", n)
+	}
+	if n := g.DeletePrefix("user:3:"); n != 100 {
+		t.Fatalf("DeletePrefix(user:3:) = %d, want 100", n)
+	}
+	waitFor(t, func() bool { return removed.Load() == 100 })
+	for i := 0; i < 100; i++ {
+		if g.CachedLocally(fmt.Sprintf("user:3:item%d", i)) {
+			t.Fatalf("user:3:item%d still cached", i)
+		}
+	}
+	if !g.CachedLocally("user:4:item0") || !g.CachedLocally("user:2:item99") {
+		t.Fatal("DeletePrefix removed keys outside the prefix")
+	}
+
+	// 匹配所有记录：并发读取重新写入的order:*可能留下，user:*全部删除
+	n := g.DeletePrefix("")
+	if n < 900 {
+		t.Fatalf("DeletePrefix(\"\") = %d, want at least the 900 remaining user entries", n)
+	}
+	waitFor(t, func() bool { return removed.Load() == int64(100+n) })
+	for _, key := range g.mainCache.keys() {
+		if strings.HasPrefix(key, "user:") {
+			t.Fatalf("%s still cached after DeletePrefix(\"\")", key)
+		}
+	}
+}
+
+// Delete之后的读取不加入之前开始的加载，那次加载的旧值也不会写回缓存
+func TestDeleteDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	started := []chan struct{}{make(chan struct{}), make(chan struct{})}
+	release := []chan struct{}{make(chan struct{}), make(chan struct{})}
+	g := NewGroup("delete-during-load", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		n := calls.Add(1) - 1
+		close(started[n])
+		<-release[n]
+		return []byte([]string{"stale", "fresh"}[n]), nil
+	}))
+
+	get := func() <-chan string {
+		ch := make(chan string, 1)
+		go func() {
+			v, err := g.Get(ctx, "k")
+			if err != nil {
+				t.Error(err)
+			}
+			ch <- v.String()
+		}()
+		return ch
+	}
+	first := get()
+	<-started[0]
+	g.Delete("k")
+	second := get()
+	<-started[1] // 没有加入第一次加载，而是重新加载
+
+	close(release[0])
+	if v := <-first; v != "stale" {
+		t.Fatalf("first caller got %q, want the value its load returned", v)
+	}
+	if g.CachedLocally("k") {
+		t.Fatal("load started before Delete wrote its value back")
+	}
+	close(release[1])
+	if v := <-second; v != "fresh" {
+		t.Fatalf("caller after Delete got %q, want fresh", v)
+	}
+	if v, _ := g.Get(ctx, "k"); v.String() != "fresh" {
+		t.Fatalf("cached value = %q, want fresh", v.String())
+	}
+}
@@ -0,0 +1,46 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+)
+
+// 存在检查：去重等场景只需要知道key是否已经被缓存，为此取回可能很大的值再丢弃是浪费。
+// Exists先查本节点的mainCache和hotCache，再用HEAD请求询问key的所属节点，两者都不会调用回调函数：
+// 返回false表示没有被缓存，而不是数据源中没有这个key。负缓存的墓碑不算作存在
+
+// Exists 判断key是否已经缓存在本节点或它的所属节点上，不会触发加载。
+// 所属节点的PeerGetter没有实现存在检查时返回错误
+func (g *Group) Exists(ctx context.Context, key string) (bool, error) {
+	if key == "" {
+		return false, fmt.Errorf("key is required")
+	}
+	if g.destroyed.Load() {
+		return false, ErrGroupDestroyed
+	}
+	key = g.cacheKey(key)
+	if g.existsLocally(key) {
+		return true, nil
+	}
+	if g.peers == nil {
+		return false, nil
+	}
+	peer, ok := g.peers.PickPeer(key)
+	if !ok {
+		return false, nil
+	}
+	ep, ok := peer.(existsPeerGetter)
+	if !ok {
+		return false, fmt.Errorf("geecache: peer for key %q does not support Exists", key)
+	}
+	return ep.Exists(ctx, g.name, key)
+}
+
+// existsLocally 判断本节点的mainCache或hotCache中是否有key的值（不包括墓碑），不计入命中统计
+func (g *Group) existsLocally(key string) bool {
+	v, ok := g.mainCache.peek(key)
+	if !ok {
+		v, ok = g.hotCache.peek(key)
+	}
+	return ok && v.err == nil
+}
@@ -0,0 +1,105 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExistsLocal(t *testing.T) {
+	var calls atomic.Int32
+	g := NewGroup("exists", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls.Add(1)
+		if key == "missing" {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return []byte(key), nil
+	}), WithNegativeTTL(time.Minute))
+	ctx := context.Background()
+
+	if ok, err := g.Exists(ctx, "k"); ok || err != nil {
+		t.Fatalf("Exists before Get = %v, %v, want false", ok, err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("Exists called the getter %d times", n)
+	}
+	g.Get(ctx, "k")
+	g.Get(ctx, "missing") // 墓碑不算存在
+	if ok, _ := g.Exists(ctx, "k"); !ok {
+		t.Fatal("Exists = false for a cached key")
+	}
+	if ok, _ := g.Exists(ctx, "missing"); ok {
+		t.Fatal("Exists = true for a negative-cache tombstone")
+	}
+	if ok, err := g.Exists(ctx, "k"); !ok || err != nil || calls.Load() != 2 {
+		t.Fatalf("Exists = %v, %v, calls = %d", ok, err, calls.Load())
+	}
+	if _, err := g.Exists(ctx, ""); err == nil {
+		t.Fatal("Exists accepted an empty key")
+	}
+
+	// 所属节点不支持存在检查时返回错误，而不是猜测
+	remote := NewGroup("exists-unsupported", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	remote.RegisterPeers(fakePeers{&echoPeer{}})
+	if _, err := remote.Exists(ctx, "k"); err == nil {
+		t.Fatal("Exists on a peer without existence checks returned no error")
+	}
+}
+
+func TestExistsOnPeer(t *testing.T) {
+	silenceLog(t)
+	const name = "exists-peer"
+	var loads atomic.Int32
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			loads.Add(1)
+			return make([]byte, 64<<10), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("k%d", i); pools[0].peers.Get(k) == urls[1] {
+			key = k
+		}
+	}
+	a, b := groups[0], groups[1]
+	ctx := context.Background()
+
+	if ok, err := a.Exists(ctx, key); ok || err != nil {
+		t.Fatalf("Exists = %v, %v, want false before anyone loaded it", ok, err)
+	}
+	b.Get(ctx, key)
+	if ok, err := a.Exists(ctx, key); !ok || err != nil {
+		t.Fatalf("Exists = %v, %v, want true once the owner cached it", ok, err)
+	}
+	// 存在检查既不调用回调函数，也不把值取回到A
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want only B's Get", n)
+	}
+	if a.existsLocally(key) {
+		t.Fatal("Exists transferred the value into A's caches")
+	}
+}
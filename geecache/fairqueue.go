@@ -0,0 +1,148 @@
+package geecache
+
+import (
+	"context"
+	"sync"
+)
+
+// fairQueue 限制对单个远程节点的并发请求数
+// 达到上限后，等待的请求按所属group分别排队，释放名额时以加权轮询的方式在各group之间挑选下一个请求，而不是先进先出
+// 这样某个group流量暴涨时也不会独占与该节点的连接，把其他group饿死
+
+type fairQueue struct {
+	mu      sync.Mutex
+	limit   int                        // 最大并发请求数
+	active  int                        // 正在进行中的请求数
+	weight  func(group string) int     // 每个group在一轮中可连续出队的次数
+	waiting map[string][]chan struct{} // 各group等待中的请求，先进先出
+	ring    []string                   // 有请求在等待的group，按加入顺序轮询
+	next    int                        // 当前轮到的group在ring中的下标
+	credit  int                        // 当前group本轮剩余的出队次数
+}
+
+func newFairQueue(limit int, weight func(group string) int) *fairQueue {
+	return &fairQueue{
+		limit:   limit,
+		weight:  weight,
+		waiting: make(map[string][]chan struct{}),
+	}
+}
+
+// acquire 为group的一次请求申请名额，名额用完时阻塞等待，直到拿到名额或ctx结束
+func (q *fairQueue) acquire(ctx context.Context, group string) error {
+	q.mu.Lock()
+	// 有请求在等待时名额一定已经用完（release会把名额直接转交给等待者），所以这里不会插队
+	if q.active < q.limit {
+		q.active++
+		q.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	if len(q.waiting[group]) == 0 {
+		q.ring = append(q.ring, group)
+	}
+	q.waiting[group] = append(q.waiting[group], ch)
+	q.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-ch:
+			q.releaseLocked() // 离开的同时拿到了名额，转交给下一个请求
+		default:
+			q.leave(group, ch)
+		}
+		return ctx.Err()
+	}
+}
+
+// leave 把放弃等待的请求移出队列，调用方需持有q.mu
+func (q *fairQueue) leave(group string, ch chan struct{}) {
+	chs := q.waiting[group]
+	for i, c := range chs {
+		if c == ch {
+			q.waiting[group] = append(chs[:i:i], chs[i+1:]...)
+			break
+		}
+	}
+	if len(q.waiting[group]) > 0 {
+		return
+	}
+	delete(q.waiting, group)
+	for i, name := range q.ring {
+		if name != group {
+			continue
+		}
+		q.ring = append(q.ring[:i], q.ring[i+1:]...)
+		if i < q.next {
+			q.next--
+		} else if i == q.next {
+			q.credit = 0 // 正轮到的group离开了，next自然指向下一个group
+		}
+		return
+	}
+}
+
+// release 归还名额，若有请求在等待，则按加权轮询挑出下一个请求并把名额转交给它
+func (q *fairQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked()
+}
+
+func (q *fairQueue) releaseLocked() {
+	if len(q.ring) == 0 {
+		q.active--
+		return
+	}
+	if q.next >= len(q.ring) {
+		q.next = 0
+	}
+	group := q.ring[q.next]
+	if q.credit <= 0 {
+		q.credit = q.weight(group)
+	}
+	ch := q.waiting[group][0]
+	q.waiting[group] = q.waiting[group][1:]
+	q.credit--
+	if len(q.waiting[group]) == 0 {
+		// 该group已经没有等待的请求，移出轮询环，next自然指向下一个group
+		delete(q.waiting, group)
+		q.ring = append(q.ring[:q.next], q.ring[q.next+1:]...)
+		q.credit = 0
+	} else if q.credit == 0 {
+		q.next++
+	}
+	close(ch)
+}
+
+// PeerQueueStats 是单个远程节点请求队列的快照
+type PeerQueueStats struct {
+	Active  int            // 正在进行中的请求数
+	Waiting map[string]int // 各group排队等待的请求数
+}
+
+// utilization 返回进行中和等待中的请求数占上限的比例，可能大于1
+func (q *fairQueue) utilization() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.active
+	for _, chs := range q.waiting {
+		n += len(chs)
+	}
+	return float64(n) / float64(q.limit)
+}
+
+func (q *fairQueue) stats() PeerQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := PeerQueueStats{Active: q.active, Waiting: make(map[string]int, len(q.waiting))}
+	for group, chs := range q.waiting {
+		s.Waiting[group] = len(chs)
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package geecache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// 运行时功能开关：某个可选功能在线上出问题时，可以通过管理接口关闭它，而不需要重启进程、丢失缓存
+// 每个开关是一个原子布尔值，功能在每次新操作开始时检查它，所以切换立即对新操作生效，已经开始的操作照常完成
+// 开关只保存在内存中，重启后恢复为默认值
+
+// Group上的开关
+const (
+	FlagEarlyRefresh = "early_refresh" // XFetch提前刷新，见WithEarlyRefresh
+)
+
+// HTTPPool上的开关
+const (
+	FlagPeerFairQueue = "peer_fair_queue" // 对远程节点的并发限制与公平排队，见WithPeerConcurrency
+)
+
+// Flags 是一组具名的功能开关
+type Flags struct {
+	mu sync.RWMutex
+	m  map[string]*atomic.Bool
+}
+
+// register 注册一个开关并返回它，功能代码直接持有返回值以便无锁地检查
+func (f *Flags) register(name string, enabled bool) *atomic.Bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.m == nil {
+		f.m = make(map[string]*atomic.Bool)
+	}
+	b := new(atomic.Bool)
+	b.Store(enabled)
+	f.m[name] = b
+	return b
+}
+
+// Enabled 返回开关的当前状态，未注册的开关视为关闭
+func (f *Flags) Enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	b, ok := f.m[name]
+	return ok && b.Load()
+}
+
+// Set 打开或关闭一个已注册的开关
+func (f *Flags) Set(name string, enabled bool) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	b, ok := f.m[name]
+	if !ok {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+	b.Store(enabled)
+	return nil
+}
+
+// Snapshot 返回所有开关的当前状态
+func (f *Flags) Snapshot() map[string]bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	s := make(map[string]bool, len(f.m))
+	for name, b := range f.m {
+		s[name] = b.Load()
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 整个集群清空：错误的数据发布之后，FlushAll清空本节点的mainCache和hotCache，并通知所有远程节点（而不只是key的所属节点）清空。
+// 清空可以重复执行。正在进行的加载不受影响，结束后照常写回，之后的读取会重新加载。
+// 维护期间各节点的清空排队到退出维护模式时执行，同样算作已确认
+
+// FlushAll 清空本节点和所有远程节点上group的本地缓存，返回确认清空的远程节点数；
+// 部分节点失败时仍然通知其余节点，返回的错误合并了每个失败节点的错误
+func (g *Group) FlushAll(ctx context.Context) (acked int, err error) {
+	if g.destroyed.Load() {
+		return 0, ErrGroupDestroyed
+	}
+	if err := g.flushLocally(); err != nil {
+		return 0, err
+	}
+	b, ok := g.peers.(broadcaster)
+	if !ok {
+		return 0, nil
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	for peer, getter := range b.broadcastTargets() {
+		f, ok := getter.(flusher)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: peer does not support FlushAll", peer))
+			continue
+		}
+		wg.Add(1)
+		go func(peer string, f flusher) {
+			defer wg.Done()
+			err := f.Flush(ctx, g.name)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", peer, err))
+				return
+			}
+			acked++
+		}(peer, f)
+	}
+	wg.Wait()
+	return acked, errors.Join(errs...)
+}
+
+// flushLocally 清空本地缓存和不存在key的过滤器，不通知其他节点
+func (g *Group) flushLocally() error {
+	_, err := g.mutate(func() {
+		g.Clear()
+		if g.notFound != nil {
+			g.notFound.reset()
+		}
+	})
+	return err
+}
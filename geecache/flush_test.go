@@ -0,0 +1,120 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFlushAll(t *testing.T) {
+	silenceLog(t)
+	ctx := context.Background()
+	const name = "flush-all"
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+		srvs   []*httptest.Server
+	)
+	for i := 0; i < 3; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			return []byte("v:" + key), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+		srvs = append(srvs, srv)
+	}
+	for _, pool := range pools {
+		pool.Set(urls...)
+	}
+	fill := func() {
+		for _, g := range groups {
+			for i := 0; i < 30; i++ {
+				if _, err := g.Get(ctx, fmt.Sprintf("k%d", i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	cached := func() int {
+		n := 0
+		for _, g := range groups {
+			n += g.mainCache.items() + g.hotCache.items()
+		}
+		return n
+	}
+
+	fill()
+	if cached() == 0 {
+		t.Fatal("nothing cached before FlushAll")
+	}
+	// 可以重复执行
+	for i := 0; i < 2; i++ {
+		acked, err := groups[0].FlushAll(ctx)
+		if err != nil || acked != 2 {
+			t.Fatalf("FlushAll = %d, %v, want 2 peers", acked, err)
+		}
+		if n := cached(); n != 0 {
+			t.Fatalf("%d entries left after FlushAll", n)
+		}
+	}
+
+	// 一个节点不可达时仍然清空其他节点，返回它的错误
+	fill()
+	srvs[2].Close()
+	acked, err := groups[1].FlushAll(ctx)
+	if acked != 1 || err == nil || !strings.Contains(err.Error(), urls[2]) {
+		t.Fatalf("FlushAll with a node down = %d, %v, want 1 peer and an error naming %s", acked, err, urls[2])
+	}
+	for i, g := range groups[:2] {
+		if n := g.mainCache.items() + g.hotCache.items(); n != 0 {
+			t.Fatalf("node %d has %d entries left", i, n)
+		}
+	}
+}
+
+func TestFlushAllInFlightLoad(t *testing.T) {
+	ctx := context.Background()
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("flush-all-in-flight", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			close(started)
+			<-release
+		}
+		return []byte("v:" + key), nil
+	}))
+	g.Get(ctx, "k")
+	done := make(chan error, 1)
+	go func() {
+		v, err := g.Get(ctx, "slow")
+		if err == nil && v.String() != "v:slow" {
+			err = fmt.Errorf("Get(slow) = %q", v.String())
+		}
+		done <- err
+	}()
+	<-started
+	if acked, err := g.FlushAll(ctx); acked != 0 || err != nil {
+		t.Fatalf("FlushAll without peers = %d, %v", acked, err)
+	}
+	if g.CachedLocally("k") {
+		t.Fatal("k still cached after FlushAll")
+	}
+	// 正在进行的加载照常完成并写回
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !g.CachedLocally("slow") {
+		t.Fatal("in-flight load was not written back after FlushAll")
+	}
+}
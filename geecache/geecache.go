@@ -1,10 +1,16 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"geecache/geecache/singleflight"
-	"log"
+	"math"
+	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 负责与外部交互，控制缓存存储和获取的主流程
@@ -21,46 +27,138 @@ import (
 
 type Group struct {
 	name      string
-	getter    Getter     // 缓存未命中时获取源数据的回调（callback）
-	mainCache cache      // 之前实现的并发缓存
-	peers     PeerPicker // HTTPPool对象，实现了PeerPicker，记录可访问的远程节点
+	getter    Getter          // 缓存未命中时获取源数据的回调（callback）
+	mainCache shardedCache    // 之前实现的并发缓存，可以分片，见WithShards
+	hotCache  cache           // 由其他节点负责、但在本节点上被频繁访问的key，见hotcache.go
+	promotion PromotionPolicy // 从远程节点取回的值是否放进hotCache，nil表示总是放入
+	codec     Codec           // GetInto和SetValue使用的编解码，nil表示JSONCodec
+	log       Logger          // 日志，nil表示使用默认的StdLogger(false)，见logger.go
+	peers     PeerPicker      // HTTPPool对象，实现了PeerPicker，记录可访问的远程节点
 
 	loader *singleflight.Group
+
+	ttl         time.Duration // 本地加载的值的硬过期时间，0表示永不过期
+	ttlJitter   float64       // 硬过期时间的随机调整比例，见ttljitter.go
+	softTTL     time.Duration // 本地加载的值的软过期时间，0表示不使用
+	negativeTTL time.Duration // 负缓存的时间，0表示不缓存，见negative.go
+	loadTimeout time.Duration // 每次加载的期限，0表示不限制，见timeout.go
+
+	keyHash      func(string) string // key的规范化函数，nil表示不变换，见keyhash.go
+	interceptors []GetInterceptor    // Get的拦截器，先注册的在外层，见intercept.go
+	getterCopy   bool                // 回调函数返回的切片不归group所有，缓存之前拷贝一份，见WithGetterCopy
+
+	loadSlots        chan struct{}    // 回调函数调用的空位，nil表示不限制，见loadlimit.go
+	loadFailFast     bool             // 没有空位时立即失败
+	inflight         *byteBudget      // 加载中的值的字节数预算，nil表示不限制，见inflight.go
+	inflightShed     bool             // 预算不足时立即失败
+	loadRate         *tokenBucket     // 回调函数调用速率的令牌桶，nil表示不限制，见ratelimit.go
+	loadRateFailFast bool             // 没有令牌时立即失败
+	notFound         *notFoundFilter  // 不存在key的布隆过滤器，nil表示不使用，见bloom.go
+	notFoundRecheck  int              // 过滤器每命中多少次放行一次
+	slowLoads        *slowLoadLog     // 慢加载的记录，nil表示不记录，见slowload.go
+	now              func() time.Time // 时钟，测试中可以替换为假时钟
+
+	flags Flags      // 运行时功能开关
+	stats groupStats // 统计数据
+
+	prefixReport func(peer string, removed int, err error) // 远程节点完成前缀失效后的回调
+	onPanic      func(err *CallbackPanicError)             // 用户回调panic时的通知，见WithOnPanic
+	maint        maintenance                               // 维护模式的状态和待办队列
+	destroyed    atomic.Bool                               // 已经被DestroyGroup注销
+
+	// XFetch提前刷新
+	earlyBeta       float64
+	earlyRefreshOn  *atomic.Bool
+	randMu          sync.Mutex
+	rand            *rand.Rand
+	refreshMu       sync.Mutex
+	refreshing      map[string]bool           // 正在后台刷新的key，同一个key同时只刷新一次
+	refreshAhead    float64                   // 剩余寿命低于这个比例时提前刷新，0表示关闭，见refreshahead.go
+	refreshFailures map[string]refreshFailure // 刷新失败、正在退避的key
+	refreshes       sync.WaitGroup
 }
 
 // 回调Getter
 
+// Getter 的ctx来自触发加载的Get，带着其中的值（如trace ID）；等待同一次加载的调用方都离开后ctx被取消，见load。
+// 返回的切片（包括GetterWithExpiry、GetterWithTTL和BatchGetter返回的）交给group所有，直接放进缓存而不拷贝，
+// 回调函数之后不能再修改或复用它；切片来自自己的map、缓冲池等会被修改的地方时使用WithGetterCopy
 type Getter interface {
-	Get(key string) ([]byte, error)
+	Get(ctx context.Context, key string) ([]byte, error)
 }
 
 // 定义函数类型 GetterFunc，并实现 Getter 接口的 Get 方法
 // 函数类型实现某一个接口，称之为接口型函数，方便使用者在调用时既能够传入函数作为参数，也能够传入实现了该接口的结构体作为参数
+// GetterFunc 不使用ctx，兼容以前的回调函数；需要ctx时使用ContextGetterFunc
 
 type GetterFunc func(key string) ([]byte, error)
 
-func (f GetterFunc) Get(key string) ([]byte, error) {
+func (f GetterFunc) Get(_ context.Context, key string) ([]byte, error) {
 	return f(key)
 }
 
+// ContextGetterFunc 是使用ctx的回调函数，同样实现了Getter
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// Expiry 是回调函数为单个key指定的过期时间，为0的一项使用group的默认值（WithSoftTTL/WithHardTTL），
+// Hard为NoExpiry时永不过期，不使用group的默认值
+type Expiry struct {
+	Soft time.Duration // 超过后在后台刷新，期间仍返回旧值
+	Hard time.Duration // 超过后不再返回
+}
+
+// GetterWithExpiry 是可选的接口，Getter同时实现它时，group改为调用GetWithExpiry加载源数据，从而为每个key单独指定过期时间
+type GetterWithExpiry interface {
+	GetWithExpiry(ctx context.Context, key string) ([]byte, Expiry, error)
+}
+
+// GetterWithTTL 是可选的接口，只为每个key指定（硬）过期时间，相当于只设置Hard的GetterWithExpiry，两者都实现时使用GetterWithExpiry。
+// ttl为0表示永不过期，即使设置了WithHardTTL（相当于Hard为NoExpiry）。从远程节点取回的值带着剩余的过期时间，不会比在所属节点上活得更久
+type GetterWithTTL interface {
+	GetWithTTL(ctx context.Context, key string) (data []byte, ttl time.Duration, err error)
+}
+
+// NoExpiry 作为Expiry.Hard时表示值永不过期，不使用group默认的硬过期时间
+const NoExpiry time.Duration = -1
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group) // 多个不同名称的Group缓存空间组成groups
 )
 
-// NewGroup 函数实例化Group，并且将group存储在全局变量groups中
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// NewGroup 函数实例化Group，并且将group存储在全局变量groups中，opts用于修改默认配置
+// cacheBytes为本地缓存的上限：0表示不缓存，每次Get都重新加载（并发的相同请求仍然合并为一次），
+// 负数会panic；不限制大小需要显式地使用WithUnlimitedBytes。
+// 迁移：以前cacheBytes为0表示不限制，依赖这一行为的调用需要加上WithUnlimitedBytes()
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
+	if cacheBytes < 0 {
+		panic(fmt.Sprintf("geecache: negative cacheBytes %d for group %q", cacheBytes, name))
+	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:       name,
+		getter:     getter,
+		mainCache:  shardedCache{cache: cache{cacheBytes: cacheBytes}},
+		loader:     &singleflight.Group{CancelAbandoned: true}, // 调用方都离开后停止加载，不再回退到本地加载
+		now:        time.Now,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		refreshing: make(map[string]bool),
+	}
+	g.mainCache.now = func() time.Time { return g.now().Add(-g.maint.staleFor()) }
+	g.earlyRefreshOn = g.flags.register(FlagEarlyRefresh, true)
+	for _, opt := range opts {
+		opt(g)
 	}
+	g.mainCache.init()
+	g.initHotCache()
 	groups[name] = g
 	return g
 }
@@ -73,17 +171,165 @@ func GetGroup(name string) *Group {
 	return g
 }
 
-func (g *Group) Get(key string) (ByteView, error) {
+// Groups 返回当前注册的所有group的快照，按名称排序
+func Groups() []*Group {
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+	return gs
+}
+
+// GroupNames 返回当前注册的所有group的名称，按名称排序
+func GroupNames() []string {
+	mu.RLock()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// RangeGroups 按名称顺序对当前注册的每个group调用f，f返回false时停止。
+// 遍历的是调用时的快照，调用f时不持有锁，f中可以创建或注销group
+func RangeGroups(f func(*Group) bool) {
+	for _, g := range Groups() {
+		if !f(g) {
+			return
+		}
+	}
+}
+
+// ErrGroupDestroyed 是对已经被DestroyGroup注销的group读写时返回的错误
+var ErrGroupDestroyed = errors.New("geecache: group destroyed")
+
+// DestroyGroup 注销名为name的group并释放它的缓存：从全局的groups和注册的HTTPPool中删除，
+// 停止后台清理，清空mainCache和hotCache（对每条记录调用OnEvicted）。之后GetGroup返回nil，
+// 仍然持有*Group的调用方读写时得到ErrGroupDestroyed，远程节点对它的请求得到404。
+// 正在进行的加载不会被中断，它们的结果写入已经分离的缓存，随group一起被回收。name不存在时什么也不做
+func DestroyGroup(name string) {
+	mu.Lock()
+	g := groups[name]
+	delete(groups, name)
+	mu.Unlock()
+	if g == nil || g.destroyed.Swap(true) {
+		return
+	}
+	if pool, ok := g.peers.(*HTTPPool); ok {
+		pool.removeGroup(g)
+	}
+	g.refreshes.Wait()
+	for _, c := range g.mainCache.shards {
+		c.close()
+	}
+	g.hotCache.close()
+}
+
+// Get 返回key对应的值，是GetTo(ctx, key, ByteViewSink(&v))的简便写法
+// ctx结束时Get立即返回ctx.Err()，但同时等待同一个key的其他调用方不受影响，见load
+func (g *Group) Get(ctx context.Context, key string) (ByteView, error) {
+	return g.GetWith(ctx, key, GetOptions{})
+}
+
+// GetTo 把key对应的值写入dest，由dest决定是否拷贝，见Sink
+func (g *Group) GetTo(ctx context.Context, key string, dest Sink) error {
+	if dest == nil {
+		return errNilSink
+	}
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+		return fmt.Errorf("key is required")
+	}
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	ctx, key = g.withSourceKey(ctx, key)
+	if v, ok := g.lookupCache(ctx, key); ok {
+		if v.err != nil {
+			return v.err
+		}
+		return setSinkView(dest, v)
+	}
+	res, destPopulated, err := g.load(ctx, key, GetOptions{}, dest)
+	if err != nil {
+		return err
+	}
+	v := res.view
+	if destPopulated {
+		// dest已经保存了加载的值，ByteViewSink再换成带过期时间的视图，不需要拷贝
+		if s, ok := dest.(*byteViewSink); ok {
+			s.setView(v)
+		}
+		return nil
 	}
+	return setSinkView(dest, v)
+}
 
-	// 从mainCache里面拿缓存， 如果能拿到就返回缓存值
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache hit]")
-		return v, nil
+// lookupCache 依次在mainCache和hotCache中查找key，命中软过期或需要提前刷新的值时触发后台刷新，ctx中带着key的加载key
+func (g *Group) lookupCache(ctx context.Context, key string) (ByteView, bool) {
+	g.stats.gets.Add(1)
+	// 命中和未命中同时记录在mainCache的计数器中，见CacheStats
+	source := SourceHit
+	v, ok := g.mainCache.get(key)
+	if !ok {
+		source = SourceHotHit
+		v, ok = g.hotCache.get(key)
+	}
+	if ok {
+		g.stats.cacheHits.Add(1)
+		recordHit(ctx, source)
 	}
-	return g.load(key) // 缓存里没有，load去其他节点拿 or 回调函数去数据库拿
+	if ok && !g.maint.active.Load() && (g.softExpired(v) || g.shouldRefreshEarly(v) || g.shouldRefreshAhead(v)) {
+		g.refreshAsync(key, sourceKey(ctx, g.name, key))
+	}
+	return v, ok
+}
+
+// CachedLocally 判断key是否在本节点的本地缓存mainCache中（不包括hotCache），不会触发加载，也不改变记录的新旧顺序
+func (g *Group) CachedLocally(key string) bool {
+	return g.mainCache.contains(g.cacheKey(key))
+}
+
+// Flags 返回group的运行时功能开关
+func (g *Group) Flags() *Flags {
+	return &g.flags
+}
+
+// SetCacheBytes 在运行时调整group的缓存上限，缩小时会立即淘汰超出部分；
+// 0表示关闭缓存并清空已有记录，同时取消WithUnlimitedBytes，负数会panic
+func (g *Group) SetCacheBytes(cacheBytes int64) {
+	if cacheBytes < 0 {
+		panic(fmt.Sprintf("geecache: negative cacheBytes %d for group %q", cacheBytes, g.name))
+	}
+	g.mainCache.resize(cacheBytes)
+	g.hotCache.resize(hotBytes(cacheBytes))
+	g.trimCaches()
+}
+
+// CacheBytes 返回本地缓存当前占用的字节数，还没有写入过时为0
+func (g *Group) CacheBytes() int64 {
+	return g.mainCache.bytes()
+}
+
+// CacheItems 返回本地缓存当前的记录数，还没有写入过时为0
+func (g *Group) CacheItems() int {
+	return g.mainCache.items()
+}
+
+// CacheLimit 返回本地缓存的上限，即NewGroup或SetCacheBytes设置的cacheBytes；
+// 不缓存时为0，使用WithUnlimitedBytes时为math.MaxInt64
+func (g *Group) CacheLimit() int64 {
+	return g.mainCache.maxBytes()
+}
+
+// Clear 清空group的本地缓存，便于测试或运维工具重置状态
+func (g *Group) Clear() {
+	g.mainCache.clear()
+	g.hotCache.clear()
 }
 
 // RegisterPeers 实现了 PeerPicker 接口的 HTTPPool 注入到 Group 中
@@ -92,52 +338,358 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 		panic("RegisterPeerPicker called more than once")
 	}
 	g.peers = peers
+	if pool, ok := peers.(*HTTPPool); ok {
+		pool.addGroup(g)
+	}
 }
 
 // 使用PickPeer方法选择节点，若非本机节点，则调用getFromPeer从远程获取，若是本机节点或失败，则回退到getLocally
 // 若缓存值在远程节点上存在，则用对应的HTTP客户端从远程节点上访问获取缓存值
 // 若不能则调用回调函数，获取值并添加到缓存
-func (g *Group) load(key string) (value ByteView, err error) {
+// 由本次调用发起加载时值直接写入dest，destPopulated为true；等待其他调用的加载结果时dest没有被写入，res.coalesced为true
+// opts不为零值时加载使用单独的singleflight key，见GetOptions
+// 加载在单独的goroutine中进行，使用的ctx带有发起加载的调用方ctx中的值，但只有等待这次加载的调用方全部因ctx结束离开后才被取消，
+// 因此一个调用方超时不会让其他调用方的加载失败，而没有人再需要结果时，远程请求和回调函数可以据此放弃
+func (g *Group) load(ctx context.Context, key string, opts GetOptions, dest Sink) (res loaded, destPopulated bool, err error) {
+	if g.maint.active.Load() {
+		return loaded{}, false, ErrMaintenance
+	}
+	g.stats.loads.Add(1)
+	if opts.LocalOnly && !g.ownedRemotely(key) {
+		opts.LocalOnly = false // 本来就在本地加载，与普通的加载合并
+	}
+	ctx, cancel := g.withLoadTimeout(ctx)
+	defer cancel()
+	ls := &loadSink{dest: dest}
+	populated, ran := false, false
 	// 这时在并发场景下针对相同的key，load过程只会调用一次
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+	viewi, err := g.loader.DoContext(ctx, opts.loadKey(key), func(ctx context.Context) (_ interface{}, err error) {
+		g.stats.loadsExecuted.Add(1)
+		ran = true
+		// 后加入的调用方不会延长这次加载的期限
+		ctx, cancel := g.withLoadTimeout(ctx)
+		defer cancel()
+		ctx, release := g.reserveLoad(ctx)
+		defer release()
+		defer func() { err = loadTimeoutErr(ctx, err) }()
+		reason := NoPeers
+		opts := opts
 		if g.peers != nil {
+			reason = OwnedLocally
 			// 通过一致性哈希找到存储key的节点客户端peer
-			if peer, ok := g.peers.PickPeer(key); ok {
+			if opts.LocalOnly {
+				reason = Forwarded
+				opts.SkipPopulate = true // 本节点不负责key，Delete和Set不会通知这里，不能留下副本
+			} else if peer, ok := g.pickReadPeer(key); ok {
+				since := g.hotCache.version()
 				// 利用HTTP客户端访问远程节点
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+				value, err := g.getFromPeer(ctx, peer, key, opts, ls)
+				g.stats.peerResult(err)
+				if err == nil {
+					populated = true
+					res := loaded{view: value, source: SourcePeer, peer: peerName(peer)}
+					if opts.SkipPopulate {
+						return res, nil
+					}
+					if winner, stored := g.promote(key, value, since); !stored {
+						// 加载期间Set写入了更新的值，dest改为这个值
+						res.view = winner
+						err = setSinkView(ls, winner)
+					}
+					return res, err
 				}
-				log.Println("[GeeCache] Failed to get from peer", err)
+				if ctx.Err() != nil {
+					return nil, ctx.Err() // 等待的调用方都已离开，不再回退到本地加载
+				}
+				if errors.Is(err, ErrInFlightBytes) {
+					return nil, err // 本节点的内存预算不足，本地加载同样需要预算
+				}
+				if isNotFound(err) {
+					// 远程节点确认key不存在，不回退到本地加载
+					if g.negativeTTL > 0 && !opts.SkipPopulate {
+						g.populateHotCache(key, g.negativeEntry(err), since)
+					}
+					return nil, err
+				}
+				reason = peerFallbackReason(err)
+				g.logger().Errorf("Failed to get %q from peer: %v", key, err)
+			} else if g.ownedRemotely(key) {
+				opts.SkipPopulate = true // 有界负载把其他节点负责的key交给了本节点，同样不留下副本
 			}
 		}
-		return g.getLocally(key) // 调用用户回调函数，获取源数据
+		value, err := g.getLocally(ctx, key, reason, opts, ls) // 调用用户回调函数，获取源数据
+		populated = err == nil
+		return loaded{view: value, source: SourceLocal}, err
 	})
 
 	if err == nil {
-		return viewi.(ByteView), nil
+		res := viewi.(loaded)
+		res.coalesced = !ran
+		return res, populated, nil
 	}
-	return
+	if ctx.Err() != nil {
+		ls.abandon()
+	}
+	return loaded{}, false, loadTimeoutErr(ctx, err)
 }
 
-// getFromPeer 使用实现了PeerGetter接口的httpGetter访问远程节点，获取缓存值
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
-	if err != nil {
+// getFromPeer 使用实现了PeerGetter接口的httpGetter访问远程节点，获取缓存值并写入dest
+// 响应体是新分配的，直接作为只读视图交给dest，不需要再拷贝。opts.ForceRefresh时要求远程节点重新加载（节点支持时）
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string, opts GetOptions, dest Sink) (_ ByteView, err error) {
+	if g.slowLoads != nil {
+		start := g.now()
+		defer func() {
+			source := peerName(peer)
+			if source == "" {
+				source = "peer"
+			}
+			g.noteSlowLoad(sourceKey(ctx, g.name, key), source, "", start, err)
+		}()
+	}
+	var value ByteView
+	if rp, ok := peer.(refreshPeerGetter); ok && opts.ForceRefresh {
+		e, err := rp.RefreshEntry(ctx, g.name, key)
+		if err != nil {
+			return ByteView{}, err
+		}
+		value = ByteView{b: e.Value, soft: g.after(e.SoftTTL), expire: g.after(e.HardTTL), version: e.Version}
+	} else if ep, ok := peer.(expiryPeerGetter); ok {
+		e, err := ep.GetEntry(ctx, g.name, key)
+		if err != nil {
+			return ByteView{}, err
+		}
+		value = ByteView{b: e.Value, soft: g.after(e.SoftTTL), expire: g.after(e.HardTTL), version: e.Version}
+	} else {
+		bytes, err := peer.Get(ctx, g.name, key)
+		if err != nil {
+			return ByteView{}, err
+		}
+		value = ByteView{b: bytes}
+	}
+	value = g.withPeerExpiry(value)
+	reservationFrom(ctx).settle(int64(value.Len()))
+	if err := setSinkView(dest, value); err != nil {
+		return ByteView{}, err
+	}
+	return value, nil
+}
+
+// getLocally 调用回调函数加载key并写入dest，reason说明为什么在本地加载
+// 回调函数返回的bytes归group所有（见Getter），dest直接保存它，缓存中保存的就是dest的视图；opts.SkipPopulate时不写入缓存
+func (g *Group) getLocally(ctx context.Context, key string, reason FallbackReason, opts GetOptions, dest Sink) (ByteView, error) {
+	if err := g.filterNotFound(key); err != nil {
+		return ByteView{}, err
+	}
+	if err := g.throttle(ctx); err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: bytes}, nil
+	if err := g.acquireLoad(ctx); err != nil {
+		return ByteView{}, err
+	}
+	g.stats.localLoads[reason].Add(1)
+	start := g.now()
+	var bytes []byte
+	var exp Expiry
+	var err error
+	since := g.mainCache.version(key)
+	source := sourceKey(ctx, g.name, key) // 回调函数使用原来的key，见WithKeyHashing
+	dest = g.getterSink(dest)
+	perr := g.protect("Getter", func() {
+		switch eg := g.getter.(type) {
+		case StreamingGetter:
+			// 新读入的切片总是归group所有
+			dest = ownedSink{dest}
+			bytes, err = g.getStream(ctx, key, source, eg)
+		case GetterWithExpiry:
+			bytes, exp, err = eg.GetWithExpiry(ctx, source)
+		case GetterWithTTL:
+			bytes, exp.Hard, err = eg.GetWithTTL(ctx, source)
+			if err == nil && exp.Hard == 0 {
+				exp.Hard = NoExpiry
+			}
+		default:
+			bytes, err = g.getter.Get(ctx, source)
+		}
+	})
+	g.releaseLoad()
+	if perr != nil {
+		err = perr
+	}
+	if g.slowLoads != nil {
+		g.noteSlowLoad(source, "getter", reason.String(), start, err)
+	}
+	if err == nil {
+		reservationFrom(ctx).settle(int64(len(bytes)))
+	}
+	return g.storeLoaded(key, bytes, exp, err, start, since, opts, dest)
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key) // 回调函数返回的bytes是[]byte类型，切片指向同一地址，需要clone，防止被外部程序改变
+// getterSink 返回接收回调函数结果的Sink：默认直接保存回调函数交出的切片，WithGetterCopy时由dest拷贝
+func (g *Group) getterSink(dest Sink) Sink {
+	if g.getterCopy {
+		return dest
+	}
+	return ownedSink{dest}
+}
+
+// storeLoaded 处理回调函数对key的加载结果：把bytes写入dest并放进mainCache，key不存在时按需写入负缓存。
+// start为开始加载的时间，since为开始加载前mainCache的写入计数，见populateLoaded；opts.SkipPopulate时只写入dest
+func (g *Group) storeLoaded(key string, bytes []byte, exp Expiry, err error, start time.Time, since uint64, opts GetOptions, dest Sink) (ByteView, error) {
 	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		if g.notFound != nil && isNotFound(err) {
+			g.notFound.add(g.now(), key)
+		}
+		if g.negativeTTL > 0 && isNotFound(err) && !opts.SkipPopulate {
+			g.mainCache.addLoaded(key, g.negativeEntry(err), since)
+			g.trimCaches()
+		}
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value) // 添加到缓存mainCache中
+	g.forgetNotFound(key) // 放行确认时key已经存在
+	if err := dest.SetBytes(bytes); err != nil {
+		return ByteView{}, err
+	}
+	value, err := dest.view()
+	if err != nil {
+		return ByteView{}, err
+	}
+	now := g.now()
+	value.delta = now.Sub(start)
+	value.loaded = now
+	value.version = 1
+	if exp.Soft > 0 {
+		value.soft = now.Add(exp.Soft)
+	}
+	if exp.Hard > 0 {
+		value.expire = now.Add(g.jitter(exp.Hard))
+	}
+	value.noExpiry = exp.Hard == NoExpiry
+	if opts.SkipPopulate {
+		return value, nil
+	}
+	// 添加到缓存mainCache中；加载期间Set写入了更新的值时保留那个值，dest改为这个值
+	value, stored := g.populateLoaded(key, value, since)
+	if !stored {
+		if err := setSinkView(dest, value); err != nil {
+			return ByteView{}, err
+		}
+	}
 	return value, nil
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
+// populateCache 把value写入本地缓存，value没有指定的过期时间使用group的默认值，返回实际写入的值
+func (g *Group) populateCache(key string, value ByteView) ByteView {
+	value = g.withDefaultExpiry(value)
 	g.mainCache.add(key, value)
+	g.trimCaches()
+	return value
+}
+
+// populateLoaded 与populateCache相同，但写入的是mainCache的写入计数为since时开始加载的值，
+// 期间key被写入了更新的值时保留那个值，见set.go。返回缓存中最终的值，以及value是否被写入
+func (g *Group) populateLoaded(key string, value ByteView, since uint64) (ByteView, bool) {
+	value, stored := g.mainCache.addLoaded(key, g.withDefaultExpiry(value), since)
+	g.trimCaches()
+	return value, stored
+}
+
+// withDefaultExpiry 为没有指定过期时间的value设置group默认的软/硬过期时间
+func (g *Group) withDefaultExpiry(value ByteView) ByteView {
+	if g.softTTL > 0 && value.soft.IsZero() {
+		value.soft = g.now().Add(g.softTTL)
+	}
+	if g.ttl > 0 && value.expire.IsZero() && !value.noExpiry {
+		value.expire = g.now().Add(g.jitter(g.ttl))
+	}
+	return value
+}
+
+// withPeerExpiry 按group的默认硬过期时间截断从远程节点取回的value的过期时间，见WithDefaultTTL。
+// 开启了WithTTLJitter时上限放宽到抖动范围的上界，保留所属节点上抖动的结果
+func (g *Group) withPeerExpiry(value ByteView) ByteView {
+	if g.ttl > 0 {
+		if limit := g.now().Add(g.ttl + time.Duration(float64(g.ttl)*g.ttlJitter)); value.expire.IsZero() || value.expire.After(limit) {
+			value.expire = limit
+		}
+	}
+	return value
+}
+
+// after 返回当前时间加上d，d为0时返回零值（没有过期时间）
+func (g *Group) after(d time.Duration) time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+	return g.now().Add(d)
+}
+
+// remaining 返回距离t的剩余时间，t为零值时返回0；已经过了t时返回负数，请求方据此得知值已软过期
+func (g *Group) remaining(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	if d := t.Sub(g.now()); d != 0 {
+		return d
+	}
+	return -1
+}
+
+// softExpired 判断v是否已经软过期，软过期的值仍然返回，但需要在后台刷新
+func (g *Group) softExpired(v ByteView) bool {
+	return !v.soft.IsZero() && !g.now().Before(v.soft)
+}
+
+// shouldRefreshEarly 按XFetch算法判断是否应该提前刷新v，见WithEarlyRefresh
+func (g *Group) shouldRefreshEarly(v ByteView) bool {
+	if g.earlyBeta <= 0 || v.expire.IsZero() || !g.earlyRefreshOn.Load() {
+		return false
+	}
+	g.randMu.Lock()
+	r := 1 - g.rand.Float64() // (0, 1]
+	g.randMu.Unlock()
+	gap := time.Duration(-float64(v.delta) * g.earlyBeta * math.Log(r))
+	return !g.now().Add(gap).Before(v.expire)
+}
+
+// refreshAsync 在后台重新调用回调函数加载key并替换缓存，同一个key同时只会有一个刷新在进行，source为key的加载key
+// 刷新通过loader进行，与同一时间的普通加载合并
+func (g *Group) refreshAsync(key, source string) {
+	g.refreshMu.Lock()
+	if g.refreshing[key] || g.refreshBackedOff(key) {
+		g.refreshMu.Unlock()
+		return
+	}
+	g.refreshing[key] = true
+	g.refreshMu.Unlock()
+
+	// 只有本地加载的值才会进入本地缓存，刷新也在本地进行
+	reason := OwnedLocally
+	if g.peers == nil {
+		reason = NoPeers
+	}
+	g.refreshes.Add(1)
+	go func() {
+		defer g.refreshes.Done()
+		ctx := context.Background()
+		if source != key {
+			ctx = g.withSourceKeys(ctx, sourceKeys{key: source})
+		}
+		_, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+			ctx, cancel := g.withLoadTimeout(ctx)
+			defer cancel()
+			ctx, release := g.reserveLoad(ctx)
+			defer release()
+			var dest ByteView
+			value, err := g.getLocally(ctx, key, reason, GetOptions{}, ByteViewSink(&dest))
+			return loaded{view: value, source: SourceLocal}, err
+		})
+		if err != nil {
+			g.logger().Errorf("Failed to refresh %q: %v", key, err)
+		}
+		g.refreshMu.Lock()
+		g.recordRefresh(key, err)
+		delete(g.refreshing, key)
+		g.refreshMu.Unlock()
+	}()
 }
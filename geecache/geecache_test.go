@@ -0,0 +1,1141 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geecache/geecache/internal/protocol"
+	"geecache/geecache/lru"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// fakeClock 是测试中使用的假时钟，只有调用Advance时才会前进
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// silenceLog 在测试期间丢弃命中日志
+func silenceLog(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func TestDefaultTTL(t *testing.T) {
+	clock := newFakeClock()
+	loads := 0
+	g := NewGroup("ttl", 0, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}), WithDefaultTTL(time.Second), WithUnlimitedBytes())
+	g.now = clock.Now
+
+	g.Get(context.Background(), "k")
+	clock.Advance(999 * time.Millisecond)
+	g.Get(context.Background(), "k")
+	if loads != 1 {
+		t.Fatalf("value reloaded before expiry, loads=%d", loads)
+	}
+	clock.Advance(time.Millisecond)
+	g.Get(context.Background(), "k")
+	if loads != 2 {
+		t.Fatalf("expired value not reloaded, loads=%d", loads)
+	}
+}
+
+// simulateExpiry 在ttl到期前后用多个并发读者反复读取同一批key，返回每个key第一次重新加载时距离过期的时间（以100ms为一档）
+func simulateExpiry(t *testing.T, name string, opts ...GroupOption) map[int]int {
+	const keys = 200
+	const ttl = 10 * time.Second
+	const step = 100 * time.Millisecond
+	clock := newFakeClock()
+	start := clock.Now()
+	var mu sync.Mutex
+	buckets := make(map[int]int) // 加载发生在距过期还有多少档 -> 次数
+	loaded := make(map[string]bool)
+	opts = append(opts, WithDefaultTTL(ttl), WithUnlimitedBytes())
+	g := NewGroup(name, 0, GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		if !loaded[key] {
+			loaded[key] = true
+			buckets[int(start.Add(ttl).Sub(clock.Now())/step)]++
+		}
+		mu.Unlock()
+		return []byte(key), nil
+	}), opts...)
+	g.now = clock.Now
+
+	// 所有key在同一时刻加载，上次加载耗时1秒
+	for i := 0; i < keys; i++ {
+		g.populateCache(fmt.Sprintf("key%d", i), ByteView{b: []byte("v"), delta: time.Second})
+	}
+	for clock.Now().Before(start.Add(ttl + time.Second)) {
+		clock.Advance(step)
+		var wg sync.WaitGroup
+		for r := 0; r < 8; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < keys; i++ {
+					g.Get(context.Background(), fmt.Sprintf("key%d", i))
+				}
+			}()
+		}
+		wg.Wait()
+		g.refreshes.Wait()
+	}
+	return buckets
+}
+
+func TestEarlyRefreshSpreadsReloads(t *testing.T) {
+	silenceLog(t)
+
+	// 不提前刷新时，所有key都在过期的瞬间重新加载
+	buckets := simulateExpiry(t, "xfetch-off")
+	if len(buckets) != 1 || buckets[0] != 200 {
+		t.Fatalf("expected all reloads at expiry, got %v", buckets)
+	}
+
+	// 提前刷新时，重新加载被打散到过期前的多个时刻，且几乎没有key等到过期才加载
+	buckets = simulateExpiry(t, "xfetch-on", WithEarlyRefresh(1))
+	total, atExpiry := 0, 0
+	for b, n := range buckets {
+		total += n
+		if b <= 0 {
+			atExpiry += n
+		}
+	}
+	if total != 200 {
+		t.Fatalf("expected exactly one refresh per key, got %d (%v)", total, buckets)
+	}
+	if atExpiry > 0 {
+		t.Fatalf("%d keys waited until expiry: %v", atExpiry, buckets)
+	}
+	if len(buckets) < 5 {
+		t.Fatalf("refreshes not spread out: %v", buckets)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	silenceLog(t)
+	for _, policy := range []EvictionPolicy{PolicyLRU, PolicySLRU, PolicyARC} {
+		loads := 0
+		g := NewGroup(fmt.Sprintf("policy-%d", policy), 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithEvictionPolicy(policy))
+		for i := 0; i < 3; i++ {
+			if v, err := g.Get(context.Background(), "Tom"); err != nil || v.String() != "Tom" {
+				t.Fatalf("policy %d: Get = %q, %v", policy, v, err)
+			}
+		}
+		if loads != 1 {
+			t.Fatalf("policy %d: getter called %d times", policy, loads)
+		}
+	}
+}
+
+func TestEarlyRefreshKillSwitch(t *testing.T) {
+	g := NewGroup("xfetch-killed", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithEarlyRefresh(1), WithUnlimitedBytes())
+	clock := newFakeClock()
+	g.now = clock.Now
+	v := ByteView{b: []byte("v"), expire: clock.Now(), delta: time.Second}
+
+	if !g.shouldRefreshEarly(v) {
+		t.Fatal("expected early refresh at expiry")
+	}
+	g.Flags().Set(FlagEarlyRefresh, false)
+	if g.shouldRefreshEarly(v) {
+		t.Fatal("early refresh still active after the flag was turned off")
+	}
+}
+
+func TestSoftAndHardTTL(t *testing.T) {
+	silenceLog(t)
+	clock := newFakeClock()
+	var mu sync.Mutex
+	loads := 0
+	block := make(chan struct{})
+	g := NewGroup("soft-hard", 0, GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		loads++
+		n := loads
+		mu.Unlock()
+		if n == 2 {
+			<-block // 后台刷新期间阻塞，检查并发读取仍然拿到旧值
+		}
+		return []byte(fmt.Sprintf("v%d", n)), nil
+	}), WithSoftTTL(time.Second), WithHardTTL(3*time.Second), WithUnlimitedBytes())
+	g.now = clock.Now
+	get := func() string {
+		v, err := g.Get(context.Background(), "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.String()
+	}
+
+	// 新鲜：直接返回缓存值
+	get()
+	clock.Advance(500 * time.Millisecond)
+	if v := get(); v != "v1" || loads != 1 {
+		t.Fatalf("fresh: got %s, loads=%d", v, loads)
+	}
+
+	// 软过期：并发读取都立即拿到旧值，后台只刷新一次
+	clock.Advance(time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v := get(); v != "v1" {
+				t.Errorf("soft-stale read got %s, want v1", v)
+			}
+		}()
+	}
+	wg.Wait()
+	close(block)
+	g.refreshes.Wait()
+	if v := get(); v != "v2" || loads != 2 {
+		t.Fatalf("after soft refresh: got %s, loads=%d", v, loads)
+	}
+
+	// 硬过期：不再返回旧值，同步重新加载
+	clock.Advance(3 * time.Second)
+	if v := get(); v != "v3" || loads != 3 {
+		t.Fatalf("hard-expired: got %s, loads=%d", v, loads)
+	}
+}
+
+// expiryGetter 为每个key返回不同的过期时间
+type expiryGetter map[string]Expiry
+
+func (e expiryGetter) Get(_ context.Context, key string) ([]byte, error) {
+	return []byte(key), nil
+}
+
+func (e expiryGetter) GetWithExpiry(_ context.Context, key string) ([]byte, Expiry, error) {
+	return []byte(key), e[key], nil
+}
+
+func TestPerKeyExpiry(t *testing.T) {
+	clock := newFakeClock()
+	g := NewGroup("per-key-expiry", 0, expiryGetter{
+		"short":   {Soft: time.Second, Hard: 2 * time.Second},
+		"forever": {Hard: NoExpiry},
+	}, WithSoftTTL(time.Minute), WithHardTTL(time.Hour), WithUnlimitedBytes())
+	g.now = clock.Now
+	start := clock.Now()
+
+	g.Get(context.Background(), "short")
+	g.Get(context.Background(), "default")
+	v, _ := g.mainCache.get("short")
+	if !v.soft.Equal(start.Add(time.Second)) || !v.expire.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("override not applied: soft=%v expire=%v", v.soft, v.expire)
+	}
+	v, _ = g.mainCache.get("default")
+	if !v.soft.Equal(start.Add(time.Minute)) || !v.expire.Equal(start.Add(time.Hour)) {
+		t.Fatalf("defaults not applied: soft=%v expire=%v", v.soft, v.expire)
+	}
+	g.Get(context.Background(), "forever")
+	if v, _ = g.mainCache.get("forever"); !v.expire.IsZero() || !v.soft.Equal(start.Add(time.Minute)) {
+		t.Fatalf("NoExpiry not applied: soft=%v expire=%v", v.soft, v.expire)
+	}
+}
+
+// ttlGetter 为每个key返回不同的TTL，统计加载次数
+type ttlGetter struct {
+	ttls  map[string]time.Duration
+	loads *atomic.Int32
+}
+
+func (g ttlGetter) Get(_ context.Context, key string) ([]byte, error) {
+	return nil, fmt.Errorf("Get called instead of GetWithTTL")
+}
+
+func (g ttlGetter) GetWithTTL(_ context.Context, key string) ([]byte, time.Duration, error) {
+	g.loads.Add(1)
+	return []byte(key), g.ttls[key], nil
+}
+
+func TestGetterWithTTL(t *testing.T) {
+	silenceLog(t)
+	ttls := map[string]time.Duration{"session": time.Minute}
+	clock := newFakeClock()
+	var loads atomic.Int32
+	g := NewGroup("getter-ttl", 1<<10, ttlGetter{ttls, &loads})
+	g.now = clock.Now
+
+	g.Get(context.Background(), "session")
+	g.Get(context.Background(), "reference")
+	if v, _ := g.Get(context.Background(), "session"); !v.Expire().Equal(clock.Now().Add(time.Minute)) {
+		t.Fatalf("session expires at %v", v.Expire())
+	}
+	clock.Advance(time.Hour)
+	g.Get(context.Background(), "session")
+	if v, _ := g.Get(context.Background(), "reference"); !v.Expire().IsZero() {
+		t.Fatalf("zero TTL expires at %v", v.Expire())
+	}
+	if n := loads.Load(); n != 3 {
+		t.Fatalf("%d loads, want 3 (session reloaded once)", n)
+	}
+
+	// 设置了WithHardTTL时，0仍然表示永不过期，非0的TTL优先于默认值
+	var defaultLoads atomic.Int32
+	withDefault := NewGroup("getter-ttl-default", 1<<10, ttlGetter{ttls, &defaultLoads}, WithHardTTL(time.Hour))
+	withDefault.now = clock.Now
+	if v, _ := withDefault.Get(context.Background(), "reference"); !v.Expire().IsZero() {
+		t.Fatalf("zero TTL with WithHardTTL expires at %v", v.Expire())
+	}
+	if v, _ := withDefault.Get(context.Background(), "session"); !v.Expire().Equal(clock.Now().Add(time.Minute)) {
+		t.Fatalf("session with WithHardTTL expires at %v", v.Expire())
+	}
+	clock.Advance(2 * time.Hour)
+	withDefault.Get(context.Background(), "reference")
+	if n := defaultLoads.Load(); n != 2 {
+		t.Fatalf("%d loads, want 2 (zero TTL value not reloaded after the group default)", n)
+	}
+
+	// 从所属节点取回的值带着剩余的TTL
+	pool := NewHTTPPool("owner")
+	ownerClock := newFakeClock()
+	owner := NewGroup("getter-ttl-peer", 1<<10, ttlGetter{ttls, new(atomic.Int32)})
+	owner.now = ownerClock.Now
+	owner.RegisterPeers(pool)
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	owner.Get(context.Background(), "session")
+	ownerClock.Advance(20 * time.Second)
+
+	peers := NewHTTPPool("a")
+	peers.Set(srv.URL)
+	a := NewGroup("getter-ttl-peer", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("unexpected local load of %s", key)
+	}))
+	a.now = clock.Now
+	a.RegisterPeers(peers)
+	if v, err := a.Get(context.Background(), "session"); err != nil || !v.Expire().Equal(clock.Now().Add(40*time.Second)) {
+		t.Fatalf("peer value expires at %v (%v), want %v", v.Expire(), err, clock.Now().Add(40*time.Second))
+	}
+}
+
+// ttlPeer 返回带有剩余硬过期时间的值
+type ttlPeer struct {
+	ttl time.Duration
+}
+
+func (p ttlPeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	return []byte(key), nil
+}
+
+func (p ttlPeer) GetEntry(_ context.Context, group string, key string) (protocol.Entry, error) {
+	return protocol.Entry{Value: []byte(key), HardTTL: p.ttl}, nil
+}
+
+func TestDefaultTTLRules(t *testing.T) {
+	ttls := map[string]time.Duration{"short": 10 * time.Second, "long": time.Hour}
+	clock := newFakeClock()
+	g := NewGroup("default-ttl-rules", 1<<10, ttlGetter{ttls, new(atomic.Int32)}, WithDefaultTTL(time.Minute))
+	g.now = clock.Now
+	expire := func(g *Group, key string) time.Duration {
+		v, err := g.Get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Expire().Sub(clock.Now())
+	}
+
+	// 回调函数给出的TTL优先，无论长短；给出0时永不过期
+	for key, want := range map[string]time.Duration{"short": 10 * time.Second, "long": time.Hour} {
+		if d := expire(g, key); d != want {
+			t.Errorf("%s expires in %v, want %v", key, d, want)
+		}
+	}
+	if v, _ := g.Get(context.Background(), "none"); !v.Expire().IsZero() {
+		t.Errorf("zero TTL expires at %v, want never", v.Expire())
+	}
+	g.Set("set", []byte("v"))
+	if d := expire(g, "set"); d != time.Minute {
+		t.Errorf("Set value expires in %v, want the default", d)
+	}
+
+	// 从远程节点取回的值取剩余时间和默认值中较短的
+	for _, c := range []struct {
+		peer PeerGetter
+		want time.Duration
+	}{
+		{&echoPeer{}, time.Minute},                    // 没有给出过期时间
+		{ttlPeer{time.Hour}, time.Minute},             // 比默认值长
+		{ttlPeer{10 * time.Second}, 10 * time.Second}, // 比默认值短
+	} {
+		r := NewGroup("default-ttl-peer", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected local load of %s", key)
+		}), WithDefaultTTL(time.Minute))
+		r.now = clock.Now
+		r.RegisterPeers(fakePeers{c.peer})
+		if d := expire(r, "k"); d != c.want {
+			t.Errorf("peer value from %T expires in %v, want %v", c.peer, d, c.want)
+		}
+	}
+}
+
+func TestAdmissionOption(t *testing.T) {
+	silenceLog(t)
+	g := NewGroup("admission", 64, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithAdmission(100))
+	for i := 0; i < 3; i++ {
+		g.Get(context.Background(), "hot")
+	}
+	for i := 0; i < 3; i++ {
+		g.Get(context.Background(), fmt.Sprintf("hot%d", i))
+		g.Get(context.Background(), fmt.Sprintf("hot%d", i))
+	}
+	for i := 0; i < 20; i++ {
+		g.Get(context.Background(), fmt.Sprintf("once%04d", i)) // 每条16字节，不开启准入时很快就会把hot挤出缓存
+	}
+	if _, ok := g.mainCache.get("hot"); !ok {
+		t.Fatal("frequently read key evicted by one-off reads")
+	}
+}
+
+func TestOnEvictedOption(t *testing.T) {
+	silenceLog(t)
+	var reasons []lru.EvictReason
+	g := NewGroup("on-evicted", 10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		if value.String() != key {
+			t.Errorf("evicted %s with value %s", key, value)
+		}
+		reasons = append(reasons, reason)
+	}))
+	g.Get(context.Background(), "aa")
+	g.Get(context.Background(), "bb")
+	g.Get(context.Background(), "cc") // 超出容量，淘汰aa
+	g.Clear()
+	expect := []lru.EvictReason{lru.ReasonCapacity, lru.ReasonCleared, lru.ReasonCleared}
+	if !reflect.DeepEqual(reasons, expect) {
+		t.Fatalf("reasons = %v, expect %v", reasons, expect)
+	}
+}
+
+func TestEvictionCallback(t *testing.T) {
+	silenceLog(t)
+	type eviction struct {
+		key, value string
+		reason     EvictReason
+	}
+	var got []eviction
+	g := NewGroup("eviction-callback", 12, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v" + key[1:]), nil
+	}), WithEvictionCallback(func(key string, value ByteView, reason EvictReason) {
+		got = append(got, eviction{key, value.String(), reason})
+	}))
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} { // 每条4字节，最多缓存3条
+		g.Get(context.Background(), key)
+	}
+	g.Delete("k3")
+	g.Clear()
+	expect := []eviction{
+		{"k1", "v1", EvictCapacity},
+		{"k2", "v2", EvictCapacity},
+		{"k3", "v3", EvictRemoved},
+	}
+	if len(got) != 5 || !reflect.DeepEqual(got[:3], expect) {
+		t.Fatalf("evictions = %v, expect %v then k4, k5 cleared", got, expect)
+	}
+	cleared := got[3:]
+	sort.Slice(cleared, func(i, j int) bool { return cleared[i].key < cleared[j].key })
+	if !reflect.DeepEqual(cleared, []eviction{{"k4", "v4", EvictCleared}, {"k5", "v5", EvictCleared}}) {
+		t.Fatalf("cleared = %v", cleared)
+	}
+}
+
+func TestOnEvictedReentrant(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	l2 := NewGroup("on-evicted-l2", 0, getter, WithUnlimitedBytes())
+	var g *Group
+	var victims []string
+	g = NewGroup("on-evicted-l1", 4, getter, WithOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		// 回调中读写同一个group和另一个group，持有锁时调用会死锁
+		if g.CachedLocally(key) {
+			t.Errorf("%s still cached when its callback runs", key)
+		}
+		if !strings.HasPrefix(key, "x") {
+			g.mainCache.add("x"+key, value)
+		}
+		l2.populateCache(key, value)
+		victims = append(victims, key)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, key := range []string{"a", "b", "c", "d"} {
+			g.Get(context.Background(), key)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnEvicted deadlocked")
+	}
+	// 回调中写入的x记录又淘汰了其他记录，它们的回调排在后面，按淘汰顺序执行
+	if len(victims) < 3 || victims[0] != "a" || victims[1] != "b" {
+		t.Fatalf("victims = %v", victims)
+	}
+	if !l2.CachedLocally("a") || !l2.CachedLocally("b") {
+		t.Fatal("victims not written to the second level")
+	}
+}
+
+func TestCachedLocallyConcurrent(t *testing.T) {
+	silenceLog(t)
+	g := NewGroup("cached-locally", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	if g.CachedLocally("k0") {
+		t.Fatal("empty group reports a cached key")
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				g.Get(context.Background(), fmt.Sprintf("k%d", (i+w)%50))
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				g.CachedLocally(fmt.Sprintf("k%d", i%50))
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 50; i++ {
+		if !g.CachedLocally(fmt.Sprintf("k%d", i)) {
+			t.Fatalf("k%d not cached after Get", i)
+		}
+	}
+}
+
+// CachedLocally只需要读锁，其他读者持有读锁时不会被阻塞
+func TestCachedLocallySharesReadLock(t *testing.T) {
+	g := NewGroup("cached-locally-rlock", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.Get(context.Background(), "k")
+	c := &g.mainCache
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	done := make(chan bool)
+	go func() { done <- c.contains("k") }()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Fatal("k not cached")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("contains blocked behind a concurrent reader")
+	}
+}
+
+func TestCleanupInterval(t *testing.T) {
+	silenceLog(t)
+	evicted := make(chan lru.EvictReason, 1)
+	g := NewGroup("cleanup", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithDefaultTTL(time.Millisecond), WithCleanupInterval(time.Millisecond),
+		WithOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+			evicted <- reason
+		}), WithUnlimitedBytes())
+	g.Get(context.Background(), "k")
+	select {
+	case reason := <-evicted:
+		if reason != lru.ReasonExpired {
+			t.Fatalf("evicted for %s, expect expired", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expired entry never cleaned up")
+	}
+}
+
+func TestCachePin(t *testing.T) {
+	c := &cache{cacheBytes: 10, now: time.Now}
+	c.add("k1", ByteView{b: []byte("v1")})
+	if !c.pin("k1") {
+		t.Fatal("pin failed")
+	}
+	c.add("k2", ByteView{b: []byte("v2")})
+	c.add("k3", ByteView{b: []byte("v3")}) // 超出上限，淘汰k2而不是被pin住的k1
+	if !c.contains("k1") || c.contains("k2") {
+		t.Fatal("pinned entry evicted")
+	}
+	c.unpin("k1")
+	c.add("k4", ByteView{b: []byte("v4")})
+	if _, ok := c.get("k3"); !ok {
+		t.Fatal("expected k1 to be evicted after unpin")
+	}
+	if c.contains("k1") {
+		t.Fatal("unpinned entry still cached")
+	}
+
+	arc := &cache{cacheBytes: 10, now: time.Now, policy: PolicyARC}
+	arc.add("k1", ByteView{b: []byte("v1")})
+	if arc.pin("k1") {
+		t.Fatal("ARC does not support pinning")
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	silenceLog(t)
+	var mu sync.Mutex
+	loads := 0
+	release := make(chan struct{})
+	g := NewGroup("cache-disabled", 0, GetterFunc(func(key string) ([]byte, error) {
+		<-release
+		mu.Lock()
+		loads++
+		mu.Unlock()
+		return []byte(key), nil
+	}))
+
+	// 缓存关闭时并发的相同请求仍然只加载一次
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.Get(context.Background(), "k"); err != nil || v.String() != "k" {
+				t.Errorf("Get = %q, %v", v.String(), err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads != 1 {
+		t.Fatalf("concurrent Gets loaded %d times, want 1", loads)
+	}
+
+	g.Get(context.Background(), "k")
+	if loads != 2 || g.CachedLocally("k") {
+		t.Fatalf("value cached with cacheBytes 0 (loads %d)", loads)
+	}
+	if !g.Stats().CacheDisabled {
+		t.Fatal("stats do not mark the cache as disabled")
+	}
+}
+
+func TestLoadHold(t *testing.T) {
+	silenceLog(t)
+	ctx := context.Background()
+	var loads atomic.Int32
+	g := NewGroup("load-hold", 0, GetterFunc(func(key string) ([]byte, error) {
+		n := loads.Add(1)
+		if key == "bad" {
+			return nil, errors.New("boom")
+		}
+		return []byte(fmt.Sprint(n)), nil
+	}), WithLoadHold(time.Hour, false))
+
+	// 缓存关闭时，保留期间的读取仍然得到刚加载的结果
+	for i := 0; i < 3; i++ {
+		if v, err := g.Get(ctx, "k"); err != nil || v.String() != "1" {
+			t.Fatalf("Get #%d = %q, %v, want the held load", i, v.String(), err)
+		}
+	}
+	// Delete丢弃保留的结果
+	g.Delete("k")
+	if v, _ := g.Get(ctx, "k"); v.String() != "2" {
+		t.Fatalf("Get after Delete = %q, want a new load", v.String())
+	}
+	// 错误默认不保留
+	g.Get(ctx, "bad")
+	g.Get(ctx, "bad")
+	if n := loads.Load(); n != 4 {
+		t.Fatalf("loads = %d, want errors not held", n)
+	}
+}
+
+func TestCacheBytesLimits(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("NewGroup accepted negative cacheBytes")
+			}
+		}()
+		NewGroup("cache-negative", -1, getter)
+	}()
+
+	g := NewGroup("cache-unlimited", 0, getter, WithUnlimitedBytes())
+	for i := 0; i < 1000; i++ {
+		g.Get(context.Background(), fmt.Sprintf("k%d", i))
+	}
+	if s := g.Stats(); s.Cache.Len != 1000 || s.CacheDisabled {
+		t.Fatalf("unlimited cache holds %d entries (disabled %v)", s.Cache.Len, s.CacheDisabled)
+	}
+
+	// 运行时改为0关闭缓存并清空已有记录，之后的值不再缓存
+	g.SetCacheBytes(0)
+	g.Get(context.Background(), "k1")
+	if s := g.Stats(); s.Cache.Len != 0 || !s.CacheDisabled {
+		t.Fatalf("SetCacheBytes(0) left %d entries", s.Cache.Len)
+	}
+	g.SetCacheBytes(2 << 10)
+	g.Get(context.Background(), "k1")
+	if !g.CachedLocally("k1") {
+		t.Fatal("cache not re-enabled by SetCacheBytes")
+	}
+}
+
+func TestReadPathPromotion(t *testing.T) {
+	c := &cache{cacheBytes: 40, now: time.Now}
+	for i := 0; i < 10; i++ {
+		c.add(fmt.Sprintf("k%d", i), ByteView{b: []byte("v0")}) // 每条4字节，正好装满
+	}
+	// k0是最久未使用的，命中只在读锁下记录，访问更新在下一次写入前补做，因此k0不会被淘汰
+	if _, ok := c.get("k0"); !ok {
+		t.Fatal("k0 missing")
+	}
+	c.add("new", ByteView{b: []byte("v")})
+	if !c.contains("k0") || c.contains("k1") {
+		t.Fatalf("promotion not applied before eviction: %v", c.keys())
+	}
+
+	// 并发读写下字节数保持准确
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				if w == 0 && i%10 == 0 {
+					c.add(fmt.Sprintf("x%d", i), ByteView{b: []byte("v0")})
+				} else {
+					c.get(fmt.Sprintf("k%d", i%10))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	var n int64
+	c.rangeEntries(func(key string, value ByteView) bool {
+		n += int64(len(key) + value.Len())
+		return true
+	})
+	if s := c.lruStats(); s.Bytes != n || s.Bytes > 40 {
+		t.Fatalf("bytes = %d, entries sum to %d", s.Bytes, n)
+	}
+}
+
+func TestCacheOccupancy(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	for _, shards := range []int{1, 4} {
+		g := NewGroup(fmt.Sprintf("occupancy-%d", shards), 2<<10, getter, WithShards(shards))
+		if g.CacheBytes() != 0 || g.CacheItems() != 0 || g.CacheLimit() != 2<<10 {
+			t.Fatalf("before first write: %d bytes, %d items, limit %d", g.CacheBytes(), g.CacheItems(), g.CacheLimit())
+		}
+		g.Get(context.Background(), "ab")
+		g.Get(context.Background(), "cd")
+		if g.CacheBytes() != 8 || g.CacheItems() != 2 {
+			t.Fatalf("%d shards: %d bytes, %d items", shards, g.CacheBytes(), g.CacheItems())
+		}
+		g.SetCacheBytes(1 << 10)
+		if g.CacheLimit() != 1<<10 {
+			t.Fatalf("%d shards: limit %d after SetCacheBytes", shards, g.CacheLimit())
+		}
+	}
+	if l := NewGroup("occupancy-unlimited", 0, getter, WithUnlimitedBytes()).CacheLimit(); l != math.MaxInt64 {
+		t.Fatalf("unlimited limit = %d", l)
+	}
+}
+
+func TestMaxEntriesOption(t *testing.T) {
+	silenceLog(t)
+	var evicted []string
+	g := NewGroup("max-entries", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithMaxEntries(2), WithEvictionPolicy(PolicySLRU), WithOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		evicted = append(evicted, key+"="+value.String())
+	}))
+	g.Get(context.Background(), "a")
+	g.Get(context.Background(), "b")
+	g.Get(context.Background(), "c")
+	if g.CacheItems() != 2 || !reflect.DeepEqual(evicted, []string{"a=a"}) {
+		t.Fatalf("%d items, evicted %v", g.CacheItems(), evicted)
+	}
+}
+
+type traceKey struct{}
+
+// 一个调用方的ctx结束只让它自己返回，同一次加载的其他调用方照常得到结果；回调函数的ctx带有发起加载的调用方ctx中的值
+func TestContextSharedLoad(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	g := NewGroup("ctx-shared", 1<<10, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return []byte(fmt.Sprint(ctx.Value(traceKey{}))), nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), traceKey{}, "trace-1"), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan ByteView)
+	go func() {
+		for calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		v, err := g.Get(context.Background(), "k")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- v
+	}()
+	if _, err := g.Get(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get with an expired ctx = %v", err)
+	}
+	close(release)
+	if v := <-done; v.String() != "trace-1" {
+		t.Fatalf("other caller got %q", v)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("getter called %d times", n)
+	}
+}
+
+// 所有调用方都离开后，发往远程节点的请求被中止，也不会回退到本地加载
+func TestContextCancelAbortsPeerRequest(t *testing.T) {
+	silenceLog(t)
+	aborted := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer srv.Close()
+
+	pool := NewHTTPPool("a")
+	pool.Set(srv.URL)
+	var local atomic.Int32
+	g := NewGroup("ctx-peer", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		local.Add(1)
+		return []byte(key), nil
+	}))
+	g.RegisterPeers(pool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := g.Get(ctx, "k"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get = %v, want context.Canceled", err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer request was not aborted")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := local.Load(); n != 0 {
+		t.Fatalf("fell back to %d local loads after cancellation", n)
+	}
+}
+
+func TestDestroyGroup(t *testing.T) {
+	silenceLog(t)
+	var evicted []string
+	pool := NewHTTPPool("self")
+	g := NewGroup("destroy", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCleanupInterval(time.Millisecond), WithOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		evicted = append(evicted, key)
+	}))
+	g.RegisterPeers(pool)
+	g.Get(context.Background(), "a")
+	g.Get(context.Background(), "b")
+
+	DestroyGroup("destroy")
+	if GetGroup("destroy") != nil {
+		t.Fatal("GetGroup returned a destroyed group")
+	}
+	sort.Strings(evicted)
+	if !reflect.DeepEqual(evicted, []string{"a", "b"}) {
+		t.Fatalf("evicted = %v", evicted)
+	}
+	if _, err := g.Get(context.Background(), "a"); !errors.Is(err, ErrGroupDestroyed) {
+		t.Fatalf("Get after destroy: %v", err)
+	}
+	if err := g.Set("a", []byte("v")); !errors.Is(err, ErrGroupDestroyed) {
+		t.Fatalf("Set after destroy: %v", err)
+	}
+	if _, errs := g.GetMulti(context.Background(), []string{"a"}); !errors.Is(errs["a"], ErrGroupDestroyed) {
+		t.Fatalf("GetMulti after destroy: %v", errs)
+	}
+
+	// 远程节点的请求得到404
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_geecache/destroy/a", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("peer request for destroyed group: %d", w.Code)
+	}
+
+	// 可以用同样的名字重新创建，再次注销不存在的group什么也不做
+	g2 := NewGroup("destroy", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("new-" + key), nil
+	}))
+	if v, err := g2.Get(context.Background(), "a"); err != nil || v.String() != "new-a" {
+		t.Fatalf("Get on new group = %q, %v", v, err)
+	}
+	DestroyGroup("destroy")
+	DestroyGroup("destroy")
+}
+
+func TestEnumerateGroups(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	for _, name := range []string{"enum-c", "enum-a", "enum-b"} {
+		NewGroup(name, 0, getter)
+	}
+	defer func() {
+		for _, name := range []string{"enum-a", "enum-b", "enum-c"} {
+			DestroyGroup(name)
+		}
+	}()
+	names := GroupNames()
+	if !sort.StringsAreSorted(names) {
+		t.Fatalf("GroupNames not sorted: %v", names)
+	}
+	gs := Groups()
+	if len(gs) != len(names) {
+		t.Fatalf("Groups returned %d groups, GroupNames %d", len(gs), len(names))
+	}
+	for i, g := range gs {
+		if g.name != names[i] {
+			t.Fatalf("Groups()[%d] = %s, want %s", i, g.name, names[i])
+		}
+	}
+	var seen []string
+	RangeGroups(func(g *Group) bool {
+		if strings.HasPrefix(g.name, "enum-") {
+			seen = append(seen, g.name)
+		}
+		return len(seen) < 2
+	})
+	if !reflect.DeepEqual(seen, []string{"enum-a", "enum-b"}) {
+		t.Fatalf("RangeGroups stopped after %v", seen)
+	}
+
+	// 遍历时可以创建和注销group，与并发的NewGroup不冲突
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("enum-tmp-%d-%d", i, j)
+				NewGroup(name, 0, getter)
+				DestroyGroup(name)
+			}
+		}(i)
+	}
+	for i := 0; i < 50; i++ {
+		RangeGroups(func(g *Group) bool {
+			if g.name == "enum-a" {
+				NewGroup("enum-inner", 0, getter)
+				DestroyGroup("enum-inner")
+			}
+			return true
+		})
+	}
+	wg.Wait()
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	var calls atomic.Int32
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		calls.Add(1)
+		if key == "big" {
+			return []byte(strings.Repeat("x", 1000)), nil
+		}
+		return []byte(key), nil
+	})
+	g := NewGroup("max-value", 2<<10, getter)
+	for i := 0; i < 10; i++ {
+		g.Get(context.Background(), fmt.Sprintf("k%d", i))
+	}
+	// 大于cacheBytes/4的值照常返回，但不缓存，也不淘汰已有的记录
+	for i := 0; i < 2; i++ {
+		v, err := g.Get(context.Background(), "big")
+		if err != nil || v.Len() != 1000 {
+			t.Fatalf("Get(big) = %d bytes, %v", v.Len(), err)
+		}
+	}
+	if n := calls.Load(); n != 12 {
+		t.Fatalf("getter called %d times, want 12", n)
+	}
+	if g.CachedLocally("big") || g.CacheItems() != 10 {
+		t.Fatalf("big value cached or resident set disturbed: %d items", g.CacheItems())
+	}
+	if s := g.CacheStats(MainCache); s.Oversize != 2 || g.Stats().Oversize != 2 {
+		t.Fatalf("oversize = %d", s.Oversize)
+	}
+
+	// 可以放宽或收紧上限
+	loose := NewGroup("max-value-loose", 2<<10, getter, WithMaxValueBytes(-1))
+	loose.Get(context.Background(), "big")
+	if !loose.CachedLocally("big") {
+		t.Fatal("WithMaxValueBytes(-1) did not cache the big value")
+	}
+	strict := NewGroup("max-value-strict", 2<<10, getter, WithMaxValueBytes(2), WithShards(2))
+	strict.Get(context.Background(), "k1")
+	strict.Get(context.Background(), "k10")
+	if !strict.CachedLocally("k1") || strict.CachedLocally("k10") {
+		t.Fatal("explicit max value size not applied to shards")
+	}
+	// 0表示使用默认的上限
+	zero := NewGroup("max-value-zero", 2<<10, getter, WithMaxValueBytes(-1), WithMaxValueBytes(0))
+	zero.Get(context.Background(), "big")
+	if zero.CachedLocally("big") {
+		t.Fatal("WithMaxValueBytes(0) did not restore the default limit")
+	}
+}
+
+func TestGetterOwnership(t *testing.T) {
+	ctx := context.Background()
+	// 默认直接缓存回调函数交出的切片
+	buf := []byte("value")
+	g := NewGroup("getter-ownership", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return buf, nil
+	}))
+	v, err := g.Get(ctx, "k")
+	if err != nil || unsafe.SliceData(v.b) != unsafe.SliceData(buf) {
+		t.Fatalf("Get = %q, %v, want the getter's slice without a copy", v.String(), err)
+	}
+	// 调用方拿到的可修改的拷贝不影响缓存
+	var b []byte
+	g.GetTo(ctx, "k", AllocatingByteSliceSink(&b))
+	b[0] = 'X'
+	if v, _ := g.Get(ctx, "k"); v.String() != "value" {
+		t.Fatalf("cached value changed to %q through a sink", v.String())
+	}
+
+	// 回调函数会复用切片时，WithGetterCopy使缓存不受影响
+	shared := []byte("first")
+	g = NewGroup("getter-copy", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return shared, nil
+	}), WithGetterCopy())
+	g.Get(ctx, "k")
+	copy(shared, "XXXXX")
+	if v, _ := g.Get(ctx, "k"); v.String() != "first" {
+		t.Fatalf("cached value = %q after the getter reused its slice", v.String())
+	}
+}
+
+// BenchmarkColdRead 测量冷读取（每次都调用回调函数）1MB的值的分配，copy为WithGetterCopy，即以前的行为
+func BenchmarkColdRead(b *testing.B) {
+	const size = 1 << 20
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, size), nil
+	})
+	for _, bc := range []struct {
+		name string
+		opts []GroupOption
+	}{
+		{"owned", nil},
+		{"copy", []GroupOption{WithGetterCopy()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			// cacheBytes为0时不缓存，每次读取都是冷读取
+			g := NewGroup("bench-cold-read-"+bc.name, 0, getter, bc.opts...)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				v, err := g.Get(ctx, "k")
+				if err != nil {
+					b.Fatal(err)
+				}
+				v.WriteTo(io.Discard)
+			}
+		})
+	}
+}
+
+// getHitGroup 返回一个已经缓存了"k"的group
+func getHitGroup(tb testing.TB, name string) *Group {
+	g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	if _, err := g.Get(context.Background(), "k"); err != nil {
+		tb.Fatal(err)
+	}
+	return g
+}
+
+// TestGetHitAllocs 防止命中路径重新引入内存分配
+func TestGetHitAllocs(t *testing.T) {
+	g := getHitGroup(t, "get-hit-allocs")
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(1000, func() {
+		if _, err := g.Get(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 1 {
+		t.Fatalf("Get on a cache hit allocates %v times, want at most 1", allocs)
+	}
+}
+
+func BenchmarkGroupGetHit(b *testing.B) {
+	g := getHitGroup(b, "bench-get-hit")
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Get(ctx, "k"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+)
+
+// 单次读取的选项：调用方刚刚修改了数据源（如更新了数据库中的行），知道缓存的值已经过时，
+// 但只想让自己这一次读取绕过缓存，而不是对所有人失效（Delete）。
+// ForceRefresh忽略mainCache和hotCache中已有的值，照常通过远程节点或回调函数加载，再替换缓存中的记录；
+// key由远程节点负责时，远程节点同样忽略它缓存的值重新加载。
+// SkipPopulate照常查找缓存，但加载到的值（以及key不存在的墓碑）不写入缓存。
+// LocalOnly不把请求转发给远程节点，即使一致性哈希选中了其他节点也调用本地的回调函数，HTTPPool用它处理其他节点转发来的请求。
+// 带选项的加载与普通加载使用不同的singleflight key：同样选项的并发读取合并为一次加载，
+// 但强制刷新不会等待一个可能在数据源修改之前就开始的普通加载，普通读取也不会拿到一个不写入缓存的结果
+
+// GetOptions 是GetWith的选项，零值与Get相同
+type GetOptions struct {
+	ForceRefresh bool // 忽略已缓存的值，重新加载并替换缓存中的记录
+	SkipPopulate bool // 加载到的值不写入缓存
+	LocalOnly    bool // 不转发给远程节点，在本节点加载
+}
+
+// loadKey 返回加载key时使用的singleflight key
+func (o GetOptions) loadKey(key string) string {
+	if o == (GetOptions{}) {
+		return key
+	}
+	// 带\x00前缀，与普通的key区分开
+	return fmt.Sprintf("\x00%t,%t,%t\x00%s", o.ForceRefresh, o.SkipPopulate, o.LocalOnly, key)
+}
+
+// forgetLoads 使之后对key的读取（任何选项）发起新的加载，而不是加入正在进行的、结果已经过时的加载，见Set和Delete
+func (g *Group) forgetLoads(key string) {
+	for i := 0; i < 8; i++ {
+		g.loader.Forget(GetOptions{ForceRefresh: i&1 != 0, SkipPopulate: i&2 != 0, LocalOnly: i&4 != 0}.loadKey(key))
+	}
+}
+
+// ownedRemotely 判断一致性哈希是否把key交给了其他节点
+func (g *Group) ownedRemotely(key string) bool {
+	if g.peers == nil {
+		return false
+	}
+	_, ok := g.peers.PickPeer(key)
+	return ok
+}
+
+// GetWith 按opts读取key，见GetOptions
+func (g *Group) GetWith(ctx context.Context, key string, opts GetOptions) (ByteView, error) {
+	if key == "" {
+		return ByteView{}, fmt.Errorf("key is required")
+	}
+	if len(g.interceptors) == 0 {
+		// 没有拦截器时不构造闭包，命中缓存不分配内存
+		ctx, ck := g.withSourceKey(ctx, key)
+		return g.getWith(ctx, ck, opts)
+	}
+	return g.intercept(ctx, key, func(ctx context.Context) (ByteView, error) {
+		ctx, ck := g.withSourceKey(ctx, key)
+		return g.getWith(ctx, ck, opts)
+	})
+}
+
+// getWith 与GetWith相同，key已经是缓存key，加载key在ctx中，见WithKeyHashing
+func (g *Group) getWith(ctx context.Context, key string, opts GetOptions) (ByteView, error) {
+	if key == "" {
+		return ByteView{}, fmt.Errorf("key is required")
+	}
+	if g.destroyed.Load() {
+		return ByteView{}, ErrGroupDestroyed
+	}
+	if opts.ForceRefresh {
+		g.stats.gets.Add(1)
+	} else if v, ok := g.lookupCache(ctx, key); ok {
+		if v.err != nil {
+			return ByteView{}, v.err
+		}
+		return v, nil
+	}
+	var dest ByteView
+	// 缓存里没有，load去其他节点拿 or 回调函数去数据库拿；加载在其他goroutine中进行，不把GetInfo交给它
+	res, _, err := g.load(withoutGetInfo(ctx), key, opts, ByteViewSink(&dest))
+	if err != nil {
+		return ByteView{}, err
+	}
+	recordLoad(ctx, res)
+	return res.view, nil
+}
@@ -0,0 +1,133 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForceRefresh(t *testing.T) {
+	var loads atomic.Int32
+	block := make(chan struct{})
+	g := NewGroup("force-refresh", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		n := loads.Add(1)
+		if n == 2 {
+			<-block // 强制刷新期间阻塞，检查并发的强制刷新合并为一次加载
+		}
+		return []byte(fmt.Sprintf("v%d", n)), nil
+	}))
+	ctx := context.Background()
+	if v, _ := g.Get(ctx, "k"); v.String() != "v1" {
+		t.Fatalf("Get = %s, want v1", v)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.GetWith(ctx, "k", GetOptions{ForceRefresh: true}); err != nil || v.String() != "v2" {
+				t.Errorf("forced GetWith = %s, %v, want v2", v, err)
+			}
+		}()
+	}
+	waitFor(t, func() bool { return loads.Load() == 2 })
+	// 刷新完成之前普通读取仍然拿到旧值
+	if v, _ := g.Get(ctx, "k"); v.String() != "v1" {
+		t.Fatalf("Get during refresh = %s, want v1", v)
+	}
+	// 等所有强制刷新都进入load，再给它们一点时间加入正在进行的加载，否则晚到的会开始新的加载
+	waitFor(t, func() bool { return g.stats.loads.Load() == 21 })
+	time.Sleep(20 * time.Millisecond)
+	close(block)
+	wg.Wait()
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("loads = %d, want forced refreshes collapsed into one", n)
+	}
+	if v, _ := g.Get(ctx, "k"); v.String() != "v2" || loads.Load() != 2 {
+		t.Fatalf("Get after refresh = %s, loads=%d, want cached v2", v, loads.Load())
+	}
+}
+
+func TestSkipPopulate(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroup("skip-populate", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(fmt.Sprintf("v%d", loads.Add(1))), nil
+	}))
+	ctx := context.Background()
+	if v, _ := g.GetWith(ctx, "k", GetOptions{SkipPopulate: true}); v.String() != "v1" {
+		t.Fatalf("GetWith = %s, want v1", v)
+	}
+	if g.CachedLocally("k") {
+		t.Fatal("SkipPopulate stored the loaded value")
+	}
+	g.Get(ctx, "k") // v2，写入缓存
+	// 命中时直接返回缓存值；强制刷新但不写入时缓存保持不变
+	if v, _ := g.GetWith(ctx, "k", GetOptions{SkipPopulate: true}); v.String() != "v2" {
+		t.Fatalf("GetWith on hit = %s, want cached v2", v)
+	}
+	if v, _ := g.GetWith(ctx, "k", GetOptions{ForceRefresh: true, SkipPopulate: true}); v.String() != "v3" {
+		t.Fatalf("forced GetWith = %s, want v3", v)
+	}
+	if v, _ := g.Get(ctx, "k"); v.String() != "v2" {
+		t.Fatalf("Get = %s, want v2 left in cache", v)
+	}
+}
+
+func TestForceRefreshThroughPeer(t *testing.T) {
+	silenceLog(t)
+	const name = "force-refresh-peer"
+	var version atomic.Int32
+	version.Store(1)
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(fmt.Sprintf("v%d", version.Load())), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("k%d", i); pools[0].peers.Get(k) == urls[1] {
+			key = k
+		}
+	}
+	a, b := groups[0], groups[1]
+	ctx := context.Background()
+
+	a.Get(ctx, key) // A的hotCache和B的mainCache中都是v1
+	version.Store(2)
+	if v, _ := a.Get(ctx, key); v.String() != "v1" {
+		t.Fatalf("Get = %s, want cached v1", v)
+	}
+	// 强制刷新让B重新加载，A和B的缓存都换成新值
+	if v, err := a.GetWith(ctx, key, GetOptions{ForceRefresh: true}); err != nil || v.String() != "v2" {
+		t.Fatalf("forced GetWith = %s, %v, want v2", v, err)
+	}
+	if v, _ := a.Get(ctx, key); v.String() != "v2" {
+		t.Fatalf("A's hot cache = %s, want v2", v)
+	}
+	if v, _ := b.Get(ctx, key); v.String() != "v2" {
+		t.Fatalf("owner's cache = %s, want v2", v)
+	}
+}
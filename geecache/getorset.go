@@ -0,0 +1,85 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+)
+
+// GetOrSet：“有缓存的值就返回它，否则把我手上的这个值放进缓存”。先Get再Set有竞争：两个调用方同时未命中，后一个Set覆盖前一个。
+// GetOrSet在key所在的节点上原子地完成检查和写入：比较和写入在分片的锁内一起完成（与SetIfVersion期望版本号为0相同），
+// 并且通过loader进行，与同一个key上的读穿透加载互相等待——正在进行的加载先开始时返回加载的结果，
+// GetOrSet先开始时同时到达的Get拿到写入的值。key由其他节点负责时转发给那个节点执行，整个集群对结果一致。
+// GetOrSet不调用回调函数，负缓存的墓碑不算作已有的值
+
+// GetOrSet 返回key已经缓存的值，stored为false；没有缓存时写入value（会被拷贝）并返回它，stored为true。
+// 维护期间返回ErrMaintenance
+func (g *Group) GetOrSet(ctx context.Context, key string, value []byte) (v ByteView, stored bool, err error) {
+	if key == "" {
+		return ByteView{}, false, fmt.Errorf("key is required")
+	}
+	if g.destroyed.Load() {
+		return ByteView{}, false, ErrGroupDestroyed
+	}
+	key = g.cacheKey(key)
+	view := ByteView{b: cloneBytes(value)}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			return g.getOrSetOnPeer(ctx, peer, key, view)
+		}
+	}
+	return g.getOrSetLocally(ctx, key, view)
+}
+
+// getOrSetOnPeer 让所属节点执行GetOrSet，结果同时放进本节点的hotCache
+func (g *Group) getOrSetOnPeer(ctx context.Context, peer PeerGetter, key string, value ByteView) (ByteView, bool, error) {
+	gp, ok := peer.(getOrSetPeer)
+	if !ok {
+		return ByteView{}, false, fmt.Errorf("geecache: peer for key %q does not support GetOrSet", key)
+	}
+	e, stored, err := gp.GetOrSet(ctx, g.name, key, value.b)
+	if err != nil {
+		return ByteView{}, false, err
+	}
+	v := g.withPeerExpiry(ByteView{b: e.Value, soft: g.after(e.SoftTTL), expire: g.after(e.HardTTL), version: e.Version})
+	g.hotCache.add(key, v)
+	g.trimCaches()
+	return v, stored, nil
+}
+
+// getOrSetLocally 在本节点执行GetOrSet，不再转发；value归本地缓存所有
+func (g *Group) getOrSetLocally(ctx context.Context, key string, value ByteView) (ByteView, bool, error) {
+	if key == "" {
+		return ByteView{}, false, fmt.Errorf("key is required")
+	}
+	if g.maint.active.Load() {
+		return ByteView{}, false, ErrMaintenance
+	}
+	stored := false
+	res, err := g.loader.DoContext(ctx, key, func(context.Context) (interface{}, error) {
+		for {
+			if v, ok := g.mainCache.peek(key); ok && v.err == nil {
+				return loaded{view: v, source: SourceHit}, nil
+			}
+			// 检查之后有其他写入时版本号不再是0，重新读取
+			var absent uint64
+			v := g.withDefaultExpiry(value)
+			version, err := g.mainCache.setVersioned(key, v, &absent)
+			if err == ErrVersionMismatch {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			g.forgetNotFound(key)
+			g.trimCaches()
+			stored = true
+			v.version = version
+			return loaded{view: v, source: SourceLocal}, nil
+		}
+	})
+	if err != nil {
+		return ByteView{}, false, err
+	}
+	// 等待了其他调用方发起的加载或GetOrSet时，写入的不是value
+	return res.(loaded).view, stored, nil
+}
@@ -0,0 +1,144 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrSet(t *testing.T) {
+	ctx := context.Background()
+	g := NewGroup("get-or-set", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	if v, stored, err := g.GetOrSet(ctx, "k", []byte("first")); err != nil || !stored || v.String() != "first" {
+		t.Fatalf("GetOrSet = %q, %v, %v, want first stored", v.String(), stored, err)
+	}
+	if v, stored, err := g.GetOrSet(ctx, "k", []byte("second")); err != nil || stored || v.String() != "first" {
+		t.Fatalf("second GetOrSet = %q, %v, %v, want the existing value", v.String(), stored, err)
+	}
+	g.Delete("k")
+	if v, stored, _ := g.GetOrSet(ctx, "k", []byte("third")); !stored || v.String() != "third" {
+		t.Fatalf("GetOrSet after Delete = %q, %v", v.String(), stored)
+	}
+}
+
+// raceGetOrSet 让n个GetOrSet和n个Get同时读写key，检查所有调用方看到同一个值，并且最多一个GetOrSet写入了自己的值
+func raceGetOrSet(t *testing.T, groups []*Group, key string, n int) {
+	t.Helper()
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		seen   = make(map[string]int)
+		stores []string
+	)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		g := groups[i%len(groups)]
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			mine := fmt.Sprintf("value%d", i)
+			v, stored, err := g.GetOrSet(context.Background(), key, []byte(mine))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			seen[v.String()]++
+			if stored {
+				if v.String() != mine {
+					t.Errorf("stored GetOrSet returned %q, want its own value %q", v.String(), mine)
+				}
+				stores = append(stores, mine)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			<-start
+			v, err := g.Get(context.Background(), key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			seen[v.String()]++
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if len(seen) != 1 || len(stores) > 1 {
+		t.Fatalf("callers saw %v with %d stored values, want one value", seen, len(stores))
+	}
+	if len(stores) == 1 && seen[stores[0]] != 2*n {
+		t.Fatalf("stored %q but callers saw %v", stores[0], seen)
+	}
+}
+
+func TestGetOrSetConcurrent(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		g := NewGroup("get-or-set-race", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			time.Sleep(time.Millisecond)
+			return []byte("loaded"), nil
+		}))
+		raceGetOrSet(t, []*Group{g}, "k", 16)
+	}
+}
+
+func TestGetOrSetThroughPeer(t *testing.T) {
+	const name = "get-or-set-peer"
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+		loads  atomic.Int32
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			loads.Add(1)
+			time.Sleep(time.Millisecond)
+			return []byte("loaded"), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, pool := range pools {
+		pool.Set(urls...)
+	}
+	var keys []string
+	for i := 0; len(keys) < 5; i++ {
+		if k := fmt.Sprintf("key%d", i); pools[0].peers.Get(k) == urls[1] {
+			keys = append(keys, k)
+		}
+	}
+	for _, key := range keys {
+		raceGetOrSet(t, groups, key, 8)
+	}
+
+	// 所属节点决定结果：A转发的GetOrSet写入之后，B上的GetOrSet看到同一个值
+	key := fmt.Sprintf("fresh-%d", time.Now().UnixNano())
+	for pools[0].peers.Get(key) != urls[1] {
+		key += "x"
+	}
+	if v, stored, err := groups[0].GetOrSet(context.Background(), key, []byte("from A")); err != nil || !stored || v.String() != "from A" {
+		t.Fatalf("GetOrSet via A = %q, %v, %v", v.String(), stored, err)
+	}
+	if v, stored, _ := groups[1].GetOrSet(context.Background(), key, []byte("from B")); stored || v.String() != "from A" {
+		t.Fatalf("GetOrSet on the owner = %q, %v, want the value set via A", v.String(), stored)
+	}
+}
@@ -0,0 +1,122 @@
+package geecache
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// 热点缓存：一致性哈希把key交给其他节点负责时，本节点从不缓存它，热点key的每次请求都要访问一次网络。
+// 与groupcache一样，从远程节点取回的值放进一个单独的hotCache，Get依次查找mainCache和hotCache。
+// hotCache的上限是cacheBytes的1/8；两者合计超出cacheBytes时，hotCache超过mainCache的1/8就从hotCache淘汰，
+// 否则从mainCache淘汰，因此总占用不超过cacheBytes，而只有本地key的节点（单机）仍然可以把cacheBytes全部用于mainCache
+
+// hotCacheRatio 是hotCache的上限占cacheBytes的比例的倒数
+const hotCacheRatio = 8
+
+// hotBytes 返回cacheBytes对应的hotCache上限，cacheBytes大于0时至少为1，否则hotCache与mainCache一起关闭
+func hotBytes(cacheBytes int64) int64 {
+	if cacheBytes > 0 && cacheBytes < hotCacheRatio {
+		return 1
+	}
+	return cacheBytes / hotCacheRatio
+}
+
+// 是否放进hotCache由PromotionPolicy决定：默认总是放入；PromoteNever让每次读取远程key都访问网络，不占本节点的内存；
+// PromoteOneIn(k)与groupcache一样随机放入1/k，只有被频繁读取的key才大概率留在hotCache中。
+// 远程节点确认key不存在的墓碑不受影响，只由WithNegativeTTL决定
+
+// PromotionPolicy 决定从远程节点取回的value是否放进本节点的hotCache，可能被并发调用
+type PromotionPolicy interface {
+	Promote(key string, value ByteView) bool
+}
+
+// PromotionPolicyFunc 是函数形式的PromotionPolicy
+type PromotionPolicyFunc func(key string, value ByteView) bool
+
+func (f PromotionPolicyFunc) Promote(key string, value ByteView) bool {
+	return f(key, value)
+}
+
+var (
+	PromoteAlways PromotionPolicy = PromotionPolicyFunc(func(string, ByteView) bool { return true })  // 总是放入（默认）
+	PromoteNever  PromotionPolicy = PromotionPolicyFunc(func(string, ByteView) bool { return false }) // 从不放入
+)
+
+// oneIn 以1/k的概率放入
+type oneIn struct {
+	k    int
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// PromoteOneIn 返回以1/k的概率放入的策略，k小于等于1时总是放入。seed为随机数种子，测试中固定它可以得到确定的结果
+func PromoteOneIn(k int, seed int64) PromotionPolicy {
+	return &oneIn{k: k, rand: rand.New(rand.NewSource(seed))}
+}
+
+func (p *oneIn) Promote(string, ByteView) bool {
+	if p.k <= 1 {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rand.Intn(p.k) == 0
+}
+
+// WithPromotionPolicy 设置从远程节点取回的值是否放进hotCache的策略，默认为PromoteAlways
+func WithPromotionPolicy(p PromotionPolicy) GroupOption {
+	return func(g *Group) {
+		g.promotion = p
+	}
+}
+
+// initHotCache 按mainCache的配置初始化hotCache，在所有选项生效之后调用
+func (g *Group) initHotCache() {
+	g.hotCache.cacheBytes = hotBytes(g.mainCache.cacheBytes)
+	g.hotCache.unlimited = g.mainCache.unlimited
+	g.hotCache.now = g.mainCache.now
+	g.hotCache.maxValue = g.mainCache.maxValue
+}
+
+// promote 按PromotionPolicy把从远程节点取回的value写入hotCache，参数和返回值同populateHotCache
+func (g *Group) promote(key string, value ByteView, since uint64) (ByteView, bool) {
+	if g.promotion != nil {
+		promote := false
+		g.protect("PromotionPolicy", func() { promote = g.promotion.Promote(key, value) })
+		if !promote {
+			return value, true
+		}
+	}
+	g.stats.promotions.Add(1)
+	return g.populateHotCache(key, value, since)
+}
+
+// populateHotCache 把从远程节点取回的值写入hotCache，since是开始请求前hotCache的写入计数，
+// 期间key被写入了更新的值时保留那个值，见set.go。返回hotCache中最终的值，以及value是否被写入
+func (g *Group) populateHotCache(key string, value ByteView, since uint64) (ByteView, bool) {
+	value, stored := g.hotCache.addLoaded(key, value, since)
+	g.trimCaches()
+	return value, stored
+}
+
+// trimCaches 在mainCache和hotCache合计超出cacheBytes时淘汰记录，直到合计不超过cacheBytes
+func (g *Group) trimCaches() {
+	limit := g.mainCache.maxBytes()
+	if limit == 0 || g.hotCache.bytes() == 0 {
+		return
+	}
+	for {
+		mainBytes, hotBytes := g.mainCache.bytes(), g.hotCache.bytes()
+		if mainBytes+hotBytes <= limit {
+			return
+		}
+		if hotBytes > mainBytes/hotCacheRatio {
+			g.hotCache.removeOldest()
+		} else {
+			g.mainCache.removeOldest()
+		}
+		if g.mainCache.bytes()+g.hotCache.bytes() == mainBytes+hotBytes {
+			return // 剩下的记录都被Pin住了
+		}
+	}
+}
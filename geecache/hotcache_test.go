@@ -0,0 +1,104 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHotCache(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+
+	// 远程节点b负责所有key，统计它收到的请求
+	poolB := NewHTTPPool("b")
+	NewGroup("hot-cache", 2<<10, getter).RegisterPeers(poolB)
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		poolB.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	poolA := NewHTTPPool("a")
+	poolA.Set(srv.URL)
+	a := NewGroup("hot-cache", 160, getter)
+	a.RegisterPeers(poolA)
+
+	for i := 0; i < 3; i++ {
+		if v, err := a.Get(context.Background(), "hot"); err != nil || v.String() != "hot" {
+			t.Fatalf("Get(hot) = %q, %v", v.String(), err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("remote-owned hot key fetched %d times, want 1", n)
+	}
+	if s := a.CacheStats(HotCache); s.Items != 1 || s.Hits != 2 {
+		t.Fatalf("hot cache stats = %+v", s)
+	}
+	if a.CachedLocally("hot") || a.CacheStats(MainCache).Items != 0 {
+		t.Fatal("remote-owned key stored in mainCache")
+	}
+
+	// 本地加载的值与热点值合计不超过cacheBytes
+	for i := 0; i < 20; i++ {
+		a.populateCache(fmt.Sprintf("local%02d", i), ByteView{b: []byte("value")})
+		a.Get(context.Background(), fmt.Sprintf("remote%02d", i))
+	}
+	main, hot := a.Stats().Cache, a.Stats().HotCache
+	if main.Bytes+hot.Bytes > 160 || hot.Bytes > 160/hotCacheRatio {
+		t.Fatalf("main %d + hot %d bytes exceeds the budget", main.Bytes, hot.Bytes)
+	}
+	a.RemovePrefix("remote")
+	a.Clear()
+	if a.CacheStats(HotCache).Items != 0 {
+		t.Fatal("Clear left entries in the hot cache")
+	}
+}
+
+func TestPromotionPolicy(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+
+	// 固定种子下，1/10的策略在多次判断中放入的比例接近1/10
+	p := PromoteOneIn(10, 1)
+	const n = 20000
+	promoted := 0
+	for i := 0; i < n; i++ {
+		if p.Promote("k", ByteView{}) {
+			promoted++
+		}
+	}
+	if promoted < n/10*8/10 || promoted > n/10*12/10 {
+		t.Fatalf("PromoteOneIn(10) promoted %d of %d", promoted, n)
+	}
+
+	tests := []struct {
+		name   string
+		policy PromotionPolicy
+		check  func(promotions, peerCalls int64) bool
+	}{
+		{"default", nil, func(pr, calls int64) bool { return pr == 1 && calls == 1 }},
+		{"never", PromoteNever, func(pr, calls int64) bool { return pr == 0 && calls == 100 }},
+		{"one-in-4", PromoteOneIn(4, 7), func(pr, calls int64) bool { return pr == 1 && calls > 1 && calls < 30 }},
+	}
+	for _, tt := range tests {
+		var opts []GroupOption
+		if tt.policy != nil {
+			opts = append(opts, WithPromotionPolicy(tt.policy))
+		}
+		peer := &echoPeer{}
+		g := NewGroup("promotion-"+tt.name, 2<<10, getter, opts...)
+		g.RegisterPeers(fakePeers{peer})
+		for i := 0; i < 100; i++ {
+			if v, err := g.Get(context.Background(), "hot"); err != nil || v.String() != "hot" {
+				t.Fatalf("%s: Get = %q, %v", tt.name, v, err)
+			}
+		}
+		if s := g.Stats(); !tt.check(s.Promotions, int64(peer.calls.Load())) {
+			t.Fatalf("%s: %d promotions, %d peer requests", tt.name, s.Promotions, peer.calls.Load())
+		}
+	}
+}
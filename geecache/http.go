@@ -1,55 +1,156 @@
 package geecache
 
 import (
-	"fmt"
+	"bufio"
+	"context"
+	"errors"
 	"geecache/geecache/consistenthash"
+	"geecache/geecache/internal/protocol"
 	"io"
-	"log"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // 基于http， 提供被其他节点访问的能力，如果一个节点启动了它的HTTP服务端，那么它就可以被其他节点访问
 
 const (
-	defaultBasePath = "/_geecache/"
-	defaultReplicas = 50
+	defaultBasePath = protocol.DefaultBasePath
+	defaultReplicas = protocol.DefaultReplicas
 )
 
 // 约定访问路径格式为/<basepath>/<groupname>/<key>
 // 通过groupname得到group实例， 再使用group.Get(key)获取缓存数据
 
 type HTTPPool struct {
-	self     string // 自己的地址，包括ip + port
-	basePath string //节点间通信地址的前缀
-	mu       sync.Mutex
-	peers    *consistenthash.Map // 根据具体的key选择节点
+	self        string // 自己的地址，包括ip + port
+	basePath    string //节点间通信地址的前缀
+	mu          sync.Mutex
+	peers       *consistenthash.Map // 根据具体的key选择节点
+	replicas    int                 // 一致性哈希的虚拟节点倍数
+	boundedLoad float64             // 有界负载的系数，0表示不开启，见WithBoundedLoad
 
 	// 键是"http://10.0.0.2:8008"，值是对应的HTTP客户端
 	// 即，从一致性哈希里面找到了key存在"http://10.0.0.2:8008"这个远程节点上，利用此字段就可获取到访问这个远程节点的HTTP客户端
 	httpGetters map[string]*httpGetter
 	// 映射远程节点与对应的 httpGetter。每一个远程节点对应一个 httpGetter，因为 httpGetter 与远程节点的地址 baseURL 有关
+
+	peerConcurrency int            // 每个远程节点允许的最大并发请求数，0表示不限制
+	groupWeights    map[string]int // 远程节点并发达到上限时，各group排队请求的轮询权重，默认为1
+
+	groups map[string]*Group // 通过RegisterPeers注册到本HTTPPool的group，同一进程中运行多个节点时互不干扰
+
+	flags       Flags // 运行时功能开关
+	fairQueueOn *atomic.Bool
+	adminToken  string // 访问管理接口需要的令牌，为空时管理接口关闭
+
+	maxBatchBytes int64 // 批量读取响应中值的累计大小上限，0表示使用protocol.DefaultMaxBatchBytes
+
+	allowed map[string]bool // 固定的group白名单，为nil时允许所有已注册的group
+	guard   groupGuard
+
+	importRate     int // 每个导入请求每秒最多处理的记录数，0表示不限制
+	maxImportEntry int // 导入记录中key或value的大小上限，0表示使用defaultMaxImportEntry
+
+	log Logger // 日志，nil表示使用默认的StdLogger(false)，见logger.go
+}
+
+// PoolOption 用于在创建HTTPPool时修改默认配置
+type PoolOption func(*HTTPPool)
+
+// WithPeerConcurrency 限制对每个远程节点同时发出的请求数
+// 达到上限后，请求按group排队，并在group之间加权轮询，避免一个group的流量饿死共享同一HTTPPool的其他group
+func WithPeerConcurrency(n int) PoolOption {
+	return func(p *HTTPPool) {
+		p.peerConcurrency = n
+	}
 }
 
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+// WithGroupWeight 设置group排队时的轮询权重，权重为n的group每轮最多可以连续发出n个请求
+func WithGroupWeight(group string, weight int) PoolOption {
+	return func(p *HTTPPool) {
+		if p.groupWeights == nil {
+			p.groupWeights = make(map[string]int)
+		}
+		p.groupWeights[group] = weight
+	}
+}
+
+// WithReplicas 设置一致性哈希的虚拟节点倍数，默认为50，集群中所有节点以及client、ownership包必须使用相同的值
+func WithReplicas(n int) PoolOption {
+	return func(p *HTTPPool) {
+		p.replicas = n
+	}
+}
+
+// WithBoundedLoad 开启有界负载：读取时，如果key所属节点正在进行的请求数达到c×平均值，改由哈希环上顺时针的下一个不超过上限的节点处理，
+// 避免热点key集中的节点过载（见consistenthash.Map.GetBounded）。c必须大于1。
+// 接手的节点（包括本节点）在本地加载这个key但不写入缓存：写入、删除以及所属节点的判断仍然使用原来的节点，
+// 它们不会通知接手的节点，留下的副本无法失效。本节点的负载不计入，因此本节点总是可以接手
+func WithBoundedLoad(c float64) PoolOption {
+	return func(p *HTTPPool) {
+		p.boundedLoad = c
+	}
+}
+
+// WithMaxBatchBytes 设置批量读取响应中值的累计大小上限，超过后剩余的key由请求方单独读取
+func WithMaxBatchBytes(n int64) PoolOption {
+	return func(p *HTTPPool) {
+		p.maxBatchBytes = n
+	}
+}
+
+// WithAdminToken 开启管理接口（/_geecache/flags），请求需要携带"Authorization: Bearer <token>"
+func WithAdminToken(token string) PoolOption {
+	return func(p *HTTPPool) {
+		p.adminToken = token
+	}
+}
+
+func NewHTTPPool(self string, opts ...PoolOption) *HTTPPool {
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		replicas: defaultReplicas,
+	}
+	p.fairQueueOn = p.flags.register(FlagPeerFairQueue, true)
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
-func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("Server %s] %s", p.self, fmt.Sprintf(format, v...))
+// groupWeight 返回group的轮询权重，未配置或配置非法时为1
+func (p *HTTPPool) groupWeight(group string) int {
+	if w := p.groupWeights[group]; w > 0 {
+		return w
+	}
+	return 1
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 判断访问路径的前缀是否是basepath， 如果不是返回错误信息
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		// 说明HTTPPool被挂载在了错误的路径上
+		p.logger().Errorf("Server %s] HTTPPool serving unexpected path: %s", p.self, r.URL.Path)
+		http.Error(w, "unexpected path: "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	p.debugf("%s %s", r.Method, r.URL.Path)
+
+	switch r.URL.Path {
+	case p.basePath + "flags":
+		p.serveFlags(w, r)
+		return
+	case p.basePath + "stats":
+		p.serveStats(w, r)
+		return
+	case p.basePath + "import":
+		p.serveImport(w, r)
+		return
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
 
 	// <basepath>/<groupname>/<key>
 	// 第一个参数实际的输入是<groupname>/<key>
@@ -66,89 +167,562 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	key := parts[1]
 
 	// 返回指定name的group
-	group := GetGroup(groupName)
+	group := p.getGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group"+groupName, http.StatusNotFound)
+		p.rejectUnknownGroup(w, r, groupName)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut:
+		// 其他节点转发来的Set，只写入本地缓存，不再转发
+		value, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get(protocol.HeaderGetOrSet) != "" {
+			view, stored, err := group.getOrSetLocally(r.Context(), key, ByteView{b: value})
+			if err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			if stored {
+				w.Header().Set(protocol.HeaderStored, "1")
+			}
+			writeView(w, group, view)
+			return
+		}
+		var ifVersion *uint64
+		if s := r.Header.Get(protocol.HeaderIfVersion); s != "" {
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				http.Error(w, "bad "+protocol.HeaderIfVersion+" header", http.StatusBadRequest)
+				return
+			}
+			ifVersion = &v
+		}
+		version, err := group.setLocally(key, value, ifVersion)
+		if err == ErrVersionMismatch {
+			w.Header().Set(protocol.HeaderVersion, strconv.FormatUint(version, 10))
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if version != 0 {
+			w.Header().Set(protocol.HeaderVersion, strconv.FormatUint(version, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case r.Method == http.MethodHead:
+		// 存在检查只看本地缓存，不触发加载
+		if !group.existsLocally(key) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	case r.Method == http.MethodPost && key == "":
+		p.serveBatch(w, r, group)
+		return
+	case r.Method == http.MethodDelete && key == "" && r.URL.Query().Has("flush"):
+		// 清空只作用于本地缓存，由发起节点负责通知其他节点
+		if err := group.flushLocally(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case r.Method == http.MethodDelete && key == "":
+		// 前缀失效只作用于本地缓存，由发起节点负责通知其他节点
+		if group.keyHash != nil {
+			http.Error(w, ErrPrefixWithKeyHashing.Error(), http.StatusBadRequest)
+			return
+		}
+		n := group.removeLocalPrefix(r.URL.Query().Get("prefix"), true)
+		w.Write([]byte(strconv.Itoa(n)))
+		return
+	case r.Method == http.MethodDelete:
+		// 其他节点转发来的Delete，只删除本地缓存，不再转发
+		if err := group.removeLocally(key); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	// 根据key值取缓存
-	view, err := group.Get(key)
+	ctx, key, err := requestKey(r, group, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 根据key值取缓存，请求方要求时忽略已缓存的值重新加载
+	view, err := group.getWith(ctx, key, GetOptions{
+		ForceRefresh: r.Header.Get(protocol.HeaderRefresh) != "",
+		LocalOnly:    forwarded(r),
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if isNotFound(err) {
+			// 带上这个头，请求方据此还原出ErrNotFound，与路径错误、未知group等404区分
+			w.Header().Set(protocol.HeaderNotFound, "1")
+		}
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
+	writeView(w, group, view)
+}
+
+// writeView 以单个读取的格式写出view：值、剩余的过期时间和版本号
+func writeView(w http.ResponseWriter, group *Group, view ByteView) {
 	// 设置httpResponse的头部
 	// Content-Type：内容类型：application/octet-stream：二进制流数据（如常见的文件下载）
 	w.Header().Set("Content-Type", "application/octet-stream")
+	// 写明长度，请求方可以一次分配好接收的缓冲区，较大的值也不会改用分块传输
+	w.Header().Set("Content-Length", strconv.Itoa(view.Len()))
+	// 把剩余的软/硬过期时间带给请求方
+	protocol.SetTTLHeaders(w.Header(), group.remaining(view.soft), group.remaining(view.expire))
+	if view.version != 0 {
+		w.Header().Set(protocol.HeaderVersion, strconv.FormatUint(view.version, 10))
+	}
 	// 将缓存值作为httpResponse的body返回
-	w.Write(view.ByteSlice())
+	view.WriteTo(w)
 }
 
-// Set 实例化了一致性哈希算法, 并且添加了传入的节点，并为每一个节点创建了一个HTTP客户端httpGetter
-// peers是一个字符串数组["http://localhost:8001","http://localhost:8002","http://localhost:8003"]
-func (p *HTTPPool) Set(peers ...string) {
+// requestKey 返回读取请求的缓存key，以及带着加载key的ctx。其他节点转发的请求路径中已经是缓存key，
+// 原来的key在请求体中，见WithKeyHashing；没有请求体时路径中是原来的key，在这里换成缓存key
+func requestKey(r *http.Request, group *Group, key string) (context.Context, string, error) {
+	if r.ContentLength <= 0 {
+		ctx, key := group.withSourceKey(r.Context(), key)
+		return ctx, key, nil
+	}
+	source, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if group.cacheKey(string(source)) != key {
+		return nil, "", errors.New("key in request body does not match the path")
+	}
+	return group.withSourceKeys(r.Context(), sourceKeys{key: string(source)}), key, nil
+}
+
+// forwarded 判断请求是否由其他节点转发而来。这样的请求只在本节点加载：发起节点认为key由本节点负责，
+// 本节点的节点列表却可能认为由发起节点（或第三个节点）负责，再转发出去请求就会在节点之间循环直到超时
+func forwarded(r *http.Request) bool {
+	return r.Header.Get(protocol.HeaderFrom) != ""
+}
+
+// errorStatus 返回读取失败时的HTTP状态码：key不存在为404，回调函数（数据源）失败为502，加载超时为504，回调函数并发、内存预算或调用速率已满为503，
+// group已注销为404，维护模式、请求取消和回调函数panic等本节点自身的问题为500
+func errorStatus(err error) int {
+	var panicErr *CallbackPanicError
+	switch {
+	case isNotFound(err), errors.Is(err, ErrGroupDestroyed):
+		return http.StatusNotFound
+	case errors.Is(err, ErrLoadTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrTooManyLoads), errors.Is(err, ErrInFlightBytes), errors.Is(err, ErrThrottled):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrMaintenance), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &panicErr):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadGateway
+}
+
+// serveBatch 处理批量读取，按请求顺序逐个写出每个key的结果
+func (p *HTTPPool) serveBatch(w http.ResponseWriter, r *http.Request, group *Group) {
+	keys, err := protocol.ReadBatchRequest(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := p.maxBatchBytes
+	if limit <= 0 {
+		limit = protocol.DefaultMaxBatchBytes
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	flusher, _ := w.(http.Flusher)
+	bw := bufio.NewWriter(w)
+	var written int64
+	opts := GetOptions{LocalOnly: forwarded(r)}
+	for i, key := range keys {
+		view, err := group.GetWith(r.Context(), key, opts)
+		if written+int64(view.Len()) > limit {
+			// 达到上限后不再加载剩余的key，请求方会逐个单独读取
+			for range keys[i:] {
+				if err := protocol.WriteRetry(bw); err != nil {
+					return
+				}
+			}
+			break
+		}
+		written += int64(view.Len())
+		if err := protocol.WriteResult(bw, view.b, err); err != nil {
+			return
+		}
+		// 每个结果立即发出，请求方不必等待整个响应
+		if bw.Flush() != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	bw.Flush()
+}
+
+// addGroup 记录注册到本HTTPPool的group
+func (p *HTTPPool) addGroup(g *Group) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	if p.groups == nil {
+		p.groups = make(map[string]*Group)
+	}
+	p.groups[g.name] = g
+}
+
+// removeGroup 删除注册到本HTTPPool的g，同名的group已经被替换时什么也不做
+func (p *HTTPPool) removeGroup(g *Group) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.groups[g.name] == g {
+		delete(p.groups, g.name)
+	}
+}
+
+// getGroup 优先返回注册到本HTTPPool的group，找不到时再查全局的groups；不在白名单中的group视为不存在
+func (p *HTTPPool) getGroup(name string) *Group {
+	if p.allowed != nil && !p.allowed[name] {
+		return nil
+	}
+	p.mu.Lock()
+	g := p.groups[name]
+	p.mu.Unlock()
+	if g == nil {
+		g = GetGroup(name)
+	}
+	return g
+}
+
+// Set 把一致性哈希的节点设置为传入的节点，并为每一个节点准备一个HTTP客户端httpGetter
+// peers是一个字符串数组["http://localhost:8001","http://localhost:8002","http://localhost:8003"]。
+// 只增删有变化的节点：没有变化的节点的httpGetter（以及其中的排队状态）继续使用，只有增删的节点上的key移动
+func (p *HTTPPool) Set(peers ...string) {
+	weights := make(map[string]int, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		weights[peer] = 1
 	}
+	p.SetWithWeights(weights)
+}
+
+// SetWithWeights 与Set相同，但每个节点在哈希环上的虚拟节点数按权重放大，负责的key大约与权重成正比，
+// 用于配置不同的节点（如内存是其他节点4倍的节点权重为4）。权重必须为正数，所有节点应当使用相同的权重
+func (p *HTTPPool) SetWithWeights(weights map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = consistenthash.New(p.replicas, nil)
+		p.httpGetters = make(map[string]*httpGetter, len(weights))
+		if p.boundedLoad > 0 {
+			p.peers.SetBoundedLoad(p.boundedLoad, p.peerLoad)
+		}
+	}
+	p.peers.SetNodesWithWeights(weights)
+	// 所有节点共用http.DefaultClient，删除的节点的空闲连接由它的空闲超时关闭
+	for peer := range p.httpGetters {
+		if _, ok := weights[peer]; !ok {
+			delete(p.httpGetters, peer)
+		}
+	}
+	for peer := range weights {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		h := &httpGetter{addr: peer, baseURL: peer + p.basePath, self: p.self, queueOn: p.fairQueueOn}
+		if p.peerConcurrency > 0 {
+			h.queue = newFairQueue(p.peerConcurrency, p.groupWeight)
+		}
+		p.httpGetters[peer] = h
+	}
+}
+
+// RemovePeer 把peer从哈希环上移除，只有原来由它负责的key改由其他节点负责；peer不在环上时什么也不做
+func (p *HTTPPool) RemovePeer(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return
+	}
+	p.peers.Remove(peer)
+	delete(p.httpGetters, peer)
+}
+
+// Flags 返回HTTPPool的运行时功能开关
+func (p *HTTPPool) Flags() *Flags {
+	return &p.flags
+}
+
+// QueueStats 返回每个远程节点当前的并发请求数和各group的排队深度，未开启并发限制时返回空
+func (p *HTTPPool) QueueStats() map[string]PeerQueueStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]PeerQueueStats, len(p.httpGetters))
+	for peer, h := range p.httpGetters {
+		if h.queue != nil {
+			stats[peer] = h.queue.stats()
+		}
+	}
+	return stats
+}
+
+// peerUtilization 实现了loadReporter接口，排队等待的请求也计入
+func (p *HTTPPool) peerUtilization() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	max := 0.0
+	for _, h := range p.httpGetters {
+		if h.queue != nil {
+			if u := h.queue.utilization(); u > max {
+				max = u
+			}
+		}
+	}
+	return max
 }
 
 // PickPeer 实现了PeerPicker接口，在哈希环上找key对应的节点，然后返回这个节点的http客户端
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+	if h, ok := p.peerFor(key); ok {
+		p.debugf("Pick peer %s", h.baseURL)
+		return h, true
+	}
+	return nil, false
+}
+
+// peerFor 与PickPeer相同，但不打印日志，用于批量处理大量key
+func (p *HTTPPool) peerFor(key string) (*httpGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	// Get方法是在一致性哈希上面找存储key的节点，返回的peer是string，如"http://localhost:8001"
+	if p.peers == nil {
+		return nil, false // 还没有调用Set设置节点
+	}
 	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// pickReadPeer 实现了boundedPicker接口，开启有界负载时按节点的负载选择处理读取的节点，否则与PickPeer相同
+func (p *HTTPPool) pickReadPeer(key string) (PeerGetter, bool) {
+	if p.boundedLoad == 0 {
+		return p.PickPeer(key)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.GetBounded(key); peer != "" && peer != p.self {
+		return p.httpGetters[peer], true
+	}
+	return nil, false
+}
+
+// peerLoad 返回对peer正在进行的请求数，本节点为0，调用时需持有p.mu
+func (p *HTTPPool) peerLoad(peer string) int64 {
+	if h := p.httpGetters[peer]; h != nil && peer != p.self {
+		return h.inflight.Load()
+	}
+	return 0
+}
+
+// broadcastTargets 返回除本节点以外的所有节点
+func (p *HTTPPool) broadcastTargets() map[string]PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	targets := make(map[string]PeerGetter, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			targets[peer] = getter
+		}
+	}
+	return targets
+}
+
 // 检查 HTTPPool 是否实现了接口 PeerPicker ，若没有则会编译出错
 var _PeerPicker = (*HTTPPool)(nil)
 
 // 客户端类httpGetter
 type httpGetter struct {
-	baseURL string // 表示要访问的远程节点的地址
+	addr    string       // 远程节点的地址，即Set传入的peer
+	baseURL string       // 表示要访问的远程节点的地址
+	self    string       // 本节点的地址，随请求发出，见protocol.HeaderFrom
+	queue   *fairQueue   // 对该节点的并发限制，为nil时不限制
+	queueOn *atomic.Bool // 并发限制的运行时开关
+
+	inflight atomic.Int64 // 正在进行（包括排队）的请求数，有界负载据此选择节点，见WithBoundedLoad
+}
+
+// begin 记录一个发往该节点的请求，开启并发限制时先排队，返回请求结束时调用的函数。
+// 开关只决定新请求是否排队，已经拿到名额的请求照常归还；排队期间ctx结束则放弃请求并返回ctx的错误
+func (h *httpGetter) begin(ctx context.Context, group string) (end func(), err error) {
+	h.inflight.Add(1)
+	if h.queue != nil && h.queueOn.Load() {
+		if err := h.queue.acquire(ctx, group); err != nil {
+			h.inflight.Add(-1)
+			return nil, err
+		}
+		return func() {
+			h.queue.release()
+			h.inflight.Add(-1)
+		}, nil
+	}
+	return func() { h.inflight.Add(-1) }, nil
+}
+
+// String 返回远程节点的地址，GetWithInfo据此给出值来自哪个节点
+func (h *httpGetter) String() string {
+	return h.addr
 }
 
 // Get 客户端httpGetter根据group和key返回缓存值
-func (h *httpGetter) Get(group string, key string) ([]byte, error) {
-	// 进行字符串拼接， 格式：http://example.com/_geecache/group/key
-	u := fmt.Sprintf(
-		"%v%v%v",
-		h.baseURL,
-		url.QueryEscape(group),
-		url.QueryEscape(key),
-	)
-	// 发起http的get请求，访问远程节点
-	res, err := http.Get(u)
+func (h *httpGetter) Get(ctx context.Context, group string, key string) ([]byte, error) {
+	e, err := h.GetEntry(ctx, group, key)
+	return e.Value, err
+}
+
+// GetEntry 读取值以及它在远程节点上剩余的软/硬过期时间
+func (h *httpGetter) GetEntry(ctx context.Context, group string, key string) (protocol.Entry, error) {
+	end, err := h.begin(ctx, group)
+	if err != nil {
+		return protocol.Entry{}, err
+	}
+	defer end()
+	// 访问地址的格式：http://example.com/_geecache/group/key，编解码与client包共用protocol
+	return protocol.GetPeerEntry(ctx, http.DefaultClient, h.baseURL, group, key, protocol.PeerRequest{From: h.self, Source: sourceKey(ctx, group, key), Reserve: peerReserve(ctx)})
+}
+
+// RefreshEntry 与GetEntry相同，但要求远程节点重新加载key，实现了refreshPeerGetter
+func (h *httpGetter) RefreshEntry(ctx context.Context, group string, key string) (protocol.Entry, error) {
+	end, err := h.begin(ctx, group)
+	if err != nil {
+		return protocol.Entry{}, err
+	}
+	defer end()
+	return protocol.GetPeerEntry(ctx, http.DefaultClient, h.baseURL, group, key, protocol.PeerRequest{From: h.self, Refresh: true, Source: sourceKey(ctx, group, key), Reserve: peerReserve(ctx)})
+}
+
+// Exists 询问远程节点是否缓存了key，不取回值，实现了existsPeerGetter
+func (h *httpGetter) Exists(ctx context.Context, group string, key string) (bool, error) {
+	end, err := h.begin(ctx, group)
+	if err != nil {
+		return false, err
+	}
+	defer end()
+	return protocol.Exists(ctx, http.DefaultClient, h.baseURL, group, key)
+}
+
+// GetMulti 批量读取多个key，每次请求最多protocol.MaxBatchKeys个key；
+// 节点因响应过大而要求单独读取的key改为单独读取。实现了batchPeerGetter
+func (h *httpGetter) GetMulti(ctx context.Context, group string, keys []string) ([]protocol.Result, error) {
+	results := make([]protocol.Result, 0, len(keys))
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > protocol.MaxBatchKeys {
+			n = protocol.MaxBatchKeys
+		}
+		rs, err := h.getBatch(ctx, group, keys[:n])
+		if err != nil {
+			return nil, err
+		}
+		for i, r := range rs {
+			if errors.Is(r.Err, protocol.ErrRetryIndividually) {
+				r.Value, r.Err = h.Get(ctx, group, keys[i])
+			}
+			results = append(results, r)
+		}
+		keys = keys[n:]
+	}
+	return results, nil
+}
+
+func (h *httpGetter) getBatch(ctx context.Context, group string, keys []string) ([]protocol.Result, error) {
+	end, err := h.begin(ctx, group)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-	// 检测状态码
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", res.Status)
+	defer end()
+	return protocol.GetMulti(ctx, http.DefaultClient, h.baseURL, group, keys, protocol.PeerRequest{From: h.self})
+}
+
+// GetOrSet 在远程节点上原子地读取或写入key，实现了getOrSetPeer
+func (h *httpGetter) GetOrSet(ctx context.Context, group string, key string, value []byte) (protocol.Entry, bool, error) {
+	end, err := h.begin(ctx, group)
+	if err != nil {
+		return protocol.Entry{}, false, err
 	}
-	// 读取消息体的响应内容
-	bytes, err := io.ReadAll(res.Body)
+	defer end()
+	return protocol.GetOrSet(ctx, http.DefaultClient, h.baseURL, group, key, value)
+}
+
+// Set 把值写入远程节点的本地缓存，实现了PeerSetter
+func (h *httpGetter) Set(group string, key string, value []byte) error {
+	end, err := h.begin(context.Background(), group)
 	if err != nil {
-		return nil, fmt.Errorf("reading response body: %v", err)
+		return err
 	}
+	defer end()
+	return protocol.Set(context.Background(), http.DefaultClient, h.baseURL, group, key, value)
+}
 
-	return bytes, nil
+// SetVersioned 写入并返回远程节点上的版本号，实现了versionedPeerSetter
+func (h *httpGetter) SetVersioned(group string, key string, value []byte, ifVersion *uint64) (uint64, error) {
+	end, err := h.begin(context.Background(), group)
+	if err != nil {
+		return 0, err
+	}
+	defer end()
+	return protocol.SetVersioned(context.Background(), http.DefaultClient, h.baseURL, group, key, value, ifVersion)
+}
 
+// Remove 从远程节点的本地缓存中删除key，实现了PeerRemover
+func (h *httpGetter) Remove(group string, key string) error {
+	end, err := h.begin(context.Background(), group)
+	if err != nil {
+		return err
+	}
+	defer end()
+	return protocol.Remove(context.Background(), http.DefaultClient, h.baseURL, group, key)
+}
+
+// RemovePrefix 让远程节点删除本地缓存中以prefix开头的key
+func (h *httpGetter) RemovePrefix(group string, prefix string) (int, error) {
+	end, err := h.begin(context.Background(), group)
+	if err != nil {
+		return 0, err
+	}
+	defer end()
+	return protocol.RemovePrefix(context.Background(), http.DefaultClient, h.baseURL, group, prefix)
+}
+
+// Flush 让远程节点清空group的本地缓存，实现了flusher
+func (h *httpGetter) Flush(ctx context.Context, group string) error {
+	end, err := h.begin(ctx, group)
+	if err != nil {
+		return err
+	}
+	defer end()
+	return protocol.Flush(ctx, http.DefaultClient, h.baseURL, group)
 }
 
 // 检查httpGetter是否实现了接口PeerGetter，若没有则会编译出错
 var _PeerGetter = (*httpGetter)(nil)
+var _ expiryPeerGetter = (*httpGetter)(nil)
+var _ prefixRemover = (*httpGetter)(nil)
+var _ flusher = (*httpGetter)(nil)
 
 // HTTPPool 既具备了提供 HTTP 服务的能力，也具备了根据具体的 key，创建 HTTP 客户端从远程节点获取缓存值的能力。
@@ -0,0 +1,579 @@
+package geecache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"geecache/geecache/internal/protocol"
+	"geecache/geecache/ownership"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询直到cond成立，超时则测试失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFairQueueWeightedRoundRobin(t *testing.T) {
+	weights := map[string]int{"greedy": 2, "light": 1}
+	q := newFairQueue(1, func(group string) int { return weights[group] })
+	q.acquire(context.Background(), "holder")
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(group string) {
+		n := q.stats().Waiting[group]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.acquire(context.Background(), group)
+			mu.Lock()
+			order = append(order, group)
+			mu.Unlock()
+			q.release()
+		}()
+		waitFor(t, func() bool { return q.stats().Waiting[group] == n+1 })
+	}
+	for i := 0; i < 4; i++ {
+		enqueue("greedy")
+	}
+	for i := 0; i < 2; i++ {
+		enqueue("light")
+	}
+
+	q.release()
+	wg.Wait()
+
+	expect := []string{"greedy", "greedy", "light", "greedy", "greedy", "light"}
+	if !reflect.DeepEqual(order, expect) {
+		t.Fatalf("dequeue order = %v, expect %v", order, expect)
+	}
+	if s := q.stats(); s.Active != 0 || len(s.Waiting) != 0 {
+		t.Fatalf("queue not drained: %+v", s)
+	}
+}
+
+func TestFairQueueAcquireCanceled(t *testing.T) {
+	q := newFairQueue(1, func(string) int { return 1 })
+	q.acquire(context.Background(), "holder")
+
+	// 排队中的请求在ctx结束后离开队列，不占名额
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.acquire(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire err = %v, expect %v", err, context.DeadlineExceeded)
+	}
+	if s := q.stats(); s.Active != 1 || len(s.Waiting) != 0 {
+		t.Fatalf("canceled waiter still queued: %+v", s)
+	}
+
+	// 离开后名额照常转交给后来的请求
+	done := make(chan struct{})
+	go func() {
+		q.acquire(context.Background(), "next")
+		close(done)
+	}()
+	waitFor(t, func() bool { return q.stats().Waiting["next"] == 1 })
+	q.release()
+	<-done
+	q.release()
+	if s := q.stats(); s.Active != 0 || len(s.Waiting) != 0 {
+		t.Fatalf("queue not drained: %+v", s)
+	}
+}
+
+// Exists、RemovePrefix和Flush与其他请求一样经过并发限制，并计入节点的负载
+func TestPeerAdminCallsQueue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0"))
+	}))
+	defer srv.Close()
+	pool := NewHTTPPool("self", WithPeerConcurrency(1))
+	pool.Set(srv.URL)
+	getter := pool.httpGetters[srv.URL]
+	end, err := getter.begin(context.Background(), "holder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := getter.Exists(ctx, "g", "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Exists err = %v, expect it to wait in the queue", err)
+	}
+	if err := getter.Flush(ctx, "g"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Flush err = %v, expect it to wait in the queue", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := getter.RemovePrefix("g", "p")
+		done <- err
+	}()
+	waitFor(t, func() bool { return getter.queue.stats().Waiting["g"] == 1 && getter.inflight.Load() == 2 })
+	end()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := getter.inflight.Load(); n != 0 {
+		t.Fatalf("inflight = %d after all calls ended", n)
+	}
+}
+
+func TestPeerFairnessAcrossGroups(t *testing.T) {
+	pool := NewHTTPPool("self", WithPeerConcurrency(2))
+	pool.Set("http://peer")
+	getter := pool.httpGetters["http://peer"]
+
+	// 名额先被两个greedy请求占满，不发真实的HTTP请求，只看名额转交的顺序
+	var ends []func()
+	for i := 0; i < 2; i++ {
+		end, err := getter.begin(context.Background(), "greedy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ends = append(ends, end)
+	}
+
+	type grant struct {
+		group string
+		end   func()
+	}
+	granted := make(chan grant)
+	enqueue := func(group string) {
+		n := getter.queue.stats().Waiting[group]
+		go func() {
+			end, err := getter.begin(context.Background(), group)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			granted <- grant{group, end}
+		}()
+		waitFor(t, func() bool { return getter.queue.stats().Waiting[group] == n+1 })
+	}
+	const greedy = 20
+	for i := 0; i < greedy; i++ {
+		enqueue("greedy")
+	}
+	enqueue("light")
+
+	// 每次归还一个名额，恰好有一个等待的请求拿到它
+	var order []string
+	for len(order) < greedy+1 {
+		ends[0]()
+		ends = ends[1:]
+		g := <-granted
+		order = append(order, g.group)
+		ends = append(ends, g.end)
+	}
+	for _, end := range ends {
+		end()
+	}
+
+	// 先进先出时light要排在所有greedy请求之后；公平排队时greedy用完本轮的名额就轮到light
+	expect := make([]string, greedy+1)
+	for i := range expect {
+		expect[i] = "greedy"
+	}
+	expect[1] = "light"
+	if !reflect.DeepEqual(order, expect) {
+		t.Fatalf("grant order = %v, expect %v", order, expect)
+	}
+	if s := pool.QueueStats()["http://peer"]; s.Active != 0 || len(s.Waiting) != 0 {
+		t.Fatalf("queue not drained: %+v", s)
+	}
+}
+
+func TestPeerCarriesExpiry(t *testing.T) {
+	silenceLog(t)
+	// 请求方与远程节点使用同名group，远程节点的group只注册在它自己的pool中
+	ownerClock, clock := newFakeClock(), newFakeClock()
+	clock.Advance(time.Hour) // 两个节点的时钟不一致
+	pool := NewHTTPPool("owner")
+	owner := NewGroup("peer-expiry", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithSoftTTL(time.Second), WithHardTTL(5*time.Second), WithUnlimitedBytes())
+	owner.now = ownerClock.Now
+	owner.RegisterPeers(pool)
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	g := NewGroup("peer-expiry", 0, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("unexpected local load of %s", key)
+	}), WithUnlimitedBytes())
+	g.now = clock.Now
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	v, err := g.getFromPeer(context.Background(), peer, "k", GetOptions{}, ByteViewSink(new(ByteView)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.soft.Equal(clock.Now().Add(time.Second)) || !v.expire.Equal(clock.Now().Add(5*time.Second)) {
+		t.Fatalf("fresh: soft=%v expire=%v", v.soft, v.expire)
+	}
+
+	// 远程节点上已经软过期的值，在请求方看来也已经软过期
+	ownerClock.Advance(2 * time.Second)
+	if v, err = g.getFromPeer(context.Background(), peer, "k", GetOptions{}, ByteViewSink(new(ByteView))); err != nil {
+		t.Fatal(err)
+	}
+	if !g.softExpired(v) || !v.expire.Equal(clock.Now().Add(3*time.Second)) {
+		t.Fatalf("soft-stale: soft=%v expire=%v", v.soft, v.expire)
+	}
+}
+
+func TestBatchResponseBounded(t *testing.T) {
+	silenceLog(t)
+	const size, limit = 1 << 20, 3 << 20
+	loads := 0
+	g := NewGroup("batch-bounded", 0, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return make([]byte, size), nil
+	}), WithUnlimitedBytes())
+	pool := NewHTTPPool("self", WithMaxBatchBytes(limit))
+	g.RegisterPeers(pool)
+
+	var body bytes.Buffer
+	for i := 0; i < 100; i++ {
+		protocol.WriteFrame(&body, []byte(fmt.Sprintf("k%d", i)))
+	}
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_geecache/batch-bounded/", &body))
+	if w.Body.Len() > limit+1024 {
+		t.Fatalf("response of %d bytes exceeds the %d byte limit", w.Body.Len(), limit)
+	}
+	// 超过上限后剩余的key不再加载
+	if loads != 4 {
+		t.Fatalf("loaded %d keys, want 4", loads)
+	}
+	r := bufio.NewReader(w.Body)
+	for i := 0; i < 100; i++ {
+		res, err := protocol.ReadResult(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if retry := errors.Is(res.Err, protocol.ErrRetryIndividually); retry != (i >= 3) {
+			t.Fatalf("key %d: result %v", i, res.Err)
+		}
+	}
+}
+
+func TestPickPeerMatchesOwnership(t *testing.T) {
+	silenceLog(t)
+	rnd := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		peers    int
+		replicas int
+	}{{1, 50}, {3, 50}, {7, 1}, {7, 160}, {20, 10}} {
+		peers := make([]string, tc.peers)
+		for i := range peers {
+			peers[i] = fmt.Sprintf("http://10.0.0.%d:8001", i+1)
+		}
+		p := NewHTTPPool("", WithReplicas(tc.replicas)) // self不在环上，所有key都由PickPeer返回
+		p.Set(peers...)
+		ring, err := ownership.New(ownership.Config{Peers: peers, Replicas: tc.replicas})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5000; i++ {
+			key := fmt.Sprintf("%x", rnd.Int63())
+			peer, ok := p.PickPeer(key)
+			if !ok {
+				t.Fatalf("%+v: no peer for %s", tc, key)
+			}
+			got := strings.TrimSuffix(peer.(*httpGetter).baseURL, defaultBasePath)
+			if want := ring.Owner(key); got != want {
+				t.Fatalf("%+v: key %s owned by %s, ownership says %s", tc, key, got, want)
+			}
+		}
+	}
+}
+
+// discardResponse 是丢弃响应内容的http.ResponseWriter，基准测试中不把响应的缓冲算进分配次数
+type discardResponse struct{ h http.Header }
+
+func (w discardResponse) Header() http.Header         { return w.h }
+func (w discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponse) WriteHeader(int)             {}
+
+// BenchmarkServeHTTP 测量节点处理单个读取的开销，disabled的group每次都调用回调函数加载
+func BenchmarkServeHTTP(b *testing.B) {
+	value := bytes.Repeat([]byte("x"), 64<<10)
+	getter := GetterFunc(func(key string) ([]byte, error) { return value, nil })
+	for _, bc := range []struct {
+		name       string
+		cacheBytes int64
+	}{{"hit", 1 << 20}, {"load", 0}} {
+		b.Run(bc.name, func(b *testing.B) {
+			pool := NewHTTPPool("bench")
+			NewGroup("bench-serve-"+bc.name, bc.cacheBytes, getter).RegisterPeers(pool)
+			req := httptest.NewRequest(http.MethodGet, "/_geecache/bench-serve-"+bc.name+"/k", nil)
+			w := discardResponse{h: make(http.Header)}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(value)))
+			for i := 0; i < b.N; i++ {
+				pool.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+// BenchmarkGetFromPeer 测量从远程节点读取一个较大的值的开销
+func BenchmarkGetFromPeer(b *testing.B) {
+	value := bytes.Repeat([]byte("x"), 256<<10)
+	pool := NewHTTPPool("owner")
+	NewGroup("bench-peer", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return value, nil
+	})).RegisterPeers(pool)
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	g := NewGroup("bench-peer", 0, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("unexpected local load of %s", key)
+	}))
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(value)))
+	for i := 0; i < b.N; i++ {
+		if _, err := g.getFromPeer(context.Background(), peer, "k", GetOptions{}, ByteViewSink(new(ByteView))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestForwardingLoopBroken(t *testing.T) {
+	silenceLog(t)
+	const name = "forwarding-loop"
+	var calls [2]atomic.Int32
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		n := i
+		g := NewGroup(name, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			calls[n].Add(1)
+			return []byte(fmt.Sprintf("%s@%d", key, n)), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	// 节点列表不一致：A认为所有key都由B负责，B认为所有key都由A负责
+	pools[0].Set(urls[1])
+	pools[1].Set(urls[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	v, err := groups[0].Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "k@1" || calls[0].Load() != 0 || calls[1].Load() != 1 {
+		t.Fatalf("Get = %s, calls = %d/%d, want B to answer locally once", v, calls[0].Load(), calls[1].Load())
+	}
+	if n := groups[1].Stats().LocalLoads[Forwarded.String()]; n != 1 {
+		t.Fatalf("B forwarded local loads = %d, want 1", n)
+	}
+
+	// 批量读取同样不再转发
+	values, errs := groups[0].GetMulti(ctx, []string{"x", "y"})
+	if len(errs) != 0 || values["x"].String() != "x@1" || values["y"].String() != "y@1" {
+		t.Fatalf("GetMulti = %v, %v", values, errs)
+	}
+	if calls[0].Load() != 0 {
+		t.Fatalf("A loaded %d keys, want the batch answered by B", calls[0].Load())
+	}
+}
+
+func TestRemovePeer(t *testing.T) {
+	silenceLog(t)
+	self, b, c := "http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://10.0.0.3:8001"
+	pool := NewHTTPPool(self)
+	pool.RemovePeer(b) // 还没有Set时什么也不做
+	pool.Set(self, b, c)
+	owner := func(key string) string {
+		if h, ok := pool.peerFor(key); ok {
+			return h.addr
+		}
+		return self
+	}
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("k%d", i)
+		before[key] = owner(key)
+	}
+
+	pool.RemovePeer(b)
+	pool.RemovePeer("http://10.0.0.9:8001")
+	for key, was := range before {
+		now := owner(key)
+		if now == b || (was != b && now != was) {
+			t.Fatalf("%s moved from %s to %s after removing %s", key, was, now, b)
+		}
+	}
+	if _, ok := pool.broadcastTargets()[b]; ok {
+		t.Fatal("removed peer still a broadcast target")
+	}
+}
+
+func TestSetWithWeights(t *testing.T) {
+	silenceLog(t)
+	self, big := "http://10.0.0.1:8001", "http://10.0.0.2:8001"
+	pool := NewHTTPPool(self)
+	pool.SetWithWeights(map[string]int{self: 1, big: 4})
+	remote := 0
+	for i := 0; i < 10000; i++ {
+		if _, ok := pool.peerFor(fmt.Sprintf("k%d", i)); ok {
+			remote++
+		}
+	}
+	if share := float64(remote) / 10000; share < 0.75 || share > 0.85 {
+		t.Fatalf("weight-4 peer owns %.3f of the keys, want about 0.8", share)
+	}
+}
+
+func TestSetReusesGetters(t *testing.T) {
+	silenceLog(t)
+	a, b, c, d := "http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://10.0.0.3:8001", "http://10.0.0.4:8001"
+	pool := NewHTTPPool(a, WithPeerConcurrency(2))
+	pool.Set(a, b, c)
+	old := make(map[string]*httpGetter)
+	for peer, h := range pool.httpGetters {
+		old[peer] = h
+	}
+
+	pool.Set(a, b, d) // 用d换掉c
+	if len(pool.httpGetters) != 3 {
+		t.Fatalf("%d getters after Set, want 3", len(pool.httpGetters))
+	}
+	for _, peer := range []string{a, b} {
+		if pool.httpGetters[peer] != old[peer] {
+			t.Fatalf("getter for unchanged peer %s was replaced", peer)
+		}
+	}
+	if _, ok := pool.httpGetters[c]; ok {
+		t.Fatal("getter for the removed peer is still there")
+	}
+	if h := pool.httpGetters[d]; h == nil || h.queue == nil {
+		t.Fatal("no getter with a queue for the added peer")
+	}
+}
+
+func TestBoundedLoadPicking(t *testing.T) {
+	silenceLog(t)
+	a, b, c := "http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://10.0.0.3:8001"
+	pool := NewHTTPPool(a, WithBoundedLoad(1.25))
+	pool.Set(a, b, c)
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("k%d", i)
+		if h, ok := pool.peerFor(key); ok && h.addr == b {
+			break
+		}
+	}
+	if peer, _ := pool.pickReadPeer(key); peer.(*httpGetter).addr != b {
+		t.Fatalf("idle owner %s not picked", b)
+	}
+
+	// b有大量正在进行的请求，读取改由其他节点处理，写入仍然交给b
+	pool.httpGetters[b].inflight.Add(100)
+	if peer, ok := pool.pickReadPeer(key); ok && peer.(*httpGetter).addr == b {
+		t.Fatal("overloaded owner still picked for reads")
+	}
+	if peer, _ := pool.PickPeer(key); peer.(*httpGetter).addr != b {
+		t.Fatal("PickPeer no longer returns the owner")
+	}
+	pool.httpGetters[b].inflight.Add(-100)
+
+	// 请求结束后inflight归零
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	h := &httpGetter{addr: srv.URL, baseURL: srv.URL + defaultBasePath, queueOn: new(atomic.Bool)}
+	h.Get(context.Background(), "g", "k")
+	if n := h.inflight.Load(); n != 0 {
+		t.Fatalf("inflight = %d after the request finished", n)
+	}
+}
+
+func TestBoundedLoadDelete(t *testing.T) {
+	silenceLog(t)
+	const name = "bounded-load-delete"
+	var source atomic.Value
+	source.Store("v1")
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 3; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url, WithBoundedLoad(1.25))
+		g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(source.Load().(string)), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, pool := range pools {
+		pool.Set(urls...)
+	}
+
+	// 由节点1负责的key，节点0上节点1过载，读取改由其他节点处理
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("k%d", i)
+		if h, ok := pools[0].peerFor(key); ok && h.addr == urls[1] {
+			break
+		}
+	}
+	pools[0].httpGetters[urls[1]].inflight.Add(100)
+	defer pools[0].httpGetters[urls[1]].inflight.Add(-100)
+
+	ctx := context.Background()
+	for _, want := range []string{"v1", "v2"} {
+		if v, err := groups[0].Get(ctx, key); err != nil || v.String() != want {
+			t.Fatalf("Get = %q, %v, want %q", v.String(), err, want)
+		}
+		for i, g := range groups {
+			if i != 1 && g.mainCache.contains(key) {
+				t.Fatalf("node %d does not own the key but cached it", i)
+			}
+		}
+		source.Store("v2")
+		if err := groups[0].Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package geecache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"geecache/geecache/internal/protocol"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 批量导入：外部的离线任务把算好的键值对直接推送到集群中预热缓存，不经过读取路径，也不调用回调函数
+// 任意节点都可以接收导入，属于自己的key保存在本地，其余的按所属节点分批转发。协议格式见protocol/import.go，
+// 导入文件可以用ImportWriter生成，client.Import负责发送和断点续传
+
+const (
+	defaultMaxImportEntry = 16 << 20 // 导入记录中key或value的默认大小上限
+	importForwardBatch    = 256      // 转发给同一个节点的记录攒够这么多条就发送一次
+)
+
+// WithImportRate 限制每个导入请求每秒处理的记录数，0表示不限制（默认）
+func WithImportRate(perSecond int) PoolOption {
+	return func(p *HTTPPool) {
+		p.importRate = perSecond
+	}
+}
+
+// WithMaxImportEntry 设置导入记录中key或value的大小上限，超过的记录被跳过并计入rejected，默认为16MB
+func WithMaxImportEntry(n int) PoolOption {
+	return func(p *HTTPPool) {
+		p.maxImportEntry = n
+	}
+}
+
+// ImportWriter 把记录编码为批量导入的格式，用于生成交给client.Import或者import子命令的导入文件：
+// 每条记录依次为 uvarint(len(key)) key uvarint(len(value)) value uvarint(ttl毫秒，0表示不过期) crc32(key+value)（4字节大端）
+type ImportWriter struct {
+	w *bufio.Writer
+}
+
+// NewImportWriter 创建写入w的ImportWriter，写完后必须调用Flush
+func NewImportWriter(w io.Writer) *ImportWriter {
+	return &ImportWriter{w: bufio.NewWriter(w)}
+}
+
+// Write 写入一条记录，ttl为0表示不过期
+func (iw *ImportWriter) Write(key string, value []byte, ttl time.Duration) error {
+	return protocol.WriteImportEntry(iw.w, protocol.ImportEntry{
+		Key:      key,
+		Value:    value,
+		TTL:      ttl,
+		Checksum: protocol.Checksum(key, value),
+	})
+}
+
+// Flush 把缓冲的记录写入底层的io.Writer
+func (iw *ImportWriter) Flush() error {
+	return iw.w.Flush()
+}
+
+// pacer 把处理速度限制在每秒perSecond条以内
+type pacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(perSecond int) *pacer {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &pacer{interval: time.Second / time.Duration(perSecond)}
+}
+
+// wait 等待下一条记录的处理时机，ctx结束时返回错误
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	d := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// importer 处理一个导入请求
+type importer struct {
+	pool      *HTTPPool
+	group     *Group
+	forwarded bool // 请求来自其他节点的转发，只在本地保存
+	progress  protocol.ImportProgress
+	pending   map[*httpGetter][]protocol.ImportEntry // 等待转发的记录
+}
+
+// add 保存或者准备转发一条已经通过校验的记录。记录按缓存key（见WithKeyHashing）选择节点和保存，
+// 转发出去的记录已经换成了缓存key，接收的节点不再变换
+func (im *importer) add(ctx context.Context, e protocol.ImportEntry) {
+	if !im.forwarded {
+		if key := im.group.cacheKey(e.Key); key != e.Key {
+			e.Key, e.Checksum = key, protocol.Checksum(key, e.Value)
+		}
+		if peer, ok := im.pool.peerFor(e.Key); ok {
+			im.pending[peer] = append(im.pending[peer], e)
+			if len(im.pending[peer]) >= importForwardBatch {
+				im.forward(ctx, peer)
+			}
+			return
+		}
+	}
+	im.group.populateCache(e.Key, ByteView{b: e.Value, expire: im.group.after(e.TTL)})
+	im.progress.Stored++
+}
+
+// flush 转发所有等待中的记录，进度确认之前调用，保证确认的Cursor之前的记录都已经处理完
+func (im *importer) flush(ctx context.Context) {
+	for peer := range im.pending {
+		im.forward(ctx, peer)
+	}
+}
+
+func (im *importer) forward(ctx context.Context, peer *httpGetter) {
+	batch := im.pending[peer]
+	delete(im.pending, peer)
+	if len(batch) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	for _, e := range batch {
+		protocol.WriteImportEntry(&buf, e)
+	}
+	res, err := protocol.Import(ctx, http.DefaultClient, peer.baseURL, im.group.name, im.pool.adminToken, 0, true, &buf, nil)
+	if err != nil {
+		im.pool.logger().Errorf("Failed to forward %d imported entries to %s: %v", len(batch), peer.baseURL, err)
+		im.progress.Rejected += int64(len(batch)) - res.Stored
+		im.progress.Forwarded += res.Stored
+		return
+	}
+	im.progress.Forwarded += res.Stored
+	im.progress.Rejected += res.Rejected
+	im.progress.ChecksumFailures += res.ChecksumFailures
+}
+
+// serveImport 处理批量导入请求，POST <basepath>import?group=<group>&start=<n>
+func (p *HTTPPool) serveImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	name := r.URL.Query().Get("group")
+	group := p.getGroup(name)
+	if group == nil {
+		p.rejectUnknownGroup(w, r, name)
+		return
+	}
+	start, err := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+	if err != nil && r.URL.Query().Get("start") != "" {
+		http.Error(w, "bad start", http.StatusBadRequest)
+		return
+	}
+	maxSize := p.maxImportEntry
+	if maxSize <= 0 {
+		maxSize = defaultMaxImportEntry
+	}
+
+	ctx := r.Context()
+	im := &importer{
+		pool:      p,
+		group:     group,
+		forwarded: r.URL.Query().Get("forwarded") == "1",
+		progress:  protocol.ImportProgress{Cursor: start},
+		pending:   make(map[*httpGetter][]protocol.ImportEntry),
+	}
+	pace := newPacer(p.importRate)
+	body := bufio.NewReader(r.Body)
+	enc := json.NewEncoder(w)
+	// 边读请求体边写进度确认，HTTP/1.x默认在开始写响应后关闭请求体
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	ack := func() {
+		im.flush(ctx)
+		enc.Encode(im.progress)
+		rc.Flush()
+	}
+	for {
+		if err := pace.wait(ctx); err != nil {
+			return
+		}
+		e, err := protocol.ReadImportEntry(body, maxSize)
+		switch {
+		case err == io.EOF:
+			im.progress.Done = true
+			ack()
+			p.Log("import into %s finished: %+v", name, im.progress)
+			return
+		case errors.Is(err, protocol.ErrEntryTooLarge):
+			im.progress.Rejected++
+		case err != nil:
+			// 请求体中断或格式错误，确认已经处理的部分，调用方从Cursor处继续
+			im.progress.Error = err.Error()
+			ack()
+			return
+		case e.Key == "":
+			im.progress.Rejected++
+		case protocol.Checksum(e.Key, e.Value) != e.Checksum:
+			im.progress.ChecksumFailures++
+		default:
+			im.add(ctx, e)
+		}
+		im.progress.Cursor++
+		if (im.progress.Cursor-start)%protocol.ImportAckEvery == 0 {
+			ack()
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"geecache/geecache/client"
+	"geecache/geecache/internal/protocol"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// flakyReader 第一次读到limit字节后返回错误，模拟导入过程中连接中断
+type flakyReader struct {
+	r      *bytes.Reader
+	limit  int64
+	failed bool
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	pos, _ := f.r.Seek(0, io.SeekCurrent)
+	if !f.failed && pos >= f.limit {
+		f.failed = true
+		return 0, errors.New("connection reset")
+	}
+	if !f.failed && pos+int64(len(p)) > f.limit {
+		p = p[:f.limit-pos]
+	}
+	return f.r.Read(p)
+}
+
+func (f *flakyReader) Seek(offset int64, whence int) (int64, error) {
+	return f.r.Seek(offset, whence)
+}
+
+func TestBulkImport(t *testing.T) {
+	silenceLog(t)
+	const token = "secret"
+	var pools [2]*HTTPPool
+	var groups [2]*Group
+	var urls []string
+	for i := range pools {
+		i := i
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	for i := range pools {
+		pools[i] = NewHTTPPool(urls[i], WithAdminToken(token), WithMaxImportEntry(1<<10))
+		pools[i].Set(urls...)
+		groups[i] = NewGroup("bulk-import", 0, GetterFunc(func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected load of %s", key)
+		}), WithUnlimitedBytes())
+		groups[i].RegisterPeers(pools[i])
+	}
+
+	var buf bytes.Buffer
+	w := NewImportWriter(&buf)
+	const n = 2500
+	for i := 0; i < n; i++ {
+		w.Write(fmt.Sprintf("key%04d", i), []byte(fmt.Sprintf("value%d", i)), time.Hour)
+	}
+	w.Write("huge", make([]byte, 2<<10), 0) // 超过大小上限
+	w.Flush()
+	protocol.WriteImportEntry(&buf, protocol.ImportEntry{Key: "corrupt", Value: []byte("v"), Checksum: 1})
+
+	// 第一次请求在中途断开，客户端从最后确认的cursor处继续
+	r := &flakyReader{r: bytes.NewReader(buf.Bytes()), limit: int64(buf.Len() / 2)}
+	c := client.New(urls, client.WithAdminToken(token), client.WithRetries(1))
+	var acks []int64
+	p, err := c.Import(context.Background(), urls[0], "bulk-import", r, 0, func(p client.ImportProgress) {
+		acks = append(acks, p.Cursor)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.failed {
+		t.Fatal("import was never interrupted")
+	}
+	if !p.Done || p.Cursor != n+2 || p.Rejected != 1 || p.ChecksumFailures != 1 {
+		t.Fatalf("progress = %+v", p)
+	}
+	if p.Stored == 0 || p.Forwarded == 0 || p.Stored+p.Forwarded < n {
+		t.Fatalf("entries lost or not spread over the cluster: %+v", p)
+	}
+	if len(acks) < 3 {
+		t.Fatalf("expected periodic acknowledgements, got %v", acks)
+	}
+
+	// 每个key都在它的所属节点上
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key%04d", i)
+		owner := 0
+		if peer, ok := pools[0].peerFor(key); ok && peer.baseURL == urls[1]+defaultBasePath {
+			owner = 1
+		}
+		v, ok := groups[owner].mainCache.get(key)
+		if !ok || v.String() != fmt.Sprintf("value%d", i) || v.expire.IsZero() {
+			t.Fatalf("%s missing on its owner (%v, %q)", key, ok, v)
+		}
+	}
+}
+
+func TestBulkImportRequiresToken(t *testing.T) {
+	silenceLog(t)
+	pool := NewHTTPPool("self", WithAdminToken("secret"))
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest("POST", defaultBasePath+"import?group=x", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, expect 401", rec.Code)
+	}
+}
+
+func TestBulkImportKeyHashing(t *testing.T) {
+	silenceLog(t)
+	const token = "secret"
+	var pools [2]*HTTPPool
+	var groups [2]*Group
+	var urls []string
+	for i := range pools {
+		i := i
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	for i := range pools {
+		pools[i] = NewHTTPPool(urls[i], WithAdminToken(token))
+		pools[i].Set(urls...)
+		groups[i] = NewGroup("bulk-import-hashed", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected load of %s", key)
+		}), WithKeyHashing(SHA256Key))
+		groups[i].RegisterPeers(pools[i])
+	}
+
+	var buf bytes.Buffer
+	w := NewImportWriter(&buf)
+	const n = 100
+	for i := 0; i < n; i++ {
+		w.Write(fmt.Sprintf("key%03d", i), []byte(fmt.Sprintf("value%d", i)), 0)
+	}
+	w.Flush()
+	c := client.New(urls, client.WithAdminToken(token))
+	p, err := c.Import(context.Background(), urls[0], "bulk-import-hashed", bytes.NewReader(buf.Bytes()), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Done || p.Stored == 0 || p.Forwarded == 0 || p.Stored+p.Forwarded != n {
+		t.Fatalf("progress = %+v", p)
+	}
+
+	// 导入的记录以缓存key保存在所属节点上，从任一节点都能读到，不会调用回调函数
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		owner := 0
+		if peer, ok := pools[0].peerFor(SHA256Key(key)); ok && peer.baseURL == urls[1]+defaultBasePath {
+			owner = 1
+		}
+		if !groups[owner].CachedLocally(key) {
+			t.Fatalf("%s not stored on its owner under the hashed key", key)
+		}
+		for _, g := range groups {
+			if v, err := g.Get(context.Background(), key); err != nil || v.String() != fmt.Sprintf("value%d", i) {
+				t.Fatalf("Get(%s) = %q, %v", key, v.String(), err)
+			}
+		}
+	}
+}
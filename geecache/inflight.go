@@ -0,0 +1,192 @@
+package geecache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// 加载中的内存预算：一批冷key同时加载时，回调函数的结果和远程节点的响应体在写入（大小受限的）缓存之前都在内存里，
+// 即使cacheBytes很小，几百个大值同时在途也可能耗尽内存。WithInFlightBytes为group设置在途字节数的上限：
+// 每次加载在缓冲值之前按预计的大小预留预算，预算不足时等待（受ctx和WithLoadTimeout约束），
+// 或者在WithInFlightShed时立即返回ErrInFlightBytes，加载结束（值写入缓存或失败）后释放。
+// 预计的大小来自StreamingGetter的大小提示和远程节点响应的Content-Length；
+// 事先不知道大小的值（普通的Getter、没有大小提示）在读完之后按实际大小记账，不会等待，但会让之后的加载等待。
+// 超过上限的单个值按上限预留，独占预算，不会永远等待。批量加载（GetMulti）不受限制
+
+// ErrInFlightBytes 是WithInFlightShed时在途字节数已达上限返回的错误，远程节点以503返回它
+var ErrInFlightBytes = errors.New("geecache: in-flight load bytes exhausted")
+
+// WithInFlightBytes 限制group正在加载、尚未写入缓存的值的总字节数，0表示不限制（默认）
+func WithInFlightBytes(limit int64) GroupOption {
+	return func(g *Group) {
+		g.inflight = nil
+		if limit > 0 {
+			g.inflight = &byteBudget{limit: limit}
+		}
+	}
+}
+
+// WithInFlightShed 使在途字节数达到WithInFlightBytes的上限时立即返回ErrInFlightBytes，而不是等待
+func WithInFlightShed() GroupOption {
+	return func(g *Group) {
+		g.inflightShed = true
+	}
+}
+
+// byteBudget 是按字节计数的信号量，等待者按先来后到的顺序获得预算
+type byteBudget struct {
+	limit   int64
+	mu      sync.Mutex
+	used    int64
+	waiters list.List // *budgetWaiter
+}
+
+type budgetWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// acquire 预留n个字节，n不能超过limit；shed为true时预算不足立即返回ErrInFlightBytes
+func (b *byteBudget) acquire(ctx context.Context, n int64, shed bool) error {
+	b.mu.Lock()
+	if b.used+n <= b.limit && b.waiters.Len() == 0 {
+		b.used += n
+		b.mu.Unlock()
+		return nil
+	}
+	if shed {
+		b.mu.Unlock()
+		return ErrInFlightBytes
+	}
+	w := &budgetWaiter{n: n, ready: make(chan struct{})}
+	e := b.waiters.PushBack(w)
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		select {
+		case <-w.ready:
+			b.used -= n // 离开的同时获得了预算，归还
+		default:
+			b.waiters.Remove(e)
+		}
+		b.notify()
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// force 不等待地记账n个字节，用于已经在内存中的值
+func (b *byteBudget) force(n int64) {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+func (b *byteBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.notify()
+	b.mu.Unlock()
+}
+
+// notify 按顺序唤醒预算足够的等待者，调用时持有b.mu
+func (b *byteBudget) notify() {
+	for e := b.waiters.Front(); e != nil; e = b.waiters.Front() {
+		w := e.Value.(*budgetWaiter)
+		if b.used+w.n > b.limit {
+			return
+		}
+		b.used += w.n
+		b.waiters.Remove(e)
+		close(w.ready)
+	}
+}
+
+func (b *byteBudget) reserved() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// peerReserve 返回按响应的Content-Length预留ctx中预算的函数，交给远程节点的请求；没有预留时返回nil
+func peerReserve(ctx context.Context) func(n int64) error {
+	r := reservationFrom(ctx)
+	if r == nil {
+		return nil
+	}
+	return func(n int64) error {
+		return r.reserve(ctx, n)
+	}
+}
+
+// loadReservation 是一次加载预留的预算，加载结束时一起释放
+type loadReservation struct {
+	g    *Group
+	mu   sync.Mutex
+	held int64
+}
+
+type reservationKey struct{}
+
+// reserveLoad 为一次加载创建预留，通过ctx交给回调函数和远程节点的请求，加载结束后必须调用返回的函数释放
+func (g *Group) reserveLoad(ctx context.Context) (context.Context, func()) {
+	if g.inflight == nil {
+		return ctx, func() {}
+	}
+	r := &loadReservation{g: g}
+	return context.WithValue(ctx, reservationKey{}, r), r.release
+}
+
+// reservationFrom 返回ctx中的预留，没有开启WithInFlightBytes时为nil
+func reservationFrom(ctx context.Context) *loadReservation {
+	r, _ := ctx.Value(reservationKey{}).(*loadReservation)
+	return r
+}
+
+// reserve 在缓冲值之前预留n个字节，n超过上限时按上限预留
+func (r *loadReservation) reserve(ctx context.Context, n int64) error {
+	if r == nil || n <= 0 {
+		return nil
+	}
+	b := r.g.inflight
+	n = min(n, b.limit)
+	if err := b.acquire(ctx, n, r.g.inflightShed); err != nil {
+		if err == ErrInFlightBytes {
+			r.g.stats.inflightShed.Add(1)
+		}
+		return err
+	}
+	r.mu.Lock()
+	r.held += n
+	r.mu.Unlock()
+	return nil
+}
+
+// settle 在值读完之后调用，预留的少于实际大小n时按实际大小补记
+func (r *loadReservation) settle(n int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n > r.held {
+		r.g.inflight.force(n - r.held)
+		r.held = n
+	}
+}
+
+func (r *loadReservation) release() {
+	r.mu.Lock()
+	held := r.held
+	r.held = 0
+	r.mu.Unlock()
+	if held > 0 {
+		r.g.inflight.release(held)
+	}
+}
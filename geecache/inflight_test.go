@@ -0,0 +1,114 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// gatedReader 在gate关闭之前阻塞，之后读出n个字节
+type gatedReader struct {
+	gate <-chan struct{}
+	n    int
+}
+
+func (r *gatedReader) Read(p []byte) (int, error) {
+	<-r.gate
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	k := min(len(p), r.n)
+	r.n -= k
+	return k, nil
+}
+
+func (r *gatedReader) Close() error { return nil }
+
+// gatedStreamGetter 返回带准确大小提示、在gate关闭之前不产生数据的流
+type gatedStreamGetter struct {
+	gate chan struct{}
+	size int
+}
+
+func (g *gatedStreamGetter) Get(context.Context, string) ([]byte, error) {
+	return nil, errors.New("Get called instead of GetStream")
+}
+
+func (g *gatedStreamGetter) GetStream(context.Context, string) (io.ReadCloser, int64, error) {
+	return &gatedReader{gate: g.gate, n: g.size}, int64(g.size), nil
+}
+
+func TestInFlightBytesShed(t *testing.T) {
+	ctx := context.Background()
+	sg := &gatedStreamGetter{gate: make(chan struct{}), size: 80}
+	g := NewGroup("inflight-shed", 1<<20, sg, WithInFlightBytes(100), WithInFlightShed())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Get(ctx, "a")
+		done <- err
+	}()
+	waitFor(t, func() bool { return g.Stats().InFlightBytes == 80 })
+
+	if _, err := g.Get(ctx, "b"); !errors.Is(err, ErrInFlightBytes) {
+		t.Fatalf("Get(b) = %v, want ErrInFlightBytes", err)
+	}
+	if n := g.Stats().InFlightShed; n != 1 {
+		t.Fatalf("InFlightShed = %d, want 1", n)
+	}
+
+	close(sg.gate)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := g.Stats().InFlightBytes; n != 0 {
+		t.Fatalf("InFlightBytes = %d after the load finished, want 0", n)
+	}
+	if _, err := g.Get(ctx, "b"); err != nil {
+		t.Fatalf("Get(b) after the budget was released = %v", err)
+	}
+}
+
+func TestInFlightBytesWait(t *testing.T) {
+	ctx := context.Background()
+	sg := &gatedStreamGetter{gate: make(chan struct{}), size: 80}
+	g := NewGroup("inflight-wait", 1<<20, sg, WithInFlightBytes(100))
+
+	results := make(chan error, 2)
+	go func() {
+		_, err := g.Get(ctx, "a")
+		results <- err
+	}()
+	waitFor(t, func() bool { return g.Stats().InFlightBytes == 80 })
+
+	// 预算不足时等待，ctx结束就放弃
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := g.Get(short, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get(b) with a short deadline = %v, want DeadlineExceeded", err)
+	}
+
+	go func() {
+		_, err := g.Get(ctx, "c")
+		results <- err
+	}()
+	select {
+	case err := <-results:
+		t.Fatalf("a load finished before the budget was released: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(sg.gate)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := g.Stats().InFlightBytes; n != 0 {
+		t.Fatalf("InFlightBytes = %d, want 0", n)
+	}
+	if n := g.Stats().InFlightShed; n != 0 {
+		t.Fatalf("InFlightShed = %d without WithInFlightShed, want 0", n)
+	}
+}
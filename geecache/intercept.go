@@ -0,0 +1,90 @@
+package geecache
+
+import (
+	"context"
+	"time"
+)
+
+// Get的拦截器：在不修改本包的前提下为读取加上链路追踪、请求日志、按租户计费等逻辑。
+// 拦截器包在Get（以及GetWith、GetWithInfo、GetInto）的主体外面，在key为空的检查之后、查找缓存和加载之前，
+// 按注册的顺序嵌套：先注册的在最外层。拦截器调用next得到结果，也可以不调用next，直接返回自己的值或错误。
+// next返回之后可以用GetInfoFrom(ctx)读取这次读取的信息，例如是否命中缓存。
+// GetTo、GetMulti以及远程节点转发来的请求不经过拦截器；拦截器中的panic不会被恢复
+
+// GetInterceptor 是Get的拦截器，key是调用方传入的key（WithKeyHashing之前）
+type GetInterceptor func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error)
+
+// WithGetInterceptor 添加一个Get的拦截器，可以多次使用，先添加的在外层
+func WithGetInterceptor(f GetInterceptor) GroupOption {
+	return func(g *Group) {
+		g.interceptors = append(g.interceptors, f)
+	}
+}
+
+// GetInfo 描述一次读取的过程，由Group在next中填写，见provenance.go
+type GetInfo struct {
+	Hit       bool        // 值（或负缓存的墓碑）来自本节点的mainCache或hotCache，没有加载
+	Source    ValueSource // 值来自哪里，拦截器自己返回值时为SourceUnknown
+	Peer      string      // Source为SourcePeer时是所属节点的地址
+	Coalesced bool        // 这次读取等待了同一个key上已经在进行的加载，没有自己发起
+}
+
+type getInfoKey struct{}
+
+// GetInfoFrom 返回拦截器收到的ctx中这次读取的信息，next返回之后才完整；ctx不是拦截器收到的ctx时返回nil
+func GetInfoFrom(ctx context.Context) *GetInfo {
+	info, _ := ctx.Value(getInfoKey{}).(*GetInfo)
+	return info
+}
+
+// intercept 按注册的顺序用拦截器包住body
+func (g *Group) intercept(ctx context.Context, key string, body func(ctx context.Context) (ByteView, error)) (ByteView, error) {
+	if len(g.interceptors) == 0 {
+		return body(ctx)
+	}
+	if GetInfoFrom(ctx) == nil {
+		ctx = context.WithValue(ctx, getInfoKey{}, new(GetInfo))
+	}
+	next := func() (ByteView, error) { return body(ctx) }
+	for i := len(g.interceptors) - 1; i >= 0; i-- {
+		f, inner := g.interceptors[i], next
+		next = func() (ByteView, error) { return f(ctx, key, inner) }
+	}
+	return next()
+}
+
+// recordHit 在ctx中的GetInfo里记录命中，source为SourceHit或SourceHotHit
+func recordHit(ctx context.Context, source ValueSource) {
+	if info := GetInfoFrom(ctx); info != nil {
+		info.Hit, info.Source = true, source
+	}
+}
+
+// recordLoad 在ctx中的GetInfo里记录加载的来源
+func recordLoad(ctx context.Context, res loaded) {
+	if info := GetInfoFrom(ctx); info != nil {
+		info.Source, info.Peer, info.Coalesced = res.source, res.peer, res.coalesced
+	}
+}
+
+// withoutGetInfo 返回不带GetInfo的ctx。加载在loader的goroutine中进行，回调函数用它读取其他key时不能写入调用方的GetInfo
+func withoutGetInfo(ctx context.Context) context.Context {
+	if GetInfoFrom(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, getInfoKey{}, (*GetInfo)(nil))
+}
+
+// LatencyInterceptor 是测量每次读取耗时的拦截器，读取结束后调用observe
+func LatencyInterceptor(observe func(key string, d time.Duration, info GetInfo, err error)) GetInterceptor {
+	return func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error) {
+		start := time.Now()
+		v, err := next()
+		var info GetInfo
+		if p := GetInfoFrom(ctx); p != nil {
+			info = *p
+		}
+		observe(key, time.Since(start), info, err)
+		return v, err
+	}
+}
@@ -0,0 +1,82 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetInterceptorOrder(t *testing.T) {
+	var trace []string
+	tracer := func(name string) GetInterceptor {
+		return func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error) {
+			trace = append(trace, name+">")
+			v, err := next()
+			trace = append(trace, "<"+name)
+			return v, err
+		}
+	}
+	g := NewGroup("intercept-order", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		trace = append(trace, "load")
+		return []byte(key), nil
+	}), WithGetInterceptor(tracer("a")), WithGetInterceptor(tracer("b")))
+
+	if _, err := g.Get(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(trace, " "); got != "a> b> load <b <a" {
+		t.Fatalf("trace = %q", got)
+	}
+	// key为空的检查在拦截器之前
+	trace = nil
+	if _, err := g.Get(context.Background(), ""); err == nil || len(trace) != 0 {
+		t.Fatalf("Get(\"\") = %v with trace %v", err, trace)
+	}
+}
+
+func TestGetInterceptorHitAndShortCircuit(t *testing.T) {
+	type observation struct {
+		key string
+		hit bool
+		err error
+	}
+	var seen []observation
+	errTenant := errors.New("tenant over quota")
+	g := NewGroup("intercept-hit", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("loaded"), nil
+	}), WithGetInterceptor(LatencyInterceptor(func(key string, d time.Duration, info GetInfo, err error) {
+		if d < 0 {
+			t.Errorf("negative latency %v", d)
+		}
+		seen = append(seen, observation{key, info.Hit, err})
+	})), WithGetInterceptor(func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error) {
+		switch {
+		case strings.HasPrefix(key, "blocked/"):
+			return ByteView{}, errTenant
+		case key == "static":
+			return ByteView{b: []byte("from interceptor")}, nil
+		}
+		return next()
+	}))
+
+	ctx := context.Background()
+	g.Get(ctx, "k")
+	g.Get(ctx, "k")
+	if _, err := g.Get(ctx, "blocked/k"); err != errTenant {
+		t.Fatalf("Get(blocked/k) = %v, want the interceptor's error", err)
+	}
+	if v, _ := g.Get(ctx, "static"); v.String() != "from interceptor" || g.CachedLocally("static") {
+		t.Fatalf("Get(static) = %q, cached=%v", v.String(), g.CachedLocally("static"))
+	}
+	want := []observation{{"k", false, nil}, {"k", true, nil}, {"blocked/k", false, errTenant}, {"static", false, nil}}
+	if len(seen) != len(want) {
+		t.Fatalf("observed %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("observation %d = %+v, want %+v", i, seen[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 批量导入：POST <basepath>import?group=<group>&start=<n>，需要管理令牌（Authorization: Bearer <token>）
+//   请求体为若干条记录，每条记录为 frame(key) frame(value) uvarint(ttl毫秒，0表示不过期) crc32(key+value)（4字节大端）
+//   响应体为若干行JSON格式的ImportProgress，每处理ImportAckEvery条记录写一行，最后一行的Done为true
+//   Cursor是已经处理完的记录数（包括start），导入中断后，从最后一次确认的Cursor处重新发送剩余的记录即可继续
+//   forwarded=1表示请求来自转发的节点，接收方只在本地保存，不再转发
+
+// ImportAckEvery 是两次进度确认之间处理的记录数
+const ImportAckEvery = 1000
+
+// ErrEntryTooLarge 表示导入的记录超过了接收方允许的大小，记录已被跳过
+var ErrEntryTooLarge = errors.New("import entry too large")
+
+// ImportEntry 是一条导入记录
+type ImportEntry struct {
+	Key      string
+	Value    []byte
+	TTL      time.Duration // 0表示不过期
+	Checksum uint32
+}
+
+// ImportProgress 是批量导入的进度确认
+type ImportProgress struct {
+	Cursor           int64  `json:"cursor"`
+	Stored           int64  `json:"stored"`            // 保存在接收节点上的记录数
+	Forwarded        int64  `json:"forwarded"`         // 转发给所属节点并保存成功的记录数
+	Rejected         int64  `json:"rejected"`          // 过大、key为空或转发失败的记录数
+	ChecksumFailures int64  `json:"checksum_failures"` // 校验和不一致的记录数
+	Done             bool   `json:"done,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// Checksum 计算记录的校验和
+func Checksum(key string, value []byte) uint32 {
+	h := crc32.NewIEEE()
+	h.Write([]byte(key))
+	h.Write(value)
+	return h.Sum32()
+}
+
+// WriteImportEntry 编码一条导入记录，e.Checksum由调用方计算
+func WriteImportEntry(w io.Writer, e ImportEntry) error {
+	if err := WriteFrame(w, []byte(e.Key)); err != nil {
+		return err
+	}
+	if err := WriteFrame(w, e.Value); err != nil {
+		return err
+	}
+	var buf [binary.MaxVarintLen64 + 4]byte
+	n := binary.PutUvarint(buf[:], uint64(e.TTL/time.Millisecond))
+	binary.BigEndian.PutUint32(buf[n:], e.Checksum)
+	_, err := w.Write(buf[:n+4])
+	return err
+}
+
+// ReadImportEntry 读取一条导入记录，不校验checksum。key或value超过maxSize时跳过整条记录并返回ErrEntryTooLarge，
+// 流在记录边界正常结束时返回io.EOF
+func ReadImportEntry(r *bufio.Reader, maxSize int) (ImportEntry, error) {
+	var e ImportEntry
+	key, tooLarge, err := readLimitedFrame(r, maxSize)
+	if err != nil {
+		return e, err
+	}
+	value, valueTooLarge, err := readLimitedFrame(r, maxSize)
+	if err != nil {
+		return e, unexpectedEOF(err)
+	}
+	ttl, err := binary.ReadUvarint(r)
+	if err != nil {
+		return e, unexpectedEOF(err)
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return e, unexpectedEOF(err)
+	}
+	if tooLarge || valueTooLarge {
+		return e, ErrEntryTooLarge
+	}
+	e.Key, e.Value = string(key), value
+	e.TTL = time.Duration(ttl) * time.Millisecond
+	e.Checksum = binary.BigEndian.Uint32(sum[:])
+	return e, nil
+}
+
+// SkipImportEntries 跳过r开头的n条记录，用于从确认过的Cursor处继续导入
+func SkipImportEntries(r *bufio.Reader, n int64) error {
+	for i := int64(0); i < n; i++ {
+		if _, err := ReadImportEntry(r, 0); err != nil && err != ErrEntryTooLarge {
+			return unexpectedEOF(err)
+		}
+	}
+	return nil
+}
+
+// readLimitedFrame 读取一个帧，长度超过maxSize时丢弃内容并返回tooLarge，maxSize<=0时总是丢弃
+func readLimitedFrame(r *bufio.Reader, maxSize int) (data []byte, tooLarge bool, err error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, false, err
+	}
+	if maxSize <= 0 || n > uint64(maxSize) {
+		_, err = io.CopyN(io.Discard, r, int64(n))
+		return nil, true, unexpectedEOF(err)
+	}
+	data = make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, false, unexpectedEOF(err)
+	}
+	return data, false, nil
+}
+
+// unexpectedEOF 把记录中间出现的io.EOF转换为io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Import 把body中的记录导入到baseURL所在的节点，start为body中第一条记录的序号
+// 每收到一次进度确认调用fn（可以为nil），返回最后一次确认的进度；请求失败或响应中断时同时返回错误，
+// 此时可以从返回进度的Cursor处继续
+func Import(ctx context.Context, client *http.Client, baseURL, group, token string, start int64, forwarded bool, body io.Reader, fn func(ImportProgress)) (ImportProgress, error) {
+	last := ImportProgress{Cursor: start}
+	q := url.Values{"group": {group}, "start": {strconv.FormatInt(start, 10)}}
+	if forwarded {
+		q.Set("forwarded", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"import?"+q.Encode(), body)
+	if err != nil {
+		return last, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return last, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return last, statusError(res)
+	}
+	dec := json.NewDecoder(res.Body)
+	for {
+		var p ImportProgress
+		if err := dec.Decode(&p); err != nil {
+			return last, fmt.Errorf("import interrupted at %d: %v", last.Cursor, unexpectedEOF(err))
+		}
+		last = p
+		if fn != nil {
+			fn(p)
+		}
+		if p.Error != "" {
+			return last, errors.New(p.Error)
+		}
+		if p.Done {
+			return last, nil
+		}
+	}
+}
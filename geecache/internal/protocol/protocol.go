@@ -0,0 +1,536 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 节点间HTTP协议的编解码，HTTPPool（服务端和httpGetter）与client包共用这一份实现，避免两边的格式不一致
+//   单个读取：GET  <basepath><group>/<key>，200返回值，其他状态码表示失败；
+//            值带有过期时间时，响应头X-Geecache-Soft-TTL/X-Geecache-Hard-TTL给出距软/硬过期的剩余时间（如"1.5s"）；
+//            数据源中没有这个key时返回404并带上X-Geecache-Not-Found头，以区别于节点上没有这个group；
+//            请求带有X-Geecache-Refresh头时节点忽略已缓存的值，重新加载并替换缓存；
+//            响应头X-Geecache-Version给出值在节点上的版本号；
+//            节点之间转发的单个和批量读取带有X-Geecache-From头（发起节点的地址），接收方只在本地加载，不再转发；
+//            请求体不为空时，路径中是规范化后的缓存key，请求体是原来的key，接收方用它调用回调函数（见geecache.WithKeyHashing）
+//   存在检查：HEAD <basepath><group>/<key>，只检查节点本地缓存，不会触发加载，200表示存在，404表示不存在
+//   批量读取：POST <basepath><group>/，请求体为若干个帧，每个帧是一个key；
+//            响应体按请求顺序为每个key写一个状态字节和一个帧，帧内是值或者错误信息；
+//            服务端边加载边写出，响应中的值累计超过上限后，剩余的key以StatusRetry返回，请求方应当逐个单独读取
+//   写入：    PUT  <basepath><group>/<key>，请求体为值，只写入节点本地缓存，不再转发，成功时返回204，响应头X-Geecache-Version为写入后的版本号；
+//            请求带有X-Geecache-If-Version头时只在节点上的版本号（没有这个key时为0）等于它时写入，否则返回412；
+//            请求带有X-Geecache-Get-Or-Set头时只在节点上没有这个key时写入，返回200和节点上最终的值（同单个读取的响应），
+//            值是这次写入的时带上X-Geecache-Stored头
+//   删除：    DELETE <basepath><group>/<key>，只删除节点本地缓存中的key，不再转发，key不存在时同样返回204
+//   前缀失效：DELETE <basepath><group>/?prefix=<prefix>，只删除节点本地缓存中以prefix开头的key，不再转发，响应体为删除的数量
+//   清空：    DELETE <basepath><group>/?flush=1，清空节点本地缓存中的group，不再转发，成功时返回204
+// 帧的格式为 uvarint(len(data)) data
+
+const (
+	DefaultBasePath = "/_geecache/"
+	DefaultReplicas = 50
+
+	MaxBatchKeys = 1024    // 一次批量读取最多包含的key数
+	maxKeySize   = 1 << 16 // 批量请求中单个key的最大长度
+
+	DefaultMaxBatchBytes = 32 << 20 // 批量读取响应中值的累计大小上限
+	maxFrameSize         = 1 << 30  // 单个帧的长度上限，防止错误的长度前缀导致巨大的内存分配
+)
+
+// 单个读取响应中携带剩余过期时间的响应头，使用剩余时间而不是时刻，节点之间的时钟不必一致
+const (
+	HeaderSoftTTL = "X-Geecache-Soft-TTL"
+	HeaderHardTTL = "X-Geecache-Hard-TTL"
+)
+
+// HeaderNotFound 标记404响应表示的是数据源中没有这个key
+const HeaderNotFound = "X-Geecache-Not-Found"
+
+// HeaderRefresh 要求节点忽略已缓存的值，重新加载key
+const HeaderRefresh = "X-Geecache-Refresh"
+
+// 值的版本号：读取和写入的响应中为节点上的版本号，写入请求中为期望的版本号
+const (
+	HeaderVersion   = "X-Geecache-Version"
+	HeaderIfVersion = "X-Geecache-If-Version"
+)
+
+// ErrVersionMismatch 表示节点上的版本号与期望的版本号不同，没有写入
+var ErrVersionMismatch = errors.New("geecache: version mismatch")
+
+// HeaderGetOrSet 使写入请求只在节点上没有这个key时写入，响应200并返回节点上的值；
+// 值是这次写入的时，响应带有HeaderStored头
+const (
+	HeaderGetOrSet = "X-Geecache-Get-Or-Set"
+	HeaderStored   = "X-Geecache-Stored"
+)
+
+// HeaderFrom 标记请求由其他节点转发而来，值为发起节点的地址
+const HeaderFrom = "X-Geecache-From"
+
+// PeerRequest 是节点之间转发的读取请求附带的信息
+type PeerRequest struct {
+	From    string // 发起请求的节点地址，接收方据此不再转发，避免节点列表不一致时请求在节点之间循环
+	Refresh bool   // 要求接收方忽略已缓存的值重新加载
+	Source  string // 接收方调用回调函数时使用的原来的key，与路径中的key不同时放在请求体中，见geecache.WithKeyHashing
+
+	// Reserve 不为nil时在读取响应体之前以Content-Length调用，返回错误时放弃读取，用于限制请求方在途的内存
+	Reserve func(n int64) error
+}
+
+func (pr PeerRequest) setHeaders(h http.Header) {
+	if pr.From != "" {
+		h.Set(HeaderFrom, pr.From)
+	}
+	if pr.Refresh {
+		h.Set(HeaderRefresh, "1")
+	}
+}
+
+// ErrNotFound 表示数据源中没有这个key
+var ErrNotFound = errors.New("geecache: not found")
+
+// 批量读取响应中每个key的状态
+const (
+	StatusOK    byte = 0
+	StatusError byte = 1
+	StatusRetry byte = 2 // 响应已达到大小上限，这个key需要单独读取
+)
+
+// ErrRetryIndividually 是以StatusRetry返回的key的错误
+var ErrRetryIndividually = errors.New("batch response limit reached, retry individually")
+
+// KeyURL 返回读取group中key的地址，baseURL形如"http://10.0.0.2:8008/_geecache/"
+func KeyURL(baseURL, group, key string) string {
+	return baseURL + url.PathEscape(group) + "/" + url.PathEscape(key)
+}
+
+// BatchURL 返回批量读取group的地址
+func BatchURL(baseURL, group string) string {
+	return baseURL + url.PathEscape(group) + "/"
+}
+
+// Entry 是单个读取的结果，SoftTTL/HardTTL为距软/硬过期的剩余时间，0表示没有对应的过期时间；
+// Version为值在节点上的版本号，0表示节点没有给出
+type Entry struct {
+	Value   []byte
+	SoftTTL time.Duration
+	HardTTL time.Duration
+	Version uint64
+}
+
+// Get 向远程节点读取group中key的值
+func Get(ctx context.Context, client *http.Client, baseURL, group, key string) ([]byte, error) {
+	e, err := GetEntry(ctx, client, baseURL, group, key)
+	return e.Value, err
+}
+
+// GetEntry 向远程节点读取group中key的值及其剩余过期时间
+func GetEntry(ctx context.Context, client *http.Client, baseURL, group, key string) (Entry, error) {
+	return GetPeerEntry(ctx, client, baseURL, group, key, PeerRequest{})
+}
+
+// GetPeerEntry 与GetEntry相同，用于节点之间的转发，请求带上pr中的信息
+func GetPeerEntry(ctx context.Context, client *http.Client, baseURL, group, key string, pr PeerRequest) (Entry, error) {
+	var body io.Reader
+	if pr.Source != "" && pr.Source != key {
+		body = strings.NewReader(pr.Source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, KeyURL(baseURL, group, key), body)
+	if err != nil {
+		return Entry{}, err
+	}
+	pr.setHeaders(req.Header)
+	res, err := client.Do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound && res.Header.Get(HeaderNotFound) != "" {
+		return Entry{}, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return Entry{}, statusError(res)
+	}
+	if pr.Reserve != nil && res.ContentLength > 0 {
+		if err := pr.Reserve(res.ContentLength); err != nil {
+			return Entry{}, err
+		}
+	}
+	return readEntry(res)
+}
+
+// readEntry 从200响应中读出值、剩余过期时间和版本号
+func readEntry(res *http.Response) (Entry, error) {
+	var e Entry
+	var err error
+	if e.SoftTTL, err = parseTTL(res.Header.Get(HeaderSoftTTL)); err != nil {
+		return Entry{}, err
+	}
+	if e.HardTTL, err = parseTTL(res.Header.Get(HeaderHardTTL)); err != nil {
+		return Entry{}, err
+	}
+	if e.Version, err = parseVersion(res.Header.Get(HeaderVersion)); err != nil {
+		return Entry{}, err
+	}
+	if e.Value, err = readBody(res); err != nil {
+		return Entry{}, fmt.Errorf("reading response body: %v", err)
+	}
+	return e, nil
+}
+
+// maxPreallocBytes 是按Content-Length预先分配缓冲区的上限，更大的响应仍由io.ReadAll逐步扩容，
+// 避免一个错误的Content-Length让请求方一次分配过多内存
+const maxPreallocBytes = 64 << 20
+
+// readBody 读取整个响应体；响应写明了长度时一次分配刚好的缓冲区，不需要io.ReadAll的多次扩容和拷贝
+func readBody(res *http.Response) ([]byte, error) {
+	n := res.ContentLength
+	if n < 0 || n > maxPreallocBytes {
+		return io.ReadAll(res.Body)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(res.Body, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SetTTLHeaders 在单个读取的响应中写入剩余过期时间，为0的不写
+func SetTTLHeaders(h http.Header, soft, hard time.Duration) {
+	if soft != 0 {
+		h.Set(HeaderSoftTTL, soft.String())
+	}
+	if hard != 0 {
+		h.Set(HeaderHardTTL, hard.String())
+	}
+}
+
+func parseVersion(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s header %q: %v", HeaderVersion, s, err)
+	}
+	return v, nil
+}
+
+func parseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad ttl header %q: %v", s, err)
+	}
+	return d, nil
+}
+
+// Set 把value写入远程节点的本地缓存中group里的key
+func Set(ctx context.Context, client *http.Client, baseURL, group, key string, value []byte) error {
+	_, err := SetVersioned(ctx, client, baseURL, group, key, value, nil)
+	return err
+}
+
+// SetVersioned 与Set相同，返回写入后的版本号；ifVersion不为nil时只在节点上的版本号等于*ifVersion时写入，
+// 否则返回ErrVersionMismatch
+func SetVersioned(ctx context.Context, client *http.Client, baseURL, group, key string, value []byte, ifVersion *uint64) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, KeyURL(baseURL, group, key), bytes.NewReader(value))
+	if err != nil {
+		return 0, err
+	}
+	if ifVersion != nil {
+		req.Header.Set(HeaderIfVersion, strconv.FormatUint(*ifVersion, 10))
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusPreconditionFailed {
+		return 0, ErrVersionMismatch
+	}
+	if res.StatusCode != http.StatusNoContent {
+		return 0, statusError(res)
+	}
+	return parseVersion(res.Header.Get(HeaderVersion))
+}
+
+// GetOrSet 在远程节点上原子地读取或写入group中的key：节点上已经有这个key时返回已有的值，stored为false；
+// 否则写入value并返回它，stored为true
+func GetOrSet(ctx context.Context, client *http.Client, baseURL, group, key string, value []byte) (e Entry, stored bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, KeyURL(baseURL, group, key), bytes.NewReader(value))
+	if err != nil {
+		return Entry{}, false, err
+	}
+	req.Header.Set(HeaderGetOrSet, "1")
+	res, err := client.Do(req)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Entry{}, false, statusError(res)
+	}
+	e, err = readEntry(res)
+	return e, res.Header.Get(HeaderStored) != "", err
+}
+
+// Remove 删除远程节点的本地缓存中group里的key
+func Remove(ctx context.Context, client *http.Client, baseURL, group, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, KeyURL(baseURL, group, key), nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return statusError(res)
+	}
+	return nil
+}
+
+// Exists 询问远程节点的本地缓存中是否有group中的key
+func Exists(ctx context.Context, client *http.Client, baseURL, group, key string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, KeyURL(baseURL, group, key), nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, statusError(res)
+}
+
+// RemovePrefix 让远程节点删除本地缓存中group里以prefix开头的key，返回删除的数量
+func RemovePrefix(ctx context.Context, client *http.Client, baseURL, group, prefix string) (int, error) {
+	u := BatchURL(baseURL, group) + "?prefix=" + url.QueryEscape(prefix)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, statusError(res)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("reading response body: %v", err)
+	}
+	n, err := strconv.Atoi(string(body))
+	if err != nil {
+		return 0, fmt.Errorf("bad response body %q", body)
+	}
+	return n, nil
+}
+
+// Flush 让远程节点清空group的本地缓存
+func Flush(ctx context.Context, client *http.Client, baseURL, group string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, BatchURL(baseURL, group)+"?flush=1", nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return statusError(res)
+	}
+	return nil
+}
+
+// ResponseError 表示远程节点返回了200以外的状态码
+type ResponseError struct {
+	Code   int
+	Status string
+}
+
+func (e *ResponseError) Error() string {
+	return "server returned: " + e.Status
+}
+
+func statusError(res *http.Response) error {
+	return &ResponseError{Code: res.StatusCode, Status: res.Status}
+}
+
+// Result 是批量读取中单个key的结果
+type Result struct {
+	Value []byte
+	Err   error
+}
+
+// GetMulti 一次请求读取远程节点上group中的多个key，返回的结果与keys一一对应。用于节点之间的转发，请求带上pr中的信息
+func GetMulti(ctx context.Context, client *http.Client, baseURL, group string, keys []string, pr PeerRequest) ([]Result, error) {
+	results := make([]Result, len(keys))
+	err := streamMulti(ctx, client, baseURL, group, keys, pr, func(i int, r Result) {
+		results[i] = r
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StreamMulti 与GetMulti相同，但每读到一个key的结果就调用fn(i, result)，i为key在keys中的下标，
+// 不需要等待整个响应，也不会在内存中保留已经交给fn的值。返回错误时，可能已经为部分key调用过fn
+func StreamMulti(ctx context.Context, client *http.Client, baseURL, group string, keys []string, fn func(i int, r Result)) error {
+	return streamMulti(ctx, client, baseURL, group, keys, PeerRequest{}, fn)
+}
+
+func streamMulti(ctx context.Context, client *http.Client, baseURL, group string, keys []string, pr PeerRequest, fn func(i int, r Result)) error {
+	if len(keys) > MaxBatchKeys {
+		return fmt.Errorf("too many keys in batch: %d > %d", len(keys), MaxBatchKeys)
+	}
+	var body bytes.Buffer
+	for _, key := range keys {
+		WriteFrame(&body, []byte(key))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, BatchURL(baseURL, group), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	pr.setHeaders(req.Header)
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return statusError(res)
+	}
+	r := bufio.NewReader(res.Body)
+	for i := range keys {
+		result, err := ReadResult(r)
+		if err != nil {
+			return fmt.Errorf("reading response body: %v", err)
+		}
+		fn(i, result)
+	}
+	return nil
+}
+
+// ReadBatchRequest 解析批量读取的请求体
+func ReadBatchRequest(body io.Reader) ([]string, error) {
+	r := bufio.NewReader(body)
+	var keys []string
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n > maxKeySize {
+			return nil, fmt.Errorf("key too long: %d bytes", n)
+		}
+		if len(keys) == MaxBatchKeys {
+			return nil, fmt.Errorf("too many keys in batch")
+		}
+		key := make([]byte, n)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, string(key))
+	}
+}
+
+// WriteResult 写入批量读取中一个key的结果
+func WriteResult(w io.Writer, value []byte, err error) error {
+	status := StatusOK
+	if err != nil {
+		status, value = StatusError, []byte(err.Error())
+	}
+	if _, err := w.Write([]byte{status}); err != nil {
+		return err
+	}
+	return WriteFrame(w, value)
+}
+
+// WriteRetry 写入一个StatusRetry结果
+func WriteRetry(w io.Writer) error {
+	if _, err := w.Write([]byte{StatusRetry}); err != nil {
+		return err
+	}
+	return WriteFrame(w, nil)
+}
+
+// ReadResult 读取批量读取响应中一个key的结果
+func ReadResult(r *bufio.Reader) (Result, error) {
+	status, err := r.ReadByte()
+	if err != nil {
+		return Result{}, err
+	}
+	data, err := ReadFrame(r)
+	if err != nil {
+		return Result{}, err
+	}
+	switch status {
+	case StatusOK:
+		return Result{Value: data}, nil
+	case StatusError:
+		if string(data) == ErrNotFound.Error() {
+			return Result{Err: ErrNotFound}, nil // 保留未找到的语义，请求方可以缓存它
+		}
+		return Result{Err: errors.New(string(data))}, nil
+	case StatusRetry:
+		return Result{Err: ErrRetryIndividually}, nil
+	}
+	return Result{}, fmt.Errorf("unknown batch status %d", status)
+}
+
+// WriteFrame 写入一个长度前缀的帧
+func WriteFrame(w io.Writer, data []byte) error {
+	var lenBuf [binary.MaxVarintLen64]byte
+	if _, err := w.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(data)))]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadFrame 读取一个长度前缀的帧
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("frame too large: %d bytes", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
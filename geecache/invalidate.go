@@ -0,0 +1,163 @@
+package geecache
+
+import (
+	"strings"
+)
+
+// 按前缀批量失效，如重新发布商品目录后删除所有以"product:"开头的key
+// 本地删除分块进行：每次在锁内用Scan取出一小块记录、删除其中匹配的，然后释放锁，避免长时间阻塞读写。
+// 删除开始前先登记一个墓碑（前缀和当前的写入计数），删除期间Get读到匹配前缀的旧记录也视为不存在，
+// 因此旧记录不会因为被访问而移动位置、躲过分块扫描。匹配的记录太多时调用方不再等待，墓碑保留下来，
+// 剩余的旧记录由后台继续分块删除（期间被读取时惰性删除），删完后移除墓碑，不再拖慢之后的每次读取。
+
+const (
+	prefixChunk            = 256   // 每次持锁扫描的记录数
+	defaultPrefixThreshold = 10000 // 删除超过这个数量后改为惰性失效
+	maxTombstones          = 64    // 保留的墓碑数量上限，超过时不再改为惰性失效，而是扫描完整个缓存
+)
+
+// tombstone 表示写入计数不超过gen、以prefix开头的记录都已失效
+type tombstone struct {
+	prefix string
+	gen    uint64
+}
+
+// invalidated 判断记录是否已被按前缀失效，调用时需持有c.mu
+func (c *cache) invalidated(key string, v ByteView) bool {
+	for _, t := range c.tombstones {
+		if v.gen <= t.gen && strings.HasPrefix(key, t.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// removePrefix 删除本地缓存中以prefix开头的记录，返回删除的数量；lazy为true时允许改为惰性失效，这时只包括已经删除的部分，
+// 剩余的记录由后台goroutine继续分块删除，删完后移除墓碑
+func (c *cache) removePrefix(prefix string, lazy bool) int {
+	c.lockWrite()
+	if c.lru == nil {
+		c.unlock()
+		return 0
+	}
+	t := tombstone{prefix: prefix, gen: c.gen}
+	c.tombstones = append(c.tombstones, t)
+	lazyAllowed := lazy && len(c.tombstones) <= maxTombstones
+	limit := 4 * c.lru.Len() // 游标失效时扫描会从头开始，限制总的扫描量
+	threshold := c.prefixThreshold
+	if threshold <= 0 {
+		threshold = defaultPrefixThreshold
+	}
+	c.unlock()
+
+	removed, cursor, done := c.scanPrefix(t, "", func(removed, scanned int) bool {
+		return lazyAllowed && (removed > threshold || scanned > limit)
+	})
+	if !done {
+		go c.scanPrefix(t, cursor, nil) // 保留墓碑，剩余的记录在后台删除，期间读到的旧记录惰性删除
+	}
+	return removed
+}
+
+// scanPrefix 从cursor开始分块删除墓碑t覆盖的记录，每块之间释放锁。stop不为nil且返回true时提前停止，
+// 返回删除的数量和下一块开始的游标；扫描完整个缓存（或期间缓存被清空）时done为true，墓碑在这时移除
+func (c *cache) scanPrefix(t tombstone, cursor string, stop func(removed, scanned int) bool) (removed int, next string, done bool) {
+	scanned := 0
+	for {
+		c.lockWrite()
+		if c.lru == nil || !c.hasTombstone(t) {
+			c.unlock() // 期间缓存被清空
+			return removed, "", true
+		}
+		entries := c.lru.Scan(cursor, prefixChunk)
+		for _, e := range entries {
+			if e.Value.gen <= t.gen && strings.HasPrefix(e.Key, t.prefix) {
+				c.lru.Remove(e.Key)
+				removed++
+				continue
+			}
+			cursor = e.Key // 以留下的记录作为游标，被删除的key不能再作为游标
+		}
+		scanned += len(entries)
+		if len(entries) < prefixChunk {
+			c.dropTombstone(t)
+			c.unlock()
+			return removed, "", true
+		}
+		c.unlock()
+		if stop != nil && stop(removed, scanned) {
+			return removed, cursor, false
+		}
+	}
+}
+
+func (c *cache) hasTombstone(t tombstone) bool {
+	for _, x := range c.tombstones {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cache) dropTombstone(t tombstone) {
+	for i, x := range c.tombstones {
+		if x == t {
+			c.tombstones = append(c.tombstones[:i], c.tombstones[i+1:]...)
+			return
+		}
+	}
+}
+
+// removeLocalPrefix 在mainCache和hotCache中按前缀删除，返回删除的总数，lazy见cache.removePrefix；
+// 不存在key的过滤器无法按前缀移除，整个清空
+func (g *Group) removeLocalPrefix(prefix string, lazy bool) int {
+	if g.notFound != nil {
+		g.notFound.reset()
+	}
+	return g.mainCache.removePrefix(prefix, lazy) + g.hotCache.removePrefix(prefix, lazy)
+}
+
+// RemovePrefix 删除本地缓存中所有以prefix开头的key，并在后台通知其他节点执行同样的删除，返回本地删除的数量
+// 匹配的记录非常多时，本地删除会在删除一部分后改为惰性失效，返回值只包括已经删除的部分，但所有匹配的旧值都不会再被返回
+// 各个远程节点的结果通过WithPrefixReport设置的回调报告。维护期间删除会排队到退出维护模式时执行，返回0。
+// 开启了WithKeyHashing时缓存key不保留前缀，不做任何删除，记录ErrPrefixWithKeyHashing并返回0
+func (g *Group) RemovePrefix(prefix string) int {
+	if g.keyHash != nil {
+		g.logger().Errorf("Failed to remove prefix %q: %v", prefix, ErrPrefixWithKeyHashing)
+		return 0
+	}
+	n := 0
+	queued, err := g.mutate(func() {
+		n = g.removePrefix(prefix)
+	})
+	if err != nil {
+		g.logger().Errorf("Failed to queue removal of prefix %q: %v", prefix, err)
+	}
+	if queued || err != nil {
+		return 0
+	}
+	return n
+}
+
+func (g *Group) removePrefix(prefix string) int {
+	n := g.removeLocalPrefix(prefix, true)
+	if b, ok := g.peers.(broadcaster); ok {
+		for peer, getter := range b.broadcastTargets() {
+			r, ok := getter.(prefixRemover)
+			if !ok {
+				continue
+			}
+			go func(peer string, r prefixRemover) {
+				removed, err := r.RemovePrefix(g.name, prefix)
+				if err != nil {
+					g.logger().Errorf("Failed to remove prefix %q on %s: %v", prefix, peer, err)
+				}
+				if g.prefixReport != nil {
+					g.protect("PrefixReport", func() { g.prefixReport(peer, removed, err) })
+				}
+			}(peer, r)
+		}
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRemovePrefix(t *testing.T) {
+	silenceLog(t)
+	loads := 0
+	g := NewGroup("remove-prefix", 0, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}), WithUnlimitedBytes())
+	for i := 0; i < 1000; i++ {
+		g.Get(context.Background(), fmt.Sprintf("product:%d", i))
+		g.Get(context.Background(), fmt.Sprintf("user:%d", i))
+	}
+
+	if n := g.RemovePrefix("product:"); n != 1000 {
+		t.Fatalf("RemovePrefix removed %d, want 1000", n)
+	}
+	if n := len(g.mainCache.keys()); n != 1000 {
+		t.Fatalf("%d keys left, want 1000", n)
+	}
+	if len(g.mainCache.tombstones) != 0 {
+		t.Fatal("tombstone kept after a complete scan")
+	}
+	loads = 0
+	g.Get(context.Background(), "user:1")
+	g.Get(context.Background(), "product:1")
+	if loads != 1 {
+		t.Fatalf("loads = %d, want only product:1 reloaded", loads)
+	}
+}
+
+func TestRemovePrefixLazy(t *testing.T) {
+	silenceLog(t)
+	g := NewGroup("remove-prefix-lazy", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithUnlimitedBytes())
+	g.mainCache.prefixThreshold = 100
+	for i := 0; i < 5000; i++ {
+		g.Get(context.Background(), fmt.Sprintf("product:%d", i))
+	}
+
+	n := g.RemovePrefix("product:")
+	if n <= 100 || n >= 5000 {
+		t.Fatalf("RemovePrefix removed %d, expect it to stop shortly after the threshold", n)
+	}
+	// 剩余的旧记录不再返回，之后写入的新记录不受影响
+	if _, ok := g.mainCache.get("product:4999"); ok {
+		t.Fatal("invalidated entry still served")
+	}
+	g.Get(context.Background(), "product:4999")
+	if _, ok := g.mainCache.get("product:4999"); !ok {
+		t.Fatal("entry written after the invalidation was dropped")
+	}
+	count := 0
+	g.mainCache.rangeEntries(func(string, ByteView) bool { count++; return true })
+	if count != 1 {
+		t.Fatalf("rangeEntries returned %d entries, want 1", count)
+	}
+
+	// 后台删完剩余的旧记录后移除墓碑，新记录保留
+	waitFor(t, func() bool {
+		g.mainCache.mu.RLock()
+		defer g.mainCache.mu.RUnlock()
+		return len(g.mainCache.tombstones) == 0
+	})
+	if keys := g.mainCache.keys(); len(keys) != 1 || keys[0] != "product:4999" {
+		t.Fatalf("%d keys left after the background sweep, want only product:4999", len(keys))
+	}
+	if _, ok := g.mainCache.get("product:4999"); !ok {
+		t.Fatal("entry written after the invalidation was swept")
+	}
+}
+
+func TestRemovePrefixBroadcast(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	reports := make(chan int, 1)
+
+	// 远程节点b，以及通知它的本节点a
+	poolB := NewHTTPPool("b")
+	b := NewGroup("remove-prefix-cluster", 0, getter, WithUnlimitedBytes())
+	b.RegisterPeers(poolB)
+	srv := httptest.NewServer(poolB)
+	defer srv.Close()
+	for i := 0; i < 10; i++ {
+		b.Get(context.Background(), fmt.Sprintf("product:%d", i))
+	}
+
+	poolA := NewHTTPPool("a")
+	poolA.Set("a", srv.URL)
+	a := NewGroup("remove-prefix-cluster", 0, getter, WithPrefixReport(func(peer string, removed int, err error) {
+		if err != nil || peer != srv.URL {
+			t.Errorf("report from %s: %v", peer, err)
+		}
+		reports <- removed
+	}), WithUnlimitedBytes())
+	a.RegisterPeers(poolA)
+	a.mainCache.add("product:x", ByteView{b: []byte("x")})
+
+	if n := a.RemovePrefix("product:"); n != 1 {
+		t.Fatalf("local RemovePrefix removed %d, want 1", n)
+	}
+	select {
+	case n := <-reports:
+		if n != 10 {
+			t.Fatalf("peer removed %d, want 10", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no report from peer")
+	}
+	if _, ok := b.mainCache.get("product:3"); ok {
+		t.Fatal("peer still holds invalidated key")
+	}
+}
@@ -0,0 +1,69 @@
+package geecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// 长key的规范化：有些key是完整的SQL语句或URL，长达数KB，会占用LRU的字节数、拖慢一致性哈希，还会让节点之间请求的URL过长。
+// WithKeyHashing在读写的入口把key换成h(key)（缓存key），本地缓存、singleflight、一致性哈希和节点之间的协议看到的都是缓存key；
+// 回调函数拿到的仍是原来的key（加载key），以便在数据源中查找。加载key通过ctx交给load和getLocally，
+// 转发给远程节点时放在请求体中（见protocol.PeerRequest.Source），所属节点用它调用回调函数。
+// 两个key的h相同时共用同一条记录，开启时需要调用方自己保证不冲突。
+// 缓存key不保留原来的前缀，开启后RemovePrefix和DeletePrefix无法匹配任何记录，因此直接拒绝（记录ErrPrefixWithKeyHashing并返回0），
+// 需要按前缀失效的group不要开启。client.Client和ownership.Ring只知道哈希环，按原来的key选择节点，也不能用于开启了WithKeyHashing的group
+
+// ErrPrefixWithKeyHashing 表示开启了WithKeyHashing的group不支持按前缀删除
+var ErrPrefixWithKeyHashing = errors.New("geecache: prefix removal is not supported with key hashing")
+
+// WithKeyHashing 设置key的规范化函数，nil表示不变换（默认）。h必须是确定的，集群中的节点需要使用同一个h
+func WithKeyHashing(h func(string) string) GroupOption {
+	return func(g *Group) {
+		g.keyHash = h
+	}
+}
+
+// SHA256Key 返回key的SHA-256的十六进制表示，可以作为WithKeyHashing的参数
+func SHA256Key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheKey 返回key对应的缓存key
+func (g *Group) cacheKey(key string) string {
+	if g.keyHash == nil || key == "" {
+		return key
+	}
+	return g.keyHash(key)
+}
+
+// sourceKeys 是缓存key到加载key的映射，只记录两者不同的key
+type sourceKeys map[string]string
+
+// sourceKeysKey 是ctx中sourceKeys的键，按group区分，回调函数读取其他group时互不影响
+type sourceKeysKey struct{ group string }
+
+// withSourceKey 把key换成缓存key，并在返回的ctx中记录加载key
+func (g *Group) withSourceKey(ctx context.Context, key string) (context.Context, string) {
+	ck := g.cacheKey(key)
+	if ck == key {
+		return ctx, key
+	}
+	return g.withSourceKeys(ctx, sourceKeys{ck: key}), ck
+}
+
+func (g *Group) withSourceKeys(ctx context.Context, keys sourceKeys) context.Context {
+	return context.WithValue(ctx, sourceKeysKey{g.name}, keys)
+}
+
+// sourceKey 返回group中缓存key对应的加载key，没有记录时就是key本身
+func sourceKey(ctx context.Context, group, key string) string {
+	if keys, ok := ctx.Value(sourceKeysKey{group}).(sourceKeys); ok {
+		if source, ok := keys[key]; ok {
+			return source
+		}
+	}
+	return key
+}
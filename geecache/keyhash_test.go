@@ -0,0 +1,171 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"geecache/geecache/internal/protocol"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyHashing(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	var mu sync.Mutex
+	var seen []string
+	g := NewGroup("key-hashing", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		seen = append(seen, key)
+		mu.Unlock()
+		return []byte(fmt.Sprintf("v:%d", len(key))), nil
+	}), WithKeyHashing(SHA256Key), WithSoftTTL(time.Second))
+	g.now = clock.Now
+
+	key := "SELECT * FROM users WHERE " + strings.Repeat("id = 1 OR ", 500) + "id = 2"
+	v, err := g.Get(ctx, key)
+	if want := fmt.Sprintf("v:%d", len(key)); err != nil || v.String() != want {
+		t.Fatalf("Get = %q, %v, want %q", v.String(), err, want)
+	}
+	// 缓存中保存的是缓存key，只有值计入字节数
+	if !g.mainCache.contains(SHA256Key(key)) || !g.CachedLocally(key) {
+		t.Fatal("value not cached under the hashed key")
+	}
+	if n := g.CacheBytes(); n >= int64(len(key)) {
+		t.Fatalf("CacheBytes = %d, want less than the key length %d", n, len(key))
+	}
+
+	// 后台刷新同样使用原来的key
+	clock.Advance(2 * time.Second)
+	g.Get(ctx, key)
+	g.refreshes.Wait()
+	mu.Lock()
+	if len(seen) != 2 || seen[0] != key || seen[1] != key {
+		t.Fatalf("getter saw %d keys, want the original key twice", len(seen))
+	}
+	mu.Unlock()
+
+	if err := g.Set(key, []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get(ctx, key); v.String() != "set" {
+		t.Fatalf("Get after Set = %q", v.String())
+	}
+	if ok, _ := g.Exists(ctx, key); !ok {
+		t.Fatal("Exists = false after Set")
+	}
+	values, errs := g.GetMulti(ctx, []string{key, "short"})
+	if len(errs) != 0 || values[key].String() != "set" || values["short"].String() != "v:5" {
+		t.Fatalf("GetMulti = %v, %v", values, errs)
+	}
+	g.Delete(key)
+	if g.CachedLocally(key) {
+		t.Fatal("value still cached after Delete")
+	}
+}
+
+func TestKeyHashingThroughHTTPPool(t *testing.T) {
+	silenceLog(t)
+	const name = "key-hashing-http"
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+		loads  [2]sync.Map // 每个节点的回调函数收到的key
+		calls  [2]atomic.Int32
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		srv.Config.MaxHeaderBytes = 8 << 10 // 常见的代理和服务器对请求行和请求头的限制
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		n := i
+		g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			calls[n].Add(1)
+			loads[n].Store(key, true)
+			return []byte(fmt.Sprintf("%d@%d", len(key), n)), nil
+		}), WithKeyHashing(SHA256Key))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, pool := range pools {
+		pool.Set(urls...)
+	}
+
+	// 找两个哈希后由B负责的长key
+	var keys []string
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprintf("https://example.com/search?page=%d&q=%s", i, strings.Repeat("x", 32<<10))
+		if pools[0].peers.Get(SHA256Key(key)) == urls[1] {
+			keys = append(keys, key)
+		}
+	}
+	// 不经过规范化，这样长的key无法放进请求的URL
+	if _, err := protocol.Get(context.Background(), http.DefaultClient, urls[1]+defaultBasePath, name, keys[0]); err == nil {
+		t.Fatal("raw long key accepted, the test server has no URL limit")
+	}
+
+	v, err := groups[0].Get(context.Background(), keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%d@1", len(keys[0])); v.String() != want {
+		t.Fatalf("Get = %q, want %q", v.String(), want)
+	}
+	if _, ok := loads[1].Load(keys[0]); !ok || calls[0].Load() != 0 {
+		t.Fatalf("owner's getter did not see the original key (A loads=%d)", calls[0].Load())
+	}
+	if !groups[1].CachedLocally(keys[0]) {
+		t.Fatal("owner did not cache the value")
+	}
+
+	// 批量读取同样把原来的key交给所属节点
+	values, errs := groups[0].GetMulti(context.Background(), keys)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for _, key := range keys {
+		if want := fmt.Sprintf("%d@1", len(key)); values[key].String() != want {
+			t.Fatalf("GetMulti[%.40q] = %q, want %q", key, values[key].String(), want)
+		}
+	}
+	if n := calls[1].Load(); n != 2 {
+		t.Fatalf("owner loaded %d times, want 2", n)
+	}
+}
+
+func TestKeyHashingRejectsPrefixRemoval(t *testing.T) {
+	logger := &captureLogger{}
+	name := "key-hashing-prefix"
+	g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithKeyHashing(SHA256Key), WithLogger(logger))
+	pool := NewHTTPPool("self")
+	g.RegisterPeers(pool)
+	g.Get(context.Background(), "product:1")
+
+	// 缓存key是哈希值，前缀匹配不到任何记录，拒绝而不是假装删除成功
+	if n := g.RemovePrefix("product:"); n != 0 || !logger.has("ERROR", ErrPrefixWithKeyHashing.Error()) {
+		t.Fatalf("RemovePrefix = %d, logs %q", n, logger.lines)
+	}
+	if n := g.DeletePrefix("product:"); n != 0 {
+		t.Fatalf("DeletePrefix = %d", n)
+	}
+	if !g.CachedLocally("product:1") {
+		t.Fatal("entry removed although the prefix was rejected")
+	}
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, defaultBasePath+name+"/?prefix=product:", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "key hashing") {
+		t.Fatalf("peer prefix removal: %d %s", rec.Code, rec.Body)
+	}
+}
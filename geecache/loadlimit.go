@@ -0,0 +1,62 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+)
+
+// 回调函数并发上限：singleflight只合并相同的key，一批不同的冷key仍然会同时调用同样多次回调函数，可能压垮数据源。
+// WithMaxConcurrentLoads限制同时进行的回调函数调用数，达到上限后新的调用等待空位（受ctx和WithLoadTimeout约束），
+// 或者在WithLoadLimitFailFast时立即返回ErrTooManyLoads。
+// 限制只作用于回调函数，不影响缓存命中和远程节点的请求；空位在singleflight发起的加载中获取，
+// 等待同一次加载的调用方不占用空位，因此不会因为等待者占满空位而死锁
+
+// ErrTooManyLoads 是WithLoadLimitFailFast时回调函数调用数已达上限返回的错误，远程节点以503返回它
+var ErrTooManyLoads = errors.New("geecache: too many concurrent loads")
+
+// WithMaxConcurrentLoads 限制同时进行的回调函数调用数，0表示不限制（默认）。批量加载（BatchGetter）的一次调用占用一个空位
+func WithMaxConcurrentLoads(n int) GroupOption {
+	return func(g *Group) {
+		g.loadSlots = nil
+		if n > 0 {
+			g.loadSlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithLoadLimitFailFast 使回调函数调用数达到WithMaxConcurrentLoads的上限时立即返回ErrTooManyLoads，而不是等待
+func WithLoadLimitFailFast() GroupOption {
+	return func(g *Group) {
+		g.loadFailFast = true
+	}
+}
+
+// acquireLoad 在调用回调函数之前获取一个空位，成功后必须调用releaseLoad
+func (g *Group) acquireLoad(ctx context.Context) error {
+	if g.loadSlots != nil {
+		if g.loadFailFast {
+			select {
+			case g.loadSlots <- struct{}{}:
+			default:
+				g.stats.loadsRejected.Add(1)
+				return ErrTooManyLoads
+			}
+		} else {
+			select {
+			case g.loadSlots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	g.stats.loadsInFlight.Add(1)
+	return nil
+}
+
+// releaseLoad 在回调函数返回后释放空位
+func (g *Group) releaseLoad() {
+	g.stats.loadsInFlight.Add(-1)
+	if g.loadSlots != nil {
+		<-g.loadSlots
+	}
+}
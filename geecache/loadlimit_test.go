@@ -0,0 +1,88 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("max-loads", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		<-release
+		return []byte(key), nil
+	}), WithMaxConcurrentLoads(2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 每个key两个调用方，等待同一次加载的调用方不占用空位
+			for j := 0; j < 2; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					key := fmt.Sprintf("k%d", i)
+					if v, err := g.Get(context.Background(), key); err != nil || v.String() != key {
+						t.Errorf("Get(%s) = %q, %v", key, v, err)
+					}
+				}()
+			}
+		}(i)
+	}
+	waitFor(t, func() bool { return g.Stats().LoadsInFlight == 2 })
+	time.Sleep(10 * time.Millisecond)
+	if s := g.Stats(); s.LoadsInFlight != 2 || s.LocalLoads[NoPeers.String()] != 2 {
+		t.Fatalf("in flight = %d, loads started = %d, want 2", s.LoadsInFlight, s.LocalLoads[NoPeers.String()])
+	}
+	// 等待空位的加载受ctx约束
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.Get(ctx, "other"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get while full = %v", err)
+	}
+	close(release)
+	wg.Wait()
+	if s := g.Stats(); s.LoadsInFlight != 0 || s.LocalLoads[NoPeers.String()] != 5 {
+		t.Fatalf("after release: %+v", s)
+	}
+}
+
+func TestMaxConcurrentLoadsFailFast(t *testing.T) {
+	silenceLog(t)
+	release := make(chan struct{})
+	g := NewGroup("max-loads-fail-fast", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		<-release
+		return []byte(key), nil
+	}), WithMaxConcurrentLoads(1), WithLoadLimitFailFast())
+	peer := &echoPeer{}
+	g.RegisterPeers(prefixPeers{"remote", peer})
+	g.Set("cached", []byte("v"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Get(context.Background(), "slow")
+	}()
+	waitFor(t, func() bool { return g.Stats().LoadsInFlight == 1 })
+
+	if _, err := g.Get(context.Background(), "other"); !errors.Is(err, ErrTooManyLoads) {
+		t.Fatalf("Get while full = %v, want ErrTooManyLoads", err)
+	}
+	// 缓存命中和远程节点的请求不受限制
+	if v, err := g.Get(context.Background(), "cached"); err != nil || v.String() != "v" {
+		t.Fatalf("cache hit while full = %q, %v", v, err)
+	}
+	if v, err := g.Get(context.Background(), "remote1"); err != nil || v.String() != "remote1" {
+		t.Fatalf("peer fetch while full = %q, %v", v, err)
+	}
+	if s := g.Stats(); s.LoadsRejected != 1 {
+		t.Fatalf("loads rejected = %d, want 1", s.LoadsRejected)
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,92 @@
+package geecache
+
+import (
+	"fmt"
+	"log"
+)
+
+// 日志：group和HTTPPool的日志都通过Logger输出，可以接入应用自己的（结构化）日志。
+// 每个请求、每次选择节点这类高频日志为Debug级别，默认的StdLogger丢弃它们；
+// 进入/退出维护模式、导入完成等为Info级别，访问远程节点失败、回调函数panic等为Error级别
+
+// Logger 是geecache输出日志的接口，可能被并发调用
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// stdLogger 通过标准库log输出，前缀为"[GeeCache] "
+type stdLogger struct {
+	debug bool
+}
+
+// StdLogger 返回通过标准库log输出的Logger，debug为false时丢弃Debug级别的日志。默认使用StdLogger(false)
+func StdLogger(debug bool) Logger {
+	return stdLogger{debug: debug}
+}
+
+func (l stdLogger) Debugf(format string, v ...interface{}) {
+	if l.debug {
+		log.Printf("[GeeCache] DEBUG "+format, v...)
+	}
+}
+
+func (l stdLogger) Infof(format string, v ...interface{}) {
+	log.Printf("[GeeCache] "+format, v...)
+}
+
+func (l stdLogger) Errorf(format string, v ...interface{}) {
+	log.Printf("[GeeCache] ERROR "+format, v...)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// NopLogger 丢弃所有日志
+var NopLogger Logger = nopLogger{}
+
+var defaultLogger = StdLogger(false)
+
+// WithLogger 设置group输出日志使用的Logger，默认为StdLogger(false)
+func WithLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.log = l
+	}
+}
+
+// WithPoolLogger 设置HTTPPool输出日志使用的Logger，默认为StdLogger(false)
+func WithPoolLogger(l Logger) PoolOption {
+	return func(p *HTTPPool) {
+		p.log = l
+	}
+}
+
+// logger 返回group使用的Logger
+func (g *Group) logger() Logger {
+	if g.log != nil {
+		return g.log
+	}
+	return defaultLogger
+}
+
+// logger 返回HTTPPool使用的Logger
+func (p *HTTPPool) logger() Logger {
+	if p.log != nil {
+		return p.log
+	}
+	return defaultLogger
+}
+
+// Log 以Info级别输出一条带着本节点地址的日志
+func (p *HTTPPool) Log(format string, v ...interface{}) {
+	p.logger().Infof("Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// debugf 以Debug级别输出一条带着本节点地址的日志
+func (p *HTTPPool) debugf(format string, v ...interface{}) {
+	p.logger().Debugf("Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
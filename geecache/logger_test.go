@@ -0,0 +1,73 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger 记录每条日志，格式为"级别 内容"
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) add(level, format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, v...))
+}
+
+func (l *captureLogger) Debugf(format string, v ...interface{}) { l.add("DEBUG", format, v...) }
+func (l *captureLogger) Infof(format string, v ...interface{})  { l.add("INFO", format, v...) }
+func (l *captureLogger) Errorf(format string, v ...interface{}) { l.add("ERROR", format, v...) }
+
+// has 判断是否有以level开头并包含substr的日志
+func (l *captureLogger) has(level, substr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.HasPrefix(line, level+" ") && strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	logger := &captureLogger{}
+	g := NewGroup("logger", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithLogger(logger))
+	g.RegisterPeers(fakePeers{failingPeer{errors.New("connection refused")}})
+	if _, err := g.Get(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	if !logger.has("ERROR", "connection refused") {
+		t.Fatalf("peer failure not logged: %q", logger.lines)
+	}
+	g.EnterMaintenance(0)
+	g.ExitMaintenance()
+	if !logger.has("INFO", "entered maintenance") || !logger.has("INFO", "left maintenance") {
+		t.Fatalf("maintenance not logged: %q", logger.lines)
+	}
+
+	// 每个请求只在Debug级别记录；挂载在错误路径上时记录错误并返回404，而不是panic
+	poolLogger := &captureLogger{}
+	pool := NewHTTPPool("self", WithPoolLogger(poolLogger))
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_geecache/logger/k", nil))
+	if w.Code != http.StatusOK || !poolLogger.has("DEBUG", "GET /_geecache/logger/k") || poolLogger.has("INFO", "GET") {
+		t.Fatalf("request logging: %d %q", w.Code, poolLogger.lines)
+	}
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/elsewhere", nil))
+	if w.Code != http.StatusNotFound || !poolLogger.has("ERROR", "unexpected path: /elsewhere") {
+		t.Fatalf("unexpected path: %d %q", w.Code, poolLogger.lines)
+	}
+}
@@ -0,0 +1,420 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ARC（Adaptive Replacement Cache）在“最近访问”和“访问频率”之间自适应地分配缓存：
+//   T1：只被访问过一次的记录；T2：被访问过至少两次的记录
+//   B1/B2：最近从T1/T2淘汰的记录的“幽灵”，只保存key，不保存值
+// 再次添加的key命中B1，说明T1太小，增大T1的目标大小p；命中B2，说明T2太小，减小p。
+// 这里的ARC以字节计量：p是T1的目标字节数，幽灵记录只有key的字节计入maxBytes。
+
+const (
+	inT1 = iota
+	inT2
+	inB1
+	inB2
+)
+
+type arcEntry[V any] struct {
+	key    string
+	value  V
+	ghost  bool // 幽灵记录，值已被移除
+	expire time.Time
+	added  time.Time // 写入（或最近一次更新）的时间
+	where  int       // 所在的链表
+}
+
+// ARCOf 是值类型为V的ARC缓存，记录占用的内存由SizeOf计算，幽灵记录只计入len(key)
+type ARCOf[V any] struct {
+	maxBytes  int64 // 允许使用的最大内存，包括幽灵记录的key
+	p         int64 // T1的目标字节数
+	lists     [4]*list.List
+	bytes     [4]int64
+	items     map[string]*list.Element
+	SizeOf    func(key string, value V) int64 // 计算一条记录的开销
+	OnEvicted func(key string, value V)       // 某条记录的值被移除时的回调函数，可以为nil
+	Now       func() time.Time                // 获取当前时间，用于判断记录是否过期，为nil时使用time.Now
+
+	// OnEvictedWithReason 与OnEvicted相同，但同时给出移除的原因；两者都设置时都会被调用
+	OnEvictedWithReason func(key string, value V, reason EvictReason)
+
+	// MaxEntries 限制记录（不包括幽灵记录）的条数，0（默认）表示不限制
+	MaxEntries int
+
+	// LowWater 是低水位比例，含义同Cache.LowWater，幽灵记录的key也计入
+	LowWater float64
+
+	// Locker 是保护缓存的锁，后台清理每批操作时持有它，淘汰回调也在持有它时调用，见StartJanitor。
+	// 需要在锁外执行回调时，可以在回调中只记录被淘汰的记录，在Locker的Unlock中再处理
+	Locker      sync.Locker
+	janitor     *janitor
+	sweepCursor string
+
+	evictions   int64 // 值因容量被淘汰的累计次数
+	expirations int64 // 因过期删除的累计次数
+}
+
+// ARC 是值实现了Value接口的ARC缓存，记录占用的内存为len(key)+value.Len()
+type ARC = ARCOf[Value]
+
+func NewARC(maxBytes int64, onEvicted func(string, Value)) *ARC {
+	return NewARCOf(maxBytes, DefaultCost, onEvicted)
+}
+
+// NewARCOf 创建值类型为V的ARC缓存，sizeOf计算一条记录占用的内存
+func NewARCOf[V any](maxBytes int64, sizeOf func(string, V) int64, onEvicted func(string, V)) *ARCOf[V] {
+	c := &ARCOf[V]{
+		maxBytes:  maxBytes,
+		items:     make(map[string]*list.Element),
+		SizeOf:    sizeOf,
+		OnEvicted: onEvicted,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+// Get 返回key对应的值，命中的记录移动到T2；幽灵记录视为未命中
+func (c *ARCOf[V]) Get(key string) (value V, ok bool) {
+	ele, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+	e := ele.Value.(*arcEntry[V])
+	if e.ghost {
+		return value, false
+	}
+	if !e.expire.IsZero() && !c.now().Before(e.expire) {
+		c.removeElement(ele, ReasonExpired)
+		return value, false
+	}
+	c.move(ele, inT2)
+	return e.value, true
+}
+
+// Peek 返回key对应的值，但不移动记录；已过期的记录视为不存在但不删除
+func (c *ARCOf[V]) Peek(key string) (value V, ok bool) {
+	if ele, ok := c.items[key]; ok {
+		if e := ele.Value.(*arcEntry[V]); !e.ghost && !c.expired(e) {
+			return e.value, true
+		}
+	}
+	return
+}
+
+// Contains 判断缓存中是否有未过期的key，幽灵记录不算
+func (c *ARCOf[V]) Contains(key string) bool {
+	ele, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	e := ele.Value.(*arcEntry[V])
+	return !e.ghost && !c.expired(e)
+}
+
+func (c *ARCOf[V]) Add(key string, value V) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加一条在expire时刻过期的记录，expire为零值表示永不过期
+func (c *ARCOf[V]) AddWithExpire(key string, value V, expire time.Time) {
+	hitB2 := false
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*arcEntry[V])
+		size := c.SizeOf(key, value)
+		switch e.where {
+		case inB1:
+			// T1中的记录被淘汰后又被需要，增大T1的目标大小
+			c.p += adapt(size, c.bytes[inB1], c.bytes[inB2])
+			if c.maxBytes != 0 && c.p > c.maxBytes {
+				c.p = c.maxBytes
+			}
+		case inB2:
+			// T2中的记录被淘汰后又被需要，减小T1的目标大小
+			hitB2 = true
+			c.p -= adapt(size, c.bytes[inB2], c.bytes[inB1])
+			if c.p < 0 {
+				c.p = 0
+			}
+		}
+		c.bytes[e.where] -= c.size(e)
+		e.value, e.ghost, e.expire, e.added = value, false, expire, c.now()
+		c.bytes[e.where] += c.size(e)
+		c.move(ele, inT2)
+	} else {
+		e := &arcEntry[V]{key: key, value: value, expire: expire, added: c.now(), where: inT1}
+		c.items[key] = c.lists[inT1].PushFront(e)
+		c.bytes[inT1] += c.size(e)
+	}
+	c.evict(hitB2)
+}
+
+// adapt 计算命中幽灵列表时p的调整量：另一个幽灵列表越大，调整越多
+func adapt(size, hit, other int64) int64 {
+	if hit > 0 && other > hit {
+		return size * other / hit
+	}
+	return size
+}
+
+// evict 总内存超过maxBytes时淘汰记录直到低水位：幽灵记录超过一半预算或已没有可淘汰的值时先丢弃幽灵记录，
+// 否则按ARC的规则把T1或T2最久未使用的记录降级为幽灵
+func (c *ARCOf[V]) evict(hitB2 bool) {
+	for c.MaxEntries > 0 && c.Len() > c.MaxEntries {
+		c.replace(hitB2)
+	}
+	if c.maxBytes == 0 || c.total() <= c.maxBytes {
+		return
+	}
+	target := lowWaterMark(c.maxBytes, c.LowWater)
+	for c.total() > target {
+		ghost := c.bytes[inB1] + c.bytes[inB2]
+		resident := c.Len()
+		if ghost > 0 && (resident == 0 || ghost > c.maxBytes/2) {
+			c.trimGhost()
+			continue
+		}
+		if resident == 0 {
+			return
+		}
+		c.replace(hitB2)
+	}
+}
+
+func (c *ARCOf[V]) replace(hitB2 bool) {
+	t1 := c.bytes[inT1]
+	if c.lists[inT1].Len() > 0 && (t1 > c.p || (hitB2 && t1 == c.p) || c.lists[inT2].Len() == 0) {
+		c.demote(c.lists[inT1].Back(), inB1)
+	} else {
+		c.demote(c.lists[inT2].Back(), inB2)
+	}
+}
+
+// demote 移除记录的值，只保留key作为幽灵记录
+func (c *ARCOf[V]) demote(ele *list.Element, to int) {
+	e := ele.Value.(*arcEntry[V])
+	c.evictions++
+	c.evicted(e.key, e.value, ReasonCapacity)
+	c.bytes[e.where] -= c.size(e)
+	var zero V
+	e.value, e.ghost = zero, true
+	c.bytes[e.where] += c.size(e)
+	c.move(ele, to)
+}
+
+func (c *ARCOf[V]) trimGhost() {
+	l := c.lists[inB1]
+	if l.Len() == 0 || (c.bytes[inB2] > c.bytes[inB1] && c.lists[inB2].Len() > 0) {
+		l = c.lists[inB2]
+	}
+	ele := l.Back()
+	e := ele.Value.(*arcEntry[V])
+	l.Remove(ele)
+	c.bytes[e.where] -= c.size(e)
+	delete(c.items, e.key)
+}
+
+// move 把记录移动到指定链表的队尾（front）
+func (c *ARCOf[V]) move(ele *list.Element, to int) {
+	e := ele.Value.(*arcEntry[V])
+	if e.where == to {
+		c.lists[to].MoveToFront(ele)
+		return
+	}
+	c.lists[e.where].Remove(ele)
+	c.bytes[e.where] -= c.size(e)
+	e.where = to
+	c.items[e.key] = c.lists[to].PushFront(e)
+	c.bytes[to] += c.size(e)
+}
+
+// Remove 删除指定的记录（包括幽灵记录），记录不存在时什么也不做
+func (c *ARCOf[V]) Remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeElement(ele, ReasonRemoved)
+	}
+}
+
+// RemoveOldest 按ARC的替换规则淘汰一条记录，它的key作为幽灵记录保留
+func (c *ARCOf[V]) RemoveOldest() {
+	if c.Len() > 0 {
+		c.replace(false)
+	}
+}
+
+func (c *ARCOf[V]) removeElement(ele *list.Element, reason EvictReason) {
+	e := ele.Value.(*arcEntry[V])
+	c.lists[e.where].Remove(ele)
+	c.bytes[e.where] -= c.size(e)
+	delete(c.items, e.key)
+	if !e.ghost {
+		if reason == ReasonExpired {
+			c.expirations++
+		}
+		c.evicted(e.key, e.value, reason)
+	}
+}
+
+// evicted 调用移除记录的回调函数
+func (c *ARCOf[V]) evicted(key string, value V, reason EvictReason) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	if c.OnEvictedWithReason != nil {
+		c.OnEvictedWithReason(key, value, reason)
+	}
+}
+
+// Resize 修改允许使用的最大内存，缩小时立即淘汰超出的部分
+func (c *ARCOf[V]) Resize(maxBytes int64) {
+	c.maxBytes = maxBytes
+	if maxBytes != 0 && c.p > maxBytes {
+		c.p = maxBytes
+	}
+	c.evict(false)
+}
+
+// Clear 清空缓存（包括幽灵记录和自适应状态），按T1、T2从旧到新的顺序对每条记录调用OnEvicted
+func (c *ARCOf[V]) Clear() {
+	// 先清空再调用回调，回调panic时缓存也已经处于一致的状态
+	t1, t2 := c.lists[inT1], c.lists[inT2]
+	for i := range c.lists {
+		c.lists[i] = list.New()
+		c.bytes[i] = 0
+	}
+	c.items = make(map[string]*list.Element)
+	c.p = 0
+	if c.OnEvicted != nil || c.OnEvictedWithReason != nil {
+		for _, l := range []*list.List{t1, t2} {
+			for ele := l.Back(); ele != nil; ele = ele.Prev() {
+				e := ele.Value.(*arcEntry[V])
+				c.evicted(e.key, e.value, ReasonCleared)
+			}
+		}
+	}
+}
+
+// Range 先遍历T2再遍历T1中未过期的记录，各自从最近使用到最久未使用，f返回false时提前结束
+// 遍历的是调用时的快照，f中增删记录不影响本次遍历的内容
+func (c *ARCOf[V]) Range(f func(key string, value V) bool) {
+	entries := c.snapshot()
+	for _, e := range entries {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Scan 按与Range相同的顺序返回key为cursor的记录之后最多n条未过期的记录，用法同Cache.Scan
+func (c *ARCOf[V]) Scan(cursor string, n int) []EntryOf[string, V] {
+	order := []int{inT2, inT1}
+	li, ele := c.seek(cursor)
+	now := c.now()
+	entries := make([]EntryOf[string, V], 0, n)
+	for len(entries) < n {
+		for ele == nil {
+			if li++; li == len(order) {
+				return entries
+			}
+			ele = c.lists[order[li]].Front()
+		}
+		if e := ele.Value.(*arcEntry[V]); e.expire.IsZero() || now.Before(e.expire) {
+			entries = append(entries, EntryOf[string, V]{e.key, e.value, e.expire})
+		}
+		ele = ele.Next()
+	}
+	return entries
+}
+
+// seek 返回cursor之后的第一条记录及其所在链表在[T2, T1]中的下标，cursor为空、不在缓存中或是幽灵记录时从头开始
+func (c *ARCOf[V]) seek(cursor string) (int, *list.Element) {
+	if cur, ok := c.items[cursor]; ok && cursor != "" {
+		if e := cur.Value.(*arcEntry[V]); !e.ghost {
+			if e.where == inT1 {
+				return 1, cur.Next()
+			}
+			return 0, cur.Next()
+		}
+	}
+	return 0, c.lists[inT2].Front()
+}
+
+// Keys 按与Range相同的顺序返回所有未过期的键
+func (c *ARCOf[V]) Keys() []string {
+	entries := c.snapshot()
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+func (c *ARCOf[V]) snapshot() []arcEntry[V] {
+	now := c.now()
+	entries := make([]arcEntry[V], 0, c.Len())
+	for _, where := range []int{inT2, inT1} {
+		for ele := c.lists[where].Front(); ele != nil; ele = ele.Next() {
+			if e := ele.Value.(*arcEntry[V]); e.expire.IsZero() || now.Before(e.expire) {
+				entries = append(entries, *e)
+			}
+		}
+	}
+	return entries
+}
+
+// Len 返回保存了值的记录数，不包括幽灵记录
+func (c *ARCOf[V]) Len() int {
+	return c.lists[inT1].Len() + c.lists[inT2].Len()
+}
+
+// Stats 返回缓存占用和淘汰情况的快照，OldestAdded取T1和T2队首中较早写入的一条
+func (c *ARCOf[V]) Stats() Stats {
+	s := Stats{
+		Len:       c.Len(),
+		Bytes:     c.total(),
+		MaxBytes:  c.maxBytes,
+		Evictions: c.evictions,
+		Expired:   c.expirations,
+	}
+	for _, where := range []int{inT1, inT2} {
+		if ele := c.lists[where].Back(); ele != nil {
+			if added := ele.Value.(*arcEntry[V]).added; s.OldestAdded.IsZero() || added.Before(s.OldestAdded) {
+				s.OldestAdded = added
+			}
+		}
+	}
+	return s
+}
+
+// Bytes 返回当前已使用的内存，包括幽灵记录的key
+func (c *ARCOf[V]) Bytes() int64 {
+	return c.total()
+}
+
+func (c *ARCOf[V]) total() int64 {
+	return c.bytes[inT1] + c.bytes[inT2] + c.bytes[inB1] + c.bytes[inB2]
+}
+
+// size 返回一条记录的开销，幽灵记录只有key
+func (c *ARCOf[V]) size(e *arcEntry[V]) int64 {
+	if e.ghost {
+		return int64(len(e.key))
+	}
+	return c.SizeOf(e.key, e.value)
+}
+
+func (c *ARCOf[V]) expired(e *arcEntry[V]) bool {
+	return !e.expire.IsZero() && !c.now().Before(e.expire)
+}
+
+func (c *ARCOf[V]) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
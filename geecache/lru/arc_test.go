@@ -0,0 +1,118 @@
+package lru
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// access 模拟缓存的典型用法：未命中时加载并添加
+func access(c *ARC, key string) bool {
+	if _, ok := c.Get(key); ok {
+		return true
+	}
+	c.Add(key, String("1234567"))
+	return false
+}
+
+func TestARCBasic(t *testing.T) {
+	evicted := make([]string, 0)
+	c := NewARC(int64(0), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	if v, ok := c.Get("k1"); !ok || string(v.(String)) != "v1" {
+		t.Fatal("cache hit k1=v1 failed")
+	}
+	if _, ok := c.Get("k3"); ok {
+		t.Fatal("cache miss k3 failed")
+	}
+	if expect := []string{"k1", "k2"}; !reflect.DeepEqual(expect, c.Keys()) {
+		t.Fatalf("Keys() = %v, expect %v", c.Keys(), expect)
+	}
+	c.Remove("k2")
+	if c.Len() != 1 || c.total() != 4 {
+		t.Fatalf("after Remove len=%d bytes=%d", c.Len(), c.total())
+	}
+	c.Clear()
+	if expect := []string{"k2", "k1"}; !reflect.DeepEqual(expect, evicted) || c.Len() != 0 || c.total() != 0 {
+		t.Fatalf("Clear evicted %v, len=%d", evicted, c.Len())
+	}
+}
+
+func TestARCBudget(t *testing.T) {
+	c := NewARC(int64(130), nil)
+	for i := 0; i < 1000; i++ {
+		access(c, fmt.Sprintf("k%02d", i%40))
+		access(c, fmt.Sprintf("k%02d", i%7))
+		if c.total() > 130 {
+			t.Fatalf("total bytes %d exceed budget", c.total())
+		}
+	}
+	// 幽灵记录只计入key的字节
+	for ele := c.lists[inB1].Front(); ele != nil; ele = ele.Next() {
+		if e := ele.Value.(*arcEntry[Value]); !e.ghost || e.value != nil || c.size(e) != int64(len(e.key)) {
+			t.Fatalf("ghost %s keeps its value", e.key)
+		}
+	}
+	c.Resize(50)
+	if c.total() > 50 {
+		t.Fatalf("total bytes %d exceed budget after Resize", c.total())
+	}
+}
+
+// 先是以最近访问为主的阶段（每个新key在稍后被再次访问一次，之后不再访问，被T1淘汰的key很快又被需要，命中B1），p增大；
+// 之后是以频率为主的阶段（一小组热点key反复访问，同时夹杂大量只访问一次的key，热点key被淘汰后命中B2），p减小
+func TestARCAdaptation(t *testing.T) {
+	c := NewARC(int64(130), nil) // 每条记录10字节
+	for i := 0; i < 300; i++ {
+		access(c, fmt.Sprintf("r%03d", i))
+		if i >= 15 {
+			access(c, fmt.Sprintf("r%03d", i-15))
+		}
+	}
+	afterRecency := c.p
+	if afterRecency == 0 {
+		t.Fatal("recency phase should grow the T1 target")
+	}
+
+	hits := 0
+	for i := 0; i < 300; i++ {
+		if access(c, fmt.Sprintf("f%d", i%4)) {
+			hits++
+		}
+		access(c, fmt.Sprintf("s%03d", i))
+		access(c, fmt.Sprintf("t%03d", i))
+	}
+	if c.p >= afterRecency {
+		t.Fatalf("frequency phase should shrink the T1 target: %d -> %d", afterRecency, c.p)
+	}
+	if hits < 250 {
+		t.Fatalf("hot keys should stay cached once ARC adapts, only %d hits", hits)
+	}
+}
+
+func TestARCOf(t *testing.T) {
+	var evicted []string
+	c := NewARCOf(20, func(key string, value []byte) int64 {
+		return int64(len(key) + len(value))
+	}, func(key string, value []byte) {
+		evicted = append(evicted, key)
+	})
+	c.Add("a", []byte("12345678"))
+	c.Add("b", []byte("12345678"))
+	if v, ok := c.Get("a"); !ok || string(v) != "12345678" {
+		t.Fatalf("Get(a) = %q, %v", v, ok)
+	}
+	c.Add("c", []byte("12345678")) // 每条9字节，T1中的b被降级为幽灵记录
+	if v, ok := c.Get("b"); ok || v != nil {
+		t.Fatalf("Get(b) = %q, %v, expect zero value", v, ok)
+	}
+	if !reflect.DeepEqual(evicted, []string{"b"}) || c.Len() != 2 {
+		t.Fatalf("len=%d evicted=%v, expect b evicted", c.Len(), evicted)
+	}
+	if got := c.Bytes(); got != 9+9+1 {
+		t.Fatalf("bytes = %d, expect two entries and one ghost key", got)
+	}
+}
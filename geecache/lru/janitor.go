@@ -0,0 +1,144 @@
+package lru
+
+import (
+	"sync"
+	"time"
+)
+
+// 后台清理：过期的记录只在被读取时惰性删除，从不再读取的过期记录会一直占用内存，直到容量不足才被淘汰。
+// 开启后台清理后，一个goroutine每隔一段时间遍历一遍缓存，删除已过期的记录（以ReasonExpired调用回调）。
+// 遍历分批进行，每批最多检查janitorBatch条记录，批与批之间释放Locker，读写不会被整轮清理阻塞
+
+const janitorBatch = 256
+
+type janitor struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startJanitor 启动清理goroutine，每隔interval调用sweep直到它返回true（遍历完一遍），每次调用都持有locker
+func startJanitor(interval time.Duration, locker sync.Locker, sweep func(n int) bool) *janitor {
+	if locker == nil {
+		panic("lru: StartJanitor requires Locker")
+	}
+	j := &janitor{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+			}
+			for finished := false; !finished; {
+				select {
+				case <-j.stop:
+					return
+				default:
+				}
+				locker.Lock()
+				finished = sweep(janitorBatch)
+				locker.Unlock()
+			}
+		}
+	}()
+	return j
+}
+
+// close 停止清理goroutine并等待它退出
+func (j *janitor) close() {
+	close(j.stop)
+	<-j.done
+}
+
+// StartJanitor 启动后台清理，每隔interval删除一遍已过期的记录，已经启动时什么也不做
+// 必须先设置Locker，缓存的所有其他操作也必须持有同一把锁
+func (c *CacheOf[K, V]) StartJanitor(interval time.Duration) {
+	if c.janitor == nil {
+		c.janitor = startJanitor(interval, c.Locker, c.sweep)
+	}
+}
+
+// StopJanitor 停止后台清理并等待清理goroutine退出，调用时不能持有Locker
+func (c *CacheOf[K, V]) StopJanitor() {
+	if c.janitor != nil {
+		c.janitor.close()
+		c.janitor = nil
+	}
+}
+
+// Close 释放缓存的后台资源，目前即StopJanitor
+func (c *CacheOf[K, V]) Close() error {
+	c.StopJanitor()
+	return nil
+}
+
+// sweep 从上次停下的位置开始检查最多n条记录，删除其中已过期的，遍历完整个缓存后返回true
+func (c *CacheOf[K, V]) sweep(n int) bool {
+	lists := c.lists()
+	li, ele := c.seek(c.sweepCursor)
+	for ; n > 0; n-- {
+		for ele == nil {
+			if li++; li == len(lists) {
+				var zero K
+				c.sweepCursor = zero
+				return true
+			}
+			ele = lists[li].Front()
+		}
+		next := ele.Next()
+		if kv := ele.Value.(*entry[K, V]); c.expired(kv) && kv.pins == 0 {
+			c.removeElement(ele, ReasonExpired)
+		} else {
+			c.sweepCursor = kv.key
+		}
+		ele = next
+	}
+	return false
+}
+
+// StartJanitor 启动后台清理，用法同Cache.StartJanitor
+func (c *ARCOf[V]) StartJanitor(interval time.Duration) {
+	if c.janitor == nil {
+		c.janitor = startJanitor(interval, c.Locker, c.sweep)
+	}
+}
+
+// StopJanitor 停止后台清理，用法同Cache.StopJanitor
+func (c *ARCOf[V]) StopJanitor() {
+	if c.janitor != nil {
+		c.janitor.close()
+		c.janitor = nil
+	}
+}
+
+// Close 释放缓存的后台资源，目前即StopJanitor
+func (c *ARCOf[V]) Close() error {
+	c.StopJanitor()
+	return nil
+}
+
+// sweep 按与Scan相同的顺序检查T2、T1中最多n条记录，删除其中已过期的，遍历完后返回true
+func (c *ARCOf[V]) sweep(n int) bool {
+	order := []int{inT2, inT1}
+	li, ele := c.seek(c.sweepCursor)
+	for ; n > 0; n-- {
+		for ele == nil {
+			if li++; li == len(order) {
+				c.sweepCursor = ""
+				return true
+			}
+			ele = c.lists[order[li]].Front()
+		}
+		next := ele.Next()
+		if e := ele.Value.(*arcEntry[V]); c.expired(e) {
+			c.removeElement(ele, ReasonExpired)
+		} else {
+			c.sweepCursor = e.key
+		}
+		ele = next
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// janitorCache 是Cache和ARC中后台清理测试用到的方法
+type janitorCache interface {
+	Policy
+	StartJanitor(time.Duration)
+	StopJanitor()
+}
+
+func testJanitor(t *testing.T, c janitorCache, mu *sync.Mutex, expired *int) {
+	start := time.Now()
+	mu.Lock()
+	for i := 0; i < 1000; i++ {
+		expire := start.Add(time.Hour)
+		if i%3 == 0 {
+			expire = start.Add(-time.Second)
+		}
+		c.AddWithExpire(fmt.Sprintf("key%04d", i), String("v"), expire)
+	}
+	mu.Unlock()
+
+	c.StartJanitor(time.Millisecond)
+	defer c.StopJanitor()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n, e := c.Len(), *expired
+		mu.Unlock()
+		if n == 666 && e == 334 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor left %d entries, %d expired callbacks", n, e)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := c.Peek("key0001"); !ok {
+		t.Fatal("janitor removed a live entry")
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	var mu sync.Mutex
+	expired := 0
+	onEvicted := func(key string, value Value, reason EvictReason) {
+		if reason != ReasonExpired {
+			t.Errorf("%s evicted for %s", key, reason)
+		}
+		expired++
+	}
+
+	c := New(0, nil)
+	c.Locker = &mu
+	c.OnEvictedWithReason = onEvicted
+	testJanitor(t, c, &mu, &expired)
+
+	expired = 0
+	a := NewARC(0, nil)
+	a.Locker = &mu
+	a.OnEvictedWithReason = onEvicted
+	testJanitor(t, a, &mu, &expired)
+}
+
+func TestJanitorStop(t *testing.T) {
+	var mu sync.Mutex
+	c := New(0, nil)
+	c.Locker = &mu
+	c.StartJanitor(time.Millisecond)
+	c.StopJanitor()
+	c.StopJanitor() // 重复调用没有影响
+
+	mu.Lock()
+	c.AddWithExpire("k", String("v"), time.Now().Add(-time.Second))
+	mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	if c.ll.Len() != 1 {
+		t.Fatal("stopped janitor still removes entries")
+	}
+}
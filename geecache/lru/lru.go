@@ -1,53 +1,356 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"sync"
+	"time"
+)
 
-type Cache struct {
-	maxBytes  int64                         // 允许使用的最大内存
-	nbytes    int64                         // 当前已使用的内存
-	ll        *list.List                    // 双向链表
-	cache     map[string]*list.Element      // 键是字符串，值是双向链表中对应节点的指针
-	OnEvicted func(key string, value Value) // 某条记录被移除时的回调函数，可以为nil
+// CacheOf 是键类型为K、值类型为V的LRU缓存，记录占用的内存由SizeOf计算
+type CacheOf[K comparable, V any] struct {
+	maxBytes  int64                      // 允许使用的最大内存
+	nbytes    int64                      // 当前已使用的内存
+	ll        *list.List                 // 双向链表，分段模式下为试用段
+	cache     map[K]*list.Element        // 值是双向链表中对应节点的指针
+	SizeOf    func(key K, value V) int64 // 计算一条记录的开销，所有记录的开销之和不超过maxBytes
+	OnEvicted func(key K, value V)       // 某条记录被移除时的回调函数，可以为nil
+	Now       func() time.Time           // 获取当前时间，用于判断记录是否过期，为nil时使用time.Now
+	Admission *TinyLFU                   // 准入策略，为nil时接纳所有新记录；Get记录访问频率，缓存满时Add据此决定是否接纳
+	Hash      func(key K) uint64         // 准入策略统计访问频率使用的哈希函数，为nil时准入策略不生效
+
+	// OnEvictedWithReason 与OnEvicted相同，但同时给出移除的原因；两者都设置时都会被调用
+	OnEvictedWithReason func(key K, value V, reason EvictReason)
+
+	// MaxEntries 限制记录的条数，超出时与超出maxBytes一样淘汰最久未使用的记录；0（默认）表示不限制
+	MaxEntries int
+
+	// LowWater 是低水位比例：超出maxBytes时一次淘汰到maxBytes*LowWater以下，之后的若干次Add不需要再淘汰。
+	// 取值在(0,1)之间，如0.9；0（默认）表示每次只淘汰到不超过maxBytes
+	LowWater float64
+
+	// Locker 是保护缓存的锁，后台清理每批操作时持有它，淘汰回调也在持有它时调用，见StartJanitor。
+	// 需要在锁外执行回调时，可以在回调中只记录被淘汰的记录，在Locker的Unlock中再处理
+	Locker      sync.Locker
+	janitor     *janitor
+	sweepCursor K // 后台清理下一批开始的位置
+
+	pinned int // 被Pin住的记录数
+
+	evictions   int64 // 因容量淘汰的累计次数
+	expirations int64 // 因过期删除的累计次数
+	// 分段模式（SLRU）：新记录先进入试用段ll，再次命中才晋升到保护段protected，淘汰时先淘汰试用段
+	// 这样一次性扫描大量key只会冲刷试用段，不会把反复访问的记录挤出缓存。protected为nil表示普通LRU
+	protected      *list.List
+	protectedRatio float64 // 保护段占maxBytes的比例
+	protectedBytes int64   // 保护段当前已使用的内存
 }
 
-type entry struct {
-	key   string
-	value Value
+// Cache 是键为字符串、值实现了Value接口的LRU缓存，记录占用的内存为len(key)+value.Len()
+type Cache = CacheOf[string, Value]
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	protected bool      // 是否位于保护段
+	expire    time.Time // 过期时间，零值表示永不过期
+	added     time.Time // 写入时间
+	pins      int       // 尚未Unpin的Pin次数，大于0时不会被淘汰、清空或者因过期被删除
 }
 
 type Value interface {
 	Len() int
 }
 
+// EvictReason 说明一条记录为什么被移出缓存
+type EvictReason int
+
+const (
+	ReasonCapacity EvictReason = iota // 超出容量被淘汰
+	ReasonRemoved                     // 被Remove显式删除
+	ReasonExpired                     // 已过期，在读取时被清除
+	ReasonCleared                     // 被Clear清空
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case ReasonCapacity:
+		return "capacity"
+	case ReasonRemoved:
+		return "removed"
+	case ReasonExpired:
+		return "expired"
+	case ReasonCleared:
+		return "cleared"
+	}
+	return "unknown"
+}
+
+// EntryOf 是一条键值记录，用于在缓存之外传递记录
+type EntryOf[K comparable, V any] struct {
+	Key    K
+	Value  V
+	Expire time.Time // 过期时间，零值表示永不过期
+}
+
+// Entry 是Cache和ARC使用的记录
+type Entry = EntryOf[string, Value]
+
+// PolicyOf 是值类型为V的各种淘汰策略（CacheOf实现的LRU/SLRU、ARCOf）共同实现的接口，上层通过它在策略之间切换
+type PolicyOf[V any] interface {
+	Get(key string) (value V, ok bool)
+	Peek(key string) (value V, ok bool)
+	Contains(key string) bool
+	Add(key string, value V)
+	AddWithExpire(key string, value V, expire time.Time)
+	Remove(key string)
+	RemoveOldest()
+	Resize(maxBytes int64)
+	Clear()
+	Range(f func(key string, value V) bool)
+	Scan(cursor string, n int) []EntryOf[string, V]
+	Keys() []string
+	Len() int
+	Bytes() int64
+	Stats() Stats
+}
+
+// Policy 是值实现了Value接口的淘汰策略，Cache和ARC都实现了它
+type Policy = PolicyOf[Value]
+
+// Stats 是缓存占用和淘汰情况的快照
+type Stats struct {
+	Len         int       `json:"len"`
+	Bytes       int64     `json:"bytes"`
+	MaxBytes    int64     `json:"max_bytes"`    // 0表示不限制
+	Evictions   int64     `json:"evictions"`    // 因容量淘汰的累计次数
+	Expired     int64     `json:"expired"`      // 因过期删除的累计次数（惰性删除和后台清理）
+	OldestAdded time.Time `json:"oldest_added"` // 下一条将被淘汰的记录的写入时间，缓存为空时为零值
+}
+
+var (
+	_ Policy           = (*Cache)(nil)
+	_ Policy           = (*ARC)(nil)
+	_ PolicyOf[[]byte] = (*CacheOf[string, []byte])(nil)
+	_ PolicyOf[[]byte] = (*ARCOf[[]byte])(nil)
+)
+
 func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
-	return &Cache{
+	return NewWithCost(maxBytes, DefaultCost, onEvicted)
+}
+
+// NewWithCost 创建用cost代替len(key)+value.Len()计量记录开销的LRU，maxBytes成为开销的上限，
+// 例如按从数据源重新获取的代价或者压缩后的大小加权。cost对同一对key、value必须始终返回相同的值
+func NewWithCost(maxBytes int64, cost func(key string, value Value) int64, onEvicted func(string, Value)) *Cache {
+	c := NewOf(maxBytes, cost, onEvicted)
+	c.Hash = HashString
+	return c
+}
+
+// NewSegmented 创建分段LRU，protectedRatio为保护段最多占用maxBytes的比例，如0.8表示试用段20%、保护段80%
+func NewSegmented(maxBytes int64, protectedRatio float64, onEvicted func(string, Value)) *Cache {
+	c := NewSegmentedOf(maxBytes, protectedRatio, DefaultCost, onEvicted)
+	c.Hash = HashString
+	return c
+}
+
+// NewOf 创建键类型为K、值类型为V的LRU缓存，sizeOf计算一条记录占用的内存
+func NewOf[K comparable, V any](maxBytes int64, sizeOf func(K, V) int64, onEvicted func(K, V)) *CacheOf[K, V] {
+	return &CacheOf[K, V]{
 		maxBytes:  maxBytes,
 		ll:        list.New(),
-		cache:     make(map[string]*list.Element),
+		cache:     make(map[K]*list.Element),
+		SizeOf:    sizeOf,
 		OnEvicted: onEvicted,
 	}
 }
 
-func (c *Cache) Get(key string) (value Value, ok bool) {
+// NewSegmentedOf 创建键类型为K、值类型为V的分段LRU，参数含义同NewSegmented和NewOf
+func NewSegmentedOf[K comparable, V any](maxBytes int64, protectedRatio float64, sizeOf func(K, V) int64, onEvicted func(K, V)) *CacheOf[K, V] {
+	c := NewOf(maxBytes, sizeOf, onEvicted)
+	c.protected = list.New()
+	c.protectedRatio = protectedRatio
+	return c
+}
+
+// DefaultCost 是Cache默认的记录开销，即记录占用的字节数
+func DefaultCost(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len())
+}
+
+// Get 返回key对应的值，已过期的记录在这里被惰性删除并视为未命中
+func (c *CacheOf[K, V]) Get(key K) (value V, ok bool) {
+	if c.Admission != nil && c.Hash != nil {
+		c.Admission.record(c.Hash(key))
+	}
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
+		kv := ele.Value.(*entry[K, V])
+		if c.expired(kv) {
+			if kv.pins == 0 {
+				c.removeElement(ele, ReasonExpired)
+			}
+			return value, false
+		}
+		if c.protected != nil && !kv.protected {
+			// 试用段的记录第二次被访问，晋升到保护段
+			c.ll.Remove(ele)
+			kv.protected = true
+			c.cache[key] = c.protected.PushFront(kv)
+			c.protectedBytes += c.size(kv)
+			c.demoteOverflow()
+		} else {
+			c.listOf(kv).MoveToFront(ele)
+		}
 		return kv.value, true
 	}
 	return
 }
 
-func (c *Cache) RemoveOldest() {
-	ele := c.ll.Back() // 渠道队首节点，从链表中删除
-	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key) // 从字典中删除
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+// Peek 返回key对应的值，但不移动记录、不晋升、不记录访问频率；已过期的记录视为不存在但不删除
+func (c *CacheOf[K, V]) Peek(key K) (value V, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		if kv := ele.Value.(*entry[K, V]); !c.expired(kv) {
+			return kv.value, true
 		}
 	}
+	return
+}
+
+// Contains 判断缓存中是否有未过期的key，只查字典，不移动记录也不读取值
+func (c *CacheOf[K, V]) Contains(key K) bool {
+	ele, ok := c.cache[key]
+	return ok && !c.expired(ele.Value.(*entry[K, V]))
+}
+
+// RemoveOldest 淘汰最久未使用的记录，跳过被Pin住的记录
+func (c *CacheOf[K, V]) RemoveOldest() {
+	c.removeOldest()
+}
+
+// removeOldest 淘汰一条记录，所有记录都被Pin住时返回false
+func (c *CacheOf[K, V]) removeOldest() bool {
+	ele := c.oldest()
+	if ele == nil {
+		return false
+	}
+	c.removeElement(ele, ReasonCapacity) // 取到队首节点，从链表中删除
+	return true
+}
+
+// Pin 让key对应的记录在Unpin之前不会被淘汰、被Clear清空或者因过期被删除，但仍然计入已使用的内存，
+// 例如在把一个很大的值写出到网络的过程中保持它不变。可以多次Pin，需要相同次数的Unpin；记录不存在时返回false
+// Remove仍然会删除被Pin住的记录
+func (c *CacheOf[K, V]) Pin(key K) bool {
+	ele, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	kv := ele.Value.(*entry[K, V])
+	if kv.pins == 0 {
+		c.pinned++
+	}
+	kv.pins++
+	return true
+}
+
+// Unpin 撤销一次Pin，记录不存在或者没有被Pin住时什么也不做
+func (c *CacheOf[K, V]) Unpin(key K) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry[K, V])
+		if kv.pins == 0 {
+			return
+		}
+		if kv.pins--; kv.pins == 0 {
+			c.pinned--
+		}
+	}
+}
+
+// GetOldest 返回下一条将被淘汰的记录，不删除也不移动它；缓存为空时ok为false
+func (c *CacheOf[K, V]) GetOldest() (key K, value V, ok bool) {
+	if ele := c.oldest(); ele != nil {
+		kv := ele.Value.(*entry[K, V])
+		return kv.key, kv.value, true
+	}
+	return
+}
+
+// OldestAge 返回下一条将被淘汰的记录距写入（或最近一次更新）已经过去的时间；缓存为空时ok为false
+func (c *CacheOf[K, V]) OldestAge() (age time.Duration, ok bool) {
+	if ele := c.oldest(); ele != nil {
+		return c.now().Sub(ele.Value.(*entry[K, V]).added), true
+	}
+	return
+}
+
+// oldest 返回下一条将被淘汰的记录，即最靠近队首且没有被Pin住的节点，分段模式下先找试用段再找保护段
+func (c *CacheOf[K, V]) oldest() *list.Element {
+	lists := c.lists()
+	for i := len(lists) - 1; i >= 0; i-- {
+		for ele := lists[i].Back(); ele != nil; ele = ele.Prev() {
+			if c.pinned == 0 || ele.Value.(*entry[K, V]).pins == 0 {
+				return ele
+			}
+		}
+	}
+	return nil
+}
+
+// Remove 删除指定的记录，记录不存在时什么也不做
+func (c *CacheOf[K, V]) Remove(key K) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, ReasonRemoved)
+	}
+}
+
+func (c *CacheOf[K, V]) removeElement(ele *list.Element, reason EvictReason) {
+	kv := ele.Value.(*entry[K, V])
+	c.listOf(kv).Remove(ele)
+	delete(c.cache, kv.key) // 从字典中删除
+	size := c.size(kv)
+	c.nbytes -= size
+	if kv.protected {
+		c.protectedBytes -= size
+	}
+	if kv.pins > 0 {
+		c.pinned--
+	}
+	c.count(reason)
+	c.evicted(kv.key, kv.value, reason)
+}
+
+// count 按移除的原因累计淘汰次数
+func (c *CacheOf[K, V]) count(reason EvictReason) {
+	switch reason {
+	case ReasonCapacity:
+		c.evictions++
+	case ReasonExpired:
+		c.expirations++
+	}
+}
+
+// Stats 返回缓存占用和淘汰情况的快照
+func (c *CacheOf[K, V]) Stats() Stats {
+	s := Stats{
+		Len:       c.Len(),
+		Bytes:     c.nbytes,
+		MaxBytes:  c.maxBytes,
+		Evictions: c.evictions,
+		Expired:   c.expirations,
+	}
+	if ele := c.oldest(); ele != nil {
+		s.OldestAdded = ele.Value.(*entry[K, V]).added
+	}
+	return s
+}
+
+// evicted 调用移除记录的回调函数，调用前记录已经从缓存中完全删除，回调panic不会破坏nbytes和链表
+func (c *CacheOf[K, V]) evicted(key K, value V, reason EvictReason) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	if c.OnEvictedWithReason != nil {
+		c.OnEvictedWithReason(key, value, reason)
+	}
 }
 
 /*
@@ -55,23 +358,265 @@ func (c *Cache) RemoveOldest() {
 		因此访问元素要移动到front，淘汰元素直接删除back
 */
 
-func (c *Cache) Add(key string, value Value) {
+func (c *CacheOf[K, V]) Add(key K, value V) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加一条在expire时刻过期的记录，expire为零值表示永不过期
+func (c *CacheOf[K, V]) AddWithExpire(key K, value V, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
-		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
-		kv.value = value
+		kv := ele.Value.(*entry[K, V])
+		c.listOf(kv).MoveToFront(ele)
+		c.update(kv, value, expire, c.now())
+		c.demoteOverflow()
 	} else {
+		if !c.admit(key, value) {
+			return
+		}
 		// 如果不存在，就创建一个新节点，添加到队尾
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry[K, V]{key: key, value: value, expire: expire, added: c.now()})
 		c.cache[key] = ele
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		c.nbytes += c.SizeOf(key, value)
+	}
+	c.removeOverflow()
+}
+
+// update 替换已有记录的值，并更新占用的内存
+func (c *CacheOf[K, V]) update(kv *entry[K, V], value V, expire, now time.Time) {
+	delta := c.SizeOf(kv.key, value) - c.size(kv)
+	c.nbytes += delta
+	if kv.protected {
+		c.protectedBytes += delta
+	}
+	kv.value, kv.expire, kv.added = value, expire, now
+}
+
+// admit 判断是否接纳新记录：未开启准入策略或者还有空间时总是接纳，否则与将被淘汰的记录比较访问频率
+func (c *CacheOf[K, V]) admit(key K, value V) bool {
+	if c.Admission == nil || c.Hash == nil || c.maxBytes == 0 || c.nbytes+c.SizeOf(key, value) <= c.maxBytes {
+		return true
+	}
+	victim := c.oldest()
+	return victim == nil || c.Admission.admit(c.Hash(key), c.Hash(victim.Value.(*entry[K, V]).key))
+}
+
+// AddAll 批量写入记录，用于预加载快照等场景：所有记录写入后才统一淘汰一次
+// 批量中重复的key以最后一条为准；批量总大小超过maxBytes时，先全部写入再从队头淘汰，
+// 因此保留下来的是批量中靠后的记录。批量写入不经过准入策略
+func (c *CacheOf[K, V]) AddAll(entries []EntryOf[K, V]) {
+	now := c.now()
+	for _, e := range entries {
+		if ele, ok := c.cache[e.Key]; ok {
+			kv := ele.Value.(*entry[K, V])
+			c.listOf(kv).MoveToFront(ele)
+			c.update(kv, e.Value, e.Expire, now)
+			continue
+		}
+		c.cache[e.Key] = c.ll.PushFront(&entry[K, V]{key: e.Key, value: e.Value, expire: e.Expire, added: now})
+		c.nbytes += c.SizeOf(e.Key, e.Value)
+	}
+	c.demoteOverflow()
+	c.removeOverflow()
+}
+
+// Resize 修改允许使用的最大内存，缩小时立即从队头淘汰，直到已使用内存不超过新的上限
+// 新上限比单条记录还小时，会把缓存淘汰空为止；maxBytes为0表示不限制
+func (c *CacheOf[K, V]) Resize(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.demoteOverflow()
+	c.removeOverflow()
+}
+
+func (c *CacheOf[K, V]) removeOverflow() {
+	for c.MaxEntries > 0 && len(c.cache) > c.MaxEntries {
+		if !c.removeOldest() {
+			break
+		}
+	}
+	if c.maxBytes == 0 || c.nbytes <= c.maxBytes {
+		return
+	}
+	target := lowWaterMark(c.maxBytes, c.LowWater)
+	for c.nbytes > target {
+		if !c.removeOldest() {
+			break // 剩下的记录都被Pin住了，暂时超出上限
+		}
+	}
+}
+
+// Bytes 返回当前已使用的内存
+func (c *CacheOf[K, V]) Bytes() int64 {
+	return c.nbytes
+}
+
+// lowWaterMark 返回超出maxBytes后需要淘汰到的内存用量
+func lowWaterMark(maxBytes int64, ratio float64) int64 {
+	if ratio <= 0 || ratio >= 1 {
+		return maxBytes
+	}
+	return int64(float64(maxBytes) * ratio)
+}
+
+// demoteOverflow 保护段超出上限时，把保护段最久未使用的记录降级到试用段的队尾
+func (c *CacheOf[K, V]) demoteOverflow() {
+	if c.protected == nil || c.maxBytes == 0 {
+		return
 	}
-	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-		c.RemoveOldest()
+	limit := int64(float64(c.maxBytes) * c.protectedRatio)
+	for c.protectedBytes > limit && c.protected.Len() > 0 {
+		ele := c.protected.Back()
+		kv := ele.Value.(*entry[K, V])
+		c.protected.Remove(ele)
+		kv.protected = false
+		c.protectedBytes -= c.size(kv)
+		c.cache[kv.key] = c.ll.PushFront(kv)
 	}
 }
 
-func (c *Cache) Len() int {
+// Clear 清空缓存，按淘汰顺序（从队头到队尾）对每条记录调用OnEvicted；被Pin住的记录保留
+func (c *CacheOf[K, V]) Clear() {
+	if c.pinned > 0 {
+		c.clearUnpinned()
+		return
+	}
+	// 先清空再调用回调，回调panic时缓存也已经处于一致的状态
+	lists := c.lists()
+	c.ll = list.New()
+	if c.protected != nil {
+		c.protected = list.New()
+	}
+	c.cache = make(map[K]*list.Element)
+	c.nbytes = 0
+	c.protectedBytes = 0
+	if c.OnEvicted != nil || c.OnEvictedWithReason != nil {
+		for i := len(lists) - 1; i >= 0; i-- {
+			for ele := lists[i].Back(); ele != nil; ele = ele.Prev() {
+				kv := ele.Value.(*entry[K, V])
+				c.evicted(kv.key, kv.value, ReasonCleared)
+			}
+		}
+	}
+}
+
+// clearUnpinned 逐条删除没有被Pin住的记录，顺序与Clear相同
+func (c *CacheOf[K, V]) clearUnpinned() {
+	lists := c.lists()
+	for i := len(lists) - 1; i >= 0; i-- {
+		for ele := lists[i].Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry[K, V]).pins == 0 {
+				c.removeElement(ele, ReasonCleared)
+			}
+			ele = prev
+		}
+	}
+}
+
+// Range 按从最近使用到最久未使用的顺序遍历未过期的记录（分段模式下先遍历保护段再遍历试用段，即与淘汰顺序相反），
+// f返回false时提前结束，遍历不会改变记录的新旧顺序
+// 遍历的是调用时的快照，f中增删记录不影响本次遍历的内容
+func (c *CacheOf[K, V]) Range(f func(key K, value V) bool) {
+	entries := make([]entry[K, V], 0, c.Len())
+	for _, l := range c.lists() {
+		for ele := l.Front(); ele != nil; ele = ele.Next() {
+			if kv := ele.Value.(*entry[K, V]); !c.expired(kv) {
+				entries = append(entries, *kv)
+			}
+		}
+	}
+	for _, kv := range entries {
+		if !f(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// Scan 按与Range相同的顺序返回key为cursor的记录之后最多n条未过期的记录，不改变记录的新旧顺序
+// cursor为零值（如空字符串）或者已经不在缓存中时从头开始。以返回的最后一个key作为下一次的cursor，可以分多次遍历整个缓存，
+// 两次调用之间可以释放锁；期间被访问而移动位置的记录可能被重复返回或者跳过
+func (c *CacheOf[K, V]) Scan(cursor K, n int) []EntryOf[K, V] {
+	lists := c.lists()
+	li, ele := c.seek(cursor)
+	entries := make([]EntryOf[K, V], 0, n)
+	for len(entries) < n {
+		for ele == nil {
+			if li++; li == len(lists) {
+				return entries
+			}
+			ele = lists[li].Front()
+		}
+		if kv := ele.Value.(*entry[K, V]); !c.expired(kv) {
+			entries = append(entries, EntryOf[K, V]{kv.key, kv.value, kv.expire})
+		}
+		ele = ele.Next()
+	}
+	return entries
+}
+
+// seek 返回cursor之后的第一条记录及其所在链表在lists()中的下标，cursor为零值或不在缓存中时从头开始
+func (c *CacheOf[K, V]) seek(cursor K) (int, *list.Element) {
+	var zero K
+	lists := c.lists()
+	cur, ok := c.cache[cursor]
+	if !ok || cursor == zero {
+		return 0, lists[0].Front()
+	}
+	li := 0
+	for lists[li] != c.listOf(cur.Value.(*entry[K, V])) {
+		li++
+	}
+	return li, cur.Next()
+}
+
+// Keys 按与Range相同的顺序返回所有未过期的键
+func (c *CacheOf[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	for _, l := range c.lists() {
+		for ele := l.Front(); ele != nil; ele = ele.Next() {
+			if kv := ele.Value.(*entry[K, V]); !c.expired(kv) {
+				keys = append(keys, kv.key)
+			}
+		}
+	}
+	return keys
+}
+
+func (c *CacheOf[K, V]) Len() int {
+	if c.protected != nil {
+		return c.ll.Len() + c.protected.Len()
+	}
 	return c.ll.Len()
 }
+
+// lists 返回从最近使用到最久未使用排列的链表
+func (c *CacheOf[K, V]) lists() []*list.List {
+	if c.protected != nil {
+		return []*list.List{c.protected, c.ll}
+	}
+	return []*list.List{c.ll}
+}
+
+// listOf 返回记录所在的链表
+func (c *CacheOf[K, V]) listOf(kv *entry[K, V]) *list.List {
+	if kv.protected {
+		return c.protected
+	}
+	return c.ll
+}
+
+func (c *CacheOf[K, V]) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// expired 判断记录是否已经过期
+func (c *CacheOf[K, V]) expired(kv *entry[K, V]) bool {
+	return !kv.expire.IsZero() && !c.now().Before(kv.expire)
+}
+
+// size 返回记录占用的内存
+func (c *CacheOf[K, V]) size(kv *entry[K, V]) int64 {
+	return c.SizeOf(kv.key, kv.value)
+}
@@ -1,8 +1,11 @@
 package lru
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 type String string
@@ -62,3 +65,614 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nbytes)
 	}
 }
+
+func TestResize(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+	lru := New(int64(0), callback)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+
+	lru.Resize(100)
+	if len(keys) != 0 || lru.Len() != 3 {
+		t.Fatalf("growing should not evict, evicted %v", keys)
+	}
+
+	lru.Resize(8)
+	if expect := []string{"k1"}; !reflect.DeepEqual(expect, keys) || lru.Len() != 2 {
+		t.Fatalf("shrink evicted %v, expect %v", keys, expect)
+	}
+
+	lru.Resize(100)
+	lru.Add("big", String("0123456789"))
+	lru.Resize(3)
+	if lru.Len() != 0 || lru.nbytes != 0 {
+		t.Fatalf("shrink below largest entry left %d entries, %d bytes", lru.Len(), lru.nbytes)
+	}
+}
+
+func TestClear(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+	lru := New(int64(0), callback)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Clear()
+
+	if expect := []string{"k1", "k2"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Clear evicted %v, expect %v", keys, expect)
+	}
+	if lru.Len() != 0 || lru.nbytes != 0 {
+		t.Fatalf("Clear left %d entries, %d bytes", lru.Len(), lru.nbytes)
+	}
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatal("k1 should be gone after Clear")
+	}
+	lru.Add("k3", String("v3"))
+	if lru.Len() != 1 {
+		t.Fatal("cache should be usable after Clear")
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	lru.Get("k1")
+
+	var got []string
+	lru.Range(func(key string, value Value) bool {
+		got = append(got, key+"="+string(value.(String)))
+		// 遍历过程中增删记录不影响本次遍历
+		if key == "k1" {
+			lru.Add("k4", String("v4"))
+			lru.RemoveOldest()
+		}
+		return true
+	})
+	if expect := []string{"k1=v1", "k3=v3", "k2=v2"}; !reflect.DeepEqual(expect, got) {
+		t.Fatalf("Range visited %v, expect %v", got, expect)
+	}
+
+	got = got[:0]
+	lru.Range(func(key string, value Value) bool {
+		got = append(got, key)
+		return len(got) < 2
+	})
+	if expect := []string{"k4", "k1"}; !reflect.DeepEqual(expect, got) {
+		t.Fatalf("Range should stop early, visited %v", got)
+	}
+
+	// Range 不改变新旧顺序
+	if expect := []string{"k4", "k1", "k3"}; !reflect.DeepEqual(expect, lru.Keys()) {
+		t.Fatalf("Keys() = %v, expect %v", lru.Keys(), expect)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	keys := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Remove("k1")
+	lru.Remove("missing")
+
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 1 || lru.nbytes != 4 {
+		t.Fatalf("Remove k1 failed: len=%d nbytes=%d", lru.Len(), lru.nbytes)
+	}
+	if expect := []string{"k1"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("OnEvicted called with %v, expect %v", keys, expect)
+	}
+}
+
+func TestSegmentedScanResistance(t *testing.T) {
+	// 每条记录4字节，容量10条，保护段最多8条
+	lru := NewSegmented(int64(40), 0.8, nil)
+	hot := []string{"h1", "h2", "h3"}
+	for _, k := range hot {
+		lru.Add(k, String("vv"))
+		lru.Get(k) // 第二次访问，晋升到保护段
+	}
+	for i := 0; i < 100; i++ {
+		lru.Add(fmt.Sprintf("s%d", i%100), String("v"))
+	}
+	for _, k := range hot {
+		if _, ok := lru.Get(k); !ok {
+			t.Fatalf("hot key %s evicted by scan", k)
+		}
+	}
+	if lru.nbytes > 40 {
+		t.Fatalf("nbytes %d exceeds maxBytes", lru.nbytes)
+	}
+
+	// 普通LRU下同样的扫描会把热点记录全部淘汰
+	plain := New(int64(40), nil)
+	for _, k := range hot {
+		plain.Add(k, String("vv"))
+		plain.Get(k)
+	}
+	for i := 0; i < 100; i++ {
+		plain.Add(fmt.Sprintf("s%d", i), String("v"))
+	}
+	if _, ok := plain.Get("h1"); ok {
+		t.Fatal("plain LRU unexpectedly kept h1")
+	}
+}
+
+func TestSegmentedAccounting(t *testing.T) {
+	keys := make([]string, 0)
+	lru := NewSegmented(int64(24), 0.5, func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lru.Add("p1", String("vv")) // 每条记录4字节
+	lru.Add("p2", String("vv"))
+	lru.Add("p3", String("vv"))
+	lru.Add("p4", String("vv"))
+	lru.Get("p1")
+	lru.Get("p2")
+	lru.Get("p3")
+	lru.Get("p4") // 保护段上限12字节，p1被降级回试用段
+
+	if lru.protectedBytes != 12 || lru.nbytes != 16 {
+		t.Fatalf("protectedBytes=%d nbytes=%d", lru.protectedBytes, lru.nbytes)
+	}
+	if expect := []string{"p4", "p3", "p2", "p1"}; !reflect.DeepEqual(expect, lru.Keys()) {
+		t.Fatalf("Keys() = %v, expect %v", lru.Keys(), expect)
+	}
+
+	lru.Add("n1", String("vv"))
+	lru.Add("n2", String("vv"))
+	lru.Add("n3", String("vv")) // 超出24字节，先淘汰试用段最旧的p1
+	if expect := []string{"p1"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("evicted %v, expect %v", keys, expect)
+	}
+
+	lru.Add("p4", String("vvvv")) // 更新保护段中的记录，保护段超限，降级p2，总量超限，淘汰n1
+	lru.Remove("p3")
+	if lru.nbytes != 18 || lru.protectedBytes != 6 {
+		t.Fatalf("after update/remove nbytes=%d protectedBytes=%d", lru.nbytes, lru.protectedBytes)
+	}
+
+	lru.Clear()
+	if expect := []string{"p1", "n1", "p3", "n2", "n3", "p2", "p4"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Clear evicted %v, expect %v", keys, expect)
+	}
+	if lru.nbytes != 0 || lru.protectedBytes != 0 || lru.Len() != 0 {
+		t.Fatal("Clear left data behind")
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, c := range []Policy{New(0, nil), NewSegmented(100, 0.5, nil), NewARC(0, nil)} {
+		for i := 0; i < 10; i++ {
+			c.Add(fmt.Sprintf("k%d", i), String("v"))
+		}
+		c.Get("k3")
+		c.Get("k7")
+
+		var got []string
+		cursor := ""
+		for {
+			entries := c.Scan(cursor, 3)
+			for _, e := range entries {
+				got = append(got, e.Key)
+			}
+			if len(entries) < 3 {
+				break
+			}
+			cursor = entries[len(entries)-1].Key
+		}
+		if !reflect.DeepEqual(got, c.Keys()) {
+			t.Fatalf("%T: chunked Scan visited %v, Keys() = %v", c, got, c.Keys())
+		}
+
+		// 游标已不在缓存中时从头开始
+		c.Remove(got[2])
+		if entries := c.Scan(got[2], 2); entries[0].Key != got[0] {
+			t.Fatalf("%T: Scan with stale cursor started at %s", c, entries[0].Key)
+		}
+	}
+}
+
+func TestGetOldest(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lru := New(int64(0), nil)
+	lru.Now = func() time.Time { return now }
+	if _, _, ok := lru.GetOldest(); ok {
+		t.Fatal("GetOldest on empty cache should return ok=false")
+	}
+	if _, ok := lru.OldestAge(); ok {
+		t.Fatal("OldestAge on empty cache should return ok=false")
+	}
+
+	lru.Add("k1", String("v1"))
+	now = now.Add(time.Second)
+	lru.Add("k2", String("v2"))
+	now = now.Add(time.Second)
+	if k, v, ok := lru.GetOldest(); !ok || k != "k1" || string(v.(String)) != "v1" {
+		t.Fatalf("GetOldest = %s, %v, %v", k, v, ok)
+	}
+	if age, _ := lru.OldestAge(); age != 2*time.Second {
+		t.Fatalf("OldestAge = %v, want 2s", age)
+	}
+
+	// GetOldest 不移动记录，连续调用结果相同
+	lru.GetOldest()
+	if k, _, _ := lru.GetOldest(); k != "k1" {
+		t.Fatalf("GetOldest promoted the entry, now %s", k)
+	}
+	// Get 把k1移到队尾，k2成为下一个被淘汰的记录
+	lru.Get("k1")
+	if k, _, _ := lru.GetOldest(); k != "k2" {
+		t.Fatalf("after Get(k1) oldest = %s, want k2", k)
+	}
+	if age, _ := lru.OldestAge(); age != time.Second {
+		t.Fatalf("OldestAge = %v, want 1s", age)
+	}
+	lru.RemoveOldest()
+	if k, _, _ := lru.GetOldest(); k != "k1" {
+		t.Fatalf("after RemoveOldest oldest = %s, want k1", k)
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	var evicted []string
+	lru := New(int64(0), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lru.Add("k1", String("old"))
+	lru.AddAll([]Entry{
+		{Key: "k1", Value: String("v1")},
+		{Key: "k2", Value: String("x")},
+		{Key: "k2", Value: String("v2")}, // 重复的key以最后一条为准
+		{Key: "k3", Value: String("v3")},
+	})
+	if v, ok := lru.Get("k2"); !ok || string(v.(String)) != "v2" {
+		t.Fatalf("duplicate key: Get(k2) = %v, %v", v, ok)
+	}
+	if lru.Len() != 3 || lru.nbytes != 12 {
+		t.Fatalf("Len = %d, nbytes = %d", lru.Len(), lru.nbytes)
+	}
+
+	// 批量总大小超过上限：全部写入后从队头淘汰，保留批量中靠后的记录
+	small := New(int64(8), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	evicted = nil
+	small.AddAll([]Entry{
+		{Key: "a", Value: String("111")},
+		{Key: "b", Value: String("222")},
+		{Key: "c", Value: String("333")},
+	})
+	if expect := []string{"c", "b"}; !reflect.DeepEqual(small.Keys(), expect) {
+		t.Fatalf("Keys = %v, expect %v", small.Keys(), expect)
+	}
+	if expect := []string{"a"}; !reflect.DeepEqual(evicted, expect) || small.nbytes != 8 {
+		t.Fatalf("evicted %v, nbytes %d", evicted, small.nbytes)
+	}
+}
+
+func TestEvictReason(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []Policy{New(10, nil), NewARC(10, nil)} {
+		var got []string
+		record := func(key string, value Value, reason EvictReason) {
+			got = append(got, key+":"+reason.String())
+		}
+		var plain []string
+		switch c := c.(type) {
+		case *Cache:
+			c.Now = func() time.Time { return now }
+			c.OnEvictedWithReason = record
+			c.OnEvicted = func(key string, value Value) { plain = append(plain, key) }
+		case *ARC:
+			c.Now = func() time.Time { return now }
+			c.OnEvictedWithReason = record
+			c.OnEvicted = func(key string, value Value) { plain = append(plain, key) }
+		}
+
+		c.Add("k1", String("v1"))
+		c.AddWithExpire("k2", String("v2"), now.Add(time.Second))
+		c.Add("k3", String("v3")) // 超出容量，淘汰k1
+		c.Remove("k3")
+		now = now.Add(time.Second)
+		c.Get("k2") // 已过期
+		c.Add("k4", String("v4"))
+		c.Clear()
+
+		expect := []string{"k1:capacity", "k3:removed", "k2:expired", "k4:cleared"}
+		if !reflect.DeepEqual(got, expect) {
+			t.Fatalf("%T: reasons %v, expect %v", c, got, expect)
+		}
+		// 旧的OnEvicted仍然被调用
+		if !reflect.DeepEqual(plain, []string{"k1", "k3", "k2", "k4"}) {
+			t.Fatalf("%T: OnEvicted saw %v", c, plain)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []Policy{New(0, nil), NewSegmented(100, 0.5, nil), NewARC(0, nil)} {
+		switch c := c.(type) {
+		case *Cache:
+			c.Now = func() time.Time { return now }
+		case *ARC:
+			c.Now = func() time.Time { return now }
+		}
+		c.Add("k1", String("v1"))
+		c.Add("k2", String("v2"))
+		c.AddWithExpire("k3", String("v3"), now.Add(time.Second))
+		before := c.Keys()
+
+		if !c.Contains("k1") || c.Contains("missing") {
+			t.Fatalf("%T: Contains reported wrong membership", c)
+		}
+		if v, ok := c.Peek("k1"); !ok || string(v.(String)) != "v1" {
+			t.Fatalf("%T: Peek(k1) = %v, %v", c, v, ok)
+		}
+		// Contains 和 Peek 都不改变新旧顺序
+		if after := c.Keys(); !reflect.DeepEqual(before, after) {
+			t.Fatalf("%T: order changed from %v to %v", c, before, after)
+		}
+
+		now = now.Add(time.Second)
+		if c.Contains("k3") {
+			t.Fatalf("%T: expired key reported as present", c)
+		}
+		if _, ok := c.Peek("k3"); ok {
+			t.Fatalf("%T: Peek returned expired key", c)
+		}
+	}
+}
+
+func TestCacheOf(t *testing.T) {
+	var evicted []int
+	c := NewOf(20, func(key int, value []byte) int64 {
+		return 8 + int64(len(value))
+	}, func(key int, value []byte) {
+		evicted = append(evicted, key)
+	})
+	c.Add(1, []byte("a"))
+	c.Add(2, []byte("b"))
+	if v, ok := c.Get(1); !ok || string(v) != "a" {
+		t.Fatalf("Get(1) = %q, %v", v, ok)
+	}
+	c.Add(3, []byte("c")) // 每条9字节，淘汰最久未使用的2
+	if v, ok := c.Get(2); ok || v != nil {
+		t.Fatalf("Get(2) = %q, %v, expect zero value", v, ok)
+	}
+	if c.Len() != 2 || !reflect.DeepEqual(evicted, []int{2}) {
+		t.Fatalf("len=%d evicted=%v, expect key 2 evicted", c.Len(), evicted)
+	}
+	c.Remove(1)
+	c.Remove(3)
+	if c.Len() != 0 || c.nbytes != 0 {
+		t.Fatalf("len=%d nbytes=%d after Remove", c.Len(), c.nbytes)
+	}
+}
+
+func TestLowWater(t *testing.T) {
+	evicted := 0
+	c := New(100, func(string, Value) { evicted++ })
+	c.LowWater = 0.5
+	for i := 0; i < 10; i++ {
+		c.Add(fmt.Sprintf("k%d", i), String("123456")) // 每条8字节
+	}
+	c.Add("k10", String("123456"))
+	c.Add("k11", String("123456")) // 98字节，尚未超出
+	if evicted != 0 {
+		t.Fatalf("evicted %d entries below the high watermark", evicted)
+	}
+	c.Add("k12", String("123456")) // 107字节，一次淘汰到50以下
+	if evicted != 8 || c.nbytes != 43 {
+		t.Fatalf("evicted=%d nbytes=%d, expect 8 and 43", evicted, c.nbytes)
+	}
+	c.Add("k13", String("123456"))
+	if evicted != 8 {
+		t.Fatalf("evicted again right after reaching the low watermark: %d", evicted)
+	}
+}
+
+// benchmarkAddAtCapacity 在缓存已满时持续写入新key，报告单次Add耗时的p99和最大值
+func benchmarkAddAtCapacity(b *testing.B, lowWater float64) {
+	c := New(1<<20, func(string, Value) {})
+	c.LowWater = lowWater
+	keys := make([]string, b.N+1<<15)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%08d", i)
+	}
+	for _, k := range keys[:1<<15] {
+		c.Add(k, String("0123456789012345678901234567890123456789"))
+	}
+	durations := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		c.Add(keys[1<<15+i], String("0123456789012345678901234567890123456789"))
+		durations[i] = time.Since(start)
+	}
+	b.StopTimer()
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	b.ReportMetric(float64(durations[len(durations)*99/100]), "p99-ns")
+	b.ReportMetric(float64(durations[len(durations)-1]), "max-ns")
+}
+
+func BenchmarkAddAtCapacity(b *testing.B) {
+	b.Run("evict-one", func(b *testing.B) { benchmarkAddAtCapacity(b, 0) })
+	b.Run("low-water-0.9", func(b *testing.B) { benchmarkAddAtCapacity(b, 0.9) })
+}
+
+func TestCostFunc(t *testing.T) {
+	// 值越"贵"（以x开头）开销越大，长度相同的值开销可以不同
+	cost := func(key string, value Value) int64 {
+		if s := value.(String); len(s) > 0 && s[0] == 'x' {
+			return 10
+		}
+		return 1
+	}
+	c := NewWithCost(12, cost, nil)
+	c.Add("a", String("xv"))
+	c.Add("b", String("cv"))
+	if c.nbytes != 11 {
+		t.Fatalf("nbytes = %d, expect 11", c.nbytes)
+	}
+	c.Add("b", String("xv")) // 更新时按新值重新计算开销，超出上限淘汰a
+	if _, ok := c.Get("a"); ok || c.nbytes != 10 {
+		t.Fatalf("nbytes = %d after update, expect a evicted and 10 left", c.nbytes)
+	}
+	c.Add("b", String("cv"))
+	c.Add("c", String("cv"))
+	if c.nbytes != 2 {
+		t.Fatalf("nbytes = %d, expect 2", c.nbytes)
+	}
+	c.Remove("b")
+	c.RemoveOldest()
+	if c.nbytes != 0 || c.Len() != 0 {
+		t.Fatalf("nbytes = %d, len = %d after removing everything", c.nbytes, c.Len())
+	}
+}
+
+func TestPin(t *testing.T) {
+	var evicted []string
+	c := New(12, func(key string, value Value) { evicted = append(evicted, key) })
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Add("k3", String("v3"))
+	if !c.Pin("k1") || c.Pin("missing") {
+		t.Fatal("Pin reported the wrong result")
+	}
+	c.Add("k4", String("v4")) // k1被Pin住，淘汰k2
+	if _, ok := c.Get("k1"); !ok || !reflect.DeepEqual(evicted, []string{"k2"}) {
+		t.Fatalf("evicted %v, expect k2 skipped over pinned k1", evicted)
+	}
+
+	// 所有记录都被Pin住时停止淘汰：新记录自己被淘汰，缩小上限后暂时超出上限
+	c.Pin("k3")
+	c.Pin("k4")
+	c.Add("k5", String("v5"))
+	c.Resize(8)
+	if c.nbytes != 12 || !reflect.DeepEqual(evicted, []string{"k2", "k5"}) {
+		t.Fatalf("nbytes=%d evicted=%v", c.nbytes, evicted)
+	}
+
+	// Clear保留被Pin住的记录，Unpin之后可以正常淘汰
+	c.Unpin("k3")
+	c.Clear()
+	if c.Len() != 2 || c.Contains("k3") {
+		t.Fatalf("Clear left %v", c.Keys())
+	}
+	c.Unpin("k1")
+	c.Unpin("k4")
+	c.Add("k6", String("v6"))
+	if c.nbytes != 8 || c.pinned != 0 {
+		t.Fatalf("nbytes=%d pinned=%d after unpinning", c.nbytes, c.pinned)
+	}
+}
+
+func TestStats(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	c := New(12, nil)
+	c.Now = clock
+	a := NewARC(12, nil)
+	a.Now = clock
+	for _, p := range []Policy{c, a} {
+		if s := p.Stats(); s != (Stats{MaxBytes: 12}) {
+			t.Fatalf("empty stats = %+v", s)
+		}
+	}
+	start := now
+	for _, p := range []Policy{c, a} {
+		p.Add("k1", String("v1"))
+	}
+	now = now.Add(time.Second)
+	for _, p := range []Policy{c, a} {
+		p.Add("k2", String("v2"))
+		p.AddWithExpire("k3", String("v3"), now)
+		p.Get("k3") // 已过期，惰性删除
+		p.Add("k4", String("v4"))
+		p.Add("k5", String("v5")) // 超出上限
+	}
+
+	s := c.Stats()
+	if s.Len != 3 || s.Bytes != 12 || s.Evictions != 1 || s.Expired != 1 || !s.OldestAdded.Equal(now) {
+		t.Fatalf("lru stats = %+v", s)
+	}
+	// ARC中幽灵记录的key也占用预算，淘汰次数与LRU不同
+	s = a.Stats()
+	if s.Evictions == 0 || s.Expired != 1 || !s.OldestAdded.After(start) {
+		t.Fatalf("arc stats = %+v", s)
+	}
+}
+
+func TestEvictedPanic(t *testing.T) {
+	// 回调panic后缓存仍然一致：nbytes等于剩余记录的大小，之后的操作正常
+	check := func(name string, c interface {
+		Len() int
+		Bytes() int64
+		Range(func(string, Value) bool)
+	}) {
+		var n int64
+		c.Range(func(key string, value Value) bool {
+			n += int64(len(key) + value.Len())
+			return true
+		})
+		if n != c.Bytes() {
+			t.Fatalf("%s: Bytes() = %d, entries sum to %d", name, c.Bytes(), n)
+		}
+	}
+	mustPanic := func(f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic from OnEvicted")
+			}
+		}()
+		f()
+	}
+	onEvicted := func(key string, value Value) { panic(key) }
+
+	l := New(int64(10), onEvicted)
+	l.Add("k1", String("v1"))
+	l.Add("k2", String("v2"))
+	mustPanic(func() { l.Add("k3", String("v3")) })
+	check("lru add", l)
+	mustPanic(l.Clear)
+	if l.Len() != 0 {
+		t.Fatalf("Clear left %d entries", l.Len())
+	}
+	check("lru clear", l)
+
+	a := NewARC(int64(10), onEvicted)
+	a.Add("k1", String("v1"))
+	a.Add("k2", String("v2"))
+	mustPanic(a.Clear)
+	if a.Len() != 0 {
+		t.Fatalf("ARC Clear left %d entries", a.Len())
+	}
+	check("arc clear", a)
+	a.Add("k3", String("v3"))
+	check("arc add", a)
+}
+
+func TestMaxEntries(t *testing.T) {
+	policies := map[string]Policy{"lru": New(0, nil), "arc": NewARC(0, nil)}
+	policies["lru"].(*Cache).MaxEntries = 3
+	policies["arc"].(*ARC).MaxEntries = 3
+	for name, p := range policies {
+		for i := 0; i < 5; i++ {
+			p.Add(fmt.Sprintf("k%d", i), String("v"))
+		}
+		if p.Len() != 3 || p.Contains("k0") || p.Contains("k1") || !p.Contains("k4") {
+			t.Fatalf("%s: %d entries, keys %v", name, p.Len(), p.Keys())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package lru
+
+import "hash/fnv"
+
+// TinyLFU 准入策略：用count-min sketch近似统计每个key最近的访问次数，
+// 缓存已满时，只有新key的访问次数超过将被淘汰的记录，才接纳新key，否则丢弃新值。
+// 只被读取一次的key因此不会把经常访问的记录挤出缓存。
+// 每记录sampleSize次访问，所有计数减半，使统计偏向最近的访问。
+
+const (
+	sketchDepth   = 4  // 每个key在sketch中对应的计数器个数，取其中的最小值作为估计
+	sketchCounter = 15 // 计数器的上限，频率只需要比较大小，不需要精确
+)
+
+type TinyLFU struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int // 上次减半以来记录的访问次数
+	sampleSize int
+}
+
+// NewTinyLFU 创建准入策略，sampleSize为两次减半之间的访问次数，通常取缓存能容纳的记录数的10倍左右
+func NewTinyLFU(sampleSize int) *TinyLFU {
+	if sampleSize < 1 {
+		sampleSize = 1
+	}
+	width := 1
+	for width < sampleSize {
+		width <<= 1
+	}
+	t := &TinyLFU{mask: uint64(width - 1), sampleSize: sampleSize}
+	for i := range t.rows {
+		t.rows[i] = make([]uint8, width)
+	}
+	return t
+}
+
+// Record 记录一次对key的访问
+func (t *TinyLFU) Record(key string) {
+	t.record(HashString(key))
+}
+
+// Estimate 返回key最近访问次数的估计值，只会高估不会低估
+func (t *TinyLFU) Estimate(key string) int {
+	return t.estimate(HashString(key))
+}
+
+// Admit 判断是否应当淘汰victim来接纳candidate
+func (t *TinyLFU) Admit(candidate, victim string) bool {
+	return t.admit(HashString(candidate), HashString(victim))
+}
+
+func (t *TinyLFU) admit(candidate, victim uint64) bool {
+	return t.estimate(candidate) > t.estimate(victim)
+}
+
+func (t *TinyLFU) record(h uint64) {
+	h1, h2 := splitHash(h)
+	for i := range t.rows {
+		c := &t.rows[i][(h1+uint64(i)*h2)&t.mask]
+		if *c < sketchCounter {
+			*c++
+		}
+	}
+	t.additions++
+	if t.additions >= t.sampleSize {
+		t.reset()
+	}
+}
+
+func (t *TinyLFU) estimate(h uint64) int {
+	h1, h2 := splitHash(h)
+	min := uint8(sketchCounter)
+	for i := range t.rows {
+		if c := t.rows[i][(h1+uint64(i)*h2)&t.mask]; c < min {
+			min = c
+		}
+	}
+	return int(min)
+}
+
+// reset 把所有计数减半
+func (t *TinyLFU) reset() {
+	for i := range t.rows {
+		for j := range t.rows[i] {
+			t.rows[i][j] >>= 1
+		}
+	}
+	t.additions /= 2
+}
+
+// HashString 是字符串键的64位哈希，New和NewSegmented创建的Cache用它作为Hash
+func HashString(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// splitHash 用一个64位哈希的高低两半构造多个哈希函数
+func splitHash(h uint64) (uint64, uint64) {
+	return h, h>>32 | 1
+}
@@ -0,0 +1,65 @@
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTinyLFUAging(t *testing.T) {
+	f := NewTinyLFU(64)
+	for i := 0; i < 6; i++ {
+		f.Record("hot")
+	}
+	if n := f.Estimate("hot"); n != 6 {
+		t.Fatalf("Estimate(hot) = %d, want 6", n)
+	}
+	if !f.Admit("hot", "cold") || f.Admit("cold", "hot") {
+		t.Fatal("hot key should beat cold key")
+	}
+	// 第64次访问触发减半
+	for i := 0; i < 58; i++ {
+		f.Record(fmt.Sprintf("other%d", i))
+	}
+	if n := f.Estimate("hot"); n != 3 {
+		t.Fatalf("Estimate(hot) after aging = %d, want 3", n)
+	}
+}
+
+// hotHitRate 反复读取5个热点key，每轮之间插入20个只读一次的key，返回热点key的命中率
+func hotHitRate(c *Cache) float64 {
+	load := func(key string) bool {
+		if _, ok := c.Get(key); ok {
+			return true
+		}
+		c.Add(key, String("1234567"))
+		return false
+	}
+	hits, total, scan := 0, 0, 0
+	for round := 0; round < 100; round++ {
+		for i := 0; i < 5; i++ {
+			if load(fmt.Sprintf("h%d", i)) {
+				hits++
+			}
+			total++
+		}
+		for i := 0; i < 20; i++ {
+			load(fmt.Sprintf("s%05d", scan))
+			scan++
+		}
+	}
+	return float64(hits) / float64(total)
+}
+
+func TestAdmissionKeepsHotKeys(t *testing.T) {
+	// 可以容纳10个扫描key
+	plain := hotHitRate(New(130, nil))
+	c := New(130, nil)
+	c.Admission = NewTinyLFU(1000)
+	admitted := hotHitRate(c)
+	if plain > 0.1 || admitted < 0.9 {
+		t.Fatalf("hot hit rate: plain LRU %.2f, with admission %.2f", plain, admitted)
+	}
+	if c.nbytes > 130 {
+		t.Fatalf("nbytes = %d exceeds maxBytes", c.nbytes)
+	}
+}
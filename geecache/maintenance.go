@@ -0,0 +1,114 @@
+package geecache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 维护模式：数据源维护期间，group只用已有的缓存回答请求，完全不调用回调函数
+//   读取：缓存中的值即使已经过期，只要过期不超过maxStale就照常返回；缓存中没有时直接返回ErrMaintenance
+//   修改：RemovePrefix等修改操作进入有界的待办队列，退出维护模式时按顺序重放
+// 过期判断是通过把本地缓存的时钟往回拨maxStale实现的，因此维护期间过期不久的记录也不会被后台清理删除
+
+// maxOutbox 是维护期间最多排队的修改操作数
+const maxOutbox = 4096
+
+var (
+	ErrMaintenance = errors.New("geecache: group is in maintenance")
+	ErrOutboxFull  = errors.New("geecache: maintenance outbox is full")
+)
+
+// MaintenanceState 描述group的维护状态
+type MaintenanceState struct {
+	Active   bool          `json:"active"`
+	Since    time.Time     `json:"since,omitempty"`     // 进入维护模式的时间
+	MaxStale time.Duration `json:"max_stale,omitempty"` // 过期后仍然返回的最长时间
+	Queued   int           `json:"queued"`              // 排队等待重放的修改操作数
+}
+
+type maintenance struct {
+	active   atomic.Bool
+	maxStale atomic.Int64 // 纳秒，只在active时有意义
+
+	mu     sync.Mutex
+	since  time.Time
+	outbox []func() // 排队的修改操作
+}
+
+// staleFor 返回本地缓存的时钟应当往回拨的时间
+func (m *maintenance) staleFor() time.Duration {
+	if !m.active.Load() {
+		return 0
+	}
+	return time.Duration(m.maxStale.Load())
+}
+
+// EnterMaintenance 进入维护模式，已经在维护模式时只更新maxStale
+func (g *Group) EnterMaintenance(maxStale time.Duration) {
+	m := &g.maint
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxStale.Store(int64(maxStale))
+	if !m.active.Load() {
+		m.since = g.now()
+		m.active.Store(true)
+	}
+	g.logger().Infof("group %s entered maintenance, serving values up to %v stale", g.name, maxStale)
+}
+
+// ExitMaintenance 按顺序重放维护期间排队的修改操作，然后恢复正常。重放期间新到达的修改继续排队并一起重放
+func (g *Group) ExitMaintenance() {
+	m := &g.maint
+	replayed := 0
+	for {
+		m.mu.Lock()
+		queue := m.outbox
+		m.outbox = nil
+		if len(queue) == 0 {
+			m.active.Store(false)
+			m.mu.Unlock()
+			break
+		}
+		m.mu.Unlock()
+		for _, apply := range queue {
+			apply()
+		}
+		replayed += len(queue)
+	}
+	g.logger().Infof("group %s left maintenance, replayed %d queued mutations", g.name, replayed)
+}
+
+// Maintenance 返回group当前的维护状态
+func (g *Group) Maintenance() MaintenanceState {
+	m := &g.maint
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active.Load() {
+		return MaintenanceState{Queued: len(m.outbox)}
+	}
+	return MaintenanceState{
+		Active:   true,
+		Since:    m.since,
+		MaxStale: time.Duration(m.maxStale.Load()),
+		Queued:   len(m.outbox),
+	}
+}
+
+// mutate 不在维护模式时立即执行apply；维护期间把它放入待办队列，返回true表示已排队
+func (g *Group) mutate(apply func()) (queued bool, err error) {
+	m := &g.maint
+	m.mu.Lock()
+	if !m.active.Load() {
+		m.mu.Unlock()
+		apply()
+		return false, nil
+	}
+	defer m.mu.Unlock()
+	if len(m.outbox) >= maxOutbox {
+		return false, ErrOutboxFull
+	}
+	m.outbox = append(m.outbox, apply)
+	return true, nil
+}
@@ -0,0 +1,66 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	silenceLog(t)
+	clock := newFakeClock()
+	loads := 0
+	version := "v1"
+	g := NewGroup("maintenance", 0, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key + "-" + version), nil
+	}), WithDefaultTTL(time.Minute), WithUnlimitedBytes())
+	g.now = clock.Now
+	g.Get(context.Background(), "user:1")
+	g.Get(context.Background(), "user:2")
+
+	// 进入维护模式：过期不超过maxStale的值照常返回，缓存中没有的key不调用回调函数
+	g.EnterMaintenance(time.Hour)
+	clock.Advance(30 * time.Minute)
+	if v, err := g.Get(context.Background(), "user:1"); err != nil || v.String() != "user:1-v1" {
+		t.Fatalf("stale read = %q, %v", v, err)
+	}
+	if _, err := g.Get(context.Background(), "user:3"); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("miss during maintenance: err = %v, expect ErrMaintenance", err)
+	}
+	if loads != 2 {
+		t.Fatalf("getter called %d times during maintenance", loads)
+	}
+
+	// 修改操作排队，不会立即生效
+	version = "v2"
+	if n := g.RemovePrefix("user:"); n != 0 {
+		t.Fatalf("RemovePrefix removed %d entries during maintenance", n)
+	}
+	if !g.CachedLocally("user:2") {
+		t.Fatal("queued removal applied during maintenance")
+	}
+	if s := g.Stats().Maintenance; !s.Active || s.Queued != 1 || s.MaxStale != time.Hour {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	// 退出维护模式：重放排队的删除，之后的读取重新加载到最新的值
+	g.ExitMaintenance()
+	if s := g.Maintenance(); s.Active || s.Queued != 0 {
+		t.Fatalf("state after exit = %+v", s)
+	}
+	for _, key := range []string{"user:1", "user:2", "user:3"} {
+		if v, err := g.Get(context.Background(), key); err != nil || v.String() != key+"-v2" {
+			t.Fatalf("Get(%s) after exit = %q, %v", key, v, err)
+		}
+	}
+
+	// 超过maxStale的值不再返回
+	g.EnterMaintenance(time.Minute)
+	clock.Advance(3 * time.Minute)
+	if _, err := g.Get(context.Background(), "user:1"); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("value older than maxStale: err = %v", err)
+	}
+	g.ExitMaintenance()
+}
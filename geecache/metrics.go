@@ -0,0 +1,239 @@
+package geecache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stats接口按请求的Accept头选择输出格式，三种格式都由同一份map[string]Stats快照生成，数值不会互相矛盾：
+//   application/json（默认）            与Stats结构相同的JSON
+//   text/plain; version=0.0.4          Prometheus文本格式
+//   application/openmetrics-text       OpenMetrics文本格式
+//
+// 指标名称和标签是稳定的接口，修改前需要考虑已有的采集配置。所有指标都带group标签：
+//   geecache_local_loads_total{group,reason}         counter 按FallbackReason统计的回调函数调用次数
+//   geecache_gets_total{group}                       counter Get、GetTo和GetMulti查询的key数
+//   geecache_cache_hits_total{group}                 counter 在本地缓存或热点缓存中命中的次数
+//   geecache_loads_total{group}                      counter 未命中后需要加载的次数
+//   geecache_loads_started_total{group}              counter 合并并发的相同加载后实际开始的加载次数（Stats.LoadsExecuted）
+//   geecache_loads_joined_total{group}               counter 加入了正在进行的相同加载、共享其结果的读取数（Stats.DedupedLoads）
+//   geecache_peer_loads_total{group}                 counter 从远程节点取回值（或确认key不存在）的次数
+//   geecache_peer_errors_total{group}                counter 访问远程节点失败的次数
+//   geecache_hot_promotions_total{group}             counter 从远程节点取回后放入热点缓存的次数
+//   geecache_local_load_errors_total{group}          counter 回调函数返回错误的次数
+//   geecache_loads_in_flight{group}                  gauge   正在进行的回调函数调用数
+//   geecache_loads_rejected_total{group}             counter 因超过并发加载上限而被拒绝的加载次数
+//   geecache_in_flight_bytes{group}                  gauge   进行中的加载预留的字节数
+//   geecache_in_flight_shed_total{group}             counter 因在途字节预算用完而被拒绝的加载次数
+//   geecache_loads_delayed_total{group}              counter 等待加载速率限制后才调用回调函数的次数
+//   geecache_loads_throttled_total{group}            counter 因加载速率限制而被拒绝的加载次数
+//   geecache_not_found_filter_hits_total{group}      counter 被不存在key的过滤器直接回答不存在的加载次数
+//   geecache_not_found_filter_rechecks_total{group}  counter 过滤器命中后仍交给回调函数复查的次数
+//   geecache_oversize_uncached_total{group}          counter 因超过单个值的上限而返回但没有缓存的次数
+//   geecache_cache_items{group}                      gauge   本地缓存的记录数
+//   geecache_cache_bytes{group}                      gauge   本地缓存占用的字节数
+//   geecache_cache_max_bytes{group}                  gauge   本地缓存的上限，0表示不限制或已关闭
+//   geecache_cache_disabled{group}                   gauge   本地缓存已关闭（cacheBytes为0）时为1
+//   geecache_cache_evictions_total{group}            counter 因容量淘汰的累计次数
+//   geecache_cache_expirations_total{group}          counter 因过期删除的累计次数
+//   geecache_hot_cache_items{group}                  gauge   热点缓存的记录数
+//   geecache_hot_cache_bytes{group}                  gauge   热点缓存占用的字节数
+//   geecache_maintenance_active{group}               gauge   处于维护模式时为1
+//   geecache_maintenance_queued{group}               gauge   维护模式下排队等待重放的修改操作数
+
+// 各格式的Content-Type
+const (
+	contentTypeJSON        = "application/json"
+	contentTypePrometheus  = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+type statsFormat int
+
+const (
+	formatJSON statsFormat = iota
+	formatPrometheus
+	formatOpenMetrics
+)
+
+// negotiateStatsFormat 按Accept头中第一个能识别的媒体类型选择格式，没有能识别的类型时返回JSON
+func negotiateStatsFormat(accept string) statsFormat {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return formatJSON
+		case "text/plain":
+			return formatPrometheus
+		case "application/openmetrics-text":
+			return formatOpenMetrics
+		}
+	}
+	return formatJSON
+}
+
+// metricFamily 是一个指标及其所有样本
+type metricFamily struct {
+	name    string // 不带_total后缀的名称
+	help    string
+	counter bool // counter的样本名称带_total后缀，否则为gauge
+	samples []metricSample
+}
+
+type metricSample struct {
+	labels [][2]string // 按输出顺序排列的标签名和值
+	value  float64
+}
+
+// metricFamilies 把stats转换成指标，group和reason按名称排序，保证输出稳定
+func metricFamilies(stats map[string]Stats) []metricFamily {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := []metricFamily{
+		{name: "geecache_local_loads", help: "Getter calls by fallback reason.", counter: true},
+		{name: "geecache_gets", help: "Keys requested through Get, GetTo and GetMulti.", counter: true},
+		{name: "geecache_cache_hits", help: "Requests served from the local or hot cache.", counter: true},
+		{name: "geecache_loads", help: "Cache misses that needed a load.", counter: true},
+		{name: "geecache_loads_started", help: "Loads actually performed after merging concurrent duplicates.", counter: true},
+		{name: "geecache_loads_joined", help: "Reads that joined an identical in-flight load and shared its result.", counter: true},
+		{name: "geecache_peer_loads", help: "Values (or not-found answers) fetched from peers.", counter: true},
+		{name: "geecache_peer_errors", help: "Failed requests to peers.", counter: true},
+		{name: "geecache_hot_promotions", help: "Values fetched from peers that were added to the hot cache.", counter: true},
+		{name: "geecache_local_load_errors", help: "Getter calls that returned an error.", counter: true},
+		{name: "geecache_loads_in_flight", help: "Getter calls in progress."},
+		{name: "geecache_loads_rejected", help: "Getter calls rejected by the concurrent load limit.", counter: true},
+		{name: "geecache_in_flight_bytes", help: "Bytes reserved by loads in progress."},
+		{name: "geecache_in_flight_shed", help: "Loads rejected because the in-flight byte budget was exhausted.", counter: true},
+		{name: "geecache_loads_delayed", help: "Getter calls that waited for the load rate limit.", counter: true},
+		{name: "geecache_loads_throttled", help: "Getter calls rejected by the load rate limit.", counter: true},
+		{name: "geecache_not_found_filter_hits", help: "Loads answered with not found by the not-found filter.", counter: true},
+		{name: "geecache_not_found_filter_rechecks", help: "Not-found filter hits passed through to the getter to revalidate.", counter: true},
+		{name: "geecache_oversize_uncached", help: "Values served but not cached because they exceeded the max value size.", counter: true},
+		{name: "geecache_cache_items", help: "Entries in the local cache."},
+		{name: "geecache_cache_bytes", help: "Bytes used by the local cache."},
+		{name: "geecache_cache_max_bytes", help: "Local cache limit in bytes, 0 when unlimited or disabled."},
+		{name: "geecache_cache_disabled", help: "1 if the local cache is disabled."},
+		{name: "geecache_cache_evictions", help: "Entries evicted for capacity.", counter: true},
+		{name: "geecache_cache_expirations", help: "Entries removed after expiring.", counter: true},
+		{name: "geecache_hot_cache_items", help: "Entries in the hot cache for keys owned by other peers."},
+		{name: "geecache_hot_cache_bytes", help: "Bytes used by the hot cache."},
+		{name: "geecache_maintenance_active", help: "1 if the group is in maintenance mode."},
+		{name: "geecache_maintenance_queued", help: "Mutations queued for replay after maintenance."},
+	}
+	for _, name := range names {
+		s := stats[name]
+		group := [][2]string{{"group", name}}
+		for r := FallbackReason(0); r < numFallbackReasons; r++ {
+			families[0].samples = append(families[0].samples, metricSample{
+				labels: [][2]string{{"group", name}, {"reason", r.String()}},
+				value:  float64(s.LocalLoads[r.String()]),
+			})
+		}
+		values := []float64{
+			float64(s.Gets),
+			float64(s.CacheHits),
+			float64(s.Loads),
+			float64(s.LoadsExecuted),
+			float64(s.DedupedLoads),
+			float64(s.PeerLoads),
+			float64(s.PeerErrors),
+			float64(s.Promotions),
+			float64(s.LocalLoadErrs),
+			float64(s.LoadsInFlight),
+			float64(s.LoadsRejected),
+			float64(s.InFlightBytes),
+			float64(s.InFlightShed),
+			float64(s.LoadsDelayed),
+			float64(s.LoadsThrottled),
+			float64(s.FilterHits),
+			float64(s.FilterRechecks),
+			float64(s.Oversize),
+			float64(s.Cache.Len),
+			float64(s.Cache.Bytes),
+			float64(s.Cache.MaxBytes),
+			boolValue(s.CacheDisabled),
+			float64(s.Cache.Evictions),
+			float64(s.Cache.Expired),
+			float64(s.HotCache.Len),
+			float64(s.HotCache.Bytes),
+			boolValue(s.Maintenance.Active),
+			float64(s.Maintenance.Queued),
+		}
+		for i, v := range values {
+			families[i+1].samples = append(families[i+1].samples, metricSample{labels: group, value: v})
+		}
+	}
+	return families
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeStats 按format把stats写到w
+func writeStats(w io.Writer, format statsFormat, stats map[string]Stats) error {
+	switch format {
+	case formatPrometheus:
+		return writeMetricsText(w, metricFamilies(stats), false)
+	case formatOpenMetrics:
+		return writeMetricsText(w, metricFamilies(stats), true)
+	}
+	return json.NewEncoder(w).Encode(stats)
+}
+
+// writeMetricsText 输出Prometheus文本格式，openMetrics为true时输出OpenMetrics格式：
+// counter的TYPE行使用不带_total的名称，并以# EOF结尾
+func writeMetricsText(w io.Writer, families []metricFamily, openMetrics bool) error {
+	var b strings.Builder
+	for _, f := range families {
+		typ, sampleName := "gauge", f.name
+		if f.counter {
+			typ, sampleName = "counter", f.name+"_total"
+		}
+		familyName := sampleName
+		if openMetrics {
+			familyName = f.name
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", familyName, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", familyName, typ)
+		for _, s := range f.samples {
+			b.WriteString(sampleName)
+			if len(s.labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", l[0], labelEscaper.Replace(l[1]))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+			b.WriteByte('\n')
+		}
+	}
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelEscaper 按指标文本格式转义标签值中的反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
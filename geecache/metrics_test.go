@@ -0,0 +1,151 @@
+package geecache
+
+import (
+	"bytes"
+	"flag"
+	"geecache/geecache/lru"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// goldenStats 是生成golden文件使用的固定统计数据
+func goldenStats() map[string]Stats {
+	loads := func(owned, peerErr int64) map[string]int64 {
+		m := make(map[string]int64, numFallbackReasons)
+		for r := FallbackReason(0); r < numFallbackReasons; r++ {
+			m[r.String()] = 0
+		}
+		m[OwnedLocally.String()] = owned
+		m[PeerError.String()] = peerErr
+		return m
+	}
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return map[string]Stats{
+		"scores": {
+			Gets:           40,
+			CacheHits:      22,
+			Loads:          18,
+			LoadsExecuted:  16,
+			DedupedLoads:   2,
+			PeerLoads:      1,
+			PeerErrors:     3,
+			Promotions:     1,
+			LocalLoads:     loads(12, 3),
+			LocalLoadErrs:  2,
+			LoadsInFlight:  3,
+			LoadsRejected:  4,
+			InFlightBytes:  1 << 20,
+			InFlightShed:   5,
+			LoadsDelayed:   6,
+			LoadsThrottled: 7,
+			FilterHits:     8,
+			FilterRechecks: 9,
+			Oversize:       1,
+			Cache:          lru.Stats{Len: 4, Bytes: 96, MaxBytes: 2048, Evictions: 7, Expired: 2, OldestAdded: since},
+			HotCache:       lru.Stats{Len: 1, Bytes: 20, MaxBytes: 256},
+		},
+		`odd "name"`: {
+			LocalLoads:    loads(1, 0),
+			Maintenance:   MaintenanceState{Active: true, Since: since, MaxStale: time.Minute, Queued: 5},
+			CacheDisabled: true,
+		},
+	}
+}
+
+func TestStatsGolden(t *testing.T) {
+	tests := []struct {
+		file   string
+		format statsFormat
+	}{
+		{"stats.json", formatJSON},
+		{"stats.prom", formatPrometheus},
+		{"stats.openmetrics", formatOpenMetrics},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeStats(&buf, tt.format, goldenStats()); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join("testdata", tt.file)
+		if *update {
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s mismatch, run go test -update\ngot:\n%s", tt.file, buf.String())
+		}
+	}
+}
+
+func TestStatsNegotiation(t *testing.T) {
+	silenceLog(t)
+	pool := NewHTTPPool("self")
+	NewGroup("stats-negotiation", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})).RegisterPeers(pool)
+
+	tests := []struct {
+		accept, contentType, contains string
+	}{
+		{"", contentTypeJSON, `"stats-negotiation":`},
+		{"*/*", contentTypeJSON, `"stats-negotiation":`},
+		{"text/plain; version=0.0.4", contentTypePrometheus, `geecache_cache_max_bytes{group="stats-negotiation"} 2048`},
+		{"application/openmetrics-text; version=1.0.0, text/plain;q=0.5", contentTypeOpenMetrics, "# EOF"},
+		{"text/html, application/json", contentTypeJSON, `"stats-negotiation":`},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/_geecache/stats", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, r)
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("Accept %q: Content-Type %q, want %q", tt.accept, ct, tt.contentType)
+		}
+		if !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("Accept %q: body missing %q:\n%s", tt.accept, tt.contains, w.Body.String())
+		}
+	}
+}
+
+// 每个指标都要在metrics.go开头的注释中写明名称、标签和类型
+func TestMetricFamiliesDocumented(t *testing.T) {
+	src, err := os.ReadFile("metrics.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range metricFamilies(goldenStats()) {
+		typ, name := "gauge", f.name
+		if f.counter {
+			typ, name = "counter", f.name+"_total"
+		}
+		labels := make([]string, 0, 2)
+		for _, l := range f.samples[0].labels {
+			labels = append(labels, l[0])
+		}
+		doc := "//   " + name + "{" + strings.Join(labels, ",") + "}"
+		i := bytes.Index(src, []byte(doc+" "))
+		if i < 0 {
+			t.Errorf("%s is not documented as %q", f.name, doc)
+			continue
+		}
+		line := string(src[i : i+bytes.IndexByte(src[i:], '\n')])
+		if !strings.Contains(line, " "+typ+" ") {
+			t.Errorf("%s is documented with the wrong type: %s", f.name, line)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"geecache/geecache/internal/protocol"
+	"geecache/geecache/singleflight"
+	"sync"
+)
+
+// 批量读取：一次页面渲染需要几十个key时，逐个Get在未命中时可能对远程节点发出同样多次请求。
+// GetMulti先查本地缓存，把未命中的key按所属节点分组：每个远程节点一次批量请求（见protocol的批量读取），
+// 本节点负责的key以及远程请求整体失败的key一起在本地加载，回调函数实现了BatchGetter时只调用一次。
+// 每个key仍然经过loader去重：与同时进行的Get或GetMulti重叠的key等待那次加载，不会重复加载。
+// 批量读取协议不携带过期时间，因此从远程节点批量取回的值不写入hotCache
+
+// BatchGetter 是可选的接口，Getter同时实现它时，GetMulti对需要在本地加载的key只调用一次GetMulti。
+// 返回的values与keys一一对应；errs为nil表示全部成功，否则同样与keys一一对应。批量加载的值使用group默认的过期时间
+type BatchGetter interface {
+	GetMulti(ctx context.Context, keys []string) (values [][]byte, errs []error)
+}
+
+// batchPeerGetter 是PeerGetter可选实现的接口，一次请求读取多个key，返回与keys一一对应的结果，整个请求失败时返回error
+type batchPeerGetter interface {
+	GetMulti(ctx context.Context, group string, keys []string) ([]protocol.Result, error)
+}
+
+// GetMulti 读取多个key，返回读取成功的值以及每个失败key的错误，一个key失败不影响其他key；keys中重复的key只读取一次
+func (g *Group) GetMulti(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	if g.keyHash != nil {
+		return g.getMultiHashed(ctx, keys)
+	}
+	return g.getMulti(ctx, keys)
+}
+
+// getMultiHashed 把keys换成缓存key后批量读取，结果仍以原来的key返回，见WithKeyHashing
+func (g *Group) getMultiHashed(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	sources := make(sourceKeys, len(keys))
+	hashed := make([]string, len(keys))
+	for i, key := range keys {
+		hashed[i] = g.cacheKey(key)
+		sources[hashed[i]] = key
+	}
+	values, errs := g.getMulti(g.withSourceKeys(ctx, sources), hashed)
+	byKey := make(map[string]ByteView, len(values))
+	for ck, v := range values {
+		byKey[sources[ck]] = v
+	}
+	errsByKey := make(map[string]error, len(errs))
+	for ck, err := range errs {
+		errsByKey[sources[ck]] = err
+	}
+	return byKey, errsByKey
+}
+
+// getMulti 与GetMulti相同，keys已经是缓存key，加载key在ctx中
+func (g *Group) getMulti(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(map[string]error)
+	if g.destroyed.Load() {
+		for _, key := range keys {
+			errs[key] = ErrGroupDestroyed
+		}
+		return values, errs
+	}
+	seen := make(map[string]bool, len(keys))
+	var misses []string
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == "" {
+			errs[key] = fmt.Errorf("key is required")
+			continue
+		}
+		v, ok := g.lookupCache(ctx, key)
+		switch {
+		case !ok:
+			misses = append(misses, key)
+		case v.err != nil:
+			errs[key] = v.err
+		default:
+			values[key] = v
+		}
+	}
+	if len(misses) == 0 {
+		return values, errs
+	}
+	if g.maint.active.Load() {
+		for _, key := range misses {
+			errs[key] = ErrMaintenance
+		}
+		return values, errs
+	}
+	g.stats.loads.Add(int64(len(misses)))
+	ctx, cancel := g.withLoadTimeout(ctx)
+	defer cancel()
+	for i, r := range g.loader.DoBatch(ctx, misses, g.loadBatch) {
+		if r.Err != nil {
+			errs[misses[i]] = loadTimeoutErr(ctx, r.Err)
+		} else {
+			values[misses[i]] = r.Val.(loaded).view
+		}
+	}
+	return values, errs
+}
+
+// loadBatch 加载一批未命中的key：按所属节点分组并发地批量请求远程节点，再在本地加载其余的key
+func (g *Group) loadBatch(ctx context.Context, keys []string) (results []singleflight.Result) {
+	g.stats.loadsExecuted.Add(int64(len(keys)))
+	ctx, cancel := g.withLoadTimeout(ctx)
+	defer cancel()
+	defer func() {
+		for i := range results {
+			results[i].Err = loadTimeoutErr(ctx, results[i].Err)
+		}
+	}()
+	results = make([]singleflight.Result, len(keys))
+	reasons := make([]FallbackReason, len(keys))
+	borrowed := make([]bool, len(keys)) // 有界负载交给本节点的、由其他节点负责的key，加载后不写入缓存
+	byPeer := make(map[PeerGetter][]int)
+	var local []int
+	for i, key := range keys {
+		reasons[i] = NoPeers
+		if g.peers != nil {
+			reasons[i] = OwnedLocally
+			if peer, ok := g.pickReadPeer(key); ok {
+				byPeer[peer] = append(byPeer[peer], i)
+				continue
+			}
+			borrowed[i] = g.ownedRemotely(key)
+		}
+		local = append(local, i)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for peer, idx := range byPeer {
+		wg.Add(1)
+		go func(peer PeerGetter, idx []int) {
+			defer wg.Done()
+			fallback := g.getBatchFromPeer(ctx, peer, keys, idx, reasons, results)
+			mu.Lock()
+			local = append(local, fallback...)
+			mu.Unlock()
+		}(peer, idx)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		for _, i := range local {
+			results[i].Err = err // 等待的调用方都已离开，不再回退到本地加载
+		}
+		return results
+	}
+	g.getLocallyBatch(ctx, keys, local, reasons, borrowed, results)
+	return results
+}
+
+// getBatchFromPeer 从远程节点读取keys中下标为idx的key，结果写入results；
+// 返回需要回退到本地加载的下标，并在reasons中记录原因
+func (g *Group) getBatchFromPeer(ctx context.Context, peer PeerGetter, keys []string, idx []int, reasons []FallbackReason, results []singleflight.Result) (fallback []int) {
+	bp, ok := peer.(batchPeerGetter)
+	if !ok {
+		// 不支持批量读取的节点逐个读取
+		for _, i := range idx {
+			var dest ByteView
+			v, err := g.getFromPeer(ctx, peer, keys[i], GetOptions{}, ByteViewSink(&dest))
+			g.stats.peerResult(err)
+			switch {
+			case err == nil:
+				results[i].Val = loaded{view: v, source: SourcePeer, peer: peerName(peer)}
+			case isNotFound(err) || ctx.Err() != nil:
+				results[i].Err = err
+			default:
+				reasons[i] = peerFallbackReason(err)
+				fallback = append(fallback, i)
+			}
+		}
+		return fallback
+	}
+
+	// 批量请求的key在请求体中，没有长度问题，发送加载key，由远程节点自己换成缓存key
+	batch := make([]string, len(idx))
+	for j, i := range idx {
+		batch[j] = sourceKey(ctx, g.name, keys[i])
+	}
+	rs, err := bp.GetMulti(ctx, g.name, batch)
+	if err != nil {
+		g.stats.peerErrors.Add(int64(len(idx)))
+		if ctx.Err() != nil {
+			for _, i := range idx {
+				results[i].Err = ctx.Err()
+			}
+			return nil
+		}
+		g.logger().Errorf("Failed to get %d keys from peer: %v", len(idx), err)
+		reason := peerFallbackReason(err)
+		for _, i := range idx {
+			reasons[i] = reason
+		}
+		return idx
+	}
+	for j, i := range idx {
+		g.stats.peerResult(rs[j].Err)
+		if rs[j].Err != nil {
+			results[i].Err = rs[j].Err
+		} else {
+			results[i].Val = loaded{view: g.withPeerExpiry(ByteView{b: rs[j].Value}), source: SourcePeer, peer: peerName(peer)}
+		}
+	}
+	return nil
+}
+
+// getLocallyBatch 调用回调函数加载keys中下标为idx的key，结果写入results；borrowed[i]为true的key不写入缓存
+func (g *Group) getLocallyBatch(ctx context.Context, keys []string, idx []int, reasons []FallbackReason, borrowed []bool, results []singleflight.Result) {
+	if len(idx) == 0 {
+		return
+	}
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		for _, i := range idx {
+			var dest ByteView
+			v, err := g.getLocally(ctx, keys[i], reasons[i], GetOptions{SkipPopulate: borrowed[i]}, ByteViewSink(&dest))
+			results[i] = singleflight.Result{Val: loaded{view: v, source: SourceLocal}, Err: err}
+		}
+		return
+	}
+
+	// 过滤器判定不存在的key不放进批量请求
+	kept := make([]int, 0, len(idx))
+	for _, i := range idx {
+		if err := g.filterNotFound(keys[i]); err != nil {
+			results[i].Err = err
+			continue
+		}
+		kept = append(kept, i)
+	}
+	if idx = kept; len(idx) == 0 {
+		return
+	}
+	err := g.throttle(ctx)
+	if err == nil {
+		err = g.acquireLoad(ctx)
+	}
+	if err != nil {
+		for _, i := range idx {
+			results[i].Err = err
+		}
+		return
+	}
+	batch := make([]string, len(idx))
+	since := make([]uint64, len(idx))
+	for j, i := range idx {
+		batch[j] = sourceKey(ctx, g.name, keys[i])
+		since[j] = g.mainCache.version(keys[i])
+		g.stats.localLoads[reasons[i]].Add(1)
+	}
+	start := g.now()
+	var values [][]byte
+	var errs []error
+	err = g.protect("Getter", func() {
+		values, errs = bg.GetMulti(ctx, batch)
+	})
+	g.releaseLoad()
+	if err == nil && (len(values) != len(batch) || errs != nil && len(errs) != len(batch)) {
+		err = fmt.Errorf("geecache: BatchGetter returned %d values and %d errors for %d keys", len(values), len(errs), len(batch))
+	}
+	for j, i := range idx {
+		if err != nil {
+			g.stats.localLoadErrs.Add(1)
+			results[i].Err = err
+			continue
+		}
+		var keyErr error
+		if errs != nil {
+			keyErr = errs[j]
+		}
+		var dest ByteView
+		v, keyErr := g.storeLoaded(keys[i], values[j], Expiry{}, keyErr, start, since[j], GetOptions{SkipPopulate: borrowed[i]}, g.getterSink(ByteViewSink(&dest)))
+		results[i] = singleflight.Result{Val: loaded{view: v, source: SourceLocal}, Err: keyErr}
+	}
+}
@@ -0,0 +1,186 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchDB 实现了BatchGetter，记录每次调用收到的key
+type batchDB struct {
+	mu    sync.Mutex
+	calls [][]string
+	data  map[string]string
+}
+
+func (db *batchDB) Get(ctx context.Context, key string) ([]byte, error) {
+	vs, errs := db.GetMulti(ctx, []string{key})
+	return vs[0], errs[0]
+}
+
+func (db *batchDB) GetMulti(_ context.Context, keys []string) ([][]byte, []error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls = append(db.calls, keys)
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		if v, ok := db.data[key]; ok {
+			values[i] = []byte(v)
+		} else {
+			errs[i] = errors.New(key + " not exist")
+		}
+	}
+	return values, errs
+}
+
+func TestGetMulti(t *testing.T) {
+	db := &batchDB{data: map[string]string{"a": "1", "b": "2", "c": "3"}}
+	g := NewGroup("get-multi", 1<<10, db)
+	if _, err := g.Get(context.Background(), "c"); err != nil {
+		t.Fatal(err)
+	}
+	db.calls = nil
+
+	values, errs := g.GetMulti(context.Background(), []string{"a", "b", "a", "c", "missing"})
+	if len(values) != 3 || values["a"].String() != "1" || values["b"].String() != "2" || values["c"].String() != "3" {
+		t.Fatalf("values = %v", values)
+	}
+	if len(errs) != 1 || errs["missing"] == nil {
+		t.Fatalf("errs = %v", errs)
+	}
+	// 已缓存的c不再加载，其余未命中的key只调用一次GetMulti
+	if len(db.calls) != 1 || len(db.calls[0]) != 3 {
+		t.Fatalf("getter calls = %v", db.calls)
+	}
+
+	values, _ = g.GetMulti(context.Background(), []string{"a", "b"})
+	if len(values) != 2 || len(db.calls) != 1 {
+		t.Fatalf("cached keys reloaded: %v", db.calls)
+	}
+}
+
+func TestGetMultiPeers(t *testing.T) {
+	silenceLog(t)
+	const name = "get-multi-peers"
+	var batches atomic.Int32
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			if key[0] == 'x' {
+				return nil, errors.New("bad key")
+			}
+			return []byte("v-" + key), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				batches.Add(1)
+			}
+			pool.ServeHTTP(w, r)
+		})
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+
+	// 由B负责的若干key，其中一个加载失败，另加一个本地的key
+	var remote []string
+	local := ""
+	for i := 0; len(remote) < 4 || local == ""; i++ {
+		k := string(rune('a'+i%20)) + string(rune('a'+i/20))
+		if pools[0].peers.Get(k) == urls[1] {
+			if len(remote) < 4 {
+				remote = append(remote, k)
+			}
+		} else if local == "" {
+			local = k
+		}
+	}
+	remote[3] = "x" + remote[3]
+	for pools[0].peers.Get(remote[3]) != urls[1] {
+		remote[3] += "x"
+	}
+
+	values, errs := groups[0].GetMulti(context.Background(), append([]string{local}, remote...))
+	if n := batches.Load(); n != 1 {
+		t.Fatalf("batch requests = %d, want 1", n)
+	}
+	for _, k := range append([]string{local}, remote[:3]...) {
+		if values[k].String() != "v-"+k {
+			t.Fatalf("values[%q] = %q", k, values[k])
+		}
+	}
+	if len(errs) != 1 || errs[remote[3]] == nil {
+		t.Fatalf("errs = %v", errs)
+	}
+	// 值由负责的节点B缓存
+	if !groups[1].CachedLocally(remote[0]) || groups[0].CachedLocally(remote[0]) {
+		t.Fatal("remote value not cached by its owner")
+	}
+}
+
+func TestGetMultiSharesLoads(t *testing.T) {
+	var calls sync.Map
+	release := make(chan struct{})
+	g := NewGroup("get-multi-shared", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		n, _ := calls.LoadOrStore(key, new(atomic.Int32))
+		n.(*atomic.Int32).Add(1)
+		<-release
+		return []byte(key), nil
+	}))
+
+	// Get正在加载a时，GetMulti等待那次加载
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Get(context.Background(), "a")
+	}()
+	for i := 0; ; i++ {
+		if _, ok := calls.Load("a"); ok {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("load did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, errs := g.GetMulti(context.Background(), []string{"a", "b"})
+			if len(errs) != 0 || values["a"].String() != "a" || values["b"].String() != "b" {
+				t.Errorf("GetMulti = %v, %v", values, errs)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	<-done
+	calls.Range(func(key, n any) bool {
+		if got := n.(*atomic.Int32).Load(); got != 1 {
+			t.Errorf("key %v loaded %d times", key, got)
+		}
+		return true
+	})
+}
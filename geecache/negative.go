@@ -0,0 +1,33 @@
+package geecache
+
+import (
+	"errors"
+	"geecache/geecache/internal/protocol"
+	"time"
+)
+
+// 负缓存：回调函数返回ErrNotFound（或包装了它的错误）时，在本地缓存中写入一条短期的墓碑记录，
+// 在negativeTTL内再次读取这个key直接返回同样的错误，不再调用回调函数或访问远程节点，避免扫描不存在的key时压垮数据源。
+// 墓碑与普通记录一样占用缓存（key和错误信息的长度）、参与淘汰，过期后下一次读取重新加载。
+// 其他错误视为暂时的失败，不会被缓存。远程节点以404和X-Geecache-Not-Found头告知请求方key不存在，
+// 请求方把墓碑写入hotCache，而不是回退到本地加载
+
+// ErrNotFound 表示数据源中没有这个key。回调函数返回它或包装了它的错误时，开启负缓存的group会缓存这个结果，见WithNegativeTTL
+var ErrNotFound = protocol.ErrNotFound
+
+// WithNegativeTTL 开启负缓存：回调函数返回ErrNotFound后的ttl内，对同一个key的读取直接返回该错误。0表示关闭（默认）
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// isNotFound 判断err是否表示key不存在
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// negativeEntry 返回key不存在的墓碑记录，值保存错误信息，使墓碑按实际大小计入缓存占用
+func (g *Group) negativeEntry(err error) ByteView {
+	return ByteView{b: []byte(err.Error()), expire: g.now().Add(g.negativeTTL), err: err}
+}
@@ -0,0 +1,188 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// missingDB 只有"known"这个key，"flaky"返回暂时的错误，统计调用次数
+func missingDB(calls *atomic.Int32) Getter {
+	return GetterFunc(func(key string) ([]byte, error) {
+		calls.Add(1)
+		switch key {
+		case "known":
+			return []byte("v"), nil
+		case "flaky":
+			return nil, errors.New("connection reset")
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	})
+}
+
+func TestNegativeCache(t *testing.T) {
+	clock := newFakeClock()
+	var calls atomic.Int32
+	g := NewGroup("negative", 1<<10, missingDB(&calls), WithNegativeTTL(5*time.Second))
+	g.now = clock.Now
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(missing) = %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("getter called %d times within the negative TTL", n)
+	}
+	var s string
+	if err := g.GetTo(context.Background(), "missing", StringSink(&s)); !errors.Is(err, ErrNotFound) || s != "" {
+		t.Fatalf("GetTo(missing) = %q, %v", s, err)
+	}
+	// 墓碑按key和错误信息的长度计入占用
+	if want := int64(len("missing") + len("geecache: not found: missing")); g.CacheBytes() != want {
+		t.Fatalf("CacheBytes = %d, want %d", g.CacheBytes(), want)
+	}
+
+	clock.Advance(6 * time.Second)
+	g.Get(context.Background(), "missing")
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("getter called %d times after the negative TTL, want 2", n)
+	}
+
+	// 暂时的错误不缓存
+	for i := 0; i < 2; i++ {
+		g.Get(context.Background(), "flaky")
+	}
+	if n := calls.Load(); n != 4 {
+		t.Fatalf("transient errors were cached: %d calls", n)
+	}
+
+	// 墓碑与其他记录一样被淘汰
+	small := NewGroup("negative-small", 64, missingDB(&calls), WithNegativeTTL(time.Minute))
+	for i := 0; i < 20; i++ {
+		small.Get(context.Background(), fmt.Sprintf("missing%02d", i))
+	}
+	if small.CacheBytes() > 64 || small.CacheItems() == 0 {
+		t.Fatalf("tombstones not evicted: %d bytes, %d items", small.CacheBytes(), small.CacheItems())
+	}
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	var calls atomic.Int32
+	g := NewGroup("negative-off", 1<<10, missingDB(&calls))
+	for i := 0; i < 2; i++ {
+		g.Get(context.Background(), "missing")
+	}
+	if n := calls.Load(); n != 2 || g.CacheItems() != 0 {
+		t.Fatalf("misses cached without WithNegativeTTL: %d calls, %d items", n, g.CacheItems())
+	}
+}
+
+func TestNegativeCacheFromPeer(t *testing.T) {
+	silenceLog(t)
+	var ownerCalls, localCalls atomic.Int32
+	poolB := NewHTTPPool("b")
+	NewGroup("negative-peer", 1<<10, missingDB(&ownerCalls)).RegisterPeers(poolB)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		poolB.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	poolA := NewHTTPPool("a")
+	poolA.Set(srv.URL)
+	a := NewGroup("negative-peer", 1<<10, missingDB(&localCalls), WithNegativeTTL(time.Minute))
+	a.RegisterPeers(poolA)
+
+	for i := 0; i < 2; i++ {
+		if _, err := a.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(missing) = %v", err)
+		}
+	}
+	if requests.Load() != 1 || localCalls.Load() != 0 {
+		t.Fatalf("%d peer requests, %d local loads; want 1 and 0", requests.Load(), localCalls.Load())
+	}
+}
+
+func TestNotFoundRoundTrip(t *testing.T) {
+	silenceLog(t)
+	var localCalls atomic.Int32
+	const name = "not-found-round-trip"
+	var (
+		urls  []string
+		pools []*HTTPPool
+		a     *Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		local := i == 0
+		g := NewGroup(name, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			if local {
+				localCalls.Add(1)
+			}
+			if strings.HasPrefix(key, "down") {
+				return nil, errors.New("database down")
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}))
+		g.RegisterPeers(pool)
+		if local {
+			a = g
+		}
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	// 找到由B负责的key
+	ownedByB := func(prefix string) string {
+		for i := 0; ; i++ {
+			if k := fmt.Sprintf("%s%d", prefix, i); pools[0].peers.Get(k) == urls[1] {
+				return k
+			}
+		}
+	}
+	missing, down := ownedByB("missing"), ownedByB("down")
+
+	// B的回调函数返回的ErrNotFound经过HTTP回到A，A不回退到本地加载
+	if _, err := a.Get(context.Background(), missing); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(%s) = %v, want ErrNotFound", missing, err)
+	}
+	if n := localCalls.Load(); n != 0 {
+		t.Fatalf("A loaded a key its owner reported missing %d times", n)
+	}
+	// 其他错误不是ErrNotFound，A回退到本地加载
+	if _, err := a.Get(context.Background(), down); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(%s) = %v, want a transient error", down, err)
+	}
+	if n := localCalls.Load(); n != 1 {
+		t.Fatalf("A fell back %d times after a transient error, want 1", n)
+	}
+
+	for _, tt := range []struct {
+		key    string
+		status int
+	}{{missing, http.StatusNotFound}, {down, http.StatusBadGateway}} {
+		res, err := http.Get(urls[1] + defaultBasePath + name + "/" + tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Fatalf("GET %s = %d, want %d", tt.key, res.StatusCode, tt.status)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package geecache
+
+import (
+	"geecache/geecache/lru"
+	"time"
+)
+
+// GroupOption 用于在创建Group时修改默认配置
+type GroupOption func(*Group)
+
+// WithDefaultTTL 设置本地缓存中的值的（硬）过期时间，0表示永不过期（默认）。规则如下：
+//   - 回调函数（GetterWithTTL、GetterWithExpiry）给出的非0过期时间优先，无论比默认值长还是短；
+//     GetterWithExpiry给出0时使用默认值，GetterWithTTL给出0或GetterWithExpiry给出NoExpiry时永不过期
+//   - Set写入和导入的值同样使用默认值
+//   - 从远程节点取回的值取所属节点上剩余的时间和默认值中较短的一个，所属节点没有给出时使用默认值，
+//     因此本节点hotCache中的副本不会比本group的配置活得更久
+//   - 与WithSoftTTL一起使用时，值在软过期之后、硬过期之前返回旧值并在后台刷新，硬过期之后同步重新加载；
+//     软过期时间不短于硬过期时间时软过期不起作用
+func WithDefaultTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithHardTTL 设置硬过期时间：超过后值不再返回，下一次Get重新加载。与WithDefaultTTL相同
+func WithHardTTL(ttl time.Duration) GroupOption {
+	return WithDefaultTTL(ttl)
+}
+
+// WithSoftTTL 设置软过期时间：超过后Get仍返回当前值，同时在后台重新加载，0表示不使用（默认）
+// 软过期时间应小于硬过期时间，否则值总是先硬过期
+func WithSoftTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.softTTL = ttl
+	}
+}
+
+// WithEarlyRefresh 开启XFetch式的概率性提前刷新：读取带过期时间的值时，
+// 若 now - delta*beta*ln(rand()) >= expire（delta为上次加载耗时）则在后台刷新，同时仍返回当前值。
+// 越接近过期、加载越慢，提前刷新的概率越大，热点key的刷新因此被随机打散，不会在过期的瞬间一拥而上。
+// beta越大刷新越早，通常取1；0表示关闭（默认）
+func WithEarlyRefresh(beta float64) GroupOption {
+	return func(g *Group) {
+		g.earlyBeta = beta
+	}
+}
+
+// WithEvictionPolicy 选择本地缓存的淘汰策略，默认为PolicyLRU
+func WithEvictionPolicy(policy EvictionPolicy) GroupOption {
+	return func(g *Group) {
+		g.mainCache.policy = policy
+	}
+}
+
+// WithAdmission 开启TinyLFU准入策略：缓存已满时，新key的近期访问次数必须超过将被淘汰的记录才会被缓存，
+// 避免只读一次的值挤占容量。sampleSize为访问计数减半的周期，0表示接纳所有新记录（默认）。
+// ARC自身已经区分访问频率，PolicyARC下忽略此选项
+func WithAdmission(sampleSize int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.admission = sampleSize
+	}
+}
+
+// WithPrefixReport 设置RemovePrefix通知的每个远程节点完成后的回调，removed为该节点删除的数量。回调在后台goroutine中调用
+func WithPrefixReport(f func(peer string, removed int, err error)) GroupOption {
+	return func(g *Group) {
+		g.prefixReport = f
+	}
+}
+
+// EvictReason 说明记录为什么被移出本地缓存，即lru.EvictReason，使用者不必导入lru包
+type EvictReason = lru.EvictReason
+
+const (
+	EvictCapacity = lru.ReasonCapacity // 超出容量被淘汰
+	EvictRemoved  = lru.ReasonRemoved  // 被Delete、失效或按前缀删除
+	EvictExpired  = lru.ReasonExpired  // 已过期，在读取或后台清理时被清除
+	EvictCleared  = lru.ReasonCleared  // 被Clear清空或group被销毁
+)
+
+// WithEvictionCallback 设置记录移出本地缓存（mainCache）时的回调，value是被移出的ByteView，reason说明是因为容量、删除、过期还是清空。
+// 回调在释放缓存锁之后按淘汰顺序串行调用，其中可以读写同一个group（例如把记录写入二级缓存或维护外部索引），
+// 但可能由另一个正在分发回调的goroutine执行，不一定在触发淘汰的操作返回前完成，见cache.unlock。
+// 开启分片时只保证同一分片内的顺序；回调中的panic被恢复并记录，见panic.go
+func WithEvictionCallback(f func(key string, value ByteView, reason EvictReason)) GroupOption {
+	return func(g *Group) {
+		g.mainCache.onEvicted = func(key string, value ByteView, reason EvictReason) {
+			g.protect("OnEvicted", func() { f(key, value, reason) })
+		}
+	}
+}
+
+// WithOnEvicted 同WithEvictionCallback，保留旧的名字
+func WithOnEvicted(f func(key string, value ByteView, reason lru.EvictReason)) GroupOption {
+	return WithEvictionCallback(f)
+}
+
+// WithUnlimitedBytes 不限制本地缓存的大小，NewGroup的cacheBytes参数被忽略。
+// 记录只会因过期、失效或Clear被删除，只适合key数量有限的group
+func WithUnlimitedBytes() GroupOption {
+	return func(g *Group) {
+		g.mainCache.unlimited = true
+	}
+}
+
+// WithMaxEntries 限制本地缓存的记录条数，超出时与超出cacheBytes一样按淘汰策略淘汰，0表示不限制（默认）
+// 分片时每个分片的上限为n/分片数（向上取整）
+func WithMaxEntries(n int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.maxEntries = n
+	}
+}
+
+// WithLowWater 设置本地缓存的低水位比例：超出cacheBytes时一次淘汰到cacheBytes*ratio以下，
+// 把淘汰和OnEvicted回调的开销分摊到少数几次写入上。ratio取值在(0,1)之间，如0.9；默认每次只淘汰到不超过cacheBytes
+func WithLowWater(ratio float64) GroupOption {
+	return func(g *Group) {
+		g.mainCache.lowWater = ratio
+	}
+}
+
+// WithMaxValueBytes 设置单个值的上限，超过的值照常返回给调用方和远程节点，但不放进本地缓存，
+// 以免一个大值把其他记录全部挤出缓存。默认为cacheBytes的1/4（分片时为每个分片上限的1/4，hotCache为它自己上限的1/4），
+// 使用WithUnlimitedBytes时默认不限制；n为0表示使用默认值，负数表示不限制。没有缓存的次数见CacheStats.Oversize
+func WithMaxValueBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.mainCache.maxValue = n
+	}
+}
+
+// WithCleanupInterval 开启后台清理，每隔interval删除本地缓存中已过期的记录，
+// 否则过期记录要等到被读取或者容量不足时才会释放内存。清理分批进行，不会长时间持有缓存的锁
+func WithCleanupInterval(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.mainCache.cleanup = interval
+	}
+}
+
+// WithGetterCopy 在缓存回调函数返回的切片之前拷贝一份，用于之后会修改或复用返回的切片的回调函数（见Getter）。
+// 默认不拷贝，冷读取的值只分配一次
+func WithGetterCopy() GroupOption {
+	return func(g *Group) {
+		g.getterCopy = true
+	}
+}
+
+// WithLoadHold 在加载结束后把结果在singleflight中保留d这么久，期间相同的读取直接得到这个结果而不再加载，
+// 用于极高并发下加载刚结束、结果还没放进缓存时又有一批相同的读取到来的情况（见singleflight.Group.Hold）。
+// holdErrors为true时加载的错误同样保留。默认不保留；Set和Delete会丢弃保留的结果
+func WithLoadHold(d time.Duration, holdErrors bool) GroupOption {
+	return func(g *Group) {
+		g.loader.Hold = d
+		g.loader.HoldErrors = holdErrors
+	}
+}
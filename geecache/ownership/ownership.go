@@ -0,0 +1,110 @@
+package ownership
+
+import (
+	"errors"
+	"fmt"
+	"geecache/geecache/consistenthash"
+	"geecache/geecache/internal/protocol"
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// 在集群之外计算key的所属节点，供需要绕过读取路径、直接把值推送到所属节点的外部系统使用
+// 只要节点列表、虚拟节点倍数、哈希种子和环的格式版本与集群一致，计算结果就与运行中的HTTPPool.PickPeer相同
+// 本包只依赖标准库和consistenthash，不会引入geecache的group、HTTP服务等。
+// Owner按传入的key计算，group开启了WithKeyHashing时集群按h(key)选择节点，调用方需要自己先做同样的变换
+
+// 环的格式版本，改变虚拟节点的命名、哈希函数或冲突的处理方式都必须增加版本号，旧版本的计算方式保留不变。
+// 两个版本只在虚拟节点的哈希值冲突时不同，滚动升级期间新旧节点对落在冲突位置上的key看法不一致
+const (
+	// RingV1 虚拟节点为strconv.Itoa(i)+peer，哈希函数为crc32（IEEE）。
+	// 哈希值冲突时节点名称（字符串比较）较大的节点得到这个位置，另一个虚拟节点不在环上
+	RingV1 = 1
+	// RingV2 与RingV1相同，但哈希值冲突时名称较小的节点（同一节点时编号较小的虚拟节点）得到这个位置，
+	// 另一个虚拟节点在名称后加上"#1"、"#2"……重新计算哈希值，直到不再冲突，因此每个节点的虚拟节点数不变
+	RingV2 = 2
+
+	CurrentVersion = RingV2
+)
+
+// DefaultReplicas 是HTTPPool默认的虚拟节点倍数
+const DefaultReplicas = protocol.DefaultReplicas
+
+// ErrNoPeers 表示没有提供任何节点
+var ErrNoPeers = errors.New("ownership: no peers")
+
+// Config 描述一个哈希环，必须与集群的配置一致
+type Config struct {
+	Peers    []string // 集群中所有节点的地址（包含自己），如"http://localhost:8001"，顺序无关
+	Replicas int      // 虚拟节点倍数，0表示DefaultReplicas
+	Seed     uint32   // 哈希种子，RingV1和RingV2没有种子，必须为0
+	Version  int      // 环的格式版本，0表示CurrentVersion
+}
+
+// Ring 根据Config计算key的所属节点，创建后只读，可以被多个goroutine并发使用
+type Ring struct {
+	owner func(key string) string
+}
+
+// New 校验配置并构建哈希环
+func New(cfg Config) (*Ring, error) {
+	if len(cfg.Peers) == 0 {
+		return nil, ErrNoPeers
+	}
+	if cfg.Version == 0 {
+		cfg.Version = CurrentVersion
+	}
+	if cfg.Version != RingV1 && cfg.Version != RingV2 {
+		return nil, fmt.Errorf("ownership: unsupported ring version %d", cfg.Version)
+	}
+	if cfg.Seed != 0 {
+		return nil, fmt.Errorf("ownership: ring version %d has no hash seed, got %d", cfg.Version, cfg.Seed)
+	}
+	if cfg.Replicas < 0 {
+		return nil, fmt.Errorf("ownership: invalid replicas %d", cfg.Replicas)
+	}
+	if cfg.Replicas == 0 {
+		cfg.Replicas = DefaultReplicas
+	}
+	if cfg.Version == RingV1 {
+		return &Ring{owner: newRingV1(cfg.Peers, cfg.Replicas).owner}, nil
+	}
+	m := consistenthash.New(cfg.Replicas, nil)
+	m.Add(cfg.Peers...)
+	return &Ring{owner: m.Get}, nil
+}
+
+// Owner 返回key所属节点的地址
+func (r *Ring) Owner(key string) string {
+	return r.owner(key)
+}
+
+// ringV1 是RingV1的环，consistenthash已经改为RingV2的冲突处理方式，这里单独保留旧的计算方式
+type ringV1 struct {
+	keys   []uint32
+	owners map[uint32]string
+}
+
+func newRingV1(peers []string, replicas int) *ringV1 {
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted) // 按名称从小到大放置，冲突时后放置的（名称较大的）节点覆盖先放置的
+	r := &ringV1{owners: make(map[uint32]string)}
+	for _, peer := range sorted {
+		for i := 0; i < replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + peer))
+			if _, ok := r.owners[hash]; !ok {
+				r.keys = append(r.keys, hash)
+			}
+			r.owners[hash] = peer
+		}
+	}
+	sort.Slice(r.keys, func(i, j int) bool { return r.keys[i] < r.keys[j] })
+	return r
+}
+
+func (r *ringV1) owner(key string) string {
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(r.keys), func(i int) bool { return r.keys[i] >= hash })
+	return r.owners[r.keys[idx%len(r.keys)]]
+}
@@ -0,0 +1,61 @@
+package ownership
+
+import (
+	"geecache/geecache/consistenthash"
+	"testing"
+)
+
+func TestConfigValidation(t *testing.T) {
+	peers := []string{"http://a", "http://b"}
+	for _, cfg := range []Config{
+		{},
+		{Peers: peers, Version: 3},
+		{Peers: peers, Seed: 1},
+		{Peers: peers, Replicas: -1},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded, expect an error", cfg)
+		}
+	}
+	r, err := New(Config{Peers: peers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := r.Owner("Tom"); owner != "http://a" && owner != "http://b" {
+		t.Fatalf("Owner(Tom) = %q", owner)
+	}
+}
+
+func TestRingVersionsOnCollision(t *testing.T) {
+	// crc32("6"+a) == crc32("19"+b)：两个节点的虚拟节点落在同一个位置
+	const a, b = "http://node5899:8001", "http://node190004:8001"
+	const slot = "6" + a // 哈希值正好是冲突的位置
+	peers := []string{a, b}
+
+	v1, err := New(Config{Peers: peers, Replicas: 50, Version: RingV1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := v1.Owner(slot); owner != a {
+		t.Fatalf("RingV1 owner = %q, want the larger name %q", owner, a)
+	}
+
+	v2, err := New(Config{Peers: []string{b, a}, Replicas: 50, Version: RingV2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := v2.Owner(slot); owner != b {
+		t.Fatalf("RingV2 owner = %q, want the smaller name %q", owner, b)
+	}
+	// 与运行中的HTTPPool使用的环一致
+	m := consistenthash.New(50, nil)
+	m.SetNodes(peers)
+	if m.Collisions() == 0 {
+		t.Fatal("the peers no longer collide")
+	}
+	for _, key := range []string{slot, "19" + b, "Tom", "Jack"} {
+		if v2.Owner(key) != m.Get(key) {
+			t.Fatalf("RingV2 owner of %q = %q, pool picks %q", key, v2.Owner(key), m.Get(key))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package geecache
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// 用户提供的回调（Getter、OnEvicted、PrefixReport）中的panic不能让服务goroutine崩溃，
+// 也不能发生在持有内部锁的时候：回调都在锁外调用，并经过protect把panic转换成*CallbackPanicError，
+// 记录日志后交给WithOnPanic设置的回调。Getter的panic作为这次加载的错误返回给所有等待者
+
+// CallbackPanicError 说明某个用户回调发生了panic
+type CallbackPanicError struct {
+	Group    string
+	Callback string      // 发生panic的回调：Getter、OnEvicted或PrefixReport
+	Value    interface{} // recover()的返回值
+	Stack    []byte      // panic时的调用栈
+}
+
+func (e *CallbackPanicError) Error() string {
+	return fmt.Sprintf("geecache: %s of group %q panicked: %v", e.Callback, e.Group, e.Value)
+}
+
+// WithOnPanic 设置用户回调发生panic时的通知，f在发生panic的goroutine中同步调用，它自己的panic不会被恢复
+func WithOnPanic(f func(err *CallbackPanicError)) GroupOption {
+	return func(g *Group) {
+		g.onPanic = f
+	}
+}
+
+// protect 调用f，f发生panic时记录日志、通知onPanic并返回*CallbackPanicError
+func (g *Group) protect(callback string, f func()) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			pe := &CallbackPanicError{Group: g.name, Callback: callback, Value: v, Stack: debug.Stack()}
+			g.logger().Errorf("%v\n%s", pe, pe.Stack)
+			if g.onPanic != nil {
+				g.onPanic(pe)
+			}
+			err = pe
+		}
+	}()
+	f()
+	return nil
+}
@@ -0,0 +1,104 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geecache/geecache/lru"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetterPanic(t *testing.T) {
+	silenceLog(t)
+	var panics []*CallbackPanicError
+	var mu sync.Mutex
+	release := make(chan struct{})
+	g := NewGroup("panic-getter", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "bad" {
+			<-release
+			panic("boom")
+		}
+		return []byte(key), nil
+	}), WithOnPanic(func(err *CallbackPanicError) {
+		mu.Lock()
+		panics = append(panics, err)
+		mu.Unlock()
+	}))
+
+	// 等待同一次加载的所有调用者都得到错误，而不是永远阻塞
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var pe *CallbackPanicError
+			if _, err := g.Get(context.Background(), "bad"); !errors.As(err, &pe) || pe.Callback != "Getter" || pe.Value != "boom" {
+				t.Errorf("Get(bad) = %v", err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if len(panics) == 0 || len(panics[0].Stack) == 0 {
+		t.Fatalf("OnPanic not called with a stack: %v", panics)
+	}
+	if v, err := g.Get(context.Background(), "good"); err != nil || v.String() != "good" {
+		t.Fatalf("group unusable after panic: %v", err)
+	}
+}
+
+func TestOnEvictedPanic(t *testing.T) {
+	silenceLog(t)
+	var panics int
+	g := NewGroup("panic-evicted", 8, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		panic("evicted " + key)
+	}), WithOnPanic(func(err *CallbackPanicError) {
+		if err.Callback != "OnEvicted" {
+			t.Errorf("callback = %s", err.Callback)
+		}
+		panics++
+	}))
+	for i := 0; i < 10; i++ {
+		g.Get(context.Background(), fmt.Sprintf("k%d", i))
+	}
+	g.Clear()
+	if panics != 10 {
+		t.Fatalf("OnPanic called %d times, want 10", panics)
+	}
+	g.Get(context.Background(), "k1")
+	if s := g.CacheStats(MainCache); s.Items != 1 || s.Bytes != 4 {
+		t.Fatalf("cache inconsistent after panics: %+v", s)
+	}
+}
+
+func TestPrefixReportPanic(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	poolB := NewHTTPPool("b")
+	NewGroup("panic-prefix", 2<<10, getter).RegisterPeers(poolB)
+	srv := httptest.NewServer(poolB)
+	defer srv.Close()
+
+	panicked := make(chan *CallbackPanicError, 1)
+	poolA := NewHTTPPool("a")
+	poolA.Set("a", srv.URL)
+	a := NewGroup("panic-prefix", 2<<10, getter, WithPrefixReport(func(peer string, removed int, err error) {
+		panic("report")
+	}), WithOnPanic(func(err *CallbackPanicError) { panicked <- err }))
+	a.RegisterPeers(poolA)
+	a.RemovePrefix("k")
+	select {
+	case err := <-panicked:
+		if err.Callback != "PrefixReport" {
+			t.Fatalf("callback = %s", err.Callback)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic in PrefixReport not reported")
+	}
+}
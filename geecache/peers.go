@@ -1,5 +1,10 @@
 package geecache
 
+import (
+	"context"
+	"geecache/geecache/internal/protocol"
+)
+
 // 实现HTTP客户端，与远程节点的服务通信
 // 实现之前的流程（2）：当缓存没有数据，选择是否应当从远程节点获取，进而与远程节点交互，返回缓存值
 
@@ -16,6 +21,77 @@ type PeerPicker interface {
 
 // PeerGetter 是客户端接口，每个客户端必须实现Get方法
 type PeerGetter interface {
-	// Get 方法用于从对应的group查找缓存值
-	Get(group string, key string) ([]byte, error)
+	// Get 方法用于从对应的group查找缓存值，ctx结束时应当放弃请求
+	Get(ctx context.Context, group string, key string) ([]byte, error)
+}
+
+// PeerSetter 是PeerGetter可选实现的接口，把值写入远程节点的本地缓存，用于Group.Set
+type PeerSetter interface {
+	// Set 方法把value写入对应group中key的缓存
+	Set(group string, key string, value []byte) error
+}
+
+// PeerRemover 是PeerGetter可选实现的接口，从远程节点的本地缓存中删除key，用于Group.Delete
+type PeerRemover interface {
+	// Remove 方法删除对应group中key的缓存，key不存在时也返回nil
+	Remove(group string, key string) error
+}
+
+// expiryPeerGetter 是PeerGetter可选实现的接口，除了值以外还返回它在远程节点上剩余的软/硬过期时间
+type expiryPeerGetter interface {
+	GetEntry(ctx context.Context, group string, key string) (protocol.Entry, error)
+}
+
+// getOrSetPeer 是PeerGetter可选实现的接口，在远程节点上原子地读取或写入key，用于Group.GetOrSet
+type getOrSetPeer interface {
+	GetOrSet(ctx context.Context, group string, key string, value []byte) (e protocol.Entry, stored bool, err error)
+}
+
+// versionedPeerSetter 是PeerGetter可选实现的接口，写入并返回远程节点上的版本号；
+// ifVersion不为nil时只在版本号等于*ifVersion时写入，否则返回ErrVersionMismatch，用于Group.SetIfVersion
+type versionedPeerSetter interface {
+	SetVersioned(group string, key string, value []byte, ifVersion *uint64) (uint64, error)
+}
+
+// existsPeerGetter 是PeerGetter可选实现的接口，询问远程节点是否缓存了key而不取回值，用于Group.Exists
+type existsPeerGetter interface {
+	Exists(ctx context.Context, group string, key string) (bool, error)
+}
+
+// refreshPeerGetter 是PeerGetter可选实现的接口，要求远程节点忽略已缓存的值重新加载，用于GetOptions.ForceRefresh
+type refreshPeerGetter interface {
+	RefreshEntry(ctx context.Context, group string, key string) (protocol.Entry, error)
+}
+
+// broadcaster 是PeerPicker可选实现的接口，返回集群中除本节点以外的所有节点，用于向整个集群发送通知
+type broadcaster interface {
+	broadcastTargets() map[string]PeerGetter
+}
+
+// boundedPicker 是PeerPicker可选实现的接口，按节点当前的负载选择处理读取的节点，不一定是key的所属节点，见WithBoundedLoad
+type boundedPicker interface {
+	pickReadPeer(key string) (PeerGetter, bool)
+}
+
+// loadReporter 是PeerPicker可选实现的接口，返回对远程节点的请求占并发上限的比例（取最忙的节点）
+type loadReporter interface {
+	peerUtilization() float64
+}
+
+// prefixRemover 是PeerGetter可选实现的接口，让远程节点删除本地缓存中以prefix开头的key
+type prefixRemover interface {
+	RemovePrefix(group string, prefix string) (int, error)
+}
+
+// flusher 是PeerGetter可选实现的接口，让远程节点清空group的本地缓存，用于Group.FlushAll
+type flusher interface {
+	Flush(ctx context.Context, group string) error
+}
+
+// pickReadPeer 选择读取key时访问的节点：PeerPicker实现了boundedPicker时按负载选择，否则使用PickPeer
+func (g *Group) pickReadPeer(key string) (PeerGetter, bool) {
+	if b, ok := g.peers.(boundedPicker); ok {
+		return b.pickReadPeer(key)
+	}
+	return g.peers.PickPeer(key)
 }
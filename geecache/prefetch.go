@@ -0,0 +1,117 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 预热：切换流量之前把一批已知的key加载进缓存，而不必写一个逐个Get的循环。
+// Prefetch用最多concurrency个goroutine并发加载，已经在缓存中的key跳过；加载与Get走同一条路径，
+// 远程节点负责的key由那个节点加载并缓存，本节点只在hotCache中保留副本，写入同样受cacheBytes和淘汰策略约束，
+// 预热的key超出缓存上限时，先预热的会被后预热的淘汰，而不会超出内存预算
+
+// PrefetchStats 汇总一次Prefetch的结果
+type PrefetchStats struct {
+	Warmed  int // 加载成功的key数
+	Skipped int // 已经在缓存中（或按PrefetchLocalOnly不由本节点负责）而跳过的key数
+	Failed  int // 加载失败的key数
+}
+
+type prefetchOptions struct {
+	localOnly bool
+}
+
+// PrefetchOption 用于修改Prefetch的行为
+type PrefetchOption func(*prefetchOptions)
+
+// PrefetchLocalOnly 只预热由本节点负责的key，其他节点负责的key计入Skipped，
+// 适合每个节点各自预热同一份key列表的场景
+func PrefetchLocalOnly() PrefetchOption {
+	return func(o *prefetchOptions) {
+		o.localOnly = true
+	}
+}
+
+// Prefetch 用最多concurrency个goroutine（小于1时为1）加载keys中尚未缓存的key，重复的key只处理一次。
+// 返回各类key的数量，以及所有失败的key的错误（errors.Join，每个错误带着key）；ctx结束后不再开始新的加载
+func (g *Group) Prefetch(ctx context.Context, keys []string, concurrency int, opts ...PrefetchOption) (PrefetchStats, error) {
+	var o prefetchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if g.destroyed.Load() {
+		return PrefetchStats{}, ErrGroupDestroyed
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mu    sync.Mutex
+		stats PrefetchStats
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	work := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				err := ctx.Err()
+				if err == nil {
+					var dest ByteView
+					kctx, ck := g.withSourceKey(ctx, key)
+					_, _, err = g.load(kctx, ck, GetOptions{}, ByteViewSink(&dest))
+				}
+				mu.Lock()
+				if err != nil {
+					stats.Failed++
+					errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				} else {
+					stats.Warmed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == "" {
+			mu.Lock()
+			stats.Failed++
+			errs = append(errs, fmt.Errorf("key is required"))
+			mu.Unlock()
+			continue
+		}
+		if g.prefetchSkips(g.cacheKey(key), o) {
+			mu.Lock()
+			stats.Skipped++
+			mu.Unlock()
+			continue
+		}
+		work <- key
+	}
+	close(work)
+	wg.Wait()
+	return stats, errors.Join(errs...)
+}
+
+// prefetchSkips 判断key是否不需要预热：已经在mainCache或hotCache中，或者按o不由本节点预热
+func (g *Group) prefetchSkips(key string, o prefetchOptions) bool {
+	if g.mainCache.contains(key) || g.hotCache.contains(key) {
+		return true
+	}
+	if o.localOnly && g.peers != nil {
+		_, remote := g.peers.PickPeer(key)
+		return remote
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// prefixPeers 把以prefix开头的key交给peer，其余的由本节点负责
+type prefixPeers struct {
+	prefix string
+	peer   PeerGetter
+}
+
+func (p prefixPeers) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, p.prefix) {
+		return p.peer, true
+	}
+	return nil, false
+}
+
+// echoPeer 返回key本身
+type echoPeer struct {
+	calls atomic.Int32
+}
+
+func (p *echoPeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	p.calls.Add(1)
+	return []byte(key), nil
+}
+
+func TestPrefetch(t *testing.T) {
+	silenceLog(t)
+	var running, maxRunning atomic.Int32
+	g := NewGroup("prefetch", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if strings.HasPrefix(key, "bad") {
+			return nil, errors.New("db error")
+		}
+		return []byte(key), nil
+	}))
+	peer := &echoPeer{}
+	g.RegisterPeers(prefixPeers{"remote", peer})
+	g.Get(context.Background(), "k0")
+
+	keys := []string{"k0", "remote1", "bad1"}
+	for i := 1; i <= 10; i++ {
+		keys = append(keys, fmt.Sprintf("k%d", i))
+	}
+	keys = append(keys, "k1")
+	stats, err := g.Prefetch(context.Background(), keys, 3)
+	if want := (PrefetchStats{Warmed: 11, Skipped: 1, Failed: 1}); stats != want {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), "bad1: db error") {
+		t.Fatalf("err = %v", err)
+	}
+	if n := maxRunning.Load(); n > 3 {
+		t.Fatalf("%d loads ran concurrently, limit 3", n)
+	}
+	for i := 0; i <= 10; i++ {
+		if !g.CachedLocally(fmt.Sprintf("k%d", i)) {
+			t.Fatalf("k%d not warmed", i)
+		}
+	}
+	// 远程节点负责的key由它加载，本节点只在hotCache中保留副本
+	if peer.calls.Load() != 1 || g.CachedLocally("remote1") || !g.hotCache.contains("remote1") {
+		t.Fatal("remote key not fetched from its owner")
+	}
+
+	// 只预热本节点负责的key
+	stats, err = g.Prefetch(context.Background(), []string{"remote2", "k11"}, 0, PrefetchLocalOnly())
+	if err != nil || stats != (PrefetchStats{Warmed: 1, Skipped: 1}) || peer.calls.Load() != 1 {
+		t.Fatalf("local only: %+v, %v, %d peer calls", stats, err, peer.calls.Load())
+	}
+
+	// ctx结束后不再加载
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err = g.Prefetch(ctx, []string{"k20", "k21"}, 2)
+	if stats.Failed != 2 || !errors.Is(err, context.Canceled) || g.CachedLocally("k20") {
+		t.Fatalf("canceled: %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,87 @@
+package geecache
+
+import "time"
+
+// 节点的负载信号：应用的准入层可以在每个请求前调用Group.Pressure，负载过高时提前拒绝或转移流量，而不是等到请求超时
+// 缓存写满本身是常态，不算过载；写满之后仍在不断淘汰（新值挤掉旧值）才说明缓存承受不住当前的工作集
+
+// churnWindow 是统计淘汰速率的窗口
+const churnWindow = time.Second
+
+// PressureReport 是Group当前负载的快照，各分量都归一化到0~1
+type PressureReport struct {
+	Score  float64 // 综合得分，取Churn和Peers中的较大值
+	Memory float64 // 本地缓存已用内存占cacheBytes的比例，不缓存或不限制大小时为0
+	Churn  float64 // 最近一个窗口内因容量淘汰的字节数占cacheBytes的比例，即每秒被替换掉的缓存比例
+	Peers  float64 // 对远程节点的并发请求（含排队）占上限的比例，取最忙的节点；未开启WithPeerConcurrency时为0
+}
+
+// churnMeter 用滑动窗口估计最近一秒淘汰的字节数，由cache.mu保护
+type churnMeter struct {
+	start time.Time // 当前窗口的开始时间
+	cur   int64     // 当前窗口内淘汰的字节数
+	prev  int64     // 上一个窗口内淘汰的字节数
+}
+
+func (m *churnMeter) roll(now time.Time) {
+	switch elapsed := now.Sub(m.start); {
+	case elapsed < churnWindow:
+	case elapsed < 2*churnWindow:
+		m.prev, m.cur = m.cur, 0
+		m.start = m.start.Add(churnWindow)
+	default:
+		m.prev, m.cur = 0, 0
+		m.start = now
+	}
+}
+
+func (m *churnMeter) add(now time.Time, n int64) {
+	m.roll(now)
+	m.cur += n
+}
+
+// rate 按当前窗口已经过去的比例，把上一个窗口的计数折算进来
+func (m *churnMeter) rate(now time.Time) float64 {
+	m.roll(now)
+	frac := float64(now.Sub(m.start)) / float64(churnWindow)
+	return float64(m.prev)*(1-frac) + float64(m.cur)
+}
+
+// pressure 返回本地缓存的内存占用和淘汰速率两个分量
+func (c *cache) pressure() (memory, churn float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	limit := c.limit()
+	if limit <= 0 {
+		return 0, 0
+	}
+	if c.lru != nil {
+		memory = clamp01(float64(c.lru.Bytes()) / float64(limit))
+	}
+	churn = clamp01(c.churn.rate(c.now()) / float64(limit))
+	return memory, churn
+}
+
+// Pressure 返回group当前的负载，只读取计数器，开销很小，可以在每个请求上调用
+func (g *Group) Pressure() PressureReport {
+	var r PressureReport
+	r.Memory, r.Churn = g.mainCache.pressure()
+	if lr, ok := g.peers.(loadReporter); ok {
+		r.Peers = clamp01(lr.peerUtilization())
+	}
+	r.Score = r.Churn
+	if r.Peers > r.Score {
+		r.Score = r.Peers
+	}
+	return r
+}
+
+func clamp01(x float64) float64 {
+	if x > 1 {
+		return 1
+	}
+	if x < 0 {
+		return 0
+	}
+	return x
+}
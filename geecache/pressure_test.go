@@ -0,0 +1,52 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPressureRisesAndFalls(t *testing.T) {
+	silenceLog(t)
+	clock := newFakeClock()
+	g := NewGroup("pressure", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 100), nil
+	}))
+	g.now = clock.Now
+	pool := NewHTTPPool("", WithPeerConcurrency(2))
+	pool.Set("http://peer")
+	g.peers = pool // 不调用RegisterPeers，避免测试中真的向peer发请求
+	if r := g.Pressure(); r.Score != 0 {
+		t.Fatalf("idle group reports pressure %+v", r)
+	}
+
+	// 工作集大于缓存：一秒内淘汰的字节数超过了整个缓存
+	for i := 0; i < 20; i++ {
+		g.mainCache.add(fmt.Sprintf("key%03d", i), ByteView{b: make([]byte, 100)})
+	}
+	// 对peer的请求排队
+	q := pool.httpGetters["http://peer"].queue
+	q.acquire(context.Background(), "pressure")
+	q.acquire(context.Background(), "pressure")
+	r := g.Pressure()
+	if r.Memory < 0.9 || r.Churn != 1 || r.Peers != 1 || r.Score != 1 {
+		t.Fatalf("overloaded group reports %+v", r)
+	}
+
+	// 负载消失后回落
+	q.release()
+	q.release()
+	clock.Advance(1500 * time.Millisecond)
+	if r := g.Pressure(); r.Churn <= 0 || r.Churn >= 1 || r.Score != r.Churn {
+		t.Fatalf("pressure did not decay half a window later: %+v", r)
+	}
+	clock.Advance(time.Second)
+	r = g.Pressure()
+	if r.Churn != 0 || r.Peers != 0 || r.Score != 0 {
+		t.Fatalf("pressure did not fall back: %+v", r)
+	}
+	if r.Memory < 0.9 {
+		t.Fatalf("a full but quiet cache should still report its memory use: %+v", r)
+	}
+}
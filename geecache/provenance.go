@@ -0,0 +1,80 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 读取结果的来源：排查线上的缓存行为时，需要知道每次读取的值来自本地缓存、远程节点还是回调函数，以及它有多旧。
+// GetWithInfo在读取的同时返回这些信息：命中时由lookupCache记录是mainCache还是hotCache，
+// 加载时loader的结果（loaded）带着来源，等待同一次加载的调用方拿到同样的来源，并标记为Coalesced。
+// 加载在loader的goroutine中进行，记录只在调用方的goroutine中写入，见withoutGetInfo
+
+// ValueSource 说明读取到的值来自哪里
+type ValueSource int
+
+const (
+	SourceUnknown ValueSource = iota // 没有经过Group的读取（例如拦截器直接返回的值）
+	SourceHit                        // 本节点的mainCache
+	SourceHotHit                     // 本节点的hotCache，即之前从所属节点取回的副本
+	SourcePeer                       // 这次从所属节点取回
+	SourceLocal                      // 这次调用回调函数加载
+)
+
+func (s ValueSource) String() string {
+	switch s {
+	case SourceHit:
+		return "hit"
+	case SourceHotHit:
+		return "hot_hit"
+	case SourcePeer:
+		return "peer"
+	case SourceLocal:
+		return "local"
+	}
+	return "unknown"
+}
+
+// loaded 是loader中一次加载的结果，等待同一次加载的调用方拿到同一个loaded
+type loaded struct {
+	view      ByteView
+	source    ValueSource // SourcePeer或SourceLocal
+	peer      string      // source为SourcePeer时是节点的地址
+	coalesced bool        // 由load为每个调用方单独填写
+}
+
+// peerName 返回peer的地址，peer没有实现fmt.Stringer时为空
+func peerName(peer PeerGetter) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return ""
+}
+
+// EntryInfo 是GetWithInfo返回的记录信息
+type EntryInfo struct {
+	GetInfo               // 值的来源
+	Version uint64        // 版本号，见SetIfVersion
+	Expire  time.Time     // 硬过期时间，零值表示永不过期
+	Age     time.Duration // 值在本节点加载之后经过的时间；从远程节点取回的值（SourcePeer、SourceHotHit）不知道，为0
+	TTL     time.Duration // 距硬过期的剩余时间，没有过期时间时为0
+}
+
+// GetWithInfo 与Get相同，同时返回值的版本号、来源、年龄等信息
+func (g *Group) GetWithInfo(ctx context.Context, key string) (ByteView, EntryInfo, error) {
+	info := new(GetInfo)
+	v, err := g.Get(context.WithValue(ctx, getInfoKey{}, info), key)
+	if err != nil {
+		return ByteView{}, EntryInfo{}, err
+	}
+	e := EntryInfo{GetInfo: *info, Version: v.version, Expire: v.expire}
+	now := g.now()
+	if !v.loaded.IsZero() {
+		e.Age = now.Sub(v.loaded)
+	}
+	if !v.expire.IsZero() {
+		e.TTL = v.expire.Sub(now)
+	}
+	return v, e, nil
+}
@@ -0,0 +1,109 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetWithInfoSource(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	g := NewGroup("info-source", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithDefaultTTL(time.Minute))
+	g.now = clock.Now
+
+	_, info, err := g.GetWithInfo(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Source != SourceLocal || info.Hit || info.Coalesced || info.Age != 0 || info.TTL != time.Minute {
+		t.Fatalf("first read info = %+v", info)
+	}
+	clock.Advance(10 * time.Second)
+	if _, info, _ = g.GetWithInfo(ctx, "k"); info.Source != SourceHit || !info.Hit || info.Age != 10*time.Second || info.TTL != 50*time.Second {
+		t.Fatalf("cached read info = %+v", info)
+	}
+}
+
+func TestGetWithInfoCoalesced(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{})
+	g := NewGroup("info-coalesced", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		close(started)
+		<-block
+		return []byte(key), nil
+	}))
+	infos := make([]EntryInfo, 2)
+	var wg sync.WaitGroup
+	for i := range infos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 1 {
+				<-started
+			}
+			_, infos[i], _ = g.GetWithInfo(context.Background(), "k")
+		}(i)
+	}
+	<-started
+	waitFor(t, func() bool { return g.stats.loads.Load() == 2 })
+	time.Sleep(10 * time.Millisecond) // 让第二个读取加入正在进行的加载
+	close(block)
+	wg.Wait()
+	if infos[0].Source != SourceLocal || infos[0].Coalesced {
+		t.Fatalf("initiator info = %+v", infos[0])
+	}
+	if infos[1].Source != SourceLocal || !infos[1].Coalesced {
+		t.Fatalf("joined read info = %+v, want local and coalesced", infos[1])
+	}
+}
+
+func TestGetWithInfoPeer(t *testing.T) {
+	const name = "info-peer"
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, pool := range pools {
+		pool.Set(urls...)
+	}
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); pools[0].peers.Get(k) == urls[1] {
+			key = k
+		}
+	}
+
+	ctx := context.Background()
+	if _, info, err := groups[0].GetWithInfo(ctx, key); err != nil || info.Source != SourcePeer || info.Peer != urls[1] {
+		t.Fatalf("GetWithInfo = %+v, %v, want peer %s", info, err, urls[1])
+	}
+	if _, info, _ := groups[0].GetWithInfo(ctx, key); info.Source != SourceHotHit || info.Peer != "" {
+		t.Fatalf("second GetWithInfo = %+v, want hot hit", info)
+	}
+	// 所属节点上是本地缓存的命中
+	if _, info, _ := groups[1].GetWithInfo(ctx, key); info.Source != SourceHit {
+		t.Fatalf("owner GetWithInfo = %+v, want hit", info)
+	}
+}
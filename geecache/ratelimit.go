@@ -0,0 +1,108 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// 回调函数的速率限制：即使有singleflight和并发上限，冷启动时每秒成千上万个不同的key仍然会打到数据源上。
+// WithLoadRateLimit用令牌桶限制每秒调用回调函数的次数：没有令牌时等待，或者在WithLoadRateFailFast时立即返回ErrThrottled。
+// 等待受加载的期限（WithLoadTimeout）约束，等到期限也拿不到令牌时直接返回ErrThrottled，不白白等待；
+// 调用方的ctx结束时和其他等待一样提前离开，最后一个调用方离开时归还预定的令牌。
+// 只限制本地加载（包括后台刷新），从远程节点读取不受限制；批量加载（BatchGetter）的一次调用消耗一个令牌。
+// 令牌在获取并发空位（见loadlimit.go）之前获取，等待令牌的加载不占用空位
+
+// ErrThrottled 是回调函数的调用速率超过WithLoadRateLimit时返回的错误，远程节点以503返回它
+var ErrThrottled = errors.New("geecache: load rate limit exceeded")
+
+// WithLoadRateLimit 限制每秒调用回调函数的次数为rps，允许burst次的突发，rps小于等于0表示不限制（默认）
+func WithLoadRateLimit(rps float64, burst int) GroupOption {
+	return func(g *Group) {
+		g.loadRate = nil
+		if rps > 0 {
+			g.loadRate = &tokenBucket{rate: rps, burst: float64(max(burst, 1))}
+		}
+	}
+}
+
+// WithLoadRateFailFast 使没有令牌时立即返回ErrThrottled，而不是等待
+func WithLoadRateFailFast() GroupOption {
+	return func(g *Group) {
+		g.loadRateFailFast = true
+	}
+}
+
+// tokenBucket 是令牌桶，令牌数可以为负，表示已经预定了未来的令牌
+type tokenBucket struct {
+	rate   float64 // 每秒补充的令牌数
+	burst  float64 // 桶的容量
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // 上次补充的时间，零值表示桶是满的
+}
+
+// reserve 在now时取一个令牌，返回拿到令牌之前需要等待的时间；需要等待超过maxWait时不取令牌，ok为false
+func (b *tokenBucket) reserve(now time.Time, maxWait time.Duration) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.tokens = b.burst
+	} else if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// cancel 归还reserve取到但没有使用的令牌
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+// throttle 在调用回调函数之前取一个令牌，按需等待
+func (g *Group) throttle(ctx context.Context) error {
+	b := g.loadRate
+	if b == nil {
+		return nil
+	}
+	maxWait := time.Duration(math.MaxInt64)
+	if g.loadRateFailFast {
+		maxWait = 0
+	} else if deadline, ok := ctx.Deadline(); ok {
+		maxWait = time.Until(deadline)
+	}
+	wait, ok := b.reserve(g.now(), maxWait)
+	if !ok {
+		g.stats.loadsThrottled.Add(1)
+		return ErrThrottled
+	}
+	if wait <= 0 {
+		return nil
+	}
+	g.stats.loadsDelayed.Add(1)
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,128 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadRateLimitPacing(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var calls []time.Time
+	g := NewGroup("rate-limit-pacing", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		calls = append(calls, time.Now())
+		mu.Unlock()
+		return []byte(key), nil
+	}), WithLoadRateLimit(50, 5))
+
+	// 25个不同的key同时未命中：5个立即加载，其余20个每20ms一个
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := g.Get(ctx, fmt.Sprintf("k%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("25 loads took %v, want about 400ms", elapsed)
+	}
+	// 除了突发部分，任意时刻前的调用数不超过 burst + rps*t
+	for i, at := range calls {
+		if limit := 5 + 50*at.Sub(start).Seconds() + 1; float64(i+1) > limit {
+			t.Fatalf("call %d at %v exceeds the rate limit", i+1, at.Sub(start))
+		}
+	}
+	s := g.Stats()
+	if s.LoadsDelayed != 20 || s.LoadsThrottled != 0 {
+		t.Fatalf("LoadsDelayed = %d, LoadsThrottled = %d, want 20 and 0", s.LoadsDelayed, s.LoadsThrottled)
+	}
+
+	// 命中不消耗令牌
+	hit := time.Now()
+	for i := 0; i < 25; i++ {
+		g.Get(ctx, fmt.Sprintf("k%d", i))
+	}
+	if d := time.Since(hit); d > 100*time.Millisecond {
+		t.Fatalf("cache hits took %v", d)
+	}
+}
+
+func TestLoadRateLimitDeadline(t *testing.T) {
+	g := NewGroup("rate-limit-deadline", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithLoadRateLimit(1, 1), WithLoadTimeout(50*time.Millisecond))
+	if _, err := g.Get(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	// 下一个令牌在1秒后，在加载的期限内拿不到，立即返回而不是白白等待
+	start := time.Now()
+	if _, err := g.Get(context.Background(), "b"); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("Get(b) = %v, want ErrThrottled", err)
+	}
+	if d := time.Since(start); d > 40*time.Millisecond {
+		t.Fatalf("Get(b) waited %v before giving up", d)
+	}
+	if n := g.Stats().LoadsThrottled; n != 1 {
+		t.Fatalf("LoadsThrottled = %d, want 1", n)
+	}
+}
+
+func TestLoadRateLimitCallerCancel(t *testing.T) {
+	g := NewGroup("rate-limit-cancel", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithLoadRateLimit(20, 1))
+	if _, err := g.Get(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	// 调用方不愿意等待下一个令牌，离开后预定的令牌被归还，下一个调用方最多等待50ms而不是100ms
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.Get(ctx, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get(b) = %v, want DeadlineExceeded", err)
+	}
+	waitFor(t, func() bool {
+		g.loadRate.mu.Lock()
+		defer g.loadRate.mu.Unlock()
+		return g.loadRate.tokens > -0.5
+	})
+	start := time.Now()
+	if _, err := g.Get(context.Background(), "c"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 70*time.Millisecond {
+		t.Fatalf("Get(c) waited %v, the cancelled reservation was not returned", d)
+	}
+}
+
+func TestLoadRateFailFast(t *testing.T) {
+	ctx := context.Background()
+	g := NewGroup("rate-limit-fail-fast", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithLoadRateLimit(1, 2), WithLoadRateFailFast())
+	for _, key := range []string{"a", "b"} {
+		if _, err := g.Get(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := g.Get(ctx, "c"); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("Get(c) = %v, want ErrThrottled", err)
+	}
+	// 已缓存的值不受影响
+	if v, err := g.Get(ctx, "a"); err != nil || v.String() != "a" {
+		t.Fatalf("Get(a) = %q, %v", v.String(), err)
+	}
+	s := g.Stats()
+	if s.LoadsThrottled != 1 || s.LoadsDelayed != 0 {
+		t.Fatalf("LoadsThrottled = %d, LoadsDelayed = %d, want 1 and 0", s.LoadsThrottled, s.LoadsDelayed)
+	}
+}
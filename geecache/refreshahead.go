@@ -0,0 +1,62 @@
+package geecache
+
+import "time"
+
+// 提前刷新（refresh-ahead）：对延迟敏感的key，宁可在后台多加载一次，也不要让请求同步地等待加载。
+// 读取到剩余寿命不足ratio的值时（寿命为从回调函数加载完成到硬过期的时间），Get立即返回当前值，
+// 同时在后台通过loader重新加载，成功后替换缓存并延长过期时间。与软过期（过期后刷新）和XFetch（随机提前）不同，
+// 它确定地在过期之前触发。只有本地加载、带过期时间的值会被提前刷新，同一个key同时只有一个刷新在进行。
+// 刷新失败后同一个key按指数退避（refreshBackoffMin到refreshBackoffMax）再次刷新，不会每次读取都打到数据源
+
+const (
+	refreshBackoffMin  = time.Second
+	refreshBackoffMax  = time.Minute
+	maxRefreshFailures = 4096 // 记录的刷新失败的key数上限，超过时清空重新开始
+)
+
+// refreshFailure 记录一个key连续刷新失败的次数和下一次允许刷新的时间
+type refreshFailure struct {
+	n     int
+	until time.Time
+}
+
+// WithRefreshAhead 开启提前刷新：读取到剩余寿命不足ratio（如0.2）的值时在后台重新加载。ratio取值在(0,1)之间，0表示关闭（默认）
+func WithRefreshAhead(ratio float64) GroupOption {
+	return func(g *Group) {
+		g.refreshAhead = ratio
+	}
+}
+
+// shouldRefreshAhead 判断v的剩余寿命是否已不足refreshAhead
+func (g *Group) shouldRefreshAhead(v ByteView) bool {
+	if g.refreshAhead <= 0 || v.expire.IsZero() || v.loaded.IsZero() {
+		return false
+	}
+	lifetime := v.expire.Sub(v.loaded)
+	return v.expire.Sub(g.now()) < time.Duration(float64(lifetime)*g.refreshAhead)
+}
+
+// refreshBackedOff 判断key是否在刷新失败后的退避期内，调用时持有refreshMu
+func (g *Group) refreshBackedOff(key string) bool {
+	f, ok := g.refreshFailures[key]
+	return ok && g.now().Before(f.until)
+}
+
+// recordRefresh 记录一次刷新的结果，失败时把下一次刷新推迟到退避期之后，调用时持有refreshMu
+func (g *Group) recordRefresh(key string, err error) {
+	if err == nil {
+		delete(g.refreshFailures, key)
+		return
+	}
+	if g.refreshFailures == nil || len(g.refreshFailures) >= maxRefreshFailures {
+		g.refreshFailures = make(map[string]refreshFailure)
+	}
+	f := g.refreshFailures[key]
+	f.n++
+	backoff := refreshBackoffMax
+	if f.n <= 6 {
+		backoff = min(refreshBackoffMin<<(f.n-1), refreshBackoffMax)
+	}
+	f.until = g.now().Add(backoff)
+	g.refreshFailures[key] = f
+}
@@ -0,0 +1,101 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	silenceLog(t)
+	clock := newFakeClock()
+	var mu sync.Mutex
+	loads := 0
+	var fail error
+	g := NewGroup("refresh-ahead", 0, GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads++
+		if fail != nil {
+			return nil, fail
+		}
+		return []byte(fmt.Sprintf("v%d", loads)), nil
+	}), WithDefaultTTL(100*time.Second), WithRefreshAhead(0.2), WithUnlimitedBytes())
+	g.now = clock.Now
+	get := func() string {
+		v, err := g.Get(context.Background(), "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.refreshes.Wait()
+		return v.String()
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return loads
+	}
+
+	get()
+	clock.Advance(70 * time.Second)
+	if v := get(); v != "v1" || count() != 1 {
+		t.Fatalf("refreshed too early: got %s, loads=%d", v, count())
+	}
+
+	// 剩余寿命不足20%：立即返回旧值，后台刷新一次并延长过期时间
+	clock.Advance(15 * time.Second)
+	if v := get(); v != "v1" {
+		t.Fatalf("refresh-ahead read got %s, want cached v1", v)
+	}
+	if v := get(); v != "v2" || count() != 2 {
+		t.Fatalf("after refresh: got %s, loads=%d", v, count())
+	}
+	clock.Advance(50 * time.Second) // 超过了原来的过期时间
+	if v := get(); v != "v2" || count() != 2 {
+		t.Fatalf("refreshed value expired early: got %s, loads=%d", v, count())
+	}
+
+	// 刷新失败：继续返回旧值，退避期内不再刷新
+	mu.Lock()
+	fail = errors.New("backend down")
+	mu.Unlock()
+	clock.Advance(35 * time.Second)
+	for i := 0; i < 5; i++ {
+		if v := get(); v != "v2" {
+			t.Fatalf("read during failing refresh got %s, want v2", v)
+		}
+	}
+	if n := count(); n != 3 {
+		t.Fatalf("loads = %d during backoff, want 3", n)
+	}
+	clock.Advance(refreshBackoffMin)
+	get()
+	if n := count(); n != 4 {
+		t.Fatalf("loads = %d after backoff, want 4", n)
+	}
+	clock.Advance(refreshBackoffMin) // 第二次失败后退避2s
+	get()
+	if n := count(); n != 4 {
+		t.Fatalf("loads = %d, want exponential backoff", n)
+	}
+}
+
+func TestRefreshAheadOffByDefault(t *testing.T) {
+	clock := newFakeClock()
+	loads := 0
+	g := NewGroup("refresh-ahead-off", 0, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}), WithDefaultTTL(10*time.Second), WithUnlimitedBytes())
+	g.now = clock.Now
+	g.Get(context.Background(), "k")
+	clock.Advance(9900 * time.Millisecond)
+	g.Get(context.Background(), "k")
+	g.refreshes.Wait()
+	if loads != 1 {
+		t.Fatalf("loads = %d, want no refresh-ahead by default", loads)
+	}
+}
@@ -0,0 +1,356 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"geecache/geecache"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 把一个完整的缓存节点（group、HTTPPool、节点服务、API服务、关闭流程）封装为Server，
+// 应用可以直接把缓存节点嵌入到自己的程序中，而不需要依赖本仓库的main
+
+const shutdownTimeout = 5 * time.Second
+
+// HeaderPressure 是API响应中携带group负载得分的响应头
+const HeaderPressure = "X-Geecache-Pressure"
+
+// 开启DebugHeaders时API响应中描述值的来源的响应头，见geecache.Group.GetWithInfo
+const (
+	HeaderSource    = "X-Geecache-Source"    // hit、hot_hit、peer或local
+	HeaderPeer      = "X-Geecache-Peer"      // 来源为peer时是所属节点的地址
+	HeaderAge       = "X-Geecache-Age"       // 值在本节点加载之后经过的时间，如"1.5s"，不知道时不设置
+	HeaderCoalesced = "X-Geecache-Coalesced" // 这次读取等待了其他请求发起的加载时为"1"
+)
+
+// Config 描述一个缓存节点
+type Config struct {
+	Self    string        // 本节点对其他节点提供服务的地址，如"http://localhost:8001"
+	Peers   []string      // 集群中所有节点的地址（包含自己）
+	APIAddr string        // 面向用户的API服务地址，如"http://localhost:9999"，为空时不启动API服务
+	Groups  []GroupConfig // 本节点提供的缓存空间
+
+	// Middleware 依次包裹节点服务和API服务的处理器，先注册的在最外层，可用于日志、鉴权等
+	Middleware []func(http.Handler) http.Handler
+	// PoolOptions 创建HTTPPool时使用的配置
+	PoolOptions []geecache.PoolOption
+	// Logger 是服务、HTTPPool和各group输出日志使用的Logger，为nil时使用geecache的默认值
+	Logger geecache.Logger
+	// PressureHeader 为true时API响应带上X-Geecache-Pressure头，值为group的负载得分（0~1），见geecache.Group.Pressure
+	PressureHeader bool
+	// DebugHeaders 为true时API读取的响应带上X-Geecache-Source等头，说明值来自本地缓存、远程节点还是回调函数
+	DebugHeaders bool
+
+	// Listener/APIListener 不为nil时直接在其上提供服务而不再监听Self/APIAddr，便于使用进程内监听
+	Listener    net.Listener
+	APIListener net.Listener
+}
+
+// GroupConfig 描述一个缓存空间，Getter为缓存未命中时获取源数据的回调
+type GroupConfig struct {
+	Name       string
+	CacheBytes int64 // 0表示不缓存，不能为负数
+	Getter     geecache.Getter
+}
+
+type Server struct {
+	cfg  Config
+	pool *geecache.HTTPPool
+
+	mu     sync.RWMutex
+	groups map[string]*geecache.Group
+}
+
+// New 校验配置，创建并注册所有group，但不开始监听，调用Run后才对外提供服务
+// group注册在geecache的全局表中，同名group会覆盖之前创建的group
+func New(cfg Config) (*Server, error) {
+	if cfg.Self == "" {
+		return nil, errors.New("server: Self is required")
+	}
+	if len(cfg.Groups) == 0 {
+		return nil, errors.New("server: at least one group is required")
+	}
+	if err := validateGroups(cfg.Groups); err != nil {
+		return nil, err
+	}
+	peers := cfg.Peers
+	if len(peers) == 0 {
+		peers = []string{cfg.Self}
+	}
+
+	poolOpts := cfg.PoolOptions
+	if cfg.Logger != nil {
+		poolOpts = append([]geecache.PoolOption{geecache.WithPoolLogger(cfg.Logger)}, poolOpts...)
+	}
+	s := &Server{
+		cfg:    cfg,
+		pool:   geecache.NewHTTPPool(cfg.Self, poolOpts...),
+		groups: make(map[string]*geecache.Group, len(cfg.Groups)),
+	}
+	s.pool.Set(peers...)
+	for _, gc := range cfg.Groups {
+		s.addGroup(gc)
+	}
+	return s, nil
+}
+
+func validateGroups(groups []GroupConfig) error {
+	seen := make(map[string]bool, len(groups))
+	for _, gc := range groups {
+		if gc.Name == "" {
+			return errors.New("server: group name is required")
+		}
+		if gc.Getter == nil {
+			return fmt.Errorf("server: group %q has no Getter", gc.Name)
+		}
+		if gc.CacheBytes < 0 {
+			return fmt.Errorf("server: group %q has negative CacheBytes", gc.Name)
+		}
+		if seen[gc.Name] {
+			return fmt.Errorf("server: duplicate group %q", gc.Name)
+		}
+		seen[gc.Name] = true
+	}
+	return nil
+}
+
+func (s *Server) addGroup(gc GroupConfig) {
+	var opts []geecache.GroupOption
+	if s.cfg.Logger != nil {
+		opts = append(opts, geecache.WithLogger(s.cfg.Logger))
+	}
+	g := geecache.NewGroup(gc.Name, gc.CacheBytes, gc.Getter, opts...)
+	g.RegisterPeers(s.pool)
+	s.groups[gc.Name] = g
+}
+
+// Group 返回本节点上指定名称的group，不存在时返回nil
+func (s *Server) Group(name string) *geecache.Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups[name]
+}
+
+// Pool 返回本节点的HTTPPool
+func (s *Server) Pool() *geecache.HTTPPool {
+	return s.pool
+}
+
+// Reload 在不丢失缓存的前提下应用新的配置：更新节点列表，调整已有group的缓存上限，创建新增的group
+// Self、监听地址和中间件不能在运行时修改，配置中去掉的group会继续保留
+func (s *Server) Reload(cfg Config) error {
+	if err := validateGroups(cfg.Groups); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(cfg.Peers) > 0 {
+		s.pool.Set(cfg.Peers...)
+	}
+	for _, gc := range cfg.Groups {
+		if g, ok := s.groups[gc.Name]; ok {
+			g.SetCacheBytes(gc.CacheBytes)
+			continue
+		}
+		s.addGroup(gc)
+	}
+	return nil
+}
+
+// Handler 返回节点间通信使用的处理器（已经包裹了中间件）
+func (s *Server) Handler() http.Handler {
+	return s.wrap(s.pool)
+}
+
+// APIHandler 返回面向用户的处理器（已经包裹了中间件）
+// 请求格式为/api?group=<groupname>&key=<key>，只有一个group时可以省略group参数；
+// POST请求把请求体作为key的值写入缓存（geecache.Group.Set），成功时返回204
+// /healthz 以JSON返回节点状态，有group处于维护模式时status为"maintenance"
+func (s *Server) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", s.serveAPI)
+	mux.HandleFunc("/healthz", s.serveHealth)
+	return s.wrap(mux)
+}
+
+// Health 是/healthz的响应
+type Health struct {
+	Status string                               `json:"status"`
+	Groups map[string]geecache.MaintenanceState `json:"groups"`
+}
+
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	h := Health{Status: "ok", Groups: make(map[string]geecache.MaintenanceState)}
+	s.mu.RLock()
+	for name, g := range s.groups {
+		m := g.Maintenance()
+		if m.Active {
+			h.Status = "maintenance"
+		}
+		h.Groups[name] = m
+	}
+	s.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
+
+func (s *Server) wrap(h http.Handler) http.Handler {
+	for i := len(s.cfg.Middleware) - 1; i >= 0; i-- {
+		h = s.cfg.Middleware[i](h)
+	}
+	return h
+}
+
+// apiGroup 返回API请求的group，没有group参数且本节点只有一个group时使用这个group。
+// 按当前的groups判断，Reload新增group之后group参数不再可以省略
+func (s *Server) apiGroup(name string) *geecache.Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if name == "" && len(s.groups) == 1 {
+		for _, g := range s.groups {
+			return g
+		}
+	}
+	return s.groups[name]
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("group")
+	g := s.apiGroup(name)
+	if g == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+	if s.cfg.PressureHeader {
+		w.Header().Set(HeaderPressure, strconv.FormatFloat(g.Pressure().Score, 'f', 3, 64))
+	}
+	if r.Method == http.MethodPost {
+		s.serveSet(w, r, g)
+		return
+	}
+	view, info, err := g.GetWithInfo(r.Context(), r.URL.Query().Get("key"))
+	if errors.Is(err, geecache.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if s.cfg.DebugHeaders {
+		setDebugHeaders(w.Header(), info)
+	}
+	if exp := view.Expire(); !exp.IsZero() {
+		maxAge := int(time.Until(exp) / time.Second)
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
+		w.Header().Set("Expires", exp.UTC().Format(http.TimeFormat))
+	}
+	view.WriteTo(w)
+}
+
+// serveSet 处理/api的POST请求
+func (s *Server) serveSet(w http.ResponseWriter, r *http.Request, g *geecache.Group) {
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := g.Set(r.URL.Query().Get("key"), value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Run 启动节点服务（以及配置了的API服务），阻塞直到ctx结束或服务出错
+// ctx结束时优雅关闭所有服务并返回nil
+func (s *Server) Run(ctx context.Context) error {
+	servers := []*http.Server{{Handler: s.Handler()}}
+	listeners := []net.Listener{s.cfg.Listener}
+	addrs := []string{s.cfg.Self}
+	if s.cfg.APIAddr != "" || s.cfg.APIListener != nil {
+		servers = append(servers, &http.Server{Handler: s.APIHandler()})
+		listeners = append(listeners, s.cfg.APIListener)
+		addrs = append(addrs, s.cfg.APIAddr)
+	}
+
+	for i := range listeners {
+		if listeners[i] != nil {
+			continue
+		}
+		ln, err := listen(addrs[i])
+		if err != nil {
+			for _, l := range listeners[:i] {
+				l.Close()
+			}
+			return err
+		}
+		listeners[i] = ln
+	}
+
+	errc := make(chan error, len(servers))
+	for i, srv := range servers {
+		s.logger().Infof("geecache is running at %s", listeners[i].Addr())
+		go func(srv *http.Server, ln net.Listener) {
+			errc <- srv.Serve(ln)
+		}(srv, listeners[i])
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		srv.Shutdown(shutdownCtx)
+	}
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
+
+// listen 监听addr中的主机和端口，addr形如"http://localhost:8001"
+func listen(addr string) (net.Listener, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("server: bad address %q: %v", addr, err)
+	}
+	return net.Listen("tcp", u.Host)
+}
+
+// logger 返回服务输出日志使用的Logger
+func (s *Server) logger() geecache.Logger {
+	if s.cfg.Logger != nil {
+		return s.cfg.Logger
+	}
+	return geecache.StdLogger(false)
+}
+
+// setDebugHeaders 把值的来源写入响应头
+func setDebugHeaders(h http.Header, info geecache.EntryInfo) {
+	h.Set(HeaderSource, info.Source.String())
+	if info.Peer != "" {
+		h.Set(HeaderPeer, info.Peer)
+	}
+	if info.Age > 0 {
+		h.Set(HeaderAge, info.Age.String())
+	}
+	if info.Coalesced {
+		h.Set(HeaderCoalesced, "1")
+	}
+}
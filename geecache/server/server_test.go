@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"geecache/geecache"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+}
+
+func slowDB(loads *int) geecache.Getter {
+	return geecache.GetterFunc(func(key string) ([]byte, error) {
+		*loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	})
+}
+
+func listenLocal(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestNewValidation(t *testing.T) {
+	getter := slowDB(new(int))
+	cases := map[string]Config{
+		"no self":   {Groups: []GroupConfig{{Name: "a", Getter: getter}}},
+		"no groups": {Self: "http://127.0.0.1:1"},
+		"no getter": {Self: "http://127.0.0.1:1", Groups: []GroupConfig{{Name: "a"}}},
+		"no name":   {Self: "http://127.0.0.1:1", Groups: []GroupConfig{{Getter: getter}}},
+		"duplicate": {Self: "http://127.0.0.1:1", Groups: []GroupConfig{{Name: "a", Getter: getter}, {Name: "a", Getter: getter}}},
+	}
+	for name, cfg := range cases {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	ln, apiLn := listenLocal(t), listenLocal(t)
+	self := "http://" + ln.Addr().String()
+	var loads int
+	var wrapped int
+	s, err := New(Config{
+		Self:        self,
+		Groups:      []GroupConfig{{Name: "server-lifecycle", CacheBytes: 2 << 10, Getter: slowDB(&loads)}},
+		Listener:    ln,
+		APIListener: apiLn,
+		Middleware: []func(http.Handler) http.Handler{func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				wrapped++
+				next.ServeHTTP(w, r)
+			})
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	// serve：API服务和节点服务都可以访问，第二次访问命中缓存
+	api := "http://" + apiLn.Addr().String()
+	for i := 0; i < 2; i++ {
+		if code, body := get(t, api+"/api?key=Tom"); code != http.StatusOK || body != "630" {
+			t.Fatalf("api returned %d %q", code, body)
+		}
+	}
+	if code, body := get(t, self+"/_geecache/server-lifecycle/Jack"); code != http.StatusOK || body != "589" {
+		t.Fatalf("peer endpoint returned %d %q", code, body)
+	}
+	if code, _ := get(t, api+"/api?group=unknown&key=Tom"); code != http.StatusNotFound {
+		t.Fatalf("unknown group returned %d", code)
+	}
+	if loads != 2 {
+		t.Fatalf("getter called %d times, expect 2", loads)
+	}
+	if wrapped != 4 {
+		t.Fatalf("middleware saw %d requests, expect 4", wrapped)
+	}
+
+	// reload：调整缓存上限并新增group，已有缓存不丢失
+	err = s.Reload(Config{
+		Peers: []string{self},
+		Groups: []GroupConfig{
+			{Name: "server-lifecycle", CacheBytes: 4 << 10, Getter: slowDB(&loads)},
+			{Name: "server-lifecycle-2", CacheBytes: 2 << 10, Getter: slowDB(&loads)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Group("server-lifecycle-2") == nil {
+		t.Fatal("reload should add new group")
+	}
+	if code, body := get(t, api+"/api?group=server-lifecycle&key=Tom"); code != http.StatusOK || body != "630" || loads != 2 {
+		t.Fatalf("after reload got %d %q with %d loads", code, body, loads)
+	}
+	if code, _ := get(t, api+"/api?key=Tom"); code != http.StatusNotFound {
+		t.Fatalf("missing group with two groups returned %d", code)
+	}
+
+	// shutdown
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if _, err := http.Get(api + "/api?key=Tom"); err == nil {
+		t.Fatal("api server still serving after shutdown")
+	}
+}
+
+func TestPressureHeader(t *testing.T) {
+	s, err := New(Config{
+		Self:           "http://127.0.0.1:1",
+		Groups:         []GroupConfig{{Name: "pressure-header", CacheBytes: 1 << 10, Getter: slowDB(new(int))}},
+		PressureHeader: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.APIHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/api?key=Tom", nil))
+	if got := rec.Header().Get(HeaderPressure); got != "0.000" {
+		t.Fatalf("%s = %q, expect 0.000", HeaderPressure, got)
+	}
+}
+
+func TestDebugHeaders(t *testing.T) {
+	s, err := New(Config{
+		Self:         "http://127.0.0.1:1",
+		Groups:       []GroupConfig{{Name: "debug-headers", CacheBytes: 1 << 10, Getter: slowDB(new(int))}},
+		DebugHeaders: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"local", "hit"} {
+		rec := httptest.NewRecorder()
+		s.APIHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/api?key=Tom", nil))
+		if got := rec.Header().Get(HeaderSource); got != want {
+			t.Fatalf("%s = %q, expect %q", HeaderSource, got, want)
+		}
+		if rec.Header().Get(HeaderPeer) != "" || rec.Header().Get(HeaderCoalesced) != "" {
+			t.Fatalf("unexpected debug headers %v", rec.Header())
+		}
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	s, err := New(Config{
+		Self:   "http://127.0.0.1:1",
+		Groups: []GroupConfig{{Name: "healthz", CacheBytes: 1 << 10, Getter: slowDB(new(int))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	health := func() Health {
+		rec := httptest.NewRecorder()
+		s.APIHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		var h Health
+		if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	if h := health(); h.Status != "ok" || h.Groups["healthz"].Active {
+		t.Fatalf("healthz = %+v", h)
+	}
+	s.Group("healthz").EnterMaintenance(time.Minute)
+	if h := health(); h.Status != "maintenance" || !h.Groups["healthz"].Active {
+		t.Fatalf("healthz during maintenance = %+v", h)
+	}
+	s.Group("healthz").ExitMaintenance()
+}
+
+// expiringDB 返回带过期时间的值
+type expiringDB time.Duration
+
+func (d expiringDB) Get(_ context.Context, key string) ([]byte, error) { return []byte(key), nil }
+
+func (d expiringDB) GetWithExpiry(_ context.Context, key string) ([]byte, geecache.Expiry, error) {
+	return []byte(key), geecache.Expiry{Hard: time.Duration(d)}, nil
+}
+
+func TestAPIExpiryHeaders(t *testing.T) {
+	s, err := New(Config{
+		Self: "http://127.0.0.1:1",
+		Groups: []GroupConfig{
+			{Name: "api-expiry", CacheBytes: 1 << 10, Getter: expiringDB(time.Hour)},
+			{Name: "api-no-expiry", CacheBytes: 1 << 10, Getter: slowDB(new(int))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.APIHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/api?group=api-expiry&key=k", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != "max-age=3599" && cc != "max-age=3600" {
+		t.Fatalf("Cache-Control = %q", cc)
+	}
+	if exp, err := http.ParseTime(rec.Header().Get("Expires")); err != nil || time.Until(exp) < 59*time.Minute {
+		t.Fatalf("Expires = %q", rec.Header().Get("Expires"))
+	}
+
+	rec = httptest.NewRecorder()
+	s.APIHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/api?group=api-no-expiry&key=Tom", nil))
+	if rec.Header().Get("Cache-Control") != "" || rec.Header().Get("Expires") != "" {
+		t.Fatalf("expiry headers on a value without expiry: %v", rec.Header())
+	}
+}
+
+func TestAPISet(t *testing.T) {
+	loads := 0
+	s, err := New(Config{
+		Self:   "http://127.0.0.1:1",
+		Groups: []GroupConfig{{Name: "api-set", CacheBytes: 1 << 10, Getter: slowDB(&loads)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.APIHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/api?key=Sam", strings.NewReader("999")))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("POST /api = %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	s.APIHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/api?key=Sam", nil))
+	if rec.Body.String() != "999" || loads != 0 {
+		t.Fatalf("GET after POST = %q (%d loads)", rec.Body, loads)
+	}
+	rec = httptest.NewRecorder()
+	s.APIHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/api", strings.NewReader("x")))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("POST without a key = %d", rec.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package geecache
+
+import (
+	"fmt"
+)
+
+// 主动写入：应用预先算好的值可以通过Set推入缓存，第一个读取者不必再访问数据源。
+// key由其他节点负责时转发给那个节点（PeerSetter），写入成功后也放进本节点的hotCache；否则写入mainCache。
+// 与加载的冲突：加载开始（调用回调函数或请求远程节点）之后完成的Set优先。加载结束写回缓存时，
+// 如果key在这期间已经被写入了更新的值，加载的结果被丢弃，发起加载的调用方和所有等待同一次加载的调用方得到的都是Set写入的值。
+// 加载开始之前完成的Set不受保护，不过那时Get会直接命中缓存，不会开始加载；
+// Set写入的记录在加载结束之前已经被淘汰时，加载的结果照常写入。Set之后的读取不会加入之前开始的加载，而是直接读到Set的值或者重新加载
+
+// Set 把value写入key所在节点的本地缓存，value会被拷贝。维护期间写入排队到退出维护模式时执行，
+// 届时转发失败只记录日志
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	key = g.cacheKey(key)
+	v := ByteView{b: cloneBytes(value)}
+	var err error
+	queued, qerr := g.mutate(func() {
+		if err = g.set(key, v, nil); err != nil {
+			g.logger().Errorf("Failed to set %q: %v", key, err)
+		}
+	})
+	if qerr != nil || queued {
+		return qerr
+	}
+	return err
+}
+
+// set 写入key，ifVersion不为nil时只在版本号等于*ifVersion时写入，见version.go
+func (g *Group) set(key string, value ByteView, ifVersion *uint64) error {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			version, err := g.setOnPeer(peer, key, value, ifVersion)
+			if err == ErrVersionMismatch {
+				// 本节点hotCache中的副本已经过时，下一次读取从所属节点取回最新的值和版本号
+				g.hotCache.remove(key)
+			}
+			if err != nil {
+				return err
+			}
+			// 同时更新本节点的hotCache，正在进行的远程读取不会再写回旧值
+			value.version = version
+			g.hotCache.add(key, value)
+			g.forgetLoads(key)
+			g.trimCaches()
+			return nil
+		}
+	}
+	_, err := g.setLocal(key, value, ifVersion)
+	return err
+}
+
+// setLocally 把其他节点转发来的值写入本地缓存，不再转发，返回写入后的版本号；value归本地缓存所有，调用方不能再修改。
+// ifVersion不为nil时比较版本号，维护期间无法比较，返回ErrMaintenance
+func (g *Group) setLocally(key string, value []byte, ifVersion *uint64) (uint64, error) {
+	if key == "" {
+		return 0, fmt.Errorf("key is required")
+	}
+	if ifVersion != nil {
+		if g.maint.active.Load() {
+			return 0, ErrMaintenance
+		}
+		return g.setLocal(key, ByteView{b: value}, ifVersion)
+	}
+	var version uint64
+	_, err := g.mutate(func() {
+		version, _ = g.setLocal(key, ByteView{b: value}, nil)
+	})
+	return version, err
+}
@@ -0,0 +1,125 @@
+package geecache
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroup("set", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte("db"), nil
+	}))
+	value := []byte("pushed")
+	if err := g.Set("k", value); err != nil {
+		t.Fatal(err)
+	}
+	value[0] = 'X' // Set拷贝了value
+	if v, err := g.Get(context.Background(), "k"); err != nil || v.String() != "pushed" || loads.Load() != 0 {
+		t.Fatalf("Get after Set = %q, %v (%d loads)", v, err, loads.Load())
+	}
+	if err := g.Set("", value); err == nil {
+		t.Fatal("Set with an empty key succeeded")
+	}
+
+	// 维护期间排队，退出时写入
+	g.EnterMaintenance(time.Minute)
+	if err := g.Set("k", []byte("later")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get(context.Background(), "k"); v.String() != "pushed" {
+		t.Fatalf("Set applied during maintenance: %q", v)
+	}
+	g.ExitMaintenance()
+	if v, _ := g.Get(context.Background(), "k"); v.String() != "later" {
+		t.Fatalf("queued Set not replayed: %q", v)
+	}
+}
+
+// 加载期间完成的Set优先，发起加载的调用方和等待同一次加载的调用方都得到Set的值
+func TestSetDuringLoad(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup("set-during-load", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("stale"), nil
+	}))
+
+	results := make([]string, 2)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var v ByteView
+		if err := g.GetTo(context.Background(), "k", ByteViewSink(&v)); err != nil {
+			t.Error(err)
+		}
+		results[0] = v.String()
+	}()
+	<-started
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var s string
+		if err := g.GetTo(context.Background(), "k", StringSink(&s)); err != nil {
+			t.Error(err)
+		}
+		results[1] = s
+	}()
+	time.Sleep(10 * time.Millisecond) // 第二个调用方进入等待
+	if err := g.Set("k", []byte("fresh")); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	wg.Wait()
+
+	for i, r := range results {
+		if r != "fresh" {
+			t.Fatalf("caller %d got %q, want the value from Set", i, r)
+		}
+	}
+	if v, _ := g.Get(context.Background(), "k"); v.String() != "fresh" {
+		t.Fatalf("stale load overwrote Set: %q", v)
+	}
+}
+
+func TestSetForwardsToOwner(t *testing.T) {
+	silenceLog(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("db"), nil })
+
+	// 远程节点b负责所有key
+	poolB := NewHTTPPool("b")
+	b := NewGroup("set-forward", 1<<10, getter)
+	b.RegisterPeers(poolB)
+	srv := httptest.NewServer(poolB)
+	defer srv.Close()
+
+	poolA := NewHTTPPool("a")
+	poolA.Set(srv.URL)
+	a := NewGroup("set-forward", 1<<10, getter)
+	a.RegisterPeers(poolA)
+
+	if err := a.Set("k", []byte("pushed")); err != nil {
+		t.Fatal(err)
+	}
+	if !b.CachedLocally("k") || a.CachedLocally("k") {
+		t.Fatal("Set was not forwarded to the owner")
+	}
+	if v, _ := b.Get(context.Background(), "k"); v.String() != "pushed" {
+		t.Fatalf("owner has %q", v)
+	}
+	if v, _ := a.Get(context.Background(), "k"); v.String() != "pushed" {
+		t.Fatalf("Get on the forwarding node = %q", v)
+	}
+
+	srv.Close()
+	if err := a.Set("k", []byte("lost")); err == nil {
+		t.Fatal("Set to an unreachable owner succeeded")
+	}
+}
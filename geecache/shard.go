@@ -0,0 +1,281 @@
+package geecache
+
+import (
+	"fmt"
+	"geecache/geecache/lru"
+)
+
+// 分片：整个本地缓存只有一把锁时，多核机器上并发的Get和写入全部串行在这把锁上。
+// 开启分片后缓存按key的哈希分成N个互不相干的cache，各有自己的锁、淘汰策略和cacheBytes/N（向上取整）的上限，
+// 淘汰只在分片内部进行，因此大于一个分片上限的值不会被缓存，即使它小于整个cacheBytes。
+// 统计、清空和按前缀删除依次作用于每个分片；OnEvicted只保证同一分片内按淘汰顺序调用
+
+// shardedCache 是group的本地缓存。嵌入的cache保存选项设置的配置，只有一个分片（默认）时它就是唯一的分片
+type shardedCache struct {
+	cache
+	n      int // 分片数，0表示1，见WithShards
+	shards []*cache
+	mask   uint32
+}
+
+// WithShards 把本地缓存分成n个分片以减少锁竞争，n必须是2的幂，默认为1（不分片）
+// 每个分片的上限为cacheBytes/n，单个值大于这个上限时不会被缓存
+func WithShards(n int) GroupOption {
+	if n < 1 || n&(n-1) != 0 {
+		panic(fmt.Sprintf("geecache: shard count %d is not a power of two", n))
+	}
+	return func(g *Group) {
+		g.mainCache.n = n
+	}
+}
+
+// init 按配置创建分片，在所有选项生效之后调用
+func (s *shardedCache) init() {
+	if s.n <= 1 {
+		s.shards = []*cache{&s.cache}
+		return
+	}
+	s.shards = make([]*cache, s.n)
+	s.mask = uint32(s.n - 1)
+	for i := range s.shards {
+		s.shards[i] = &cache{
+			cacheBytes:      s.shardBytes(s.cacheBytes),
+			unlimited:       s.unlimited,
+			now:             s.now,
+			policy:          s.policy,
+			admission:       s.admission,
+			onEvicted:       s.onEvicted,
+			lowWater:        s.lowWater,
+			maxEntries:      (s.maxEntries + s.n - 1) / s.n,
+			cleanup:         s.cleanup,
+			prefixThreshold: s.prefixThreshold,
+			maxValue:        s.maxValue,
+		}
+	}
+}
+
+// shardBytes 返回每个分片的上限，向上取整，保证cacheBytes大于0时每个分片都能缓存
+func (s *shardedCache) shardBytes(cacheBytes int64) int64 {
+	n := int64(len(s.shards))
+	if n == 0 {
+		n = int64(s.n)
+	}
+	return (cacheBytes + n - 1) / n
+}
+
+// shardFor 返回key所在的分片
+func (s *shardedCache) shardFor(key string) *cache {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h&s.mask]
+}
+
+func (s *shardedCache) add(key string, value ByteView) {
+	s.shardFor(key).add(key, value)
+}
+
+// version 返回key所在分片的写入计数
+func (s *shardedCache) version(key string) uint64 {
+	return s.shardFor(key).version()
+}
+
+func (s *shardedCache) addLoaded(key string, value ByteView, since uint64) (ByteView, bool) {
+	return s.shardFor(key).addLoaded(key, value, since)
+}
+
+// addAll 按分片分组后在每个分片上一次写入
+func (s *shardedCache) addAll(keys []string, values []ByteView) {
+	if len(s.shards) == 1 {
+		s.shards[0].addAll(keys, values)
+		return
+	}
+	byShard := make(map[*cache][]int)
+	for i, key := range keys {
+		c := s.shardFor(key)
+		byShard[c] = append(byShard[c], i)
+	}
+	for c, idx := range byShard {
+		ks := make([]string, len(idx))
+		vs := make([]ByteView, len(idx))
+		for j, i := range idx {
+			ks[j], vs[j] = keys[i], values[i]
+		}
+		c.addAll(ks, vs)
+	}
+}
+
+func (s *shardedCache) remove(key string) {
+	s.shardFor(key).remove(key)
+}
+
+func (s *shardedCache) get(key string) (ByteView, bool) {
+	return s.shardFor(key).get(key)
+}
+
+func (s *shardedCache) peek(key string) (ByteView, bool) {
+	return s.shardFor(key).peek(key)
+}
+
+// valueLimit 返回key所在分片的单个值上限
+func (s *shardedCache) valueLimit(key string) int64 {
+	return s.shardFor(key).valueLimit()
+}
+
+func (s *shardedCache) rejectOversize(key string) {
+	s.shardFor(key).rejectOversize()
+}
+
+func (s *shardedCache) contains(key string) bool {
+	return s.shardFor(key).contains(key)
+}
+
+func (s *shardedCache) pin(key string) bool {
+	return s.shardFor(key).pin(key)
+}
+
+func (s *shardedCache) unpin(key string) {
+	s.shardFor(key).unpin(key)
+}
+
+func (s *shardedCache) isDisabled() bool {
+	return s.shards[0].isDisabled()
+}
+
+// lruStats 汇总所有分片的占用和淘汰统计，OldestAdded取各分片中最早的
+func (s *shardedCache) lruStats() lru.Stats {
+	var total lru.Stats
+	for _, c := range s.shards {
+		st := c.lruStats()
+		total.Len += st.Len
+		total.Bytes += st.Bytes
+		total.MaxBytes += st.MaxBytes
+		total.Evictions += st.Evictions
+		total.Expired += st.Expired
+		if !st.OldestAdded.IsZero() && (total.OldestAdded.IsZero() || st.OldestAdded.Before(total.OldestAdded)) {
+			total.OldestAdded = st.OldestAdded
+		}
+	}
+	return total
+}
+
+// stats 汇总所有分片的计数器
+func (s *shardedCache) stats() CacheStats {
+	var total CacheStats
+	for _, c := range s.shards {
+		st := c.stats()
+		total.Bytes += st.Bytes
+		total.Items += st.Items
+		total.Gets += st.Gets
+		total.Hits += st.Hits
+		total.Misses += st.Misses
+		total.Adds += st.Adds
+		total.Evictions += st.Evictions
+		total.Oversize += st.Oversize
+	}
+	return total
+}
+
+// pressure 返回各分片内存占用和淘汰速率的平均值，分片的上限相同
+func (s *shardedCache) pressure() (memory, churn float64) {
+	for _, c := range s.shards {
+		m, ch := c.pressure()
+		memory += m
+		churn += ch
+	}
+	n := float64(len(s.shards))
+	return memory / n, churn / n
+}
+
+// resize 修改整个缓存的上限，平分到每个分片
+func (s *shardedCache) resize(cacheBytes int64) {
+	if len(s.shards) == 1 {
+		s.shards[0].resize(cacheBytes)
+		return
+	}
+	s.cache.mu.Lock()
+	s.cacheBytes = cacheBytes
+	s.unlimited = false
+	s.cache.mu.Unlock()
+	for _, c := range s.shards {
+		c.resize(s.shardBytes(cacheBytes))
+	}
+}
+
+// bytes 返回所有分片占用的字节数之和
+func (s *shardedCache) bytes() int64 {
+	var n int64
+	for _, c := range s.shards {
+		n += c.bytes()
+	}
+	return n
+}
+
+// items 返回所有分片的记录数之和
+func (s *shardedCache) items() int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.items()
+	}
+	return n
+}
+
+// maxBytes 返回整个缓存配置的上限，由嵌入的cache保存
+func (s *shardedCache) maxBytes() int64 {
+	return s.cache.maxBytes()
+}
+
+// removeOldest 在占用最多的分片上淘汰一条记录
+func (s *shardedCache) removeOldest() {
+	victim, most := s.shards[0], int64(-1)
+	for _, c := range s.shards {
+		if n := c.bytes(); n > most {
+			victim, most = c, n
+		}
+	}
+	victim.removeOldest()
+}
+
+func (s *shardedCache) clear() {
+	for _, c := range s.shards {
+		c.clear()
+	}
+}
+
+// keys 依次返回每个分片的键，分片内按从最近使用到最久未使用的顺序
+func (s *shardedCache) keys() []string {
+	var keys []string
+	for _, c := range s.shards {
+		keys = append(keys, c.keys()...)
+	}
+	return keys
+}
+
+// rangeEntries 依次遍历每个分片，f返回false时停止
+func (s *shardedCache) rangeEntries(f func(key string, value ByteView) bool) {
+	stopped := false
+	for _, c := range s.shards {
+		c.rangeEntries(func(key string, value ByteView) bool {
+			stopped = !f(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// removePrefix 在每个分片上按前缀删除，返回删除的总数
+func (s *shardedCache) removePrefix(prefix string, lazy bool) int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.removePrefix(prefix, lazy)
+	}
+	return n
+}
@@ -0,0 +1,106 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestShards(t *testing.T) {
+	silenceLog(t)
+	g := NewGroup("shards", 16<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithShards(8))
+	if n := len(g.mainCache.shards); n != 8 {
+		t.Fatalf("%d shards, want 8", n)
+	}
+	for i := 0; i < 100; i++ {
+		g.Get(context.Background(), fmt.Sprintf("k%02d", i))
+	}
+	used := 0
+	for _, c := range g.mainCache.shards {
+		if c.lruStats().Len > 0 {
+			used++
+		}
+	}
+	if used < 4 {
+		t.Fatalf("keys landed in only %d of 8 shards", used)
+	}
+
+	s := g.Stats().Cache
+	if s.Len != 100 || s.Bytes != 600 || s.MaxBytes != 16<<10 {
+		t.Fatalf("aggregated stats = %+v", s)
+	}
+	if cs := g.CacheStats(MainCache); cs.Misses != 100 || cs.Items != 100 {
+		t.Fatalf("aggregated counters = %+v", cs)
+	}
+	if n := g.RemovePrefix("k1"); n != 10 {
+		t.Fatalf("RemovePrefix removed %d, want 10", n)
+	}
+	g.SetCacheBytes(8 << 10)
+	if s := g.Stats().Cache; s.MaxBytes != 8<<10 {
+		t.Fatalf("MaxBytes after resize = %d", s.MaxBytes)
+	}
+	g.Clear()
+	if n := len(g.mainCache.keys()); n != 0 {
+		t.Fatalf("%d keys left after Clear", n)
+	}
+}
+
+func TestShardOversizedValue(t *testing.T) {
+	silenceLog(t)
+	// 整个缓存能放下，但超过单个分片的上限（1024/4=256）
+	big := strings.Repeat("x", 300)
+	g := NewGroup("shards-oversized", 1024, GetterFunc(func(key string) ([]byte, error) {
+		if key == "big" {
+			return []byte(big), nil
+		}
+		return []byte(key), nil
+	}), WithShards(4))
+	g.Get(context.Background(), "small")
+	if v, err := g.Get(context.Background(), "big"); err != nil || v.String() != big {
+		t.Fatalf("Get(big) = %v", err)
+	}
+	if g.CachedLocally("big") {
+		t.Fatal("value larger than a shard was cached")
+	}
+	if !g.CachedLocally("small") {
+		t.Fatal("oversized value evicted entries from other shards")
+	}
+}
+
+func TestWithShardsPowerOfTwo(t *testing.T) {
+	for _, n := range []int{0, 3, 12} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithShards(%d) did not panic", n)
+				}
+			}()
+			WithShards(n)
+		}()
+	}
+}
+
+func BenchmarkCacheParallelGet(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c := &shardedCache{cache: cache{cacheBytes: 1 << 20}, n: shards}
+			c.init()
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key%d", i)
+				c.add(keys[i], ByteView{b: []byte("value")})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(keys[i&1023])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -1,42 +1,356 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-// call 代表正在进行中，或已经结束的请求，使用 sync.WaitGroup 锁避免重入
+// fn的panic和runtime.Goexit：fn在单独的goroutine中运行，panic被恢复并记为*PanicError，
+// 发起请求的Do/DoContext调用方重新panic，其他等待的调用方（以及DoChan、DoBatch的调用方）得到这个错误；
+// fn调用runtime.Goexit时所有调用方得到ErrGoexit。无论哪种情况都不会有调用方一直等待下去，之后的调用重新发起请求
+
+// ErrGoexit 表示fn调用了runtime.Goexit，没有返回结果
+var ErrGoexit = errors.New("singleflight: fn called runtime.Goexit")
+
+// PanicError 表示fn发生了panic，Value是panic的值，Stack是panic时fn所在goroutine的调用栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: fn panicked: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap 在panic的值是error时返回它
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// call 代表正在进行中，或已经结束的请求
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done    chan struct{} // fn返回后关闭
+	val     interface{}
+	err     error
+	waiters int                // 仍在等待结果的调用方数量
+	dups    atomic.Int32       // 加入这次请求的后来的调用方数量，不为0时结果是共享的；保留的结果被取走时也会增加
+	cancel  context.CancelFunc // 取消传给fn的共享ctx
 }
 
-// Group 管理不同key的请求（call）
+// Group 管理不同key的请求（call）。
+// Hold大于0时，fn结束后结果在key上保留Hold这么久，期间的调用直接得到这个结果而不再调用fn，
+// 用于请求刚结束、调用方还没来得及把结果放进缓存时又有一批相同的请求到来的情况；
+// 默认只保留成功的结果，HoldErrors为true时错误同样保留。panic和runtime.Goexit的结果从不保留，
+// 被取消的请求（见CancelAbandoned）也不保留。Forget同样删除保留的结果。
+// 默认所有调用方都离开的请求不被取消，fn继续运行，之后的调用加入它；
+// CancelAbandoned为true时这样的请求被取消，fn的ctx随之取消（见DoCtx）。
+// 这些字段需在第一次调用之前设置
 type Group struct {
 	mu sync.Mutex
 	m  map[string]*call
+
+	Hold            time.Duration
+	HoldErrors      bool
+	CancelAbandoned bool
+
+	calls, executed, shared atomic.Int64 // 见Stats
+}
+
+// Stats 是Group的调用统计，DoBatch按key计
+type Stats struct {
+	Calls    int64 // 调用次数
+	Executed int64 // 实际交给fn处理的次数，Calls与它的差就是合并掉的调用
+	Shared   int64 // 得到了其他调用方发起的请求的结果的调用数，不包括ctx结束提前离开的调用方
+}
+
+// Stats 返回调用统计的快照
+func (g *Group) Stats() Stats {
+	return Stats{Calls: g.calls.Load(), Executed: g.executed.Load(), Shared: g.shared.Load()}
+}
+
+// ResetStats 把调用统计清零
+func (g *Group) ResetStats() {
+	g.calls.Store(0)
+	g.executed.Store(0)
+	g.shared.Store(0)
+}
+
+// Do 作用：针对相同的key，无论Do被调用多少次，函数fn都只会被调用1次，等待fn调用结束了，返回 返回值或错误，
+// shared表示结果是否也交给了其他调用方
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	return g.DoCtx(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// DoContext 与DoCtx相同，但不返回结果是否共享
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	v, err, _ := g.DoCtx(ctx, key, fn)
+	return v, err
+}
+
+// DoCtx 与Do相同，但调用方可以通过ctx提前离开，shared表示结果是否也交给了其他调用方。
+// fn在单独的goroutine中运行，使用的ctx带有发起请求的调用方ctx中的值（如trace ID），
+// 但不会因为某一个调用方的ctx结束而取消：调用方的ctx结束时只有它自己立即返回ctx.Err()，其他调用方继续等待同一个结果；
+// 默认所有调用方都离开后fn仍然运行到结束，之后的调用加入它；CancelAbandoned为true时共享的ctx这时被取消，
+// fn应当据此放弃（如中止HTTP请求），之后的调用重新发起请求
+func (g *Group) DoCtx(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	if err := ctx.Err(); err != nil {
+		return nil, err, false
+	}
+	c, created := g.join(ctx, key, fn)
+	select {
+	case <-c.done:
+		if pe, ok := c.err.(*PanicError); ok && created {
+			panic(pe) // 在发起请求的调用方重新panic
+		}
+		if !created {
+			g.shared.Add(1)
+		}
+		return c.val, c.err, c.dups.Load() > 0 // 请求结束，返回结果
+	case <-ctx.Done():
+		g.mu.Lock()
+		g.leave(key, c)
+		g.mu.Unlock()
+		return nil, ctx.Err(), false
+	}
+}
+
+// leave 记录一个调用方因ctx结束离开c，没有调用方等待且CancelAbandoned时取消c，调用时需持有g.mu
+func (g *Group) leave(key string, c *call) {
+	c.waiters--
+	if c.waiters == 0 && g.CancelAbandoned {
+		c.cancel()
+		g.forget(key, c)
+	}
+}
+
+// DoChan 与Do相同，但不阻塞，返回接收结果的channel，Result.Shared表示结果是否也交给了其他调用方。
+// 每个调用方有自己的带缓冲的channel，不接收结果也不会阻塞其他调用方；DoChan的调用方不能提前离开，fn的ctx不会因此被取消
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	c, created := g.join(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+	go func() {
+		<-c.done
+		if !created {
+			g.shared.Add(1)
+		}
+		ch <- c.result()
+	}()
+	return ch
 }
 
-// Do 作用：针对相同的key，无论Do被调用多少次，函数fn都只会被调用1次，等待fn调用结束了，返回 返回值或错误
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// join 加入key正在进行的请求，没有时用fn发起一个，返回这个请求，以及它是否是这次发起的
+func (g *Group) join(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (*call, bool) {
 	g.mu.Lock()
+	defer g.mu.Unlock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
+	g.calls.Add(1)
 	if c, ok := g.m[key]; ok {
-		g.mu.Unlock()
-		c.wg.Wait()         // 如果请求正在进行中，则等待
-		return c.val, c.err // 请求结束，返回结果
+		c.waiters++ // 如果请求正在进行中，则等待
+		c.dups.Add(1)
+		return c, false
 	}
-	c := new(call)
-	c.wg.Add(1)  // 发起请求前加锁
+	g.executed.Add(1)
+	c := &call{done: make(chan struct{}), waiters: 1}
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c.cancel = cancel
 	g.m[key] = c // 添加到g.m, 表明key已经有对应的请求再处理
+	go g.run(callCtx, key, c, fn)
+	return c, true
+}
+
+// result 返回结束的请求的结果
+func (c *call) result() Result {
+	return Result{Val: c.val, Err: c.err, Shared: c.dups.Load() > 0}
+}
+
+// run 调用fn，发起请求，结束后通知所有等待的调用方
+func (g *Group) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (interface{}, error)) {
+	finished := false // fn返回了，或者panic被恢复
+	defer func() {
+		if !finished {
+			c.val, c.err = nil, ErrGoexit
+		}
+		g.mu.Lock()
+		g.release(key, c) // 更新 g.m
+		g.mu.Unlock()
+		close(c.done)
+		c.cancel()
+	}()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.val, c.err = nil, &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		c.val, c.err = fn(ctx)
+	}()
+	finished = true
+}
+
+// errResults 返回n个错误都是err的结果
+func errResults(n int, err error) []Result {
+	rs := make([]Result, n)
+	for i := range rs {
+		rs[i].Err = err
+	}
+	return rs
+}
+
+// Forget 使之后对key的调用发起新的请求，而不是加入正在进行的请求，用于调用方知道进行中的结果已经过时（如数据被修改）。
+// 已经在等待的调用方仍然得到原来请求的结果
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
 	g.mu.Unlock()
+}
+
+// release 在fn结束后把c从g.m中删除，按Hold和HoldErrors保留结果时到期后再删除，调用时需持有g.mu
+func (g *Group) release(key string, c *call) {
+	if g.m[key] != c {
+		return // 已经被Forget，或者所有调用方都离开了
+	}
+	_, panicked := c.err.(*PanicError)
+	if g.Hold <= 0 || panicked || c.err == ErrGoexit || (c.err != nil && !g.HoldErrors) {
+		delete(g.m, key)
+		return
+	}
+	time.AfterFunc(g.Hold, func() {
+		g.mu.Lock()
+		g.forget(key, c)
+		g.mu.Unlock()
+	})
+}
+
+// forget 在key对应的仍然是c时把它从g.m中删除，调用时需持有g.mu
+func (g *Group) forget(key string, c *call) {
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+}
 
-	c.val, c.err = fn() // 调用fn，发起请求
-	c.wg.Done()         // 请求结束
+// Result 是DoChan或DoBatch中单个key的结果
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // 结果是否也交给了其他调用方
+}
 
+// DoBatch 是多个key的DoContext：已经有请求在进行的key等待那个请求，其余的key由一次fn调用一起处理，
+// fn收到这些key，返回与之一一对应的结果。其他调用方（Do、DoContext或DoBatch）在此期间请求这些key时同样等待这次fn调用。
+// 返回的结果与keys一一对应，keys中不能有重复的key；ctx结束时尚未得到结果的key返回ctx.Err()。
+// CancelAbandoned时，传给fn的ctx在这次fn处理的所有key都没有调用方等待之后才被取消
+func (g *Group) DoBatch(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) []Result) []Result {
+	results := make([]Result, len(keys))
+	if err := ctx.Err(); err != nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+	calls := make([]*call, len(keys))
+	joined := make([]bool, len(keys)) // 加入了已有的请求的key
+	var claimed []string
+	var claimedCalls []*call
 	g.mu.Lock()
-	delete(g.m, key) // 更新 g.m
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	batchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	remaining := 0 // 仍有调用方等待的、由这次fn处理的key数，在g.mu下修改
+	g.calls.Add(int64(len(keys)))
+	for i, key := range keys {
+		if c, ok := g.m[key]; ok {
+			c.waiters++
+			c.dups.Add(1)
+			calls[i] = c
+			joined[i] = true
+			continue
+		}
+		c := &call{done: make(chan struct{}), waiters: 1}
+		c.cancel = func() {
+			if remaining--; remaining == 0 {
+				cancel()
+			}
+		}
+		remaining++
+		g.m[key] = c
+		calls[i] = c
+		claimed = append(claimed, key)
+		claimedCalls = append(claimedCalls, c)
+	}
+	g.executed.Add(int64(len(claimed)))
 	g.mu.Unlock()
 
-	return c.val, c.err // 返回结果
+	if len(claimed) == 0 {
+		cancel()
+	} else {
+		go func() {
+			var rs []Result
+			finished := false
+			defer func() {
+				if !finished {
+					rs = errResults(len(claimed), ErrGoexit)
+				}
+				g.mu.Lock()
+				for i, c := range claimedCalls {
+					c.val, c.err = rs[i].Val, rs[i].Err
+					g.release(claimed[i], c)
+				}
+				g.mu.Unlock()
+				for _, c := range claimedCalls {
+					close(c.done)
+				}
+				cancel()
+			}()
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						rs = errResults(len(claimed), &PanicError{Value: r, Stack: debug.Stack()})
+					}
+				}()
+				rs = fn(batchCtx, claimed)
+			}()
+			finished = true
+		}()
+	}
+
+	for i, c := range calls {
+		select {
+		case <-c.done:
+			results[i] = c.result()
+			if joined[i] {
+				g.shared.Add(1)
+			}
+		case <-ctx.Done():
+			g.mu.Lock()
+			for j, c := range calls[i:] {
+				select {
+				case <-c.done:
+					results[i+j] = c.result()
+					if joined[i+j] {
+						g.shared.Add(1)
+					}
+					continue
+				default:
+				}
+				results[i+j].Err = ctx.Err()
+				g.leave(keys[i+j], c)
+			}
+			g.mu.Unlock()
+			return results
+		}
+	}
+	return results
 }
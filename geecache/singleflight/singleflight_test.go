@@ -0,0 +1,508 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	r := <-g.DoChan("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if r.Val != "bar" || r.Err != nil || r.Shared {
+		t.Fatalf("DoChan = %+v, want bar, not shared", r)
+	}
+
+	want := errors.New("boom")
+	r = <-g.DoChan("key", func() (interface{}, error) {
+		return nil, want
+	})
+	if r.Err != want {
+		t.Fatalf("DoChan error = %v, want %v", r.Err, want)
+	}
+}
+
+func TestDoChanNotBlocking(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	start := time.Now()
+	ch := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("DoChan blocked for %v", d)
+	}
+	// 不接收结果的调用方不会阻塞其他调用方
+	g.DoChan("key", func() (interface{}, error) { return 2, nil })
+	close(release)
+	if r := <-ch; r.Val != 1 || !r.Shared {
+		t.Fatalf("DoChan = %+v, want the first call's result, shared", r)
+	}
+}
+
+// TestDoAndDoChanMixed 同一个key上并发的Do和DoChan共享同一次fn调用
+func TestDoAndDoChanMixed(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return "v", nil
+	}
+	// 先发起请求，保证其他调用方都加入同一次调用
+	first := g.DoChan("key", fn)
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan Result, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			v, err, shared := g.Do("key", fn)
+			results <- Result{Val: v, Err: err, Shared: shared}
+		}()
+		go func() {
+			defer wg.Done()
+			results <- <-g.DoChan("key", fn)
+		}()
+	}
+	// 等所有调用方都加入之后再结束fn
+	for {
+		g.mu.Lock()
+		dups := g.m["key"].dups.Load()
+		g.mu.Unlock()
+		if dups == 2*n {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if r := <-first; r.Val != "v" || !r.Shared {
+		t.Fatalf("first DoChan = %+v, want v, shared", r)
+	}
+	for r := range results {
+		if r.Val != "v" || r.Err != nil || !r.Shared {
+			t.Fatalf("result = %+v, want v, shared", r)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("fn called %d times, want 1", n)
+	}
+	if s := g.Stats(); s != (Stats{Calls: 2*n + 1, Executed: 1, Shared: 2 * n}) {
+		t.Fatalf("Stats = %+v, want %d calls, 1 executed, %d shared", s, 2*n+1, 2*n)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "old", nil
+	})
+	g.Forget("key")
+	// Forget之后的调用发起新的请求
+	second := g.DoChan("key", func() (interface{}, error) {
+		return "new", nil
+	})
+	if r := <-second; r.Val != "new" || r.Shared {
+		t.Fatalf("call after Forget = %+v, want a fresh call", r)
+	}
+	close(release)
+	if r := <-first; r.Val != "old" {
+		t.Fatalf("waiter of the forgotten call got %+v, want old", r)
+	}
+}
+
+// TestForgetOldCompletes 被Forget的请求结束时，不会把之后发起的新请求从g.m中删掉
+func TestForgetOldCompletes(t *testing.T) {
+	var g Group
+	releaseOld, releaseNew := make(chan struct{}), make(chan struct{})
+	old := g.DoChan("key", func() (interface{}, error) {
+		<-releaseOld
+		return "old", nil
+	})
+	g.Forget("key")
+	fresh := g.DoChan("key", func() (interface{}, error) {
+		<-releaseNew
+		return "new", nil
+	})
+	close(releaseOld)
+	<-old
+	late := g.DoChan("key", func() (interface{}, error) {
+		t.Error("late caller started a third call")
+		return nil, nil
+	})
+	close(releaseNew)
+	if r := <-late; r.Val != "new" || !r.Shared {
+		t.Fatalf("late caller got %+v, want to share the new call", r)
+	}
+	<-fresh
+}
+
+// TestForgetRacingCompletion 并发的Forget、Do和DoChan与请求的结束交错，每个调用方都得到结果，最后不留下请求
+func TestForgetRacingCompletion(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	fn := func() (interface{}, error) {
+		return calls.Add(1), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if (i+j)%3 == 0 {
+					g.Forget("key")
+				}
+				var r Result
+				if j%2 == 0 {
+					r = <-g.DoChan("key", fn)
+				} else {
+					r.Val, r.Err, r.Shared = g.Do("key", fn)
+				}
+				if r.Err != nil || r.Val.(int32) < 1 {
+					t.Errorf("got %+v", r)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(g.m); n != 0 {
+		t.Fatalf("%d calls left in the group", n)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	initiator := make(chan interface{}, 1)
+	go func() {
+		defer func() { initiator <- recover() }()
+		g.Do("key", func() (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	const n = 5
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err, _ := g.Do("key", func() (interface{}, error) { return nil, nil })
+			errs <- err
+		}()
+	}
+	for g.waiting("key") != n+1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	// 发起请求的调用方重新panic，其他调用方得到*PanicError
+	r := <-initiator
+	if pe, ok := r.(*PanicError); !ok || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Fatalf("initiator recovered %#v, want *PanicError with value boom", r)
+	}
+	for i := 0; i < n; i++ {
+		var pe *PanicError
+		if err := <-errs; !errors.As(err, &pe) || pe.Value != "boom" {
+			t.Fatalf("waiter got %v, want *PanicError", err)
+		}
+	}
+	if v, err, _ := g.Do("key", func() (interface{}, error) { return "ok", nil }); v != "ok" || err != nil {
+		t.Fatalf("Do after panic = %v, %v", v, err)
+	}
+}
+
+func TestPanicDoChanAndBatch(t *testing.T) {
+	var g Group
+	r := <-g.DoChan("key", func() (interface{}, error) { panic("chan") })
+	if pe, ok := r.Err.(*PanicError); !ok || pe.Value != "chan" {
+		t.Fatalf("DoChan = %+v, want *PanicError", r)
+	}
+	rs := g.DoBatch(context.Background(), []string{"a", "b"}, func(context.Context, []string) []Result {
+		panic("batch")
+	})
+	for i, r := range rs {
+		if pe, ok := r.Err.(*PanicError); !ok || pe.Value != "batch" {
+			t.Fatalf("DoBatch[%d] = %+v, want *PanicError", i, r)
+		}
+	}
+}
+
+func TestGoexit(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	const n = 5
+	errs := make(chan error, n+1)
+	go func() {
+		_, err, _ := g.Do("key", func() (interface{}, error) {
+			close(started)
+			<-release
+			runtime.Goexit()
+			return nil, nil
+		})
+		errs <- err
+	}()
+	<-started
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err, _ := g.Do("key", func() (interface{}, error) { return nil, nil })
+			errs <- err
+		}()
+	}
+	for g.waiting("key") != n+1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < n+1; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrGoexit) {
+				t.Fatalf("Do = %v, want ErrGoexit", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("callers still waiting after fn called runtime.Goexit")
+		}
+	}
+
+	rs := g.DoBatch(context.Background(), []string{"a"}, func(context.Context, []string) []Result {
+		runtime.Goexit()
+		return nil
+	})
+	if !errors.Is(rs[0].Err, ErrGoexit) {
+		t.Fatalf("DoBatch = %+v, want ErrGoexit", rs[0])
+	}
+}
+
+// waiting 返回key正在进行的请求的调用方数目
+func (g *Group) waiting(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.m[key]; ok {
+		return c.waiters
+	}
+	return 0
+}
+
+func TestHold(t *testing.T) {
+	g := Group{Hold: time.Hour}
+	var calls atomic.Int32
+	fn := func() (interface{}, error) {
+		return calls.Add(1), nil
+	}
+	for i := 0; i < 3; i++ {
+		if v, err, _ := g.Do("key", fn); v != int32(1) || err != nil {
+			t.Fatalf("Do #%d = %v, %v, want the held result 1", i, v, err)
+		}
+	}
+	if r := <-g.DoChan("key", fn); r.Val != int32(1) || !r.Shared {
+		t.Fatalf("DoChan = %+v, want the held result, shared", r)
+	}
+	// Forget同样删除保留的结果
+	g.Forget("key")
+	if v, _, _ := g.Do("key", fn); v != int32(2) {
+		t.Fatalf("Do after Forget = %v, want 2", v)
+	}
+
+	// 保留到期后重新调用fn
+	short := Group{Hold: 10 * time.Millisecond}
+	short.Do("key", fn)
+	for short.waiting("key") != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if v, _, _ := short.Do("key", fn); v != int32(4) {
+		t.Fatalf("Do after the hold expired = %v, want 4", v)
+	}
+}
+
+func TestHoldErrors(t *testing.T) {
+	var calls atomic.Int32
+	fn := func() (interface{}, error) {
+		calls.Add(1)
+		return nil, errors.New("boom")
+	}
+	g := Group{Hold: time.Hour}
+	g.Do("key", fn)
+	g.Do("key", fn)
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("fn called %d times, want errors not held by default", n)
+	}
+
+	calls.Store(0)
+	h := Group{Hold: time.Hour, HoldErrors: true}
+	h.Do("key", fn)
+	if _, err, _ := h.Do("key", fn); err == nil || calls.Load() != 1 {
+		t.Fatalf("Do = %v after %d calls, want the held error", err, calls.Load())
+	}
+	// panic从不保留
+	func() {
+		defer func() { recover() }()
+		h.Do("panic", func() (interface{}, error) { panic("boom") })
+	}()
+	if v, err, _ := h.Do("panic", func() (interface{}, error) { return "ok", nil }); v != "ok" || err != nil {
+		t.Fatalf("Do after panic = %v, %v, want a fresh call", v, err)
+	}
+}
+
+func TestDoCtxAggressiveCancel(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		g := Group{CancelAbandoned: true}
+		var calls, canceled atomic.Int32
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (interface{}, error) {
+			calls.Add(1)
+			select {
+			case <-ctx.Done():
+				canceled.Add(1)
+				return nil, ctx.Err()
+			case <-release:
+				return "v", nil
+			}
+		}
+
+		// 一个调用方一直等待，其余的调用方很快离开：fn不被取消
+		stay := make(chan Result, 1)
+		go func() {
+			v, err, shared := g.DoCtx(context.Background(), "key", fn)
+			stay <- Result{Val: v, Err: err, Shared: shared}
+		}()
+		for g.waiting("key") != 1 {
+			time.Sleep(time.Microsecond)
+		}
+		const n = 100
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%5)*100*time.Microsecond)
+				defer cancel()
+				if _, err, _ := g.DoCtx(ctx, "key", fn); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("canceled waiter got %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if n := g.waiting("key"); n != 1 {
+			t.Fatalf("round %d: %d waiters after the others left, want 1", round, n)
+		}
+		if canceled.Load() != 0 {
+			t.Fatalf("round %d: fn canceled while a waiter remained", round)
+		}
+		close(release)
+		if r := <-stay; r.Val != "v" || r.Err != nil || !r.Shared {
+			t.Fatalf("round %d: remaining waiter got %+v, want v, shared", round, r)
+		}
+
+		// 所有调用方都离开后fn被取消，之后的调用重新发起请求
+		release = make(chan struct{})
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%5)*100*time.Microsecond)
+				defer cancel()
+				g.DoCtx(ctx, "key", fn)
+			}(i)
+		}
+		wg.Wait()
+		deadline := time.Now().Add(5 * time.Second)
+		for canceled.Load() != calls.Load()-1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("round %d: %d of %d calls canceled after every waiter left", round, canceled.Load(), calls.Load()-1)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if n := g.waiting("key"); n != 0 {
+			t.Fatalf("round %d: key still has %d waiters", round, n)
+		}
+	}
+}
+
+func TestAbandonedCallKeepsRunning(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		calls.Add(1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-release:
+			return "v", nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoCtx(ctx, "key", fn); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DoCtx = %v, want DeadlineExceeded", err)
+	}
+	// 请求没有被取消，之后的调用加入它
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		close(release)
+	}()
+	if v, err, shared := g.DoCtx(context.Background(), "key", fn); v != "v" || err != nil || !shared || calls.Load() != 1 {
+		t.Fatalf("DoCtx = %v, %v, %v after %d calls, want the abandoned call's result", v, err, shared, calls.Load())
+	}
+}
+
+func TestStatsBatchAndCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	slow := g.DoChan("a", func() (interface{}, error) {
+		<-release
+		return "a", nil
+	})
+	// b、c由这次fn处理，a加入已有的请求
+	done := make(chan []Result)
+	go func() {
+		done <- g.DoBatch(context.Background(), []string{"a", "b", "c"}, func(_ context.Context, keys []string) []Result {
+			rs := make([]Result, len(keys))
+			for i, k := range keys {
+				rs[i].Val = k
+			}
+			return rs
+		})
+	}()
+	for g.waiting("a") != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// 提前离开的调用方不计入Shared
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g.DoCtx(ctx, "a", nil)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	g.DoCtx(ctx, "a", nil)
+
+	close(release)
+	<-slow
+	<-done
+	if s := g.Stats(); s != (Stats{Calls: 5, Executed: 3, Shared: 1}) {
+		t.Fatalf("Stats = %+v, want 5 calls, 3 executed, 1 shared", s)
+	}
+	g.ResetStats()
+	if s := g.Stats(); s != (Stats{}) {
+		t.Fatalf("Stats after ResetStats = %+v", s)
+	}
+}
@@ -0,0 +1,300 @@
+package geecache
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+// Sink：Get把值写到调用方提供的Sink中，由Sink决定要不要拷贝、以什么形式保存。
+// 需要ByteView的调用方使用ByteViewSink，直接拿到缓存中的只读视图，不需要拷贝；
+// 需要string或者可修改的[]byte的调用方使用StringSink或AllocatingByteSliceSink，只拷贝一次。
+// 在本地加载时，发起加载的调用方的Sink直接接收回调函数的结果，缓存中保存的就是这个Sink的视图；
+// 同一时间等待同一个key的其他调用方从缓存的视图写入各自的Sink
+
+// Sink 接收Get的结果。加载的值被同时进行的Set取代（见set.go）时会再写入一次，ByteViewSink还可能再补上过期时间
+type Sink interface {
+	// SetString 把值设为s
+	SetString(s string) error
+
+	// SetBytes 把值设为v，调用方之后可能修改v，Sink需要保存时必须拷贝
+	SetBytes(v []byte) error
+
+	// SetProto 把值设为m编码后的结果
+	SetProto(m Message) error
+
+	// view 返回值的只读视图，Sink之后不会再修改它，因此可以直接放进缓存
+	view() (ByteView, error)
+}
+
+// Message 是SetProto和ProtoSink使用的消息，protobuf（如gogo/protobuf）生成的类型都实现了这两个方法，
+// 这样geecache本身不需要依赖protobuf
+type Message interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// viewSetter 是Sink可选实现的接口，接收一个只读视图，Sink可以直接保存它而不必像SetBytes那样先拷贝
+type viewSetter interface {
+	setView(v ByteView) error
+}
+
+// setSinkView 把只读视图v写入s，s实现了viewSetter时只做Sink本身需要的拷贝
+func setSinkView(s Sink, v ByteView) error {
+	if vs, ok := s.(viewSetter); ok {
+		return vs.setView(v)
+	}
+	return s.SetBytes(v.b)
+}
+
+// stringView 返回与s共享内存的只读视图，string本身不可修改，ByteView也不会修改它
+func stringView(s string) ByteView {
+	return ByteView{b: unsafe.Slice(unsafe.StringData(s), len(s))}
+}
+
+// ByteViewSink 返回把值写到*dst的Sink，得到的是缓存中的视图本身，带着过期时间
+func ByteViewSink(dst *ByteView) Sink {
+	if dst == nil {
+		panic("nil dst")
+	}
+	return &byteViewSink{dst: dst}
+}
+
+type byteViewSink struct {
+	dst *ByteView
+}
+
+func (s *byteViewSink) setView(v ByteView) error {
+	*s.dst = v
+	return nil
+}
+
+func (s *byteViewSink) view() (ByteView, error) {
+	return *s.dst, nil
+}
+
+func (s *byteViewSink) SetString(v string) error {
+	*s.dst = stringView(v)
+	return nil
+}
+
+func (s *byteViewSink) SetBytes(b []byte) error {
+	*s.dst = ByteView{b: cloneBytes(b)}
+	return nil
+}
+
+func (s *byteViewSink) SetProto(m Message) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	*s.dst = ByteView{b: b}
+	return nil
+}
+
+// StringSink 返回把值写到*sp的Sink
+func StringSink(sp *string) Sink {
+	if sp == nil {
+		panic("nil sp")
+	}
+	return &stringSink{sp: sp}
+}
+
+type stringSink struct {
+	sp *string
+	v  ByteView
+}
+
+func (s *stringSink) view() (ByteView, error) {
+	return s.v, nil
+}
+
+func (s *stringSink) setView(v ByteView) error {
+	*s.sp = string(v.b)
+	s.v = v
+	return nil
+}
+
+func (s *stringSink) SetString(v string) error {
+	*s.sp = v
+	s.v = stringView(v)
+	return nil
+}
+
+func (s *stringSink) SetBytes(b []byte) error {
+	return s.SetString(string(b))
+}
+
+func (s *stringSink) SetProto(m Message) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	// b是刚编码出来的，不会再被修改，可以与string共享
+	s.v = ByteView{b: b}
+	*s.sp = unsafe.String(unsafe.SliceData(b), len(b))
+	return nil
+}
+
+// AllocatingByteSliceSink 返回把值写到*dst的Sink，*dst是调用方独占的拷贝，可以修改
+func AllocatingByteSliceSink(dst *[]byte) Sink {
+	if dst == nil {
+		panic("nil dst")
+	}
+	return &allocBytesSink{dst: dst}
+}
+
+type allocBytesSink struct {
+	dst *[]byte
+	v   ByteView // 放进缓存的只读视图，与*dst互不共享
+}
+
+func (s *allocBytesSink) view() (ByteView, error) {
+	return s.v, nil
+}
+
+func (s *allocBytesSink) setView(v ByteView) error {
+	return s.setOwned(v.b)
+}
+
+// setOwned 保存不会再被修改的b，*dst需要另外拷贝一份
+func (s *allocBytesSink) setOwned(b []byte) error {
+	s.v = ByteView{b: b}
+	*s.dst = cloneBytes(b)
+	return nil
+}
+
+func (s *allocBytesSink) SetString(v string) error {
+	*s.dst = []byte(v)
+	s.v = stringView(v)
+	return nil
+}
+
+func (s *allocBytesSink) SetBytes(b []byte) error {
+	return s.setOwned(cloneBytes(b))
+}
+
+func (s *allocBytesSink) SetProto(m Message) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	return s.setOwned(b)
+}
+
+// ProtoSink 返回把值解码到m的Sink
+func ProtoSink(m Message) Sink {
+	if m == nil {
+		panic("nil Message")
+	}
+	return &protoSink{dst: m}
+}
+
+type protoSink struct {
+	dst Message
+	v   ByteView
+}
+
+func (s *protoSink) view() (ByteView, error) {
+	return s.v, nil
+}
+
+func (s *protoSink) SetBytes(b []byte) error {
+	if err := s.dst.Unmarshal(b); err != nil {
+		return err
+	}
+	s.v = ByteView{b: cloneBytes(b)}
+	return nil
+}
+
+func (s *protoSink) SetString(v string) error {
+	b := stringView(v).b
+	if err := s.dst.Unmarshal(b); err != nil {
+		return err
+	}
+	s.v = ByteView{b: b}
+	return nil
+}
+
+func (s *protoSink) SetProto(m Message) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := s.dst.Unmarshal(b); err != nil {
+		return err
+	}
+	s.v = ByteView{b: b}
+	return nil
+}
+
+var errNilSink = errors.New("geecache: nil dest Sink")
+
+// loadSink 是交给加载的Sink。加载在单独的goroutine中进行（见singleflight.DoContext），发起加载的调用方因ctx结束离开后，
+// 它的dest不能再被修改，之后的写入改为保存在loadSink自己的视图中，加载的结果照常写入缓存
+type loadSink struct {
+	mu   sync.Mutex
+	dest Sink // 为nil表示调用方已经离开
+	v    ByteView
+}
+
+// abandon 在调用方离开时调用，保留dest中已经写入的值
+func (s *loadSink) abandon() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.v, _ = s.dest.view()
+	s.dest = nil
+}
+
+func (s *loadSink) view() (ByteView, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dest != nil {
+		return s.dest.view()
+	}
+	return s.v, nil
+}
+
+func (s *loadSink) setView(v ByteView) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dest != nil {
+		return setSinkView(s.dest, v)
+	}
+	s.v = v
+	return nil
+}
+
+func (s *loadSink) SetString(v string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dest != nil {
+		return s.dest.SetString(v)
+	}
+	s.v = stringView(v)
+	return nil
+}
+
+func (s *loadSink) SetBytes(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dest != nil {
+		return s.dest.SetBytes(b)
+	}
+	s.v = ByteView{b: cloneBytes(b)}
+	return nil
+}
+
+func (s *loadSink) SetProto(m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dest != nil {
+		return s.dest.SetProto(m)
+	}
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	s.v = ByteView{b: b}
+	return nil
+}
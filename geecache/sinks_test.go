@@ -0,0 +1,135 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// upperMessage 是测试用的Message，编码结果为大写的文本
+type upperMessage struct{ text string }
+
+func (m *upperMessage) Marshal() ([]byte, error) { return []byte(strings.ToUpper(m.text)), nil }
+
+func (m *upperMessage) Unmarshal(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty message")
+	}
+	m.text = string(data)
+	return nil
+}
+
+func TestSinks(t *testing.T) {
+	g := NewGroup("sinks", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}), WithHardTTL(time.Minute))
+
+	// 第一次由本次调用加载，第二次命中缓存
+	for i := 0; i < 2; i++ {
+		var view ByteView
+		if err := g.GetTo(context.Background(), "view", ByteViewSink(&view)); err != nil || view.String() != "v-view" {
+			t.Fatalf("ByteViewSink = %q, %v", view, err)
+		}
+		if view.Expire().IsZero() {
+			t.Fatalf("ByteViewSink lost the expiry on pass %d", i)
+		}
+
+		var s string
+		if err := g.GetTo(context.Background(), "string", StringSink(&s)); err != nil || s != "v-string" {
+			t.Fatalf("StringSink = %q, %v", s, err)
+		}
+
+		var b []byte
+		if err := g.GetTo(context.Background(), "bytes", AllocatingByteSliceSink(&b)); err != nil || string(b) != "v-bytes" {
+			t.Fatalf("AllocatingByteSliceSink = %q, %v", b, err)
+		}
+		b[0] = 'X' // 调用方的拷贝可以修改，不影响缓存
+
+		var m upperMessage
+		if err := g.GetTo(context.Background(), "proto", ProtoSink(&m)); err != nil || m.text != "v-proto" {
+			t.Fatalf("ProtoSink = %q, %v", m.text, err)
+		}
+	}
+	if v, _ := g.Get(context.Background(), "bytes"); v.String() != "v-bytes" {
+		t.Fatalf("cached value modified through the sink: %q", v)
+	}
+	if !g.CachedLocally("string") {
+		t.Fatal("value loaded into a StringSink was not cached")
+	}
+
+	if err := g.GetTo(context.Background(), "k", nil); err == nil {
+		t.Fatal("GetTo with a nil Sink succeeded")
+	}
+}
+
+func TestSinkSetProto(t *testing.T) {
+	in := &upperMessage{text: "hello"}
+	var view ByteView
+	var s string
+	var b []byte
+	var out upperMessage
+	for _, sink := range []Sink{ByteViewSink(&view), StringSink(&s), AllocatingByteSliceSink(&b), ProtoSink(&out)} {
+		if err := sink.SetProto(in); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := sink.view(); v.String() != "HELLO" {
+			t.Fatalf("%T view = %q", sink, v)
+		}
+	}
+	if view.String() != "HELLO" || s != "HELLO" || string(b) != "HELLO" || out.text != "HELLO" {
+		t.Fatalf("SetProto = %q %q %q %q", view, s, b, out.text)
+	}
+	if err := ProtoSink(&out).SetBytes(nil); err == nil {
+		t.Fatal("ProtoSink accepted an invalid message")
+	}
+}
+
+// 同一个key的并发加载合并为一次，发起加载的调用方和每个等待者的Sink都得到同一个值
+func TestSinkDuplicateLoads(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	g := NewGroup("sinks-dup", 0, GetterFunc(func(key string) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("shared"), nil
+	}))
+
+	const n = 8
+	results := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			switch i % 3 {
+			case 0:
+				var v ByteView
+				err = g.GetTo(context.Background(), "k", ByteViewSink(&v))
+				results[i] = v.String()
+			case 1:
+				err = g.GetTo(context.Background(), "k", StringSink(&results[i]))
+			case 2:
+				var b []byte
+				err = g.GetTo(context.Background(), "k", AllocatingByteSliceSink(&b))
+				results[i] = string(b)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	waitFor(t, func() bool { return calls.Load() == 1 })
+	time.Sleep(10 * time.Millisecond) // 让其他调用方进入等待
+	close(release)
+	wg.Wait()
+	for i, r := range results {
+		if r != "shared" {
+			t.Fatalf("caller %d got %q", i, r)
+		}
+	}
+}
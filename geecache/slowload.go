@@ -0,0 +1,84 @@
+package geecache
+
+import (
+	"sync"
+	"time"
+)
+
+// 慢加载日志：WithSlowLoadThreshold开启后，调用回调函数（getLocally）或访问远程节点（getFromPeer）超过阈值时，
+// 输出一行key=value格式的Info日志，包括key、来源（远程节点的地址或"getter"）、本地加载的原因、耗时和错误，
+// 并记入一个只保留最近slowLoadHistory条的环形缓冲区，通过Group.SlowLoads和统计接口（Stats.SlowLoads）查看。
+// 未开启时只多一次nil判断，不读取时钟
+
+const slowLoadHistory = 32 // 保留的慢加载记录数
+
+// SlowLoad 是一次超过阈值的加载
+type SlowLoad struct {
+	Key      string        `json:"key"`              // 回调函数使用的原来的key，见WithKeyHashing
+	Source   string        `json:"source"`           // 远程节点的地址，本地加载为"getter"
+	Reason   string        `json:"reason,omitempty"` // 本地加载的原因（FallbackReason），访问远程节点时为空
+	Start    time.Time     `json:"start"`            // 开始加载的时间
+	Duration time.Duration `json:"duration"`         // 加载的耗时
+	Err      string        `json:"error,omitempty"`  // 加载失败时的错误
+}
+
+// WithSlowLoadThreshold 设置慢加载的阈值，耗时超过d的加载会被记录，0表示关闭（默认）
+func WithSlowLoadThreshold(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.slowLoads = nil
+		if d > 0 {
+			g.slowLoads = &slowLoadLog{threshold: d}
+		}
+	}
+}
+
+// slowLoadLog 是慢加载的环形缓冲区
+type slowLoadLog struct {
+	threshold time.Duration
+	mu        sync.Mutex
+	ring      [slowLoadHistory]SlowLoad
+	next      int // 下一条写入的位置
+	n         int // 已有的记录数
+}
+
+func (l *slowLoadLog) add(s SlowLoad) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ring[l.next] = s
+	l.next = (l.next + 1) % len(l.ring)
+	l.n = min(l.n+1, len(l.ring))
+}
+
+// list 按从旧到新的顺序返回所有记录
+func (l *slowLoadLog) list() []SlowLoad {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	loads := make([]SlowLoad, 0, l.n)
+	for i := l.next - l.n; i < l.next; i++ {
+		loads = append(loads, l.ring[(i+len(l.ring))%len(l.ring)])
+	}
+	return loads
+}
+
+// noteSlowLoad 在从start开始的加载超过阈值时记录它，reason为本地加载的原因，访问远程节点时为空。
+// 调用方只在g.slowLoads不为nil时调用
+func (g *Group) noteSlowLoad(key, source, reason string, start time.Time, err error) {
+	d := g.now().Sub(start)
+	if d <= g.slowLoads.threshold {
+		return
+	}
+	s := SlowLoad{Key: key, Source: source, Reason: reason, Start: start, Duration: d}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	g.slowLoads.add(s)
+	g.logger().Infof("slow load: group=%q key=%q source=%q reason=%q duration=%v error=%q", g.name, key, source, reason, d, s.Err)
+}
+
+// SlowLoads 按从旧到新的顺序返回最近的慢加载，未开启WithSlowLoadThreshold时为nil
+func (g *Group) SlowLoads() []SlowLoad {
+	if g.slowLoads == nil {
+		return nil
+	}
+	return g.slowLoads.list()
+}
@@ -0,0 +1,90 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clockPeer 每次读取把假时钟向前拨d
+type clockPeer struct {
+	clock *fakeClock
+	d     time.Duration
+}
+
+func (p clockPeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	p.clock.Advance(p.d)
+	return []byte(key), nil
+}
+
+func TestSlowLoads(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	logger := &captureLogger{}
+	g := NewGroup("slow-loads", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		switch {
+		case strings.HasPrefix(key, "slow"):
+			clock.Advance(2 * time.Second)
+		case key == "broken":
+			clock.Advance(3 * time.Second)
+			return nil, errors.New("db timeout")
+		default:
+			clock.Advance(10 * time.Millisecond)
+		}
+		return []byte(key), nil
+	}), WithSlowLoadThreshold(time.Second), WithLogger(logger))
+	g.now = clock.Now
+	g.RegisterPeers(prefixPeers{prefix: "remote:", peer: clockPeer{clock: clock, d: 1500 * time.Millisecond}})
+
+	g.Get(ctx, "fast")
+	g.Get(ctx, "slow")
+	g.Get(ctx, "broken")
+	g.Get(ctx, "remote:k")
+	loads := g.SlowLoads()
+	if len(loads) != 3 {
+		t.Fatalf("SlowLoads = %+v, want 3 loads", loads)
+	}
+	want := []SlowLoad{
+		{Key: "slow", Source: "getter", Reason: "owned_locally", Duration: 2 * time.Second},
+		{Key: "broken", Source: "getter", Reason: "owned_locally", Duration: 3 * time.Second, Err: "db timeout"},
+		{Key: "remote:k", Source: "peer", Duration: 1500 * time.Millisecond},
+	}
+	for i, w := range want {
+		got := loads[i]
+		got.Start = time.Time{}
+		if got != w {
+			t.Fatalf("SlowLoads[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+	if !logger.has("INFO", `key="broken" source="getter" reason="owned_locally" duration=3s error="db timeout"`) {
+		t.Fatalf("no slow load log line for broken, got %q", logger.lines)
+	}
+	if logger.has("INFO", `key="fast"`) {
+		t.Fatal("a fast load was logged")
+	}
+	if s := g.Stats(); len(s.SlowLoads) != 3 {
+		t.Fatalf("Stats().SlowLoads has %d loads, want 3", len(s.SlowLoads))
+	}
+
+	// 只保留最近的slowLoadHistory条
+	for i := 0; i < slowLoadHistory+5; i++ {
+		g.Get(ctx, fmt.Sprintf("slow%d", i))
+	}
+	loads = g.SlowLoads()
+	if len(loads) != slowLoadHistory || loads[0].Key != "slow5" || loads[len(loads)-1].Key != fmt.Sprintf("slow%d", slowLoadHistory+4) {
+		t.Fatalf("SlowLoads kept %d loads from %s to %s", len(loads), loads[0].Key, loads[len(loads)-1].Key)
+	}
+}
+
+func TestSlowLoadsDisabled(t *testing.T) {
+	g := NewGroup("slow-loads-disabled", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.Get(context.Background(), "k")
+	if loads := g.SlowLoads(); loads != nil {
+		t.Fatalf("SlowLoads = %v without a threshold", loads)
+	}
+}
@@ -0,0 +1,41 @@
+package geecache
+
+import "geecache/geecache/snapshot"
+
+// SaveSnapshot 把group本地缓存的内容分段保存到dir，dir中已有快照时只重写发生变化的段
+func (g *Group) SaveSnapshot(dir string) error {
+	var entries []snapshot.Entry
+	g.mainCache.rangeEntries(func(key string, value ByteView) bool {
+		if value.err != nil {
+			return true // 负缓存的墓碑不保存
+		}
+		entries = append(entries, snapshot.Entry{Key: key, Value: value.b, Expire: value.expire, Soft: value.soft, Version: value.version})
+		return true
+	})
+	_, err := snapshot.Save(dir, entries, 0)
+	return err
+}
+
+// LoadSnapshot 从dir加载快照并写入本地缓存，损坏的段会被跳过并记录在返回的LoadReport中。
+// 条目保留保存时的过期时间和版本号，已经过期的条目不再加载
+func (g *Group) LoadSnapshot(dir string) (snapshot.LoadReport, error) {
+	entries, report, err := snapshot.Load(dir)
+	if err != nil {
+		return report, err
+	}
+	for i, seg := range report.Lost {
+		g.logger().Errorf("Skipped snapshot segment %s: %v, lost %d keys in [%q, %q]", seg.File, report.Errors[i], seg.Count, seg.FirstKey, seg.LastKey)
+	}
+	now := g.now()
+	keys := make([]string, 0, len(entries))
+	values := make([]ByteView, 0, len(entries))
+	for _, e := range entries {
+		if !e.Expire.IsZero() && !now.Before(e.Expire) {
+			continue
+		}
+		keys = append(keys, e.Key)
+		values = append(values, g.withDefaultExpiry(ByteView{b: e.Value, expire: e.Expire, soft: e.Soft, version: e.Version}))
+	}
+	g.mainCache.addAll(keys, values)
+	return report, nil
+}
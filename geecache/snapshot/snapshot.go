@@ -0,0 +1,339 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 把缓存内容持久化到一个目录中，便于进程重启后预热
+// 条目按键排序后切分为多个段文件，每个段单独计算CRC，索引文件记录每个段的文件名、CRC和键范围：
+//   - 加载时跳过损坏的段（并记录丢失了哪一段键），而不是因为一处损坏丢弃全部数据
+//   - 保存时沿用上一次的段边界，只重写内容发生变化的段
+
+const (
+	DefaultSegmentSize = 64 << 20 // 默认每个段文件的大小上限
+	indexFile          = "index.json"
+	indexVersion       = 2 // 版本1的段中只有键和值，仍然可以加载
+)
+
+// Entry 是快照中的一条记录
+type Entry struct {
+	Key     string
+	Value   []byte
+	Expire  time.Time // 硬过期时间，零值表示永不过期
+	Soft    time.Time // 软过期时间，零值表示没有软过期
+	Version uint64    // 版本号
+}
+
+// Segment 是索引中对一个段文件的描述，段内的键都在[FirstKey, LastKey]范围内
+type Segment struct {
+	File     string `json:"file"`
+	CRC      uint32 `json:"crc"`
+	Size     int64  `json:"size"`
+	Count    int    `json:"count"`
+	FirstKey string `json:"first_key"`
+	LastKey  string `json:"last_key"`
+}
+
+type index struct {
+	Version  int       `json:"version"`
+	Seq      int       `json:"seq"` // 下一个新段文件的编号，保证新写的段不会覆盖仍被旧索引引用的文件
+	Segments []Segment `json:"segments"`
+}
+
+// SaveStats 记录一次保存重写了多少个段，沿用了多少个未变化的段
+type SaveStats struct {
+	Written int
+	Reused  int
+}
+
+// LoadReport 记录一次加载读取了多少个段，以及因为损坏而跳过的段
+type LoadReport struct {
+	Segments int
+	Lost     []Segment
+	Errors   []error // 与Lost一一对应，每个段被跳过的原因
+}
+
+// Save 把entries保存到dir，segmentSize为每个段的大小上限，0表示使用DefaultSegmentSize
+// dir中已有快照时沿用它的段边界，内容没有变化的段不会重写
+func Save(dir string, entries []Entry, segmentSize int64) (SaveStats, error) {
+	var stats SaveStats
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return stats, err
+	}
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	// 旧索引不存在或已损坏时全部重写
+	old, err := readIndex(dir)
+	if err != nil {
+		old = &index{Version: indexVersion}
+	}
+	reusable := make(map[string]Segment, len(old.Segments))
+	for _, seg := range old.Segments {
+		reusable[seg.FirstKey] = seg
+	}
+
+	next := &index{Version: indexVersion, Seq: old.Seq}
+	kept := make(map[string]bool)
+	for _, chunk := range partition(sorted, old.Segments, segmentSize) {
+		data := encode(chunk)
+		seg := Segment{
+			CRC:      crc32.ChecksumIEEE(data),
+			Size:     int64(len(data)),
+			Count:    len(chunk),
+			FirstKey: chunk[0].Key,
+			LastKey:  chunk[len(chunk)-1].Key,
+		}
+		if prev, ok := reusable[seg.FirstKey]; ok && prev.CRC == seg.CRC && prev.Size == seg.Size && prev.LastKey == seg.LastKey && intact(filepath.Join(dir, prev.File), prev) {
+			next.Segments = append(next.Segments, prev)
+			kept[prev.File] = true
+			stats.Reused++
+			continue
+		}
+		seg.File = fmt.Sprintf("seg-%06d.dat", next.Seq)
+		next.Seq++
+		if err := writeFile(filepath.Join(dir, seg.File), data); err != nil {
+			return stats, err
+		}
+		next.Segments = append(next.Segments, seg)
+		stats.Written++
+	}
+
+	data, err := json.Marshal(next)
+	if err != nil {
+		return stats, err
+	}
+	if err := writeFile(filepath.Join(dir, indexFile), data); err != nil {
+		return stats, err
+	}
+	// 新索引落盘之后再删除不再引用的旧段
+	for _, seg := range old.Segments {
+		if !kept[seg.File] {
+			os.Remove(filepath.Join(dir, seg.File))
+		}
+	}
+	return stats, nil
+}
+
+// partition 把已排序的entries切分为段：先按旧索引的段边界分桶，使未变化的段内容保持不变，
+// 没有旧边界或者某个桶超过两倍段大小时，再按segmentSize切分
+func partition(sorted []Entry, old []Segment, segmentSize int64) [][]Entry {
+	bounds := make([]string, 0, len(old))
+	for i, seg := range old {
+		if i > 0 {
+			bounds = append(bounds, seg.FirstKey)
+		}
+	}
+	buckets := make([][]Entry, len(bounds)+1)
+	for _, e := range sorted {
+		// 落在第一个大于该键的边界之前的桶里
+		i := sort.SearchStrings(bounds, e.Key)
+		if i < len(bounds) && bounds[i] == e.Key {
+			i++
+		}
+		buckets[i] = append(buckets[i], e)
+	}
+
+	var chunks [][]Entry
+	for _, bucket := range buckets {
+		if len(bucket) == 0 {
+			continue
+		}
+		if len(old) > 0 && encodedSize(bucket) <= 2*segmentSize {
+			chunks = append(chunks, bucket)
+			continue
+		}
+		start, size := 0, int64(0)
+		for i, e := range bucket {
+			n := entrySize(e)
+			if i > start && size+n > segmentSize {
+				chunks = append(chunks, bucket[start:i])
+				start, size = i, 0
+			}
+			size += n
+		}
+		chunks = append(chunks, bucket[start:])
+	}
+	return chunks
+}
+
+// Load 读取dir中的快照，CRC校验失败、被截断或无法读取的段会被跳过并记录在LoadReport中
+// 只有索引本身无法读取时才返回错误
+func Load(dir string) ([]Entry, LoadReport, error) {
+	var report LoadReport
+	idx, err := readIndex(dir)
+	if err != nil {
+		return nil, report, err
+	}
+	var entries []Entry
+	for _, seg := range idx.Segments {
+		report.Segments++
+		data, err := os.ReadFile(filepath.Join(dir, seg.File))
+		if err == nil && (int64(len(data)) != seg.Size || crc32.ChecksumIEEE(data) != seg.CRC) {
+			err = errors.New("checksum mismatch")
+		}
+		var chunk []Entry
+		if err == nil {
+			chunk, err = decode(data, idx.Version)
+		}
+		if err != nil {
+			report.Lost = append(report.Lost, seg)
+			report.Errors = append(report.Errors, err)
+			continue
+		}
+		entries = append(entries, chunk...)
+	}
+	return entries, report, nil
+}
+
+func readIndex(dir string) (*index, error) {
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		return nil, err
+	}
+	idx := &index{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("snapshot: corrupt index: %v", err)
+	}
+	if idx.Version < 1 || idx.Version > indexVersion {
+		return nil, fmt.Errorf("snapshot: unsupported index version %d", idx.Version)
+	}
+	return idx, nil
+}
+
+// 段文件由连续的记录组成，每条记录为：uvarint(len(key)) key uvarint(len(value)) value varint(expire) varint(soft) uvarint(version)
+// 过期时间记录为UnixNano，0表示零值；版本1的记录只有前四项
+
+func entrySize(e Entry) int64 {
+	return int64(5*binary.MaxVarintLen64 + len(e.Key) + len(e.Value))
+}
+
+func encodedSize(entries []Entry) int64 {
+	var n int64
+	for _, e := range entries {
+		n += entrySize(e)
+	}
+	return n
+}
+
+func encode(entries []Entry) []byte {
+	var buf bytes.Buffer
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, e := range entries {
+		buf.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(e.Key)))])
+		buf.WriteString(e.Key)
+		buf.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(e.Value)))])
+		buf.Write(e.Value)
+		buf.Write(lenBuf[:binary.PutVarint(lenBuf[:], unixNano(e.Expire))])
+		buf.Write(lenBuf[:binary.PutVarint(lenBuf[:], unixNano(e.Soft))])
+		buf.Write(lenBuf[:binary.PutUvarint(lenBuf[:], e.Version)])
+	}
+	return buf.Bytes()
+}
+
+func decode(data []byte, version int) ([]Entry, error) {
+	var entries []Entry
+	for len(data) > 0 {
+		key, rest, err := readField(data)
+		if err != nil {
+			return nil, err
+		}
+		value, rest, err := readField(rest)
+		if err != nil {
+			return nil, err
+		}
+		e := Entry{Key: string(key), Value: value}
+		if version >= 2 {
+			var expire, soft int64
+			if expire, rest, err = readVarint(rest); err != nil {
+				return nil, err
+			}
+			if soft, rest, err = readVarint(rest); err != nil {
+				return nil, err
+			}
+			n, size := binary.Uvarint(rest)
+			if size <= 0 {
+				return nil, errors.New("truncated record")
+			}
+			e.Expire, e.Soft, e.Version = fromUnixNano(expire), fromUnixNano(soft), n
+			rest = rest[size:]
+		}
+		entries = append(entries, e)
+		data = rest
+	}
+	return entries, nil
+}
+
+func readVarint(data []byte) (n int64, rest []byte, err error) {
+	n, size := binary.Varint(data)
+	if size <= 0 {
+		return 0, nil, errors.New("truncated record")
+	}
+	return n, data[size:], nil
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func readField(data []byte) (field, rest []byte, err error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return nil, nil, errors.New("truncated record")
+	}
+	data = data[size:]
+	return data[:n:n], data[n:], nil
+}
+
+// intact 检查磁盘上的段文件是否与索引描述一致，损坏的段不能沿用
+func intact(name string, seg Segment) bool {
+	data, err := os.ReadFile(name)
+	return err == nil && int64(len(data)) == seg.Size && crc32.ChecksumIEEE(data) == seg.CRC
+}
+
+// writeFile 先写临时文件再重命名，保证崩溃时不会留下写了一半的同名文件
+func writeFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
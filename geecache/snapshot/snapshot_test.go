@@ -0,0 +1,157 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func makeEntries(n int) []Entry {
+	entries := make([]Entry, n)
+	for i := range entries {
+		entries[i] = Entry{Key: fmt.Sprintf("key%03d", i), Value: []byte(fmt.Sprintf("value%03d", i))}
+	}
+	return entries
+}
+
+func toMap(entries []Entry) map[string]string {
+	m := make(map[string]string, len(entries))
+	for _, e := range entries {
+		m[e.Key] = string(e.Value)
+	}
+	return m
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	entries := makeEntries(100)
+	stats, err := Save(dir, entries, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Written < 5 || stats.Reused != 0 {
+		t.Fatalf("expected several new segments, got %+v", stats)
+	}
+	loaded, report, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Lost) != 0 || report.Segments != stats.Written {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if !reflect.DeepEqual(toMap(entries), toMap(loaded)) {
+		t.Fatal("loaded entries differ from saved entries")
+	}
+}
+
+func TestSaveLoadMetadata(t *testing.T) {
+	dir := t.TempDir()
+	expire := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Key: "a", Value: []byte("1"), Expire: expire, Soft: expire.Add(-time.Minute), Version: 3},
+		{Key: "b", Value: []byte("2")},
+	}
+	if _, err := Save(dir, entries, 0); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || !loaded[0].Expire.Equal(expire) || !loaded[0].Soft.Equal(expire.Add(-time.Minute)) || loaded[0].Version != 3 {
+		t.Fatalf("metadata of a not restored: %+v", loaded)
+	}
+	if !loaded[1].Expire.IsZero() || !loaded[1].Soft.IsZero() || loaded[1].Version != 0 {
+		t.Fatalf("zero metadata of b not restored: %+v", loaded[1])
+	}
+}
+
+func TestIncrementalSave(t *testing.T) {
+	dir := t.TempDir()
+	entries := makeEntries(100)
+	first, err := Save(dir, entries, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries[50].Value = []byte("changed")
+	stats, err := Save(dir, entries, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Written != 1 || stats.Reused != first.Written-1 {
+		t.Fatalf("expected only the changed segment to be rewritten, got %+v", stats)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "seg-*.dat"))
+	if len(files) != first.Written {
+		t.Fatalf("stale segment files left behind: %v", files)
+	}
+	loaded, _, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toMap(loaded)["key050"] != "changed" {
+		t.Fatal("incremental save lost the update")
+	}
+}
+
+// 模拟崩溃：截断一个段、翻转另一个段中的一位，其余段仍然可以加载
+func TestPartialRecovery(t *testing.T) {
+	dir := t.TempDir()
+	entries := makeEntries(100)
+	if _, err := Save(dir, entries, 200); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := readIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated, flipped := idx.Segments[1], idx.Segments[3]
+	if err := os.Truncate(filepath.Join(dir, truncated.File), truncated.Size/2); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, flipped.File)
+	data, _ := os.ReadFile(name)
+	data[len(data)/2] ^= 0x01
+	os.WriteFile(name, data, 0644)
+
+	loaded, report, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Lost, []Segment{truncated, flipped}) {
+		t.Fatalf("lost segments = %+v", report.Lost)
+	}
+	if len(report.Errors) != 2 || report.Errors[1].Error() != "checksum mismatch" {
+		t.Fatalf("skip reasons = %v", report.Errors)
+	}
+	if expect := len(entries) - truncated.Count - flipped.Count; len(loaded) != expect {
+		t.Fatalf("recovered %d entries, expect %d", len(loaded), expect)
+	}
+	for _, e := range loaded {
+		if (e.Key >= truncated.FirstKey && e.Key <= truncated.LastKey) || (e.Key >= flipped.FirstKey && e.Key <= flipped.LastKey) {
+			t.Fatalf("key %s from a corrupt segment was loaded", e.Key)
+		}
+	}
+
+	// 再次保存会重写损坏的段
+	stats, err := Save(dir, entries, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Written != 2 {
+		t.Fatalf("expected the two corrupt segments to be rewritten, got %+v", stats)
+	}
+	if _, report, _ := Load(dir); len(report.Lost) != 0 {
+		t.Fatalf("still corrupt after resave: %+v", report.Lost)
+	}
+}
+
+func TestLoadMissingIndex(t *testing.T) {
+	if _, _, err := Load(t.TempDir()); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
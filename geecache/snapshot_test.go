@@ -0,0 +1,73 @@
+package geecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotKeepsExpiryAndVersion(t *testing.T) {
+	silenceLog(t)
+	clock := newFakeClock()
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("loaded"), nil })
+	g := NewGroup("snapshot-src", 1<<10, getter, WithDefaultTTL(time.Minute))
+	g.now = clock.Now
+	g.Set("old", []byte("v1"))
+	clock.Advance(30 * time.Second)
+	g.Set("new", []byte("v1"))
+	g.Set("new", []byte("v2"))
+	_, want, err := g.GetWithInfo(context.Background(), "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := g.SaveSnapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// 恢复时old已经过期，new保留原来的过期时间和版本号，而不是重新计算TTL
+	clock.Advance(45 * time.Second)
+	restored := NewGroup("snapshot-dst", 1<<10, getter, WithDefaultTTL(time.Minute))
+	restored.now = clock.Now
+	if _, err := restored.LoadSnapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.mainCache.get("old"); ok {
+		t.Fatal("expired entry was restored")
+	}
+	v, info, err := restored.GetWithInfo(context.Background(), "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "v2" || !info.Expire.Equal(want.Expire) || info.Version != want.Version {
+		t.Fatalf("restored %q expire=%v version=%d, expect %q expire=%v version=%d",
+			v.String(), info.Expire, info.Version, "v2", want.Expire, want.Version)
+	}
+}
+
+func TestLoadSnapshotLogsLostSegments(t *testing.T) {
+	logger := &captureLogger{}
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	g := NewGroup("snapshot-lost", 1<<10, getter, WithLogger(logger))
+	g.Set("k", []byte("v"))
+	dir := t.TempDir()
+	if err := g.SaveSnapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+	segs, _ := filepath.Glob(filepath.Join(dir, "seg-*.dat"))
+	if len(segs) != 1 {
+		t.Fatalf("expected one segment, got %v", segs)
+	}
+	os.WriteFile(segs[0], []byte("garbage"), 0644)
+
+	report, err := g.LoadSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Lost) != 1 || !logger.has("ERROR", "Skipped snapshot segment "+filepath.Base(segs[0])) {
+		t.Fatalf("lost segment not logged through the group logger: %+v, %q", report, logger.lines)
+	}
+}
@@ -0,0 +1,241 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"geecache/geecache/internal/protocol"
+	"geecache/geecache/lru"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// FallbackReason 说明一次请求为什么调用了本地的回调函数，用于排查后端负载升高的原因：
+// key确实由本节点负责，还是远程节点失败、被熔断或者被限流后回退到了本地
+type FallbackReason int
+
+const (
+	OwnedLocally   FallbackReason = iota // 一致性哈希选中了本节点
+	NoPeers                              // group没有注册PeerPicker
+	PeerError                            // 远程节点返回了错误
+	PeerTimeout                          // 请求远程节点超时
+	BreakerOpen                          // 远程节点的熔断器处于打开状态，PeerGetter返回ErrBreakerOpen
+	NotFoundOnPeer                       // 远程节点上没有这个group
+	Shedded                              // 远程节点拒绝了请求以减轻负载，PeerGetter返回ErrShedded
+	Forwarded                            // 请求由其他节点转发而来，但本节点认为key由另一个节点负责，为避免循环转发在本地加载
+	numFallbackReasons
+)
+
+var fallbackReasonNames = [...]string{
+	OwnedLocally:   "owned_locally",
+	NoPeers:        "no_peers",
+	PeerError:      "peer_error",
+	PeerTimeout:    "peer_timeout",
+	BreakerOpen:    "breaker_open",
+	NotFoundOnPeer: "not_found_on_peer",
+	Shedded:        "shedded",
+	Forwarded:      "forwarded",
+}
+
+func (r FallbackReason) String() string {
+	if r >= 0 && r < numFallbackReasons {
+		return fallbackReasonNames[r]
+	}
+	return "unknown"
+}
+
+// PeerGetter可以返回（或包装）以下错误，说明请求没有到达远程节点的原因
+var (
+	ErrBreakerOpen = errors.New("geecache: peer circuit breaker open")
+	ErrShedded     = errors.New("geecache: request shed by peer")
+)
+
+// peerFallbackReason 根据访问远程节点的错误判断回退的原因
+func peerFallbackReason(err error) FallbackReason {
+	var netErr net.Error
+	var statusErr *protocol.ResponseError
+	switch {
+	case errors.Is(err, ErrBreakerOpen):
+		return BreakerOpen
+	case errors.Is(err, ErrShedded):
+		return Shedded
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return PeerTimeout
+	case errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound:
+		return NotFoundOnPeer
+	case errors.As(err, &statusErr) && statusErr.Code == http.StatusServiceUnavailable:
+		return Shedded
+	}
+	return PeerError
+}
+
+// groupStats 是group加载路径上的计数器，只使用原子操作
+type groupStats struct {
+	gets           atomic.Int64 // Get、GetTo和GetMulti查询的key数
+	cacheHits      atomic.Int64 // 在mainCache或hotCache中命中的次数
+	loads          atomic.Int64 // 未命中后需要加载的次数，即gets-cacheHits（维护模式下除外）
+	loadsExecuted  atomic.Int64 // 经过singleflight去重后实际进行的加载次数
+	peerLoads      atomic.Int64 // 从远程节点取回值（或确认key不存在）的次数
+	peerErrors     atomic.Int64 // 访问远程节点失败的次数
+	localLoads     [numFallbackReasons]atomic.Int64
+	localLoadErrs  atomic.Int64 // 回调函数返回错误的次数
+	promotions     atomic.Int64 // 从远程节点取回的值放进hotCache的次数
+	loadsInFlight  atomic.Int64 // 正在进行的回调函数调用数
+	loadsRejected  atomic.Int64 // 因并发上限被拒绝的回调函数调用数，见WithLoadLimitFailFast
+	inflightShed   atomic.Int64 // 因内存预算不足被拒绝的加载数，见WithInFlightShed
+	loadsDelayed   atomic.Int64 // 等待令牌的回调函数调用数，见WithLoadRateLimit
+	loadsThrottled atomic.Int64 // 因调用速率被拒绝的回调函数调用数
+	filterHits     atomic.Int64 // 被不存在key的过滤器挡住的加载数，见WithNotFoundFilter
+	filterRechecks atomic.Int64 // 过滤器命中后放行确认的加载数
+}
+
+// peerResult 按访问远程节点的结果计数，远程节点确认key不存在算作成功的读取
+func (s *groupStats) peerResult(err error) {
+	if err == nil || isNotFound(err) {
+		s.peerLoads.Add(1)
+	} else {
+		s.peerErrors.Add(1)
+	}
+}
+
+// reset 把所有计数器清零
+func (s *groupStats) reset() {
+	for _, c := range []*atomic.Int64{&s.gets, &s.cacheHits, &s.loads, &s.loadsExecuted, &s.peerLoads, &s.peerErrors, &s.localLoadErrs, &s.promotions, &s.loadsRejected, &s.inflightShed, &s.loadsDelayed, &s.loadsThrottled, &s.filterHits, &s.filterRechecks} {
+		c.Store(0)
+	}
+	for r := range s.localLoads {
+		s.localLoads[r].Store(0)
+	}
+}
+
+// Stats 是group统计数据的快照
+type Stats struct {
+	Gets           int64            `json:"gets"`                      // 查询的key数
+	CacheHits      int64            `json:"cache_hits"`                // 在本地缓存（包括hotCache）中命中的次数
+	Loads          int64            `json:"loads"`                     // 未命中后需要加载的次数
+	LoadsExecuted  int64            `json:"loads_executed"`            // 并发的相同加载合并后实际进行的加载次数
+	DedupedLoads   int64            `json:"deduped_loads"`             // 加入了正在进行的相同加载、直接得到其结果的读取数（见singleflight.Stats）
+	PeerLoads      int64            `json:"peer_loads"`                // 从远程节点取回值（或确认key不存在）的次数
+	PeerErrors     int64            `json:"peer_errors"`               // 访问远程节点失败的次数
+	Promotions     int64            `json:"promotions"`                // 从远程节点取回的值放进hotCache的次数，见PromotionPolicy
+	LocalLoads     map[string]int64 `json:"local_loads"`               // 按FallbackReason统计的回调函数调用次数
+	LocalLoadErrs  int64            `json:"local_load_errs"`           // 回调函数返回错误的次数
+	LoadsInFlight  int64            `json:"loads_in_flight"`           // 正在进行的回调函数调用数
+	LoadsRejected  int64            `json:"loads_rejected"`            // 因并发上限被拒绝的回调函数调用数，见WithMaxConcurrentLoads
+	InFlightBytes  int64            `json:"in_flight_bytes"`           // 正在加载的值预留的字节数，见WithInFlightBytes
+	InFlightShed   int64            `json:"in_flight_shed"`            // 因内存预算不足被拒绝的加载数，见WithInFlightShed
+	LoadsDelayed   int64            `json:"loads_delayed"`             // 等待令牌的回调函数调用数，见WithLoadRateLimit
+	LoadsThrottled int64            `json:"loads_throttled"`           // 因调用速率被拒绝（ErrThrottled）的回调函数调用数
+	FilterHits     int64            `json:"not_found_filter_hits"`     // 被不存在key的过滤器挡住、直接返回ErrNotFound的加载数，见WithNotFoundFilter
+	FilterRechecks int64            `json:"not_found_filter_rechecks"` // 过滤器命中后放行、重新调用回调函数确认的加载数
+	Oversize       int64            `json:"oversize"`                  // 值太大、照常返回但没有缓存的次数（包括hotCache），见WithMaxValueBytes
+	Maintenance    MaintenanceState `json:"maintenance"`               // 维护模式的状态
+	Cache          lru.Stats        `json:"cache"`                     // 本地缓存的占用和淘汰情况
+	HotCache       lru.Stats        `json:"hot_cache"`                 // 热点缓存（其他节点负责的key）的占用和淘汰情况
+	CacheDisabled  bool             `json:"cache_disabled"`            // cacheBytes为0，本地缓存已关闭
+	SlowLoads      []SlowLoad       `json:"slow_loads,omitempty"`      // 最近的慢加载，见WithSlowLoadThreshold
+}
+
+// CacheType 选择group中的一个缓存
+type CacheType int
+
+const (
+	MainCache CacheType = iota + 1 // 本节点负责的key的本地缓存
+	HotCache                       // 从其他节点取回的热点key，见hotcache.go
+)
+
+// CacheStats 是一个缓存的计数器快照，Gets=Hits+Misses
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`     // 当前占用的字节数
+	Items     int64 `json:"items"`     // 当前的记录数
+	Gets      int64 `json:"gets"`      // 查询次数
+	Hits      int64 `json:"hits"`      // 命中次数
+	Misses    int64 `json:"misses"`    // 未命中次数（包括命中了已失效的记录）
+	Adds      int64 `json:"adds"`      // 写入次数
+	Evictions int64 `json:"evictions"` // 移除次数，包括容量淘汰、过期、删除和清空
+	Oversize  int64 `json:"oversize"`  // 值超过单个值的上限而没有缓存的次数，见WithMaxValueBytes
+}
+
+// CacheStats 返回which指定的缓存的统计数据，未知的which返回零值
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	}
+	return CacheStats{}
+}
+
+// Stats 返回group当前的统计数据
+func (g *Group) Stats() Stats {
+	s := Stats{LocalLoads: make(map[string]int64, numFallbackReasons), Maintenance: g.Maintenance(), Cache: g.mainCache.lruStats(), HotCache: g.hotCache.lruStats()}
+	s.CacheDisabled = g.mainCache.isDisabled()
+	s.Gets = g.stats.gets.Load()
+	s.CacheHits = g.stats.cacheHits.Load()
+	s.Loads = g.stats.loads.Load()
+	s.LoadsExecuted = g.stats.loadsExecuted.Load()
+	s.DedupedLoads = g.loader.Stats().Shared
+	s.PeerLoads = g.stats.peerLoads.Load()
+	s.PeerErrors = g.stats.peerErrors.Load()
+	s.Promotions = g.stats.promotions.Load()
+	s.LocalLoadErrs = g.stats.localLoadErrs.Load()
+	s.LoadsInFlight = g.stats.loadsInFlight.Load()
+	s.LoadsRejected = g.stats.loadsRejected.Load()
+	if g.inflight != nil {
+		s.InFlightBytes = g.inflight.reserved()
+	}
+	s.InFlightShed = g.stats.inflightShed.Load()
+	s.LoadsDelayed = g.stats.loadsDelayed.Load()
+	s.LoadsThrottled = g.stats.loadsThrottled.Load()
+	s.FilterHits = g.stats.filterHits.Load()
+	s.FilterRechecks = g.stats.filterRechecks.Load()
+	s.Oversize = g.mainCache.stats().Oversize + g.hotCache.stats().Oversize
+	s.SlowLoads = g.SlowLoads()
+	for r := FallbackReason(0); r < numFallbackReasons; r++ {
+		s.LocalLoads[r.String()] = g.stats.localLoads[r].Load()
+	}
+	return s
+}
+
+// ResetStats 把Stats中加载路径上的计数器清零，便于测试；缓存的占用和淘汰统计不受影响
+func (g *Group) ResetStats() {
+	g.stats.reset()
+	g.loader.ResetStats()
+}
+
+// serveStats 返回本HTTPPool提供服务的每个group（见getGroup）的统计数据，GET <basepath>stats，格式按Accept头协商，见metrics.go
+func (p *HTTPPool) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := make(map[string]Stats)
+	RangeGroups(func(g *Group) bool {
+		// 同名时以注册到本HTTPPool的group为准，不在白名单中的group不报告
+		if g := p.getGroup(g.name); g != nil {
+			stats[g.name] = g.Stats()
+		}
+		return true
+	})
+	// 注册到本HTTPPool、但全局注册表中已经没有同名group的，同样由本HTTPPool提供服务
+	p.mu.Lock()
+	for name, g := range p.groups {
+		if _, ok := stats[name]; !ok && (p.allowed == nil || p.allowed[name]) {
+			stats[name] = g.Stats()
+		}
+	}
+	p.mu.Unlock()
+	format := negotiateStatsFormat(r.Header.Get("Accept"))
+	switch format {
+	case formatPrometheus:
+		w.Header().Set("Content-Type", contentTypePrometheus)
+	case formatOpenMetrics:
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	default:
+		w.Header().Set("Content-Type", contentTypeJSON)
+	}
+	w.Header().Add("Vary", "Accept")
+	writeStats(w, format, stats)
+}
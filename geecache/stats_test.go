@@ -0,0 +1,198 @@
+package geecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePeers 把所有key交给peer，peer为nil时表示key由本节点负责
+type fakePeers struct {
+	peer PeerGetter
+}
+
+func (f fakePeers) PickPeer(key string) (PeerGetter, bool) {
+	return f.peer, f.peer != nil
+}
+
+// failingPeer 总是返回err
+type failingPeer struct {
+	err error
+}
+
+func (f failingPeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	return nil, f.err
+}
+
+func TestFallbackReasons(t *testing.T) {
+	silenceLog(t)
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	tests := []struct {
+		peers  PeerPicker
+		reason FallbackReason
+	}{
+		{nil, NoPeers},
+		{fakePeers{}, OwnedLocally},
+		{fakePeers{failingPeer{errors.New("connection refused")}}, PeerError},
+		{fakePeers{failingPeer{fmt.Errorf("get: %w", context.DeadlineExceeded)}}, PeerTimeout},
+		{fakePeers{failingPeer{fmt.Errorf("peer 10.0.0.2: %w", ErrBreakerOpen)}}, BreakerOpen},
+		{fakePeers{failingPeer{ErrShedded}}, Shedded},
+		{fakePeers{&httpGetter{baseURL: notFound.URL + defaultBasePath}}, NotFoundOnPeer},
+	}
+	for _, tt := range tests {
+		g := NewGroup("fallback-"+tt.reason.String(), 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+		if tt.peers != nil {
+			g.RegisterPeers(tt.peers)
+		}
+		if _, err := g.Get(context.Background(), "k"); err != nil {
+			t.Fatal(err)
+		}
+		stats := g.Stats()
+		for r := FallbackReason(0); r < numFallbackReasons; r++ {
+			want := int64(0)
+			if r == tt.reason {
+				want = 1
+			}
+			if got := stats.LocalLoads[r.String()]; got != want {
+				t.Errorf("%s: local_loads[%s] = %d, want %d", tt.reason, r, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadCounters(t *testing.T) {
+	silenceLog(t)
+	release := make(chan struct{})
+	g := NewGroup("load-counters", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		<-release
+		if key == "bad" {
+			return nil, errors.New("bad key")
+		}
+		return []byte(key), nil
+	}))
+
+	// 并发的5次未命中合并为1次加载
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Get(context.Background(), "a")
+		}()
+	}
+	for g.loader.Stats().Calls < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	g.Get(context.Background(), "a")
+	g.Get(context.Background(), "bad")
+
+	want := Stats{Gets: 7, CacheHits: 1, Loads: 6, LoadsExecuted: 2, DedupedLoads: 4, LocalLoadErrs: 1}
+	s := g.Stats()
+	got := Stats{Gets: s.Gets, CacheHits: s.CacheHits, Loads: s.Loads, LoadsExecuted: s.LoadsExecuted, DedupedLoads: s.DedupedLoads,
+		PeerLoads: s.PeerLoads, PeerErrors: s.PeerErrors, LocalLoadErrs: s.LocalLoadErrs}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("counters = %+v, want %+v", got, want)
+	}
+	if n := s.LocalLoads[NoPeers.String()]; n != 2 {
+		t.Fatalf("local_loads[no_peers] = %d, want 2", n)
+	}
+
+	// 远程节点失败后回退到本地加载
+	p := NewGroup("load-counters-peer", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p.RegisterPeers(fakePeers{failingPeer{errors.New("connection refused")}})
+	p.Get(context.Background(), "k")
+	if s := p.Stats(); s.PeerLoads != 0 || s.PeerErrors != 1 || s.LocalLoads[PeerError.String()] != 1 {
+		t.Fatalf("peer counters = %+v", s)
+	}
+
+	g.ResetStats()
+	s = g.Stats()
+	if s.Gets != 0 || s.Loads != 0 || s.LoadsExecuted != 0 || s.DedupedLoads != 0 || s.LocalLoadErrs != 0 || s.LocalLoads[NoPeers.String()] != 0 {
+		t.Fatalf("after ResetStats: %+v", s)
+	}
+	if s.Cache.Len != 1 {
+		t.Fatalf("ResetStats changed the cache stats: %+v", s.Cache)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	silenceLog(t)
+	pool := NewHTTPPool("self")
+	g := NewGroup("stats-endpoint", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.RegisterPeers(pool)
+	g.Get(context.Background(), "a")
+	g.Get(context.Background(), "b")
+	NewGroup("stats-endpoint-global", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	defer DestroyGroup("stats-endpoint-global")
+
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_geecache/stats", nil))
+	var stats map[string]Stats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if n := stats["stats-endpoint"].LocalLoads["owned_locally"]; n != 2 {
+		t.Fatalf("owned_locally = %d, want 2 (%+v)", n, stats)
+	}
+	if c := stats["stats-endpoint"].Cache; c.Len != 2 || c.Bytes != 4 || c.MaxBytes != 2<<10 {
+		t.Fatalf("cache stats = %+v", c)
+	}
+	// 没有注册到本HTTPPool的全局group同样由它提供服务，也出现在统计中
+	if _, ok := stats["stats-endpoint-global"]; !ok {
+		t.Fatalf("global group missing from stats: %v", stats)
+	}
+}
+
+func TestCacheStatsConcurrent(t *testing.T) {
+	silenceLog(t)
+	g := NewGroup("cache-stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	const workers, gets = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < gets; i++ {
+				g.Get(context.Background(), fmt.Sprintf("k%d", i%10))
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := g.CacheStats(MainCache)
+	if s.Gets != workers*gets || s.Hits+s.Misses != s.Gets {
+		t.Fatalf("lost updates: %+v", s)
+	}
+	// 每个key至少未命中一次，并发的未命中合并为一次加载
+	if s.Misses < 10 || s.Adds < 10 || s.Adds > s.Misses {
+		t.Fatalf("misses/adds = %d/%d", s.Misses, s.Adds)
+	}
+	if s.Items != 10 || s.Bytes != 40 {
+		t.Fatalf("items/bytes = %d/%d, want 10/40", s.Items, s.Bytes)
+	}
+	g.Clear()
+	if s := g.CacheStats(MainCache); s.Items != 0 || s.Evictions != 10 {
+		t.Fatalf("after Clear: %+v", s)
+	}
+}
@@ -0,0 +1,131 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 流式加载：源数据有几十MB时，Getter必须先把整个值读进一个[]byte，group再拷贝一份放进缓存，
+// 峰值内存是值的两倍，而且读完之后才知道它会不会因为超过单个值的上限而不被缓存。
+// StreamingGetter返回一个reader和大小提示：提示超过单个值的上限时直接拒绝，不读取任何数据；
+// 否则按提示分配一个刚好大小的切片读入，这个切片直接成为缓存中的值，不再拷贝。
+// 不知道大小（提示为负数）时先读入池中的缓冲区，再拷贝到刚好大小的切片，缓冲区放回池中复用
+
+// ErrValueTooLarge 表示StreamingGetter返回的值超过了单个值的上限，没有被读取，见WithMaxValueBytes
+var ErrValueTooLarge = errors.New("geecache: value exceeds the maximum value size")
+
+// StreamingGetter 是可选的接口，Getter同时实现它时，group改为调用GetStream加载源数据，优先于GetterWithExpiry和GetterWithTTL。
+// size是值的大小提示，负数表示未知；group读完后关闭reader
+type StreamingGetter interface {
+	GetStream(ctx context.Context, key string) (r io.ReadCloser, size int64, err error)
+}
+
+const (
+	maxStreamPrealloc = 64 << 20 // 按大小提示预先分配的上限，提示更大时边读边扩容，避免错误的提示导致巨大的内存分配
+	maxPooledBuffer   = 4 << 20  // 放回池中的缓冲区的容量上限，更大的缓冲区交给GC
+)
+
+var streamBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readStream 调用StreamingGetter读取key，返回新分配的切片。limit为单个值的上限，负数表示不限制；
+// 有大小提示时在读取之前调用reserve预留内存预算，见inflight.go
+func readStream(ctx context.Context, sg StreamingGetter, key string, limit int64, reserve func(n int64) error) ([]byte, error) {
+	r, size, err := sg.GetStream(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if limit >= 0 && size > limit {
+		return nil, fmt.Errorf("%w: %q is %d bytes, limit %d", ErrValueTooLarge, key, size, limit)
+	}
+	if size > 0 {
+		if err := reserve(size); err != nil {
+			return nil, err
+		}
+	}
+	var src io.Reader = r
+	if limit >= 0 {
+		src = io.LimitReader(r, limit+1) // 多读1个字节，判断实际大小是否超过上限
+	}
+	var b []byte
+	if size >= 0 {
+		b, err = readSized(src, size)
+	} else {
+		b, err = readPooled(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && int64(len(b)) > limit {
+		return nil, fmt.Errorf("%w: %q is larger than %d bytes", ErrValueTooLarge, key, limit)
+	}
+	return b, nil
+}
+
+// readSized 按大小提示分配切片读入；实际比提示短时截短，比提示长时继续扩容读完
+func readSized(r io.Reader, size int64) ([]byte, error) {
+	b := make([]byte, min(size, maxStreamPrealloc))
+	n, err := io.ReadFull(r, b)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		return b[:n], nil
+	case nil:
+	default:
+		return nil, err
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) == 0 {
+		return b, nil
+	}
+	return append(b, rest...), nil
+}
+
+// readPooled 读入池中的缓冲区，再拷贝到刚好大小的切片
+func readPooled(r io.Reader) ([]byte, error) {
+	buf := streamBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			streamBuffers.Put(buf)
+		}
+	}()
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// getStream 以加载key source调用sg，按缓存key所在分片的单个值上限读取，超过上限时计入CacheStats.Oversize
+func (g *Group) getStream(ctx context.Context, key, source string, sg StreamingGetter) ([]byte, error) {
+	limit := g.mainCache.valueLimit(key)
+	if g.mainCache.isDisabled() {
+		limit = -1 // 不缓存时没有上限
+	}
+	b, err := readStream(ctx, sg, source, limit, func(n int64) error {
+		return reservationFrom(ctx).reserve(ctx, n)
+	})
+	if errors.Is(err, ErrValueTooLarge) {
+		g.mainCache.rejectOversize(key)
+	}
+	return b, err
+}
+
+// ownedSink 把SetBytes收到的切片直接作为视图交给Sink，用于新分配、之后不会再被修改的切片，省去一次拷贝
+type ownedSink struct {
+	Sink
+}
+
+func (s ownedSink) SetBytes(b []byte) error {
+	return setSinkView(s.Sink, ByteView{b: b})
+}
+
+func (s ownedSink) setView(v ByteView) error {
+	return setSinkView(s.Sink, v)
+}
@@ -0,0 +1,199 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+// patternReader 不分配内存地生成n个字节的内容
+type patternReader struct {
+	n, off int64
+	read   *atomic.Int64
+	closed *atomic.Int32
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.off >= r.n {
+		return 0, io.EOF
+	}
+	k := int(min(int64(len(p)), r.n-r.off))
+	for i := range p[:k] {
+		p[i] = patternByte(r.off + int64(i))
+	}
+	r.off += int64(k)
+	r.read.Add(int64(k))
+	return k, nil
+}
+
+func (r *patternReader) Close() error {
+	r.closed.Add(1)
+	return nil
+}
+
+func patternByte(i int64) byte {
+	return byte(i % 251)
+}
+
+func checkPattern(t *testing.T, v ByteView, n int) {
+	t.Helper()
+	if v.Len() != n {
+		t.Fatalf("value is %d bytes, want %d", v.Len(), n)
+	}
+	for i := 0; i < n; i++ {
+		if v.At(i) != patternByte(int64(i)) {
+			t.Fatalf("byte %d = %d, want %d", i, v.At(i), patternByte(int64(i)))
+		}
+	}
+}
+
+// streamGetter 为每个key流式返回sizes[key]个字节，hint为大小提示（nil时给出准确的大小）
+type streamGetter struct {
+	sizes  map[string]int64
+	hint   func(size int64) int64
+	read   atomic.Int64
+	closed atomic.Int32
+}
+
+func (g *streamGetter) Get(_ context.Context, key string) ([]byte, error) {
+	return nil, fmt.Errorf("Get called instead of GetStream")
+}
+
+func (g *streamGetter) GetStream(_ context.Context, key string) (io.ReadCloser, int64, error) {
+	size, ok := g.sizes[key]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	hint := size
+	if g.hint != nil {
+		hint = g.hint(size)
+	}
+	return &patternReader{n: size, read: &g.read, closed: &g.closed}, hint, nil
+}
+
+func TestStreamingGetter(t *testing.T) {
+	ctx := context.Background()
+	for name, hint := range map[string]func(int64) int64{
+		"exact":   nil,
+		"unknown": func(int64) int64 { return -1 },
+		"short":   func(n int64) int64 { return n / 2 },
+		"long":    func(n int64) int64 { return n * 2 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			sg := &streamGetter{sizes: map[string]int64{"k": 100 << 10}, hint: hint}
+			g := NewGroup("stream-"+name, 1<<20, sg)
+			v, err := g.Get(ctx, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPattern(t, v, 100<<10)
+			if !g.CachedLocally("k") || sg.closed.Load() != 1 {
+				t.Fatalf("cached=%v closed=%d, want cached and reader closed once", g.CachedLocally("k"), sg.closed.Load())
+			}
+		})
+	}
+}
+
+func TestStreamingGetterRejectsOversize(t *testing.T) {
+	ctx := context.Background()
+	sg := &streamGetter{sizes: map[string]int64{"big": 1 << 20, "small": 10}}
+	g := NewGroup("stream-oversize", 1<<20, sg, WithMaxValueBytes(64<<10))
+	if _, err := g.Get(ctx, "big"); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Get(big) = %v, want ErrValueTooLarge", err)
+	}
+	// 大小提示已经超过上限，一个字节都不读
+	if n := sg.read.Load(); n != 0 || sg.closed.Load() != 1 {
+		t.Fatalf("read %d bytes, closed %d times, want 0 and 1", n, sg.closed.Load())
+	}
+	if n := g.Stats().Oversize; n != 1 {
+		t.Fatalf("Oversize = %d, want 1", n)
+	}
+
+	// 提示不准确时读到上限就停止
+	sg.hint = func(int64) int64 { return -1 }
+	if _, err := g.Get(ctx, "big"); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Get(big) without a hint = %v, want ErrValueTooLarge", err)
+	}
+	if n := sg.read.Load(); n > 64<<10+1 {
+		t.Fatalf("read %d bytes past the limit", n)
+	}
+	if v, err := g.Get(ctx, "small"); err != nil || v.Len() != 10 {
+		t.Fatalf("Get(small) = %d bytes, %v", v.Len(), err)
+	}
+}
+
+// allocated 返回f执行期间分配的字节数
+func allocated(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestStreamingGetterThroughHTTPPool(t *testing.T) {
+	silenceLog(t)
+	const size = 8 << 20
+	const name = "stream-http"
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		sg := &streamGetter{sizes: map[string]int64{}}
+		for j := 0; j < 100; j++ {
+			sg.sizes[fmt.Sprintf("k%d", j)] = size
+		}
+		g := NewGroup(name, 64<<20, sg, WithUnlimitedBytes())
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	owned := func(i int) string {
+		for j := 0; ; j++ {
+			if k := fmt.Sprintf("k%d", j); pools[0].peers.Get(k) == urls[i] {
+				return k
+			}
+		}
+	}
+	ctx := context.Background()
+
+	// 本地加载：值只读入一次，没有再拷贝一份
+	var v ByteView
+	var err error
+	n := allocated(func() { v, err = groups[0].Get(ctx, owned(0)) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPattern(t, v, size)
+	if n > size*3/2 {
+		t.Fatalf("local streamed load allocated %d bytes for a %d-byte value", n, size)
+	}
+
+	// 经过HTTPPool：所属节点读入一次，请求方读取响应体一次
+	n = allocated(func() { v, err = groups[0].Get(ctx, owned(1)) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPattern(t, v, size)
+	if n > size*5/2 {
+		t.Fatalf("streamed load through HTTPPool allocated %d bytes for a %d-byte value", n, size)
+	}
+}
@@ -0,0 +1,40 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 加载超时：回调函数卡住或远程节点没有响应时，没有超时的Get会一直等待，
+// 而singleflight让同一个key的所有并发调用方都等着同一次加载。
+// WithLoadTimeout为每次加载设置期限：等待的调用方在期限到达时返回ErrLoadTimeout，
+// 传给回调函数和远程请求的ctx同时结束，远程请求被中止。不理会ctx的回调函数之后仍然成功时，
+// 加载的值照常写入缓存，之后的请求可以直接命中
+
+// ErrLoadTimeout 是加载超过WithLoadTimeout设置的期限时返回的错误，errors.Is(err, context.DeadlineExceeded)同样成立
+var ErrLoadTimeout = fmt.Errorf("geecache: load timed out: %w", context.DeadlineExceeded)
+
+// WithLoadTimeout 设置每次加载（请求远程节点以及回退到的回调函数）的期限，0表示不限制（默认）。
+// 调用方ctx的期限更早时以ctx为准
+func WithLoadTimeout(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loadTimeout = d
+	}
+}
+
+// withLoadTimeout 为ctx加上加载的期限，没有设置WithLoadTimeout时原样返回
+func (g *Group) withLoadTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.loadTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, g.loadTimeout, ErrLoadTimeout)
+}
+
+// loadTimeoutErr 在ctx因加载的期限而结束时把err换成ErrLoadTimeout
+func loadTimeoutErr(ctx context.Context, err error) error {
+	if err != nil && context.Cause(ctx) == ErrLoadTimeout {
+		return ErrLoadTimeout
+	}
+	return err
+}
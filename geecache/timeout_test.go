@@ -0,0 +1,84 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadTimeout(t *testing.T) {
+	silenceLog(t)
+	release := make(chan struct{})
+	g := NewGroup("load-timeout", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		<-release // 不理会ctx的回调函数
+		return []byte(key), nil
+	}), WithLoadTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	_, err := g.Get(context.Background(), "slow")
+	if !errors.Is(err, ErrLoadTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get = %v, want ErrLoadTimeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Get returned after %v", d)
+	}
+	if values, errs := g.GetMulti(context.Background(), []string{"slow2"}); len(values) != 0 || !errors.Is(errs["slow2"], ErrLoadTimeout) {
+		t.Fatalf("GetMulti = %v, %v", values, errs)
+	}
+
+	// 被放弃的加载之后成功时，值照常写入缓存
+	close(release)
+	for i := 0; !g.CachedLocally("slow"); i++ {
+		if i > 1000 {
+			t.Fatal("abandoned load did not populate the cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v, err := g.Get(context.Background(), "slow"); err != nil || v.String() != "slow" {
+		t.Fatalf("Get after the load finished = %q, %v", v, err)
+	}
+}
+
+func TestLoadTimeoutCancelsFetch(t *testing.T) {
+	silenceLog(t)
+	canceled := make(chan error, 1)
+	g := NewGroup("load-timeout-ctx", 1<<10, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return nil, ctx.Err()
+	}), WithLoadTimeout(20*time.Millisecond))
+	if _, err := g.Get(context.Background(), "k"); !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("Get = %v, want ErrLoadTimeout", err)
+	}
+	select {
+	case err := <-canceled:
+		// 取决于调用方离开和加载的期限哪个先到，ctx被取消或者到期
+		if err == nil {
+			t.Fatal("getter ctx ended without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("getter ctx was not canceled")
+	}
+
+	// 远程节点没有响应时请求被中止，也不回退到本地加载
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+	var localCalls atomic.Int32
+	p := NewGroup("load-timeout-peer", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		localCalls.Add(1)
+		return []byte(key), nil
+	}), WithLoadTimeout(20*time.Millisecond))
+	p.RegisterPeers(fakePeers{&httpGetter{baseURL: hung.URL + defaultBasePath}})
+	if _, err := p.Get(context.Background(), "k"); !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("Get from hung peer = %v, want ErrLoadTimeout", err)
+	}
+	if n := localCalls.Load(); n != 0 {
+		t.Fatalf("fell back to a local load %d times after the load timed out", n)
+	}
+}
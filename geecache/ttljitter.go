@@ -0,0 +1,38 @@
+package geecache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// 过期时间抖动：启动时用同一个TTL预热的大量key会在同一时刻过期，让数据源在一个TTL之后遭遇一次集中加载。
+// WithTTLJitter在写入缓存时把每个值的硬过期时间随机放大或缩小一定比例，过期时刻因此被打散。
+// 抖动后的时间记录在值的过期时间里，远程节点取回时看到的也是抖动后的剩余时间
+
+// WithTTLJitter 把写入缓存的值的硬过期时间在±fraction的范围内随机调整，例如0.1表示±10%，0表示关闭（默认）。
+// 回调函数给出的过期时间和group的默认值（包括Set写入和导入的值）都会被调整，从远程节点取回的值保留所属节点上抖动后的时间；
+// fraction大于1时按1处理，调整后的时间总是大于0。软过期时间不受影响
+func WithTTLJitter(fraction float64) GroupOption {
+	return func(g *Group) {
+		g.ttlJitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithRandSeed 设置group的随机数种子，过期时间抖动和提前刷新（WithEarlyRefresh）都使用这个随机数源。
+// 默认使用当前时间，测试中固定它可以得到确定的结果
+func WithRandSeed(seed int64) GroupOption {
+	return func(g *Group) {
+		g.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// jitter 按WithTTLJitter随机调整过期时间d，d为0（不过期）时原样返回
+func (g *Group) jitter(d time.Duration) time.Duration {
+	if g.ttlJitter <= 0 || d <= 0 {
+		return d
+	}
+	g.randMu.Lock()
+	f := (2*g.rand.Float64() - 1) * g.ttlJitter // [-fraction, fraction)
+	g.randMu.Unlock()
+	return max(d+time.Duration(float64(d)*f), 1)
+}
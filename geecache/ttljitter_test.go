@@ -0,0 +1,93 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jitteredTTLs 加载n个key，返回每个值的TTL相对base的比例
+func jitteredTTLs(t *testing.T, g *Group, n int, base time.Duration, clock *fakeClock) []float64 {
+	t.Helper()
+	ratios := make([]float64, n)
+	for i := range ratios {
+		v, err := g.Get(context.Background(), fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ratios[i] = float64(v.Expire().Sub(clock.Now())) / float64(base)
+	}
+	return ratios
+}
+
+func TestTTLJitter(t *testing.T) {
+	const n = 2000
+	for _, tc := range []struct {
+		name string
+		opts []GroupOption
+		ttls map[string]time.Duration
+	}{
+		{name: "default", opts: []GroupOption{WithDefaultTTL(time.Hour)}},
+		{name: "getter", ttls: map[string]time.Duration{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := newFakeClock()
+			var getter Getter = GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+			if tc.ttls != nil {
+				for i := 0; i < n; i++ {
+					tc.ttls[fmt.Sprintf("key%d", i)] = time.Hour
+				}
+				getter = ttlGetter{tc.ttls, new(atomic.Int32)}
+			}
+			opts := append(tc.opts, WithTTLJitter(0.1), WithRandSeed(1), WithUnlimitedBytes())
+			g := NewGroup("ttl-jitter-"+tc.name, 0, getter, opts...)
+			g.now = clock.Now
+
+			ratios := jitteredTTLs(t, g, n, time.Hour, clock)
+			lo, hi := ratios[0], ratios[0]
+			var buckets [4]int // 把[0.9, 1.1)均分为4档
+			for _, r := range ratios {
+				lo, hi = min(lo, r), max(hi, r)
+				if r < 0.9 || r >= 1.1 {
+					t.Fatalf("TTL ratio %.4f outside ±10%%", r)
+				}
+				buckets[int((r-0.9)/0.05)]++
+			}
+			if lo > 0.91 || hi < 1.09 {
+				t.Fatalf("TTL ratios span [%.4f, %.4f], want close to [0.9, 1.1]", lo, hi)
+			}
+			for i, c := range buckets {
+				if c < n/4*8/10 || c > n/4*12/10 {
+					t.Fatalf("bucket %d has %d of %d entries, want about %d: %v", i, c, n, n/4, buckets)
+				}
+			}
+
+			// 同样的种子得到同样的结果
+			g2 := NewGroup("ttl-jitter-"+tc.name+"-2", 0, getter, opts...)
+			g2.now = clock.Now
+			for i, r := range jitteredTTLs(t, g2, n, time.Hour, clock) {
+				if r != ratios[i] {
+					t.Fatalf("key%d: TTL ratio %.4f with the same seed, want %.4f", i, r, ratios[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTTLJitterStaysPositive(t *testing.T) {
+	g := NewGroup("ttl-jitter-positive", 0, GetterFunc(func(key string) ([]byte, error) { return nil, nil }),
+		WithTTLJitter(5), WithRandSeed(1))
+	for i := 0; i < 1000; i++ {
+		if d := g.jitter(time.Nanosecond); d <= 0 {
+			t.Fatalf("jitter(1ns) = %v, want > 0", d)
+		}
+		if d := g.jitter(time.Second); d <= 0 || d > 2*time.Second {
+			t.Fatalf("jitter(1s) = %v, want in (0, 2s]", d)
+		}
+	}
+	if d := g.jitter(0); d != 0 {
+		t.Fatalf("jitter(0) = %v, want 0 (no expiry)", d)
+	}
+}
@@ -0,0 +1,94 @@
+package geecache
+
+import (
+	"fmt"
+
+	"geecache/geecache/internal/protocol"
+)
+
+// 版本号：两个节点同时Set同一个key时，后到的写入会覆盖先到的，读取-修改-写入的调用方因此丢失更新。
+// 本地缓存中的每条记录带有一个版本号：通过回调函数或远程节点加载、导入的记录为1，每次Set在原来的版本号上加1。
+// SetIfVersion只在key所在节点上的版本号等于期望值时写入（没有这个key时版本号为0），比较和写入在分片的锁内一起完成，
+// 因此并发的SetIfVersion中只有一个成功，其余的返回ErrVersionMismatch，调用方应当用GetWithInfo重新读取后再试。
+// 版本号只在记录留在缓存中时有意义：记录被淘汰、过期或删除后重新加载，版本号从1重新开始。
+// key由其他节点负责时，版本号以所属节点为准：读取和写入的响应带上版本号（X-Geecache-Version），
+// SetIfVersion把期望值带给所属节点（X-Geecache-If-Version），版本号不一致时本节点hotCache中的副本被丢弃
+
+// ErrVersionMismatch 表示key当前的版本号与SetIfVersion期望的不同，没有写入
+var ErrVersionMismatch = protocol.ErrVersionMismatch
+
+// SetIfVersion 与Set相同，但只在key当前的版本号等于version时写入，version为0表示只在key不存在时写入；
+// 版本号不同时返回ErrVersionMismatch。维护期间无法比较版本号，返回ErrMaintenance
+func (g *Group) SetIfVersion(key string, value []byte, version uint64) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	if g.maint.active.Load() {
+		return ErrMaintenance
+	}
+	return g.set(g.cacheKey(key), ByteView{b: cloneBytes(value)}, &version)
+}
+
+// setOnPeer 把value写入远程节点，返回写入后的版本号，节点没有给出时为0
+func (g *Group) setOnPeer(peer PeerGetter, key string, value ByteView, ifVersion *uint64) (uint64, error) {
+	if vs, ok := peer.(versionedPeerSetter); ok {
+		return vs.SetVersioned(g.name, key, value.b, ifVersion)
+	}
+	s, ok := peer.(PeerSetter)
+	if !ok || ifVersion != nil {
+		return 0, fmt.Errorf("geecache: peer for key %q does not support Set", key)
+	}
+	return 0, s.Set(g.name, key, value.b)
+}
+
+// setLocal 把value写入mainCache，ifVersion不为nil时比较版本号，见cache.setVersioned
+func (g *Group) setLocal(key string, value ByteView, ifVersion *uint64) (uint64, error) {
+	version, err := g.mainCache.setVersioned(key, g.withDefaultExpiry(value), ifVersion)
+	if err == nil {
+		g.forgetLoads(key)
+		g.forgetNotFound(key)
+		g.trimCaches()
+	}
+	return version, err
+}
+
+// storedVersion 返回写入缓存时使用的版本号，没有设置的为1
+func storedVersion(value ByteView) ByteView {
+	if value.version == 0 {
+		value.version = 1
+	}
+	return value
+}
+
+// setVersioned 在一次加锁中比较并写入key：ifVersion不为nil且与当前的版本号（没有这个key时为0）不同时返回ErrVersionMismatch，
+// 否则以当前的版本号加1写入value，返回新的版本号。缓存关闭或value超过单个值的上限时不写入，但同样返回新的版本号
+func (c *cache) setVersioned(key string, value ByteView, ifVersion *uint64) (uint64, error) {
+	c.lockWrite()
+	defer c.unlock()
+	var current uint64
+	if c.lru != nil {
+		if v, ok := c.lru.Peek(key); ok && v.err == nil && !c.invalidated(key, v) {
+			current = v.version
+		}
+	}
+	if ifVersion != nil && *ifVersion != current {
+		return current, ErrVersionMismatch
+	}
+	value.version = current + 1
+	if c.disabled() || c.oversize(value) {
+		return value.version, nil
+	}
+	c.ensurePolicy()
+	c.gen++
+	c.nadd++
+	value.gen = c.gen
+	c.lru.AddWithExpire(key, value, value.expire)
+	return value.version, nil
+}
+
+func (s *shardedCache) setVersioned(key string, value ByteView, ifVersion *uint64) (uint64, error) {
+	return s.shardFor(key).setVersioned(key, value, ifVersion)
+}
@@ -0,0 +1,159 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetIfVersion(t *testing.T) {
+	g := NewGroup("set-if-version", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("loaded"), nil
+	}))
+	ctx := context.Background()
+	version := func(key string) uint64 {
+		_, info, err := g.GetWithInfo(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Version
+	}
+
+	if v := version("k"); v != 1 {
+		t.Fatalf("loaded version = %d, want 1", v)
+	}
+	g.Set("k", []byte("set"))
+	if v := version("k"); v != 2 {
+		t.Fatalf("version after Set = %d, want 2", v)
+	}
+	if err := g.SetIfVersion("k", []byte("stale"), 1); err != ErrVersionMismatch {
+		t.Fatalf("SetIfVersion with stale version = %v, want ErrVersionMismatch", err)
+	}
+	if err := g.SetIfVersion("k", []byte("cas"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, info, _ := g.GetWithInfo(ctx, "k"); v.String() != "cas" || info.Version != 3 {
+		t.Fatalf("GetWithInfo = %s@%d, want cas@3", v, info.Version)
+	}
+
+	// 版本号0表示只在key不存在时写入
+	if err := g.SetIfVersion("new", []byte("a"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetIfVersion("new", []byte("b"), 0); err != ErrVersionMismatch {
+		t.Fatalf("second create = %v, want ErrVersionMismatch", err)
+	}
+}
+
+func TestConcurrentSetIfVersion(t *testing.T) {
+	g := NewGroup("concurrent-cas", 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v0"), nil
+	}))
+	_, info, err := g.GetWithInfo(context.Background(), "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wins atomic.Int32
+	var winner atomic.Value
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := fmt.Sprintf("w%d", i)
+			switch err := g.SetIfVersion("k", []byte(value), info.Version); err {
+			case nil:
+				wins.Add(1)
+				winner.Store(value)
+			case ErrVersionMismatch:
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := wins.Load(); n != 1 {
+		t.Fatalf("%d concurrent SetIfVersion succeeded, want exactly 1", n)
+	}
+	if v, _ := g.Get(context.Background(), "k"); v.String() != winner.Load() {
+		t.Fatalf("cached %s, want the winner %s", v, winner.Load())
+	}
+}
+
+func TestSetIfVersionThroughPeer(t *testing.T) {
+	silenceLog(t)
+	const name = "cas-peer"
+	var (
+		urls   []string
+		pools  []*HTTPPool
+		groups []*Group
+	)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewUnstartedServer(nil)
+		url := "http://" + srv.Listener.Addr().String()
+		pool := NewHTTPPool(url)
+		g := NewGroup(name, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte("v0"), nil
+		}))
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		urls = append(urls, url)
+		pools = append(pools, pool)
+		groups = append(groups, g)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("k%d", i); pools[0].peers.Get(k) == urls[1] {
+			key = k
+		}
+	}
+	a, b := groups[0], groups[1]
+	ctx := context.Background()
+
+	// A读到的版本号来自所属节点B
+	_, info, err := a.GetWithInfo(ctx, key)
+	if err != nil || info.Version != 1 {
+		t.Fatalf("GetWithInfo = %d, %v, want version 1 from the owner", info.Version, err)
+	}
+	// A和B同时以版本号1写入，只有一个成功
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for _, g := range []*Group{a, b, a, b} {
+		wg.Add(1)
+		go func(g *Group) {
+			defer wg.Done()
+			switch err := g.SetIfVersion(key, []byte("cas"), 1); err {
+			case nil:
+				wins.Add(1)
+			case ErrVersionMismatch:
+			default:
+				t.Error(err)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := wins.Load(); n != 1 {
+		t.Fatalf("%d SetIfVersion succeeded across nodes, want exactly 1", n)
+	}
+	// 失败的一方丢弃hotCache中的副本，重新读取后拿到所属节点上的版本号，可以再次写入
+	for _, g := range []*Group{a, b} {
+		_, info, err := g.GetWithInfo(ctx, key)
+		if err != nil || info.Version != 2 {
+			t.Fatalf("version on %s = %d, %v, want 2", g.name, info.Version, err)
+		}
+	}
+	if err := a.SetIfVersion(key, []byte("again"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, info, _ := b.GetWithInfo(ctx, key); v.String() != "again" || info.Version != 3 {
+		t.Fatalf("owner has %s@%d, want again@3", v, info.Version)
+	}
+}
@@ -1 +1,3 @@
 module geecache
+
+go 1.21
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"geecache/geecache/ownership"
+	"io"
+	"os"
+	"strings"
+)
+
+// owner 子命令计算key的所属节点，如 ./server owner --peers=http://localhost:8001,http://localhost:8002 --key=Tom
+// 不指定--key时从标准输入逐行读取key，每行输出"key<TAB>owner"
+func runOwner(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("owner", flag.ContinueOnError)
+	peers := fs.String("peers", "", "comma separated peer addresses")
+	key := fs.String("key", "", "key to look up, read keys from stdin if empty")
+	replicas := fs.Int("replicas", ownership.DefaultReplicas, "virtual nodes per peer")
+	seed := fs.Uint("seed", 0, "hash seed")
+	version := fs.Int("version", ownership.CurrentVersion, "ring format version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *peers == "" {
+		return errors.New("owner: --peers is required")
+	}
+	ring, err := ownership.New(ownership.Config{
+		Peers:    strings.Split(*peers, ","),
+		Replicas: *replicas,
+		Seed:     uint32(*seed),
+		Version:  *version,
+	})
+	if err != nil {
+		return err
+	}
+	if *key != "" {
+		_, err := fmt.Fprintln(stdout, ring.Owner(*key))
+		return err
+	}
+	w := bufio.NewWriter(stdout)
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		fmt.Fprintf(w, "%s\t%s\n", scanner.Text(), ring.Owner(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func ownerMain() {
+	if err := runOwner(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}